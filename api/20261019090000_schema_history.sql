@@ -0,0 +1,46 @@
+-- +goose Up
+-- +goose StatementBegin
+
+ALTER TABLE sync_job ADD COLUMN IF NOT EXISTS workspace_id UUID REFERENCES workspace(id) ON DELETE CASCADE;
+ALTER TABLE sync_job ADD COLUMN IF NOT EXISTS table_name TEXT;
+ALTER TABLE sync_run ADD COLUMN IF NOT EXISTS workflow_id TEXT;
+ALTER TABLE sync_run ADD COLUMN IF NOT EXISTS error TEXT;
+
+CREATE TABLE IF NOT EXISTS schema_snapshot (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    job_id UUID REFERENCES sync_job(id) ON DELETE CASCADE,
+    run_id UUID REFERENCES sync_run(id) ON DELETE SET NULL,
+    schema_hash VARCHAR(64) NOT NULL,
+    columns_json JSONB NOT NULL,
+    changes_json JSONB NOT NULL DEFAULT '[]',
+    created_at TIMESTAMPTZ DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS alert_event (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    workspace_id UUID REFERENCES workspace(id) ON DELETE CASCADE,
+    job_id UUID REFERENCES sync_job(id) ON DELETE CASCADE,
+    run_id UUID REFERENCES sync_run(id) ON DELETE SET NULL,
+    kind TEXT NOT NULL,
+    severity TEXT CHECK (severity IN ('info','warning','critical')) NOT NULL,
+    message TEXT NOT NULL,
+    details_json JSONB NOT NULL DEFAULT '{}',
+    created_at TIMESTAMPTZ DEFAULT now()
+);
+
+CREATE INDEX idx_sync_job_connector_table ON sync_job(connector_id, table_name);
+CREATE INDEX idx_schema_snapshot_job_id ON schema_snapshot(job_id, created_at);
+CREATE INDEX idx_alert_event_workspace_id ON alert_event(workspace_id, created_at);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS alert_event;
+DROP TABLE IF EXISTS schema_snapshot;
+DROP INDEX IF EXISTS idx_sync_job_connector_table;
+ALTER TABLE sync_run DROP COLUMN IF EXISTS error;
+ALTER TABLE sync_run DROP COLUMN IF EXISTS workflow_id;
+ALTER TABLE sync_job DROP COLUMN IF EXISTS table_name;
+ALTER TABLE sync_job DROP COLUMN IF EXISTS workspace_id;
+-- +goose StatementEnd
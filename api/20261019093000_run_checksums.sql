@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+
+ALTER TABLE sync_run ADD COLUMN IF NOT EXISTS dest_checksum VARCHAR(64);
+ALTER TABLE sync_run DROP CONSTRAINT IF EXISTS sync_run_status_check;
+ALTER TABLE sync_run ADD CONSTRAINT sync_run_status_check
+    CHECK (status IN ('running','success','failed','cancelled','unverified'));
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+UPDATE sync_run SET status = 'success' WHERE status = 'unverified';
+ALTER TABLE sync_run DROP CONSTRAINT IF EXISTS sync_run_status_check;
+ALTER TABLE sync_run ADD CONSTRAINT sync_run_status_check
+    CHECK (status IN ('running','success','failed','cancelled'));
+ALTER TABLE sync_run DROP COLUMN IF EXISTS dest_checksum;
+-- +goose StatementEnd
@@ -0,0 +1,28 @@
+-- +goose Up
+-- +goose StatementBegin
+
+CREATE TABLE IF NOT EXISTS data_diff (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    workspace_id UUID REFERENCES workspace(id) ON DELETE CASCADE,
+    workflow_id TEXT,
+    source_connector_id UUID REFERENCES connector(id) ON DELETE SET NULL,
+    target_connector_id UUID REFERENCES connector(id) ON DELETE SET NULL,
+    source_relation TEXT NOT NULL,
+    target_relation TEXT NOT NULL,
+    key_column TEXT NOT NULL,
+    status TEXT CHECK (status IN ('running','success','failed','cancelled')) NOT NULL,
+    stats_json JSONB NOT NULL DEFAULT '{}',
+    report_key TEXT,
+    error TEXT,
+    started_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    finished_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_data_diff_workspace_id ON data_diff(workspace_id, started_at);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS data_diff;
+-- +goose StatementEnd
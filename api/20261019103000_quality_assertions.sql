@@ -0,0 +1,36 @@
+-- +goose Up
+-- +goose StatementBegin
+
+CREATE TABLE IF NOT EXISTS job_assertion (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    job_id UUID REFERENCES sync_job(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    kind TEXT CHECK (kind IN ('not_null','unique','accepted_values','row_count_delta','freshness','custom_sql')) NOT NULL,
+    column_name TEXT,
+    params_json JSONB NOT NULL DEFAULT '{}',
+    severity TEXT CHECK (severity IN ('warn','error')) NOT NULL DEFAULT 'error',
+    enabled BOOLEAN NOT NULL DEFAULT true,
+    created_at TIMESTAMPTZ DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS assertion_result (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    run_id UUID REFERENCES sync_run(id) ON DELETE CASCADE,
+    assertion_id UUID REFERENCES job_assertion(id) ON DELETE CASCADE,
+    passed BOOLEAN NOT NULL,
+    severity TEXT NOT NULL,
+    message TEXT NOT NULL,
+    observed_json JSONB NOT NULL DEFAULT '{}',
+    created_at TIMESTAMPTZ DEFAULT now()
+);
+
+CREATE INDEX idx_job_assertion_job_id ON job_assertion(job_id);
+CREATE INDEX idx_assertion_result_run_id ON assertion_result(run_id);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS assertion_result;
+DROP TABLE IF EXISTS job_assertion;
+-- +goose StatementEnd
@@ -0,0 +1,23 @@
+-- +goose Up
+-- +goose StatementBegin
+
+ALTER TABLE sync_job ADD COLUMN IF NOT EXISTS anomaly_mode TEXT
+    CHECK (anomaly_mode IN ('off','rolling','weekday')) NOT NULL DEFAULT 'rolling';
+ALTER TABLE sync_job ADD COLUMN IF NOT EXISTS anomaly_threshold DOUBLE PRECISION;
+ALTER TABLE sync_run ADD COLUMN IF NOT EXISTS anomaly BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE sync_run ADD COLUMN IF NOT EXISTS anomaly_score DOUBLE PRECISION;
+ALTER TABLE sync_run ADD COLUMN IF NOT EXISTS expected_rows DOUBLE PRECISION;
+
+CREATE INDEX idx_sync_run_job_started ON sync_run(job_id, started_at DESC);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_sync_run_job_started;
+ALTER TABLE sync_run DROP COLUMN IF EXISTS expected_rows;
+ALTER TABLE sync_run DROP COLUMN IF EXISTS anomaly_score;
+ALTER TABLE sync_run DROP COLUMN IF EXISTS anomaly;
+ALTER TABLE sync_job DROP COLUMN IF EXISTS anomaly_threshold;
+ALTER TABLE sync_job DROP COLUMN IF EXISTS anomaly_mode;
+-- +goose StatementEnd
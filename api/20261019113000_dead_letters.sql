@@ -0,0 +1,33 @@
+-- +goose Up
+-- +goose StatementBegin
+
+ALTER TABLE sync_job ADD COLUMN IF NOT EXISTS max_error_rows BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE sync_job ADD COLUMN IF NOT EXISTS max_error_pct DOUBLE PRECISION NOT NULL DEFAULT 0;
+ALTER TABLE sync_run ADD COLUMN IF NOT EXISTS error_rows BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE sync_run DROP CONSTRAINT IF EXISTS sync_run_status_check;
+ALTER TABLE sync_run ADD CONSTRAINT sync_run_status_check
+    CHECK (status IN ('running','success','partial_success','failed','cancelled','unverified'));
+
+CREATE TABLE IF NOT EXISTS dead_letter (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    run_id UUID REFERENCES sync_run(id) ON DELETE CASCADE,
+    stage TEXT CHECK (stage IN ('transform','load')) NOT NULL,
+    object_key TEXT NOT NULL,
+    row_count BIGINT NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT now(),
+    UNIQUE (run_id, stage)
+);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS dead_letter;
+UPDATE sync_run SET status = 'success' WHERE status = 'partial_success';
+ALTER TABLE sync_run DROP CONSTRAINT IF EXISTS sync_run_status_check;
+ALTER TABLE sync_run ADD CONSTRAINT sync_run_status_check
+    CHECK (status IN ('running','success','failed','cancelled','unverified'));
+ALTER TABLE sync_run DROP COLUMN IF EXISTS error_rows;
+ALTER TABLE sync_job DROP COLUMN IF EXISTS max_error_pct;
+ALTER TABLE sync_job DROP COLUMN IF EXISTS max_error_rows;
+-- +goose StatementEnd
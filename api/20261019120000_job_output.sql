@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+
+ALTER TABLE sync_job ADD COLUMN IF NOT EXISTS output_json JSONB NOT NULL DEFAULT '{}';
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE sync_job DROP COLUMN IF EXISTS output_json;
+-- +goose StatementEnd
@@ -0,0 +1,25 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Highest cursor value an incremental run has loaded.
+ALTER TABLE sync_job ADD COLUMN IF NOT EXISTS last_sync_at TIMESTAMPTZ;
+
+CREATE TABLE IF NOT EXISTS source_file (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    job_id UUID NOT NULL REFERENCES sync_job(id) ON DELETE CASCADE,
+    run_id UUID REFERENCES sync_run(id) ON DELETE SET NULL,
+    object_key TEXT NOT NULL,
+    etag TEXT NOT NULL DEFAULT '',
+    last_modified TIMESTAMPTZ,
+    size_bytes BIGINT NOT NULL DEFAULT 0,
+    processed_at TIMESTAMPTZ DEFAULT now(),
+    UNIQUE (job_id, object_key)
+);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS source_file;
+ALTER TABLE sync_job DROP COLUMN IF EXISTS last_sync_at;
+-- +goose StatementEnd
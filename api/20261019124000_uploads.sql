@@ -0,0 +1,35 @@
+-- +goose Up
+-- +goose StatementBegin
+
+CREATE TABLE IF NOT EXISTS upload (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    workspace_id UUID NOT NULL REFERENCES workspace(id) ON DELETE CASCADE,
+    created_by_user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    filename TEXT NOT NULL,
+    size_bytes BIGINT NOT NULL DEFAULT 0,
+    object_key TEXT NOT NULL,
+    -- S3 multipart upload of a resumable upload; cleared once complete.
+    s3_upload_id TEXT NOT NULL DEFAULT '',
+    part_size BIGINT NOT NULL DEFAULT 0,
+    status TEXT CHECK (status IN ('uploading','ready','aborted')) NOT NULL DEFAULT 'uploading',
+    options_json JSONB NOT NULL DEFAULT '{}',
+    created_at TIMESTAMPTZ DEFAULT now(),
+    completed_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS upload_workspace_idx ON upload (workspace_id, created_at DESC);
+
+ALTER TABLE connector DROP CONSTRAINT IF EXISTS connector_type_check;
+ALTER TABLE connector ADD CONSTRAINT connector_type_check
+    CHECK (type IN ('pg','mysql','s3','excel','sf','gsheets','rest','upload'));
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM connector WHERE type = 'upload';
+ALTER TABLE connector DROP CONSTRAINT IF EXISTS connector_type_check;
+ALTER TABLE connector ADD CONSTRAINT connector_type_check
+    CHECK (type IN ('pg','mysql','s3','excel','sf','gsheets','rest'));
+DROP TABLE IF EXISTS upload;
+-- +goose StatementEnd
@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- A destination is written by its connector's credentials; a job with one
+-- loads there instead of the bucket.
+ALTER TABLE destination ADD COLUMN IF NOT EXISTS name TEXT NOT NULL DEFAULT '';
+ALTER TABLE sync_job ADD COLUMN IF NOT EXISTS destination_id UUID REFERENCES destination(id) ON DELETE SET NULL;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE sync_job DROP COLUMN IF EXISTS destination_id;
+ALTER TABLE destination DROP COLUMN IF EXISTS name;
+-- +goose StatementEnd
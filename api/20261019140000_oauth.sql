@@ -0,0 +1,27 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- status is reauth_required once a connector's OAuth refresh token stops
+-- working, until someone connects it again.
+ALTER TABLE connector ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'active'
+    CHECK (status IN ('active','reauth_required'));
+
+-- An authorization request in flight: state is sent to the provider and
+-- comes back to the callback, which may use it once.
+CREATE TABLE IF NOT EXISTS oauth_state (
+    state TEXT PRIMARY KEY,
+    provider TEXT NOT NULL,
+    connector_id UUID NOT NULL REFERENCES connector(id) ON DELETE CASCADE,
+    user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+    code_verifier TEXT NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT now()
+);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS oauth_state;
+ALTER TABLE connector DROP COLUMN IF EXISTS status;
+-- +goose StatementEnd
@@ -0,0 +1,25 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- File destinations (sqlite, duckdb) have no connector, so a destination
+-- now belongs to its workspace directly.
+ALTER TABLE destination ADD COLUMN IF NOT EXISTS workspace_id UUID REFERENCES workspace(id) ON DELETE CASCADE;
+UPDATE destination d SET workspace_id = c.workspace_id
+FROM connector c WHERE c.id = d.connector_id AND d.workspace_id IS NULL;
+CREATE INDEX IF NOT EXISTS idx_destination_workspace ON destination(workspace_id);
+
+ALTER TABLE destination DROP CONSTRAINT IF EXISTS destination_type_check;
+ALTER TABLE destination ADD CONSTRAINT destination_type_check
+    CHECK (type IN ('pg','s3','excel','gsheets','bq','sqlite','duckdb'));
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM destination WHERE type IN ('sqlite','duckdb');
+ALTER TABLE destination DROP CONSTRAINT IF EXISTS destination_type_check;
+ALTER TABLE destination ADD CONSTRAINT destination_type_check
+    CHECK (type IN ('pg','s3','excel','gsheets','bq'));
+DROP INDEX IF EXISTS idx_destination_workspace;
+ALTER TABLE destination DROP COLUMN IF EXISTS workspace_id;
+-- +goose StatementEnd
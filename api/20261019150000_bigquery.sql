@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+-- A bq connector holds the project and credentials bq destinations load
+-- with; it is not a source.
+ALTER TABLE connector DROP CONSTRAINT IF EXISTS connector_type_check;
+ALTER TABLE connector ADD CONSTRAINT connector_type_check
+    CHECK (type IN ('pg','mysql','s3','excel','sf','gsheets','rest','upload','bq'));
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM destination WHERE type = 'bq';
+DELETE FROM connector WHERE type = 'bq';
+ALTER TABLE connector DROP CONSTRAINT IF EXISTS connector_type_check;
+ALTER TABLE connector ADD CONSTRAINT connector_type_check
+    CHECK (type IN ('pg','mysql','s3','excel','sf','gsheets','rest','upload'));
+-- +goose StatementEnd
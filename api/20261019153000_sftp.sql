@@ -0,0 +1,23 @@
+-- +goose Up
+-- +goose StatementBegin
+-- An sftp connector reads files as a source and holds the server an sftp
+-- destination writes to.
+ALTER TABLE connector DROP CONSTRAINT IF EXISTS connector_type_check;
+ALTER TABLE connector ADD CONSTRAINT connector_type_check
+    CHECK (type IN ('pg','mysql','s3','excel','sf','gsheets','rest','upload','bq','sftp'));
+ALTER TABLE destination DROP CONSTRAINT IF EXISTS destination_type_check;
+ALTER TABLE destination ADD CONSTRAINT destination_type_check
+    CHECK (type IN ('pg','s3','excel','gsheets','bq','sqlite','duckdb','sftp'));
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM destination WHERE type = 'sftp';
+DELETE FROM connector WHERE type = 'sftp';
+ALTER TABLE destination DROP CONSTRAINT IF EXISTS destination_type_check;
+ALTER TABLE destination ADD CONSTRAINT destination_type_check
+    CHECK (type IN ('pg','s3','excel','gsheets','bq','sqlite','duckdb'));
+ALTER TABLE connector DROP CONSTRAINT IF EXISTS connector_type_check;
+ALTER TABLE connector ADD CONSTRAINT connector_type_check
+    CHECK (type IN ('pg','mysql','s3','excel','sf','gsheets','rest','upload','bq'));
+-- +goose StatementEnd
@@ -0,0 +1,23 @@
+-- +goose Up
+-- +goose StatementBegin
+-- A file connector reads and writes a directory of the worker, inside
+-- FILE_CONNECTOR_ROOTS.
+ALTER TABLE connector DROP CONSTRAINT IF EXISTS connector_type_check;
+ALTER TABLE connector ADD CONSTRAINT connector_type_check
+    CHECK (type IN ('pg','mysql','s3','excel','sf','gsheets','rest','upload','bq','sftp','file'));
+ALTER TABLE destination DROP CONSTRAINT IF EXISTS destination_type_check;
+ALTER TABLE destination ADD CONSTRAINT destination_type_check
+    CHECK (type IN ('pg','s3','excel','gsheets','bq','sqlite','duckdb','sftp','file'));
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM destination WHERE type = 'file';
+DELETE FROM connector WHERE type = 'file';
+ALTER TABLE destination DROP CONSTRAINT IF EXISTS destination_type_check;
+ALTER TABLE destination ADD CONSTRAINT destination_type_check
+    CHECK (type IN ('pg','s3','excel','gsheets','bq','sqlite','duckdb','sftp'));
+ALTER TABLE connector DROP CONSTRAINT IF EXISTS connector_type_check;
+ALTER TABLE connector ADD CONSTRAINT connector_type_check
+    CHECK (type IN ('pg','mysql','s3','excel','sf','gsheets','rest','upload','bq','sftp'));
+-- +goose StatementEnd
@@ -0,0 +1,23 @@
+-- +goose Up
+-- +goose StatementBegin
+-- A webhook connector holds the url, headers and signing secret webhook
+-- destinations POST to; it is not a source.
+ALTER TABLE connector DROP CONSTRAINT IF EXISTS connector_type_check;
+ALTER TABLE connector ADD CONSTRAINT connector_type_check
+    CHECK (type IN ('pg','mysql','s3','excel','sf','gsheets','rest','upload','bq','sftp','file','webhook'));
+ALTER TABLE destination DROP CONSTRAINT IF EXISTS destination_type_check;
+ALTER TABLE destination ADD CONSTRAINT destination_type_check
+    CHECK (type IN ('pg','s3','excel','gsheets','bq','sqlite','duckdb','sftp','file','webhook'));
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM destination WHERE type = 'webhook';
+DELETE FROM connector WHERE type = 'webhook';
+ALTER TABLE destination DROP CONSTRAINT IF EXISTS destination_type_check;
+ALTER TABLE destination ADD CONSTRAINT destination_type_check
+    CHECK (type IN ('pg','s3','excel','gsheets','bq','sqlite','duckdb','sftp','file'));
+ALTER TABLE connector DROP CONSTRAINT IF EXISTS connector_type_check;
+ALTER TABLE connector ADD CONSTRAINT connector_type_check
+    CHECK (type IN ('pg','mysql','s3','excel','sf','gsheets','rest','upload','bq','sftp','file'));
+-- +goose StatementEnd
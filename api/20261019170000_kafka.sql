@@ -0,0 +1,24 @@
+-- +goose Up
+-- +goose StatementBegin
+-- A kafka connector reaches a Kafka-compatible cluster, and its schema
+-- registry for Avro values. As a source it reads topics; kafka destinations
+-- publish to them.
+ALTER TABLE connector DROP CONSTRAINT IF EXISTS connector_type_check;
+ALTER TABLE connector ADD CONSTRAINT connector_type_check
+    CHECK (type IN ('pg','mysql','s3','excel','sf','gsheets','rest','upload','bq','sftp','file','webhook','kafka'));
+ALTER TABLE destination DROP CONSTRAINT IF EXISTS destination_type_check;
+ALTER TABLE destination ADD CONSTRAINT destination_type_check
+    CHECK (type IN ('pg','s3','excel','gsheets','bq','sqlite','duckdb','sftp','file','webhook','kafka'));
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM destination WHERE type = 'kafka';
+DELETE FROM connector WHERE type = 'kafka';
+ALTER TABLE destination DROP CONSTRAINT IF EXISTS destination_type_check;
+ALTER TABLE destination ADD CONSTRAINT destination_type_check
+    CHECK (type IN ('pg','s3','excel','gsheets','bq','sqlite','duckdb','sftp','file','webhook'));
+ALTER TABLE connector DROP CONSTRAINT IF EXISTS connector_type_check;
+ALTER TABLE connector ADD CONSTRAINT connector_type_check
+    CHECK (type IN ('pg','mysql','s3','excel','sf','gsheets','rest','upload','bq','sftp','file','webhook'));
+-- +goose StatementEnd
@@ -16,6 +16,18 @@ import (
 	"github.com/Zubimendi/sync-loop/api/internal/connector"
 	"github.com/Zubimendi/sync-loop/api/internal/job"
 	"github.com/Zubimendi/sync-loop/api/internal/temporal"
+	"github.com/Zubimendi/sync-loop/api/internal/schema"
+	"github.com/Zubimendi/sync-loop/api/internal/alert"
+	"github.com/Zubimendi/sync-loop/api/internal/diff"
+	"github.com/Zubimendi/sync-loop/api/internal/quality"
+	"github.com/Zubimendi/sync-loop/api/internal/run"
+	"github.com/Zubimendi/sync-loop/api/internal/mapping"
+	"github.com/Zubimendi/sync-loop/api/internal/deadletter"
+	"github.com/Zubimendi/sync-loop/api/internal/sourcefile"
+	"github.com/Zubimendi/sync-loop/api/internal/upload"
+	"github.com/Zubimendi/sync-loop/api/internal/egress"
+	"github.com/Zubimendi/sync-loop/api/internal/destination"
+	"github.com/Zubimendi/sync-loop/api/internal/oauth"
 	"github.com/rs/cors"
 )
 
@@ -39,6 +51,13 @@ func main() {
 	connSvc  := connector.NewService(connRepo)
 	connH    := connector.NewHandler(connSvc)
 
+	schemaH := schema.NewHandler(schema.NewRepo(db))
+	alertH  := alert.NewHandler(alert.NewRepo(db))
+	runRepo := run.NewRepo(db)
+	qualityH := quality.NewHandler(quality.NewRepo(db), runRepo)
+	runH    := run.NewHandler(runRepo)
+	mappingH := mapping.NewHandler(mapping.NewRepo(db), runRepo)
+
 	c := cors.New(cors.Options{
 	AllowedOrigins:   []string{"http://localhost:3000"},
 	AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
@@ -58,18 +77,28 @@ func main() {
 		log.Fatal().Err(err).Msg("temporal init")
 	}
 	defer temporal.Close()
-	jobH := job.NewHandler(temporal.DefaultClient)
+	jobH := job.NewHandler(connRepo, runRepo, temporal.DefaultClient)
+	diffH := diff.NewHandler(diff.NewRepo(db), connRepo, temporal.DefaultClient)
+	deadLetterH := deadletter.NewHandler(deadletter.NewRepo(db), runRepo, temporal.DefaultClient)
+	sourceFileH := sourcefile.NewHandler(sourcefile.NewRepo(db))
+	uploadH := upload.NewHandler(upload.NewService(upload.NewRepo(db), connSvc))
+	egressH := egress.NewHandler(egress.NewRepo(db))
+	destH := destination.NewHandler(destination.NewRepo(db))
+	oauthH := oauth.NewHandler(oauth.NewService(oauth.NewRepo(db), connRepo))
 
 	r.Route("/api/v1", func(r chi.Router) {
 		r.Post("/register", authH.Register)
 		r.Post("/login", authH.Login)
 		r.Post("/logout", authH.Logout)
+		r.Get("/oauth/{provider}/callback", oauthH.Callback)
 
 		r.Group(func(r chi.Router) {
 			r.Use(authMw)
 			r.Get("/me", authH.Me)
 			r.Get("/connectors", connH.List)
 			r.Post("/connectors", connH.Create)
+			r.Post("/connectors/{id}/test", connH.Test)
+			r.Get("/connectors/{id}/tables", connH.Tables)
 			r.Get("/jobs", jobH.List)
 			r.Post("/jobs/run-now", jobH.RunNow)
 			r.Post("/jobs/cancel", jobH.Cancel)
@@ -80,6 +109,44 @@ func main() {
 			r.Post("/jobs/schedule", jobH.CreateSchedule)        // Create/update schedule
 			r.Post("/jobs/schedule/toggle", jobH.ToggleSchedule) // Pause/unpause schedule
 			r.Get("/jobs/{id}/status", jobH.GetJobStatus)
+			r.Get("/jobs/{id}/schema", schemaH.Timeline) // id = sync_job id
+			r.Get("/alerts", alertH.List)
+			r.Get("/jobs/{id}/runs", runH.List)
+			r.Put("/jobs/{id}/anomaly", runH.SetAnomaly)
+			r.Get("/jobs/{id}/assertions", qualityH.List)
+			r.Post("/jobs/{id}/assertions", qualityH.Create)
+			r.Delete("/assertions/{id}", qualityH.Delete)
+			r.Get("/runs/{id}/assertions", qualityH.Results)
+			r.Post("/diffs", diffH.Start)
+			r.Get("/diffs", diffH.List)
+			r.Get("/diffs/{id}", diffH.Get)
+			r.Get("/jobs/{id}/mappings", mappingH.List)
+			r.Put("/jobs/{id}/mappings", mappingH.Replace)
+			r.Put("/jobs/{id}/error-budget", runH.SetErrorBudget)
+			r.Put("/jobs/{id}/output", runH.SetOutput)
+			r.Put("/jobs/{id}/destination", runH.SetDestination)
+			r.Get("/runs/{id}/dead-letters", deadLetterH.List)
+			r.Get("/runs/{id}/dead-letters/download", deadLetterH.Download)
+			r.Post("/runs/{id}/dead-letters/replay", deadLetterH.Replay)
+			r.Get("/jobs/{id}/files", sourceFileH.List)
+			r.Delete("/jobs/{id}/files", sourceFileH.Forget)
+			r.Post("/uploads", uploadH.Create)
+			r.Get("/uploads", uploadH.List)
+			r.Get("/uploads/{id}", uploadH.Get)
+			r.Delete("/uploads/{id}", uploadH.Delete)
+			r.Put("/uploads/{id}/parts/{n}", uploadH.PutPart)
+			r.Post("/uploads/{id}/complete", uploadH.Complete)
+			r.Get("/uploads/{id}/preview", uploadH.Preview)
+			r.Put("/uploads/{id}/options", uploadH.SetOptions)
+			r.Post("/uploads/{id}/connector", uploadH.Connect)
+			r.Get("/egress/allow", egressH.List)
+			r.Post("/egress/allow", egressH.Add)
+			r.Delete("/egress/allow/{id}", egressH.Delete)
+			r.Get("/destinations", destH.List)
+			r.Post("/destinations", destH.Create)
+			r.Delete("/destinations/{id}", destH.Delete)
+			r.Get("/destinations/{id}/snapshot", destH.Snapshot)
+			r.Get("/oauth/{provider}/start", oauthH.Start)
 		})
 	})
 
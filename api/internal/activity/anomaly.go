@@ -0,0 +1,72 @@
+package activity
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Zubimendi/sync-loop/api/internal/alert"
+	"github.com/Zubimendi/sync-loop/api/internal/anomaly"
+	"github.com/Zubimendi/sync-loop/api/internal/model"
+	"github.com/Zubimendi/sync-loop/api/internal/run"
+	"github.com/Zubimendi/sync-loop/api/internal/workflow"
+)
+
+// historyWindow bounds how far back the baseline looks; weekday mode needs
+// several weeks to have enough same-day samples.
+const historyWindow = 120
+
+// DetectAnomalyActivity scores this run's rows_read against the job's run
+// history, stores the verdict on the run and alerts when it is flagged.
+func DetectAnomalyActivity(ctx context.Context, params workflow.DetectAnomalyParams) (workflow.DetectAnomalyResult, error) {
+	db, err := metaDB()
+	if err != nil {
+		return workflow.DetectAnomalyResult{}, fmt.Errorf("postgres connect: %w", err)
+	}
+	runs := run.NewRepo(db)
+	job, err := runs.GetJobByID(ctx, params.JobID)
+	if err != nil {
+		return workflow.DetectAnomalyResult{}, fmt.Errorf("get job: %w", err)
+	}
+	opt := anomaly.Options{Mode: job.AnomalyMode}
+	if job.AnomalyThreshold != nil {
+		opt.Threshold = *job.AnomalyThreshold
+	}
+	if opt.Mode == anomaly.ModeOff {
+		return workflow.DetectAnomalyResult{}, nil
+	}
+
+	hist, err := runs.History(ctx, params.JobID, params.RunID, historyWindow)
+	if err != nil {
+		return workflow.DetectAnomalyResult{}, fmt.Errorf("run history: %w", err)
+	}
+	points := make([]anomaly.Point, len(hist))
+	for i, h := range hist {
+		points[i] = anomaly.Point{At: h.StartedAt, Rows: *h.RowsRead}
+	}
+	res := anomaly.Detect(points, anomaly.Point{
+		At:   params.StartedAt,
+		Rows: params.RowsRead,
+	}, opt)
+
+	if err := runs.MarkAnomaly(ctx, params.RunID, res.Anomalous, res.Score, res.Expected); err != nil {
+		return workflow.DetectAnomalyResult{}, fmt.Errorf("mark run: %w", err)
+	}
+	if res.Anomalous {
+		e := &model.AlertEvent{
+			JobID:    &params.JobID,
+			RunID:    &params.RunID,
+			Kind:     "row_count_anomaly",
+			Severity: model.SeverityCritical,
+			Message: fmt.Sprintf("%s read %d rows, expected about %.0f (%s)",
+				params.Table, params.RowsRead, res.Expected, res.Reason),
+			Details: model.AlertDetails{"anomaly": res, "rows_read": params.RowsRead},
+		}
+		if params.WorkspaceID != "" {
+			e.WorkspaceID = &params.WorkspaceID
+		}
+		if err := alert.NewRepo(db).Emit(ctx, e); err != nil {
+			return workflow.DetectAnomalyResult{}, fmt.Errorf("emit alert: %w", err)
+		}
+	}
+	return workflow.DetectAnomalyResult{Anomalous: res.Anomalous, Score: res.Score, Expected: res.Expected}, nil
+}
@@ -0,0 +1,28 @@
+package activity
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Zubimendi/sync-loop/api/internal/source"
+	"github.com/Zubimendi/sync-loop/api/internal/workflow"
+)
+
+// CommitCheckpointActivity stores where a successful run's source stopped
+// reading, such as the offsets of a Kafka consumer group, so the job's next
+// incremental run starts there.
+func CommitCheckpointActivity(ctx context.Context, params workflow.CommitCheckpointParams) error {
+	src, err := openSource(ctx, params.ConnectorID, params.WorkspaceID)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	c, ok := src.(source.Checkpointed)
+	if !ok {
+		return fmt.Errorf("connector %s keeps no checkpoint", params.ConnectorID)
+	}
+	if err := c.Commit(ctx, params.Checkpoint); err != nil {
+		return fmt.Errorf("commit checkpoint: %w", err)
+	}
+	return nil
+}
@@ -8,10 +8,8 @@ import (
 	"os"
 	"time"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/credentials"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/Zubimendi/sync-loop/api/internal/checksum"
+	"github.com/Zubimendi/sync-loop/api/internal/storage"
 	"github.com/jmoiron/sqlx"
 	_ "github.com/lib/pq"
 )
@@ -67,7 +65,7 @@ func CopyTableActivity(ctx context.Context, table string) error {
 		}
 		strRow := make([]string, len(row))
 		for i, v := range row {
-			strRow[i] = fmt.Sprint(v)
+			strRow[i] = checksum.Canonical(v)
 		}
 		if err := w.Write(strRow); err != nil {
 			return fmt.Errorf("write row: %w", err)
@@ -84,34 +82,10 @@ func CopyTableActivity(ctx context.Context, table string) error {
 	}
 
 	// 5. MinIO upload
-	cfg, err := config.LoadDefaultConfig(ctx,
-		config.WithEndpointResolverWithOptions(
-			aws.EndpointResolverWithOptionsFunc(
-				func(service, region string, opts ...interface{}) (aws.Endpoint, error) {
-					return aws.Endpoint{URL: os.Getenv("S3_ENDPOINT")}, nil
-				})),
-		config.WithCredentialsProvider(
-			credentials.NewStaticCredentialsProvider(
-				os.Getenv("S3_KEY"),
-				os.Getenv("S3_SECRET"),
-				"")),
-	)
+	store, err := storage.FromEnv(ctx)
 	if err != nil {
-		return fmt.Errorf("load aws config: %w", err)
+		return err
 	}
-	s3Client := s3.NewFromConfig(cfg, func(o *s3.Options) {
-		o.UsePathStyle = true
-	})
-
-	bucket := os.Getenv("S3_BUCKET")
 	key := fmt.Sprintf("sync-loop/%s_%d.csv", table, time.Now().Unix())
-	_, err = s3Client.PutObject(ctx, &s3.PutObjectInput{
-		Bucket: aws.String(bucket),
-		Key:    aws.String(key),
-		Body:   file,
-	})
-	if err != nil {
-		return fmt.Errorf("s3 upload: %w", err)
-	}
-	return nil
-}
\ No newline at end of file
+	return store.Put(ctx, key, file)
+}
@@ -0,0 +1,24 @@
+package activity
+
+import (
+	"os"
+	"sync"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+)
+
+var (
+	dbOnce sync.Once
+	db     *sqlx.DB
+	dbErr  error
+)
+
+// metaDB returns the worker's pool for the SyncLoop database. It is opened on
+// first use and kept for the life of the worker process.
+func metaDB() (*sqlx.DB, error) {
+	dbOnce.Do(func() {
+		db, dbErr = sqlx.Connect("postgres", os.Getenv("DATABASE_URL"))
+	})
+	return db, dbErr
+}
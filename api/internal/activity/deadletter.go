@@ -0,0 +1,33 @@
+package activity
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Zubimendi/sync-loop/api/internal/deadletter"
+	"github.com/Zubimendi/sync-loop/api/internal/storage"
+)
+
+// saveDeadLetters uploads the rejected rows of a stage and records them on
+// the run. An empty buffer is a no-op.
+func saveDeadLetters(ctx context.Context, runID string, b *deadletter.Buffer) error {
+	if b.Len() == 0 {
+		return nil
+	}
+	if runID == "" {
+		return fmt.Errorf("%d rows rejected at %s", b.Len(), b.Stage())
+	}
+	store, err := storage.FromEnv(ctx)
+	if err != nil {
+		return err
+	}
+	key := deadletter.Key(runID, b.Stage())
+	if err := store.Put(ctx, key, b.Reader()); err != nil {
+		return fmt.Errorf("dead letters: %w", err)
+	}
+	db, err := metaDB()
+	if err != nil {
+		return fmt.Errorf("postgres connect: %w", err)
+	}
+	return deadletter.NewRepo(db).Save(ctx, runID, b.Stage(), key, b.Len())
+}
@@ -0,0 +1,94 @@
+package activity
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Zubimendi/sync-loop/api/internal/deadletter"
+	"github.com/Zubimendi/sync-loop/api/internal/destination"
+	"github.com/Zubimendi/sync-loop/api/internal/output"
+	"github.com/Zubimendi/sync-loop/api/internal/workflow"
+	"github.com/jmoiron/sqlx"
+)
+
+// loadDestination writes the rows to a job's destination instead of the
+// bucket. The destination reads back what it wrote, and the run is checked
+// against the rows it accepted, in the form it keeps them.
+func loadDestination(ctx context.Context, params workflow.LoadParams, destinationID string) (workflow.LoadResult, error) {
+	db, err := metaDB()
+	if err != nil {
+		return workflow.LoadResult{}, fmt.Errorf("postgres connect: %w", err)
+	}
+	d, err := destination.NewRepo(db).GetInWorkspace(ctx, destinationID, params.WorkspaceID)
+	if err != nil {
+		return workflow.LoadResult{}, fmt.Errorf("destination %s: %w", destinationID, err)
+	}
+	// SQLite and DuckDB destinations have no connector, so no credentials
+	// or egress.
+	pctx, cfg := ctx, map[string]interface{}(nil)
+	if d.ConnectorID != nil {
+		c, ccfg, err := workspaceConnector(ctx, db, *d.ConnectorID, d.WorkspaceID)
+		if err != nil {
+			return workflow.LoadResult{}, err
+		}
+		if cfg, err = freshConfig(ctx, db, c, ccfg); err != nil {
+			return workflow.LoadResult{}, err
+		}
+		if pctx, err = withPolicy(ctx, db, c); err != nil {
+			return workflow.LoadResult{}, err
+		}
+	}
+	vars := output.Vars{
+		Workspace: d.WorkspaceID, Connector: params.ConnectorID, Job: params.JobID,
+		Table: params.Table, RunID: params.RunID, Time: time.Now(),
+	}
+	w, err := destination.Open(pctx, d, cfg, vars)
+	if err != nil {
+		return workflow.LoadResult{}, err
+	}
+	defer w.Close()
+
+	if d.Type == "sqlite" || d.Type == "duckdb" {
+		unlock, err := lockDestination(ctx, db, d.ID)
+		if err != nil {
+			return workflow.LoadResult{}, fmt.Errorf("lock destination %s: %w", d.Name, err)
+		}
+		defer unlock()
+	}
+	rejects := deadletter.NewBuffer(deadletter.StageLoad)
+	written, accepted, err := w.Write(ctx, output.Columns(params.Columns, params.Data), params.Data, rejects.Add)
+	if err != nil {
+		return workflow.LoadResult{}, fmt.Errorf("load %s destination %s: %w", d.Type, d.Name, err)
+	}
+	if err := saveDeadLetters(ctx, params.RunID, rejects); err != nil {
+		return workflow.LoadResult{}, err
+	}
+	res := workflow.LoadResult{
+		RowsProcessed: written.Rows(),
+		Success:       true,
+		Checksum:      written.Sum(),
+		Rejected:      rejects.Len(),
+	}
+	if res.Rejected > 0 {
+		res.AcceptedChecksum = accepted.Sum()
+	}
+	return res, nil
+}
+
+// lockDestination waits until no other run loads the destination. Runs of a
+// sqlite or duckdb destination each load a copy of the latest file and
+// publish it whole, so without taking turns one would drop the tables the
+// other loaded. The lock is held by a transaction, so a worker that dies
+// releases it with its connection.
+func lockDestination(ctx context.Context, db *sqlx.DB, destinationID string) (unlock func(), err error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtextextended('destination:' || $1, 0))`, destinationID); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	return func() { tx.Rollback() }, nil
+}
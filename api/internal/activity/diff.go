@@ -0,0 +1,123 @@
+package activity
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/Zubimendi/sync-loop/api/internal/diff"
+	"github.com/Zubimendi/sync-loop/api/internal/model"
+	"github.com/Zubimendi/sync-loop/api/internal/source"
+	"github.com/Zubimendi/sync-loop/api/internal/storage"
+	"github.com/Zubimendi/sync-loop/api/internal/workflow"
+	"go.temporal.io/sdk/activity"
+	"go.temporal.io/sdk/temporal"
+)
+
+// maxReportEntries caps the report file; the counts in the summary are
+// always complete.
+const maxReportEntries = 100000
+
+func StartDataDiffActivity(ctx context.Context, params workflow.DataDiffParams) (string, error) {
+	db, err := metaDB()
+	if err != nil {
+		return "", fmt.Errorf("postgres connect: %w", err)
+	}
+	wfID := activity.GetInfo(ctx).WorkflowExecution.ID
+	d := &model.DataDiff{
+		WorkspaceID:       &params.WorkspaceID,
+		WorkflowID:        &wfID,
+		SourceConnectorID: &params.SourceConnectorID,
+		TargetConnectorID: &params.TargetConnectorID,
+		SourceRelation:    relation(params.SourceTable, params.SourceQuery).String(),
+		TargetRelation:    relation(params.TargetTable, params.TargetQuery).String(),
+		KeyColumn:         params.KeyColumn,
+	}
+	if err := diff.NewRepo(db).Create(ctx, d); err != nil {
+		return "", fmt.Errorf("create diff: %w", err)
+	}
+	return d.ID, nil
+}
+
+// DiffTableActivity runs the bisecting diff and uploads the NDJSON report.
+func DiffTableActivity(ctx context.Context, params workflow.DiffTableParams) (workflow.DataDiffResult, error) {
+	p := params.Params
+	src, err := openSegmenter(ctx, p.SourceConnectorID, p.WorkspaceID)
+	if err != nil {
+		return workflow.DataDiffResult{}, fmt.Errorf("source: %w", err)
+	}
+	defer src.Close()
+	dst, err := openSegmenter(ctx, p.TargetConnectorID, p.WorkspaceID)
+	if err != nil {
+		return workflow.DataDiffResult{}, fmt.Errorf("target: %w", err)
+	}
+	defer dst.Close()
+
+	var report bytes.Buffer
+	enc := json.NewEncoder(&report)
+	written := 0
+	stats, err := diff.Run(ctx,
+		src.(source.Segmenter), dst.(source.Segmenter),
+		relation(p.SourceTable, p.SourceQuery), relation(p.TargetTable, p.TargetQuery),
+		diff.Options{
+			Key:        p.KeyColumn,
+			Columns:    p.Columns,
+			Tolerances: p.Tolerances,
+			LeafRows:   p.LeafRows,
+			Progress:   func(s model.DiffStats) { activity.RecordHeartbeat(ctx, s) },
+		},
+		func(e diff.Entry) error {
+			if written >= maxReportEntries {
+				return nil
+			}
+			written++
+			return enc.Encode(e)
+		})
+	if err != nil {
+		return workflow.DataDiffResult{Stats: stats}, err
+	}
+
+	store, err := storage.FromEnv(ctx)
+	if err != nil {
+		return workflow.DataDiffResult{Stats: stats}, err
+	}
+	key := fmt.Sprintf("sync-loop/diffs/%s.ndjson", params.DiffID)
+	if err := store.Put(ctx, key, &report); err != nil {
+		return workflow.DataDiffResult{Stats: stats}, err
+	}
+	return workflow.DataDiffResult{ReportKey: key, Stats: stats}, nil
+}
+
+func FinishDataDiffActivity(ctx context.Context, params workflow.FinishDataDiffParams) error {
+	db, err := metaDB()
+	if err != nil {
+		return fmt.Errorf("postgres connect: %w", err)
+	}
+	err = diff.NewRepo(db).Finish(ctx, params.DiffID, params.Status, params.Stats, params.ReportKey, params.Error)
+	if err != nil {
+		return fmt.Errorf("finish diff: %w", err)
+	}
+	return nil
+}
+
+// openSegmenter opens one side of a diff. Diffs always compare connectors:
+// the queries they run must never reach the SyncLoop database.
+func openSegmenter(ctx context.Context, connectorID, workspaceID string) (source.Source, error) {
+	if connectorID == "" {
+		return nil, temporal.NewNonRetryableApplicationError("a diff needs a connector on both sides", "ConnectorRequired", nil)
+	}
+	src, err := openSource(ctx, connectorID, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := src.(source.Segmenter); !ok {
+		src.Close()
+		return nil, fmt.Errorf("connector %s cannot be diffed", connectorID)
+	}
+	return src, nil
+}
+
+func relation(table, query string) source.Relation {
+	return source.Relation{Table: table, Query: query}
+}
@@ -0,0 +1,169 @@
+package activity
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Zubimendi/sync-loop/api/internal/checksum"
+	"github.com/Zubimendi/sync-loop/api/internal/deadletter"
+	"github.com/Zubimendi/sync-loop/api/internal/model"
+	"github.com/Zubimendi/sync-loop/api/internal/source"
+	"github.com/Zubimendi/sync-loop/api/internal/sourcefile"
+	"github.com/Zubimendi/sync-loop/api/internal/storage"
+	"github.com/Zubimendi/sync-loop/api/internal/workflow"
+)
+
+const defaultCursorColumn = "updated_at"
+
+// ExtractActivity reads the table and digests every row as it goes, so the
+// checksum covers exactly what is handed to the rest of the pipeline.
+func ExtractActivity(ctx context.Context, params workflow.ExtractParams) (workflow.ExtractResult, error) {
+	if params.ReplayRunID != "" {
+		return extractDeadLetters(ctx, params)
+	}
+	src, err := openSource(ctx, params.ConnectorID, params.WorkspaceID)
+	if err != nil {
+		return workflow.ExtractResult{}, err
+	}
+	defer src.Close()
+
+	cols, err := src.Columns(ctx, params.Table)
+	if err != nil {
+		return workflow.ExtractResult{}, fmt.Errorf("columns: %w", err)
+	}
+
+	cursor := params.CursorColumn
+	if cursor == "" {
+		cursor = defaultCursorColumn
+		if c, ok := src.(source.Cursored); ok {
+			cursor = c.DefaultCursor()
+		}
+	}
+	var (
+		data   []map[string]interface{}
+		digest checksum.Digest
+		maxTS  time.Time
+	)
+	read := func(fn func(source.Row) error) error {
+		return src.Read(ctx, source.Query{
+			Table:        params.Table,
+			Incremental:  params.Incremental,
+			CursorColumn: cursor,
+			Since:        params.LastSyncTime,
+			JobID:        params.JobID,
+		}, fn)
+	}
+	// File sources pick up whole files: incremental runs read only those
+	// that are new or changed since a previous run loaded them.
+	var files []model.SourceFile
+	if fs, ok := src.(source.FileSource); ok {
+		objs, err := pendingObjects(ctx, fs, params)
+		if err != nil {
+			return workflow.ExtractResult{}, err
+		}
+		for _, o := range objs {
+			files = append(files, sourcefile.Version(o))
+		}
+		read = func(fn func(source.Row) error) error {
+			return fs.ReadObjects(ctx, params.Table, objs, fn)
+		}
+	}
+	err = read(func(row source.Row) error {
+		digest.Add(row)
+		if s, ok := row[cursor].(string); ok {
+			if ts, err := time.Parse(time.RFC3339Nano, s); err == nil && ts.After(maxTS) {
+				maxTS = ts
+			}
+		}
+		data = append(data, row)
+		return nil
+	})
+	if err != nil {
+		return workflow.ExtractResult{}, fmt.Errorf("read %s: %w", params.Table, err)
+	}
+
+	var checkpoint string
+	if c, ok := src.(source.Checkpointed); ok {
+		checkpoint = c.Checkpoint()
+	}
+
+	return workflow.ExtractResult{
+		Data:         data,
+		Columns:      cols,
+		RowCount:     digest.Rows(),
+		MaxTimestamp: maxTS,
+		Checksum:     digest.Sum(),
+		Files:        files,
+		Checkpoint:   checkpoint,
+	}, nil
+}
+
+func pendingObjects(ctx context.Context, fs source.FileSource, params workflow.ExtractParams) ([]source.Object, error) {
+	objs, err := fs.Objects(ctx, params.Table)
+	if err != nil {
+		return nil, fmt.Errorf("list %s: %w", params.Table, err)
+	}
+	if !params.Incremental || params.JobID == "" {
+		return objs, nil
+	}
+	db, err := metaDB()
+	if err != nil {
+		return nil, fmt.Errorf("postgres connect: %w", err)
+	}
+	seen, err := sourcefile.NewRepo(db).Processed(ctx, params.JobID)
+	if err != nil {
+		return nil, fmt.Errorf("processed files: %w", err)
+	}
+	return sourcefile.Pending(objs, seen), nil
+}
+
+// extractDeadLetters reads back the rows an earlier run rejected at one
+// stage. Transform rejects are source rows, so the source columns still
+// describe them; load rejects were already mapped and carry no column list.
+func extractDeadLetters(ctx context.Context, params workflow.ExtractParams) (workflow.ExtractResult, error) {
+	db, err := metaDB()
+	if err != nil {
+		return workflow.ExtractResult{}, fmt.Errorf("postgres connect: %w", err)
+	}
+	dl, err := deadletter.NewRepo(db).Get(ctx, params.ReplayRunID, params.ReplayStage)
+	if err != nil {
+		return workflow.ExtractResult{}, fmt.Errorf("dead letters of run %s: %w", params.ReplayRunID, err)
+	}
+	store, err := storage.FromEnv(ctx)
+	if err != nil {
+		return workflow.ExtractResult{}, err
+	}
+	body, err := store.Get(ctx, dl.ObjectKey)
+	if err != nil {
+		return workflow.ExtractResult{}, err
+	}
+	defer body.Close()
+
+	var (
+		data   []map[string]interface{}
+		digest checksum.Digest
+	)
+	err = deadletter.Read(body, func(rec deadletter.Record) error {
+		digest.Add(rec.Row)
+		data = append(data, rec.Row)
+		return nil
+	})
+	if err != nil {
+		return workflow.ExtractResult{}, err
+	}
+
+	var cols []model.Column
+	if params.ReplayStage == deadletter.StageTransform {
+		if src, err := openSource(ctx, params.ConnectorID, params.WorkspaceID); err == nil {
+			cols, _ = src.Columns(ctx, params.Table)
+			src.Close()
+		}
+	}
+	return workflow.ExtractResult{
+		Data:     data,
+		Columns:  cols,
+		RowCount: digest.Rows(),
+		Checksum: digest.Sum(),
+	}, nil
+}
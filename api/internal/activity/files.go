@@ -0,0 +1,44 @@
+package activity
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Zubimendi/sync-loop/api/internal/source"
+	"github.com/Zubimendi/sync-loop/api/internal/sourcefile"
+	"github.com/Zubimendi/sync-loop/api/internal/workflow"
+)
+
+// RecordSourceFilesActivity remembers the files a successful run loaded,
+// then, when params.Consume is set, hands them to sources that delete or
+// archive what they have read. They are recorded first, so incremental runs
+// skip a file even when it could not be disposed of.
+func RecordSourceFilesActivity(ctx context.Context, params workflow.RecordSourceFilesParams) error {
+	db, err := metaDB()
+	if err != nil {
+		return fmt.Errorf("postgres connect: %w", err)
+	}
+	if err := sourcefile.NewRepo(db).Record(ctx, params.JobID, params.RunID, params.Files); err != nil {
+		return err
+	}
+	if params.ConnectorID == "" || !params.Consume {
+		return nil
+	}
+	src, err := openSource(ctx, params.ConnectorID, params.WorkspaceID)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	c, ok := src.(source.Consumer)
+	if !ok {
+		return nil
+	}
+	objs := make([]source.Object, len(params.Files))
+	for i, f := range params.Files {
+		objs[i] = sourcefile.Object(f)
+	}
+	if err := c.Consume(ctx, objs); err != nil {
+		return fmt.Errorf("dispose of source files: %w", err)
+	}
+	return nil
+}
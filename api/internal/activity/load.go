@@ -0,0 +1,258 @@
+package activity
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/Zubimendi/sync-loop/api/internal/checksum"
+	"github.com/Zubimendi/sync-loop/api/internal/deadletter"
+	"github.com/Zubimendi/sync-loop/api/internal/model"
+	"github.com/Zubimendi/sync-loop/api/internal/output"
+	"github.com/Zubimendi/sync-loop/api/internal/run"
+	"github.com/Zubimendi/sync-loop/api/internal/storage"
+	"github.com/Zubimendi/sync-loop/api/internal/workflow"
+)
+
+// LoadActivity writes the rows to the bucket in the job's output format,
+// or to the job's destination when it has one (see loadDestination),
+// split into parts per partition, then reads every part back and digests
+// what actually landed. The returned Checksum is that read-back digest, not
+// the digest of the rows we meant to write. Rows the format cannot hold
+// faithfully are dead-lettered.
+//
+// Parts are written under the run's staging prefix and only copied to their
+// final keys once all of them have been verified. Copying is one object at
+// a time, so a reader listing the table's prefix can see some parts of a
+// batch before others; the manifest (the returned ObjectKey) and the
+// optional latest pointer are written after the last copy, and readers that
+// need whole batches must go through them. Parts an earlier attempt of the
+// run published that this attempt did not write are deleted afterwards.
+func LoadActivity(ctx context.Context, params workflow.LoadParams) (workflow.LoadResult, error) {
+	job, err := loadJob(ctx, params.JobID)
+	if err != nil {
+		return workflow.LoadResult{}, err
+	}
+	if job != nil && job.DestinationID != nil {
+		return loadDestination(ctx, params, *job.DestinationID)
+	}
+	now := time.Now()
+	vars := output.Vars{Connector: params.ConnectorID, Table: params.Table, RunID: params.RunID, Time: now}
+	var opts model.OutputOptions
+	if job != nil {
+		opts, vars.Job = job.Output, job.ID
+		if job.WorkspaceID != nil {
+			vars.Workspace = *job.WorkspaceID
+		}
+	}
+	format, err := output.New(opts)
+	if err != nil {
+		return workflow.LoadResult{}, err
+	}
+	layout, err := output.NewLayout(opts, vars)
+	if err != nil {
+		return workflow.LoadResult{}, err
+	}
+	cols := output.Columns(params.Columns, params.Data)
+	limits := output.Limits{MaxRows: opts.MaxFileRows, MaxBytes: opts.MaxFileBytes}
+
+	splits := map[string]*output.Splitter{}
+	var (
+		accepted checksum.Digest
+		rejects  = deadletter.NewBuffer(deadletter.StageLoad)
+	)
+	for _, row := range params.Data {
+		err := writeRow(layout, splits, row, func() *output.Splitter {
+			return output.NewSplitter(format, cols, limits)
+		})
+		var rowErr *output.RowError
+		if errors.As(err, &rowErr) {
+			if err := rejects.Add(row, err); err != nil {
+				return workflow.LoadResult{}, err
+			}
+			continue
+		}
+		if err != nil {
+			return workflow.LoadResult{}, fmt.Errorf("write row: %w", err)
+		}
+		accepted.Add(project(cols, row))
+	}
+	if len(splits) == 0 {
+		splits[""] = output.NewSplitter(format, cols, limits)
+	}
+	partitions := make([]string, 0, len(splits))
+	for p := range splits {
+		partitions = append(partitions, p)
+	}
+	sort.Strings(partitions)
+
+	store, err := storage.FromEnv(ctx)
+	if err != nil {
+		return workflow.LoadResult{}, err
+	}
+	manifest := output.Manifest{
+		Table:     params.Table,
+		RunID:     params.RunID,
+		Format:    format.Ext(),
+		Columns:   cols,
+		CreatedAt: now.UTC(),
+	}
+	var (
+		digest checksum.Digest
+		staged []string
+	)
+	// Staged objects are removed whether or not the batch was published;
+	// a failed delete only leaves garbage under _staging.
+	defer func() {
+		for _, k := range staged {
+			_ = store.Delete(context.WithoutCancel(ctx), k)
+		}
+	}()
+	for _, p := range partitions {
+		parts, err := splits[p].Close()
+		if err != nil {
+			return workflow.LoadResult{}, fmt.Errorf("%s close: %w", format.Ext(), err)
+		}
+		for i, part := range parts {
+			key := layout.Key(p, i, format.Ext())
+			tmp := layout.Staging(key)
+			staged = append(staged, tmp)
+			d, err := putAndDigest(ctx, store, format, tmp, part.Data)
+			if err != nil {
+				return workflow.LoadResult{}, err
+			}
+			digest.Merge(d)
+			manifest.Parts = append(manifest.Parts, output.ManifestPart{
+				Key: key, Partition: p, Rows: d.Rows(), Bytes: int64(len(part.Data)), Checksum: d.Sum(),
+			})
+		}
+	}
+	manifest.Rows, manifest.Checksum = digest.Rows(), digest.Sum()
+
+	for i, part := range manifest.Parts {
+		if err := store.Copy(ctx, staged[i], part.Key); err != nil {
+			return workflow.LoadResult{}, fmt.Errorf("publish: %w", err)
+		}
+	}
+	key := layout.ManifestKey()
+	if err := putJSON(ctx, store, key, manifest); err != nil {
+		return workflow.LoadResult{}, err
+	}
+	if opts.Latest {
+		latest := output.Latest{Manifest: key, RunID: params.RunID, CreatedAt: now.UTC()}
+		if err := putJSON(ctx, store, layout.LatestKey(), latest); err != nil {
+			return workflow.LoadResult{}, err
+		}
+	}
+	if err := deleteStaleParts(ctx, store, layout, manifest); err != nil {
+		return workflow.LoadResult{}, err
+	}
+
+	if err := saveDeadLetters(ctx, params.RunID, rejects); err != nil {
+		return workflow.LoadResult{}, err
+	}
+	res := workflow.LoadResult{
+		RowsProcessed: digest.Rows(),
+		Success:       true,
+		Checksum:      digest.Sum(),
+		ObjectKey:     key,
+		Rejected:      rejects.Len(),
+	}
+	if res.Rejected > 0 {
+		res.AcceptedChecksum = accepted.Sum()
+	}
+	return res, nil
+}
+
+// writeRow routes a row to the splitter of its partition.
+func writeRow(layout *output.Layout, splits map[string]*output.Splitter, row map[string]interface{}, newSplitter func() *output.Splitter) error {
+	p, err := layout.Partition(row)
+	if err != nil {
+		return err
+	}
+	s, ok := splits[p]
+	if !ok {
+		s = newSplitter()
+		splits[p] = s
+	}
+	return s.Write(row)
+}
+
+// deleteStaleParts removes the run's published parts that are not in its
+// manifest. A retried load can split differently, for instance when the
+// source changed or the load time moved to another {date}, and its
+// leftovers would otherwise be read alongside the new batch.
+func deleteStaleParts(ctx context.Context, store *storage.Store, layout *output.Layout, manifest output.Manifest) error {
+	objs, err := store.List(ctx, layout.Root())
+	if err != nil {
+		return fmt.Errorf("list stale parts: %w", err)
+	}
+	keep := make(map[string]bool, len(manifest.Parts))
+	for _, p := range manifest.Parts {
+		keep[p.Key] = true
+	}
+	for _, o := range objs {
+		if keep[o.Key] || !layout.IsRunPart(o.Key) {
+			continue
+		}
+		if err := store.Delete(ctx, o.Key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// putAndDigest uploads one part and digests it as read back from the bucket.
+func putAndDigest(ctx context.Context, store *storage.Store, format output.Format, key string, data []byte) (*checksum.Digest, error) {
+	if err := store.Put(ctx, key, bytes.NewReader(data)); err != nil {
+		return nil, err
+	}
+	body, err := store.Get(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("read back: %w", err)
+	}
+	defer body.Close()
+	d, err := format.Digest(body)
+	if err != nil {
+		return nil, fmt.Errorf("read back %s: %w", key, err)
+	}
+	return d, nil
+}
+
+func putJSON(ctx context.Context, store *storage.Store, key string, v interface{}) error {
+	body, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return store.Put(ctx, key, bytes.NewReader(body))
+}
+
+// project keeps only the written columns of row, so the accepted digest
+// matches what the read-back can see.
+func project(cols []model.Column, row map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(cols))
+	for _, c := range cols {
+		out[c.Name] = row[c.Name]
+	}
+	return out
+}
+
+// loadJob returns the job a load belongs to, or nil for loads without one.
+func loadJob(ctx context.Context, jobID string) (*model.SyncJob, error) {
+	if jobID == "" {
+		return nil, nil
+	}
+	db, err := metaDB()
+	if err != nil {
+		return nil, fmt.Errorf("postgres connect: %w", err)
+	}
+	job, err := run.NewRepo(db).GetJobByID(ctx, jobID)
+	if err != nil {
+		return nil, fmt.Errorf("load job: %w", err)
+	}
+	return job, nil
+}
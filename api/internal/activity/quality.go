@@ -0,0 +1,108 @@
+package activity
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Zubimendi/sync-loop/api/internal/alert"
+	"github.com/Zubimendi/sync-loop/api/internal/model"
+	"github.com/Zubimendi/sync-loop/api/internal/quality"
+	"github.com/Zubimendi/sync-loop/api/internal/run"
+	"github.com/Zubimendi/sync-loop/api/internal/source"
+	"github.com/Zubimendi/sync-loop/api/internal/workflow"
+)
+
+// RunAssertionsActivity evaluates the job's assertions against the rows just
+// loaded, stores one result per assertion and raises an alert for each
+// failure. Only error-severity failures are reported back as Failed.
+func RunAssertionsActivity(ctx context.Context, params workflow.RunAssertionsParams) (workflow.RunAssertionsResult, error) {
+	var out workflow.RunAssertionsResult
+	db, err := metaDB()
+	if err != nil {
+		return out, fmt.Errorf("postgres connect: %w", err)
+	}
+	checks := quality.NewRepo(db)
+	aa, err := checks.Enabled(ctx, params.JobID)
+	if err != nil {
+		return out, fmt.Errorf("list assertions: %w", err)
+	}
+	if len(aa) == 0 {
+		return out, nil
+	}
+
+	prev, err := run.NewRepo(db).PreviousRowsWritten(ctx, params.JobID, params.RunID)
+	if err != nil {
+		return out, fmt.Errorf("previous run: %w", err)
+	}
+	in := quality.Input{
+		Table:            source.QuoteTable(params.Table),
+		Rows:             params.Data,
+		RowCount:         params.RowCount,
+		PreviousRowCount: prev,
+		Now:              time.Now(),
+	}
+	// Custom SQL runs on the job's own connector, never on the SyncLoop
+	// database that jobs without one read from; without it the assertion
+	// fails.
+	if params.ConnectorID != "" && hasCustomSQL(aa) {
+		src, err := openSource(ctx, params.ConnectorID, params.WorkspaceID)
+		if err != nil {
+			in.Query = func(context.Context, string) (int64, error) { return 0, err }
+		} else {
+			defer src.Close()
+			if pg, ok := src.(*source.Postgres); ok {
+				in.Query = func(ctx context.Context, q string) (int64, error) {
+					var n int64
+					err := pg.DB().GetContext(ctx, &n, "SELECT count(*) FROM ("+q+") AS assertion_q")
+					return n, err
+				}
+			}
+		}
+	}
+
+	alerts := alert.NewRepo(db)
+	for _, a := range aa {
+		res := quality.Evaluate(ctx, a, in)
+		res.RunID = params.RunID
+		if err := checks.SaveResult(ctx, &res); err != nil {
+			return out, fmt.Errorf("save result: %w", err)
+		}
+		if res.Passed {
+			out.Passed++
+			continue
+		}
+		severity := model.SeverityWarning
+		if a.Severity == model.AssertError {
+			severity = model.SeverityCritical
+			out.Failed++
+			out.Failures = append(out.Failures, fmt.Sprintf("%s: %s", a.Name, res.Message))
+		} else {
+			out.Warned++
+		}
+		e := &model.AlertEvent{
+			JobID:    &params.JobID,
+			RunID:    &params.RunID,
+			Kind:     "assertion_failed",
+			Severity: severity,
+			Message:  fmt.Sprintf("assertion %q failed on %s: %s", a.Name, params.Table, res.Message),
+			Details:  model.AlertDetails{"assertion_id": a.ID, "kind": a.Kind, "observed": res.Observed},
+		}
+		if params.WorkspaceID != "" {
+			e.WorkspaceID = &params.WorkspaceID
+		}
+		if err := alerts.Emit(ctx, e); err != nil {
+			return out, fmt.Errorf("emit alert: %w", err)
+		}
+	}
+	return out, nil
+}
+
+func hasCustomSQL(aa []model.Assertion) bool {
+	for _, a := range aa {
+		if a.Kind == quality.CustomSQL {
+			return true
+		}
+	}
+	return false
+}
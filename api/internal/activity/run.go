@@ -0,0 +1,81 @@
+package activity
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Zubimendi/sync-loop/api/internal/run"
+	"github.com/Zubimendi/sync-loop/api/internal/workflow"
+	"go.temporal.io/sdk/activity"
+)
+
+// StartRunActivity resolves the sync_job for the workflow and opens a
+// sync_run row for this execution.
+func StartRunActivity(ctx context.Context, params workflow.StartRunParams) (workflow.RunInfo, error) {
+	db, err := metaDB()
+	if err != nil {
+		return workflow.RunInfo{}, fmt.Errorf("postgres connect: %w", err)
+	}
+	runs := run.NewRepo(db)
+	jobID, err := runs.EnsureJob(ctx, params.WorkspaceID, params.ConnectorID, params.Table)
+	if err != nil {
+		return workflow.RunInfo{}, fmt.Errorf("ensure job: %w", err)
+	}
+	r, err := runs.StartRun(ctx, jobID, activity.GetInfo(ctx).WorkflowExecution.ID)
+	if err != nil {
+		return workflow.RunInfo{}, fmt.Errorf("start run: %w", err)
+	}
+	job, err := runs.GetJobByID(ctx, jobID)
+	if err != nil {
+		return workflow.RunInfo{}, fmt.Errorf("load job: %w", err)
+	}
+	return workflow.RunInfo{
+		JobID:        jobID,
+		RunID:        r.ID,
+		MaxErrorRows: job.MaxErrorRows,
+		MaxErrorPct:  job.MaxErrorPct,
+	}, nil
+}
+
+func FinishRunActivity(ctx context.Context, params workflow.FinishRunParams) error {
+	db, err := metaDB()
+	if err != nil {
+		return fmt.Errorf("postgres connect: %w", err)
+	}
+	err = run.NewRepo(db).FinishRun(ctx, params.RunID, run.Outcome{
+		Status:       params.Status,
+		RowsRead:     params.RowsRead,
+		RowsWritten:  params.RowsWritten,
+		Checksum:     params.Checksum,
+		DestChecksum: params.DestChecksum,
+		Error:        params.Error,
+		ErrorRows:    params.ErrorRows,
+	})
+	if err != nil {
+		return fmt.Errorf("finish run: %w", err)
+	}
+	return nil
+}
+
+// GetLastSyncTimeActivity returns the job's incremental cursor, zero before
+// the first incremental run.
+func GetLastSyncTimeActivity(ctx context.Context, params workflow.GetLastSyncTimeParams) (workflow.LastSyncInfo, error) {
+	job, err := loadJob(ctx, params.JobID)
+	if err != nil || job == nil || job.LastSyncAt == nil {
+		return workflow.LastSyncInfo{}, err
+	}
+	return workflow.LastSyncInfo{LastSyncTime: *job.LastSyncAt}, nil
+}
+
+func UpdateLastSyncTimeActivity(ctx context.Context, params workflow.UpdateLastSyncTimeParams) error {
+	// Sources without a cursor column, files among them, have nothing to
+	// advance.
+	if params.JobID == "" || params.SyncTime.IsZero() {
+		return nil
+	}
+	db, err := metaDB()
+	if err != nil {
+		return fmt.Errorf("postgres connect: %w", err)
+	}
+	return run.NewRepo(db).SetLastSync(ctx, params.JobID, params.SyncTime)
+}
@@ -0,0 +1,102 @@
+package activity
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Zubimendi/sync-loop/api/internal/alert"
+	"github.com/Zubimendi/sync-loop/api/internal/model"
+	"github.com/Zubimendi/sync-loop/api/internal/schema"
+	"github.com/Zubimendi/sync-loop/api/internal/workflow"
+)
+
+// SnapshotSchemaActivity stores the source schema seen by this run and fires a
+// schema_drift alert for every column added, removed or retyped since the
+// previous run of the same job.
+func SnapshotSchemaActivity(ctx context.Context, params workflow.SnapshotSchemaParams) (workflow.SnapshotSchemaResult, error) {
+	db, err := metaDB()
+	if err != nil {
+		return workflow.SnapshotSchemaResult{}, fmt.Errorf("postgres connect: %w", err)
+	}
+	cols := params.Columns
+	if len(cols) == 0 {
+		src, err := openSource(ctx, params.ConnectorID, params.WorkspaceID)
+		if err != nil {
+			return workflow.SnapshotSchemaResult{}, err
+		}
+		defer src.Close()
+		if cols, err = src.Columns(ctx, params.Table); err != nil {
+			return workflow.SnapshotSchemaResult{}, fmt.Errorf("columns: %w", err)
+		}
+	}
+
+	snapshots := schema.NewRepo(db)
+	prev, err := snapshots.Latest(ctx, params.JobID)
+	if err != nil {
+		return workflow.SnapshotSchemaResult{}, fmt.Errorf("latest snapshot: %w", err)
+	}
+
+	cur := &model.SchemaSnapshot{
+		JobID:   params.JobID,
+		RunID:   &params.RunID,
+		Hash:    schema.Hash(cols),
+		Columns: cols,
+		Changes: model.SchemaChangeList{},
+	}
+	if prev != nil && prev.Hash != cur.Hash {
+		cur.Changes = schema.Diff(prev.Columns, cols)
+	}
+	if err := snapshots.Create(ctx, cur); err != nil {
+		return workflow.SnapshotSchemaResult{}, fmt.Errorf("store snapshot: %w", err)
+	}
+
+	alerts := alert.NewRepo(db)
+	for _, c := range cur.Changes {
+		e := &model.AlertEvent{
+			JobID:    &params.JobID,
+			RunID:    &params.RunID,
+			Kind:     "schema_drift",
+			Severity: driftSeverity(c),
+			Message:  driftMessage(params.Table, c),
+			Details: model.AlertDetails{
+				"change":        c,
+				"previous_hash": prev.Hash,
+				"schema_hash":   cur.Hash,
+			},
+		}
+		if params.WorkspaceID != "" {
+			e.WorkspaceID = &params.WorkspaceID
+		}
+		if err := alerts.Emit(ctx, e); err != nil {
+			return workflow.SnapshotSchemaResult{}, fmt.Errorf("emit alert: %w", err)
+		}
+	}
+	return workflow.SnapshotSchemaResult{Hash: cur.Hash, Changes: cur.Changes}, nil
+}
+
+// Additions and new NOT NULL constraints rarely break readers; removals,
+// type changes and columns that may now be NULL usually do.
+func driftSeverity(c model.SchemaChange) string {
+	switch {
+	case c.Kind == schema.ColumnAdded,
+		c.Kind == schema.NullabilityChanged && c.Nullable != nil && !*c.Nullable:
+		return model.SeverityWarning
+	}
+	return model.SeverityCritical
+}
+
+func driftMessage(table string, c model.SchemaChange) string {
+	switch c.Kind {
+	case schema.ColumnAdded:
+		return fmt.Sprintf("column %q (%s) added to %s", c.Column, c.NewType, table)
+	case schema.ColumnRemoved:
+		return fmt.Sprintf("column %q removed from %s", c.Column, table)
+	case schema.NullabilityChanged:
+		if c.Nullable != nil && *c.Nullable {
+			return fmt.Sprintf("column %q in %s is now nullable", c.Column, table)
+		}
+		return fmt.Sprintf("column %q in %s is now NOT NULL", c.Column, table)
+	default:
+		return fmt.Sprintf("column %q in %s changed type from %s to %s", c.Column, table, c.OldType, c.NewType)
+	}
+}
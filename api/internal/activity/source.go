@@ -0,0 +1,135 @@
+package activity
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/Zubimendi/sync-loop/api/internal/alert"
+	"github.com/Zubimendi/sync-loop/api/internal/connector"
+	"github.com/Zubimendi/sync-loop/api/internal/egress"
+	"github.com/Zubimendi/sync-loop/api/internal/model"
+	"github.com/Zubimendi/sync-loop/api/internal/oauth"
+	"github.com/Zubimendi/sync-loop/api/internal/source"
+	"github.com/Zubimendi/sync-loop/api/internal/upload"
+	"github.com/jmoiron/sqlx"
+	"github.com/rs/zerolog/log"
+	"go.temporal.io/sdk/temporal"
+)
+
+// openSource resolves a connector of the run's workspace to a Source. Runs
+// started without a connector read from the SyncLoop database itself, as
+// CopyTableActivity does.
+func openSource(ctx context.Context, connectorID, workspaceID string) (source.Source, error) {
+	if connectorID == "" {
+		return source.OpenPostgres(ctx, os.Getenv("DATABASE_URL"))
+	}
+	db, err := metaDB()
+	if err != nil {
+		return nil, fmt.Errorf("postgres connect: %w", err)
+	}
+	c, cfg, err := workspaceConnector(ctx, db, connectorID, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	if c.Type == "upload" {
+		// Read the file from the upload record, so a connector can only
+		// reach its own workspace's uploads.
+		id, _ := cfg["upload_id"].(string)
+		u, err := upload.NewRepo(db).Get(ctx, id, c.Workspace)
+		if err != nil {
+			return nil, fmt.Errorf("upload %s: %w", id, err)
+		}
+		if u.Status != "ready" {
+			return nil, fmt.Errorf("upload %s: %w", id, upload.ErrNotReady)
+		}
+		cfg = upload.Config(u)
+	}
+	if cfg, err = freshConfig(ctx, db, c, cfg); err != nil {
+		return nil, err
+	}
+	ctx, err = withPolicy(ctx, db, c)
+	if err != nil {
+		return nil, err
+	}
+	return source.Open(ctx, c.Type, cfg)
+}
+
+// workspaceConnector loads a connector and its config, failing without
+// retries unless it belongs to workspaceID: activities get IDs from workflow
+// params, and a run must never reach another workspace's systems.
+func workspaceConnector(ctx context.Context, db *sqlx.DB, connectorID, workspaceID string) (*model.Connector, map[string]interface{}, error) {
+	c, cfg, err := connector.NewService(connector.NewRepo(db)).Config(ctx, connectorID)
+	if err == nil && c.Workspace != workspaceID {
+		err = sql.ErrNoRows
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		msg := fmt.Sprintf("connector %s not found", connectorID)
+		return nil, nil, temporal.NewNonRetryableApplicationError(msg, "ConnectorNotFound", err)
+	}
+	return c, cfg, err
+}
+
+// freshConfig refreshes the access token of a connector connected by OAuth
+// before it expires. A connector whose refresh token was refused fails the
+// run without retries, and the first such failure raises an alert.
+func freshConfig(ctx context.Context, db *sqlx.DB, c *model.Connector, cfg map[string]interface{}) (map[string]interface{}, error) {
+	cfg, err := oauth.NewService(oauth.NewRepo(db), connector.NewRepo(db)).Fresh(ctx, c, cfg)
+	if !errors.Is(err, oauth.ErrReauthRequired) {
+		return cfg, err
+	}
+	if c.Status != oauth.StatusReauthRequired {
+		wid := c.Workspace
+		e := &model.AlertEvent{
+			WorkspaceID: &wid,
+			Kind:        "connector_reauth_required",
+			Severity:    model.SeverityCritical,
+			Message:     fmt.Sprintf("connector %s lost its authorization and must be connected again", c.Name),
+			Details:     model.AlertDetails{"connector_id": c.ID, "connector": c.Type},
+		}
+		if err := alert.NewRepo(db).Emit(context.WithoutCancel(ctx), e); err != nil {
+			log.Error().Err(err).Msg("record connector_reauth_required event")
+		}
+	}
+	return nil, temporal.NewNonRetryableApplicationError(err.Error(), "ReauthRequired", err)
+}
+
+// withPolicy carries the egress policy of a connector's workspace in ctx,
+// recording what it blocks.
+func withPolicy(ctx context.Context, db *sqlx.DB, c *model.Connector) (context.Context, error) {
+	policy, err := egress.NewRepo(db).Policy(ctx, c.Workspace)
+	if err != nil {
+		return nil, fmt.Errorf("egress policy: %w", err)
+	}
+	policy.OnBlock = func(b egress.Blocked) {
+		blockedEgress(context.WithoutCancel(ctx), c, b)
+	}
+	return egress.NewContext(ctx, policy), nil
+}
+
+// blockedEgress records a connection the egress policy refused as a
+// security event of the connector's workspace.
+func blockedEgress(ctx context.Context, c *model.Connector, b egress.Blocked) {
+	db, err := metaDB()
+	if err != nil {
+		return
+	}
+	wid := c.Workspace
+	e := &model.AlertEvent{
+		WorkspaceID: &wid,
+		Kind:        "egress_blocked",
+		Severity:    model.SeverityCritical,
+		Message:     fmt.Sprintf("connector %s tried to reach %s: %s", c.Name, b.Addr, b.Reason),
+		Details: model.AlertDetails{
+			"connector_id": c.ID,
+			"connector":    c.Type,
+			"addr":         b.Addr,
+			"ip":           b.IP.String(),
+		},
+	}
+	if err := alert.NewRepo(db).Emit(ctx, e); err != nil {
+		log.Error().Err(err).Msg("record egress_blocked event")
+	}
+}
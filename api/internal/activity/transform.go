@@ -0,0 +1,68 @@
+package activity
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Zubimendi/sync-loop/api/internal/checksum"
+	"github.com/Zubimendi/sync-loop/api/internal/deadletter"
+	"github.com/Zubimendi/sync-loop/api/internal/mapping"
+	"github.com/Zubimendi/sync-loop/api/internal/workflow"
+)
+
+// TransformActivity applies the job's field mappings. Rows that fail a cast
+// or check are dead-lettered instead of failing the activity. Without
+// mappings the rows pass through and Checksum stays empty, signalling they
+// are unchanged from extract.
+func TransformActivity(ctx context.Context, params workflow.TransformParams) (workflow.TransformResult, error) {
+	pass := workflow.TransformResult{
+		Data:     params.Data,
+		Columns:  params.Columns,
+		RowCount: int64(len(params.Data)),
+	}
+	if params.JobID == "" {
+		return pass, nil
+	}
+	db, err := metaDB()
+	if err != nil {
+		return workflow.TransformResult{}, fmt.Errorf("postgres connect: %w", err)
+	}
+	mm, err := mapping.NewRepo(db).ListByJob(ctx, params.JobID)
+	if err != nil {
+		return workflow.TransformResult{}, fmt.Errorf("load mappings: %w", err)
+	}
+	m, err := mapping.Compile(mm)
+	if err != nil {
+		return workflow.TransformResult{}, err
+	}
+	if m.Empty() {
+		return pass, nil
+	}
+
+	var (
+		data    = make([]map[string]interface{}, 0, len(params.Data))
+		digest  checksum.Digest
+		rejects = deadletter.NewBuffer(deadletter.StageTransform)
+	)
+	for _, row := range params.Data {
+		out, err := m.Apply(row)
+		if err != nil {
+			if err := rejects.Add(row, err); err != nil {
+				return workflow.TransformResult{}, err
+			}
+			continue
+		}
+		digest.Add(out)
+		data = append(data, out)
+	}
+	if err := saveDeadLetters(ctx, params.RunID, rejects); err != nil {
+		return workflow.TransformResult{}, err
+	}
+	return workflow.TransformResult{
+		Data:     data,
+		Columns:  m.Columns(params.Columns),
+		RowCount: digest.Rows(),
+		Checksum: digest.Sum(),
+		Rejected: rejects.Len(),
+	}, nil
+}
@@ -0,0 +1,30 @@
+package alert
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/Zubimendi/sync-loop/api/internal/middleware"
+)
+
+type Handler struct {
+	repo *Repo
+}
+
+func NewHandler(repo *Repo) *Handler { return &Handler{repo: repo} }
+
+// GET /api/v1/alerts?kind=schema_drift&limit=50
+func (h *Handler) List(w http.ResponseWriter, r *http.Request) {
+	wid := r.Context().Value(middleware.CtxWorkspaceID).(string)
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit <= 0 || limit > 500 {
+		limit = 50
+	}
+	ee, err := h.repo.ListByWorkspace(r.Context(), wid, r.URL.Query().Get("kind"), limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"alerts": ee})
+}
@@ -0,0 +1,40 @@
+package alert
+
+import (
+	"context"
+
+	"github.com/Zubimendi/sync-loop/api/internal/model"
+	"github.com/jmoiron/sqlx"
+	"github.com/rs/zerolog/log"
+)
+
+type Repo struct {
+	db *sqlx.DB
+}
+
+func NewRepo(db *sqlx.DB) *Repo { return &Repo{db: db} }
+
+// Emit records an alert event and mirrors it to the log so it shows up even
+// before any notification channel is wired.
+func (r *Repo) Emit(ctx context.Context, e *model.AlertEvent) error {
+	log.Warn().
+		Str("kind", e.Kind).
+		Str("severity", e.Severity).
+		Interface("details", e.Details).
+		Msg(e.Message)
+	return r.db.QueryRowxContext(ctx, `
+		INSERT INTO alert_event (workspace_id, job_id, run_id, kind, severity, message, details_json)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at`,
+		e.WorkspaceID, e.JobID, e.RunID, e.Kind, e.Severity, e.Message, e.Details).Scan(&e.ID, &e.CreatedAt)
+}
+
+func (r *Repo) ListByWorkspace(ctx context.Context, workspaceID, kind string, limit int) ([]model.AlertEvent, error) {
+	ee := make([]model.AlertEvent, 0)
+	err := r.db.SelectContext(ctx, &ee, `
+		SELECT * FROM alert_event
+		WHERE workspace_id = $1 AND ($2 = '' OR kind = $2)
+		ORDER BY created_at DESC
+		LIMIT $3`, workspaceID, kind, limit)
+	return ee, err
+}
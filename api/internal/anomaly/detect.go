@@ -0,0 +1,121 @@
+// Package anomaly flags runs whose row volume is far from the job's history,
+// using a median/MAD baseline that a single bad day cannot drag around.
+package anomaly
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+const (
+	ModeOff     = "off"
+	ModeRolling = "rolling" // last Window successful runs
+	ModeWeekday = "weekday" // same weekday only, falling back to rolling
+)
+
+// madScale turns a MAD into a standard-deviation estimate for normal data.
+const madScale = 1.4826
+
+// minMADFraction floors the MAD at a fraction of the median, and at one
+// row, so a steady history does not flag every small change.
+const minMADFraction = 0.01
+
+type Point struct {
+	At   time.Time
+	Rows int64
+}
+
+type Options struct {
+	Mode      string
+	Threshold float64 // robust z-score above which a run is flagged
+	Window    int
+	// MinHistory is how many past runs are needed before judging at all.
+	MinHistory int
+}
+
+func (o Options) withDefaults() Options {
+	if o.Mode == "" {
+		o.Mode = ModeRolling
+	}
+	if o.Threshold <= 0 {
+		o.Threshold = 3.5
+	}
+	if o.Window <= 0 {
+		o.Window = 28
+	}
+	if o.MinHistory <= 0 {
+		o.MinHistory = 5
+	}
+	return o
+}
+
+type Result struct {
+	Anomalous bool    `json:"anomalous"`
+	Score     float64 `json:"score"`
+	Expected  float64 `json:"expected"`
+	MAD       float64 `json:"mad"`
+	Basis     string  `json:"basis"`
+	Samples   int     `json:"samples"`
+	Reason    string  `json:"reason,omitempty"`
+}
+
+// Detect compares cur against history, which must be newest first.
+func Detect(history []Point, cur Point, opt Options) Result {
+	opt = opt.withDefaults()
+	if opt.Mode == ModeOff {
+		return Result{Basis: ModeOff}
+	}
+
+	sample, basis := history, ModeRolling
+	if opt.Mode == ModeWeekday {
+		var same []Point
+		for _, p := range history {
+			if p.At.Weekday() == cur.At.Weekday() {
+				same = append(same, p)
+			}
+		}
+		if len(same) >= opt.MinHistory {
+			sample, basis = same, ModeWeekday
+		}
+	}
+	if len(sample) > opt.Window {
+		sample = sample[:opt.Window]
+	}
+	res := Result{Basis: basis, Samples: len(sample)}
+	if len(sample) < opt.MinHistory {
+		res.Reason = "not enough history"
+		return res
+	}
+
+	vals := make([]float64, len(sample))
+	for i, p := range sample {
+		vals[i] = float64(p.Rows)
+	}
+	med := median(vals)
+	dev := make([]float64, len(vals))
+	for i, v := range vals {
+		dev[i] = math.Abs(v - med)
+	}
+	mad := math.Max(median(dev), math.Max(1, med*minMADFraction))
+	res.Expected, res.MAD = med, mad
+	res.Score = math.Abs(float64(cur.Rows)-med) / (madScale * mad)
+
+	switch {
+	case cur.Rows == 0 && med > 0:
+		res.Anomalous, res.Reason = true, "zero rows where history has data"
+	case res.Score > opt.Threshold:
+		res.Anomalous, res.Reason = true, "row count outside baseline"
+	}
+	return res
+}
+
+func median(v []float64) float64 {
+	s := append([]float64(nil), v...)
+	sort.Float64s(s)
+	n := len(s)
+	if n%2 == 1 {
+		return s[n/2]
+	}
+	return (s[n/2-1] + s[n/2]) / 2
+}
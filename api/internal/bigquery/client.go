@@ -0,0 +1,566 @@
+// Package bigquery is a small client for the BigQuery REST API: tables,
+// load jobs fed by upload and query jobs. The base URL comes from the
+// connector config, so a local emulator can stand in for Google.
+package bigquery
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Zubimendi/sync-loop/api/internal/googleauth"
+	"github.com/Zubimendi/sync-loop/api/internal/retry"
+)
+
+const (
+	DefaultBaseURL = "https://bigquery.googleapis.com"
+	scope          = "https://www.googleapis.com/auth/bigquery"
+
+	defaultRetries = 6
+	// maxPoll is the longest wait between two looks at a running job.
+	maxPoll = 10 * time.Second
+)
+
+// ErrNotFound is the API's answer for a missing table or job.
+var ErrNotFound = errors.New("bigquery: not found")
+
+// Config is how a bq connector reaches the API. ServiceAccount or
+// AccessToken authenticates; an emulator at BaseURL may need neither.
+type Config struct {
+	BaseURL string
+	Project string
+	// Location is where jobs run, e.g. EU; the dataset's when empty.
+	Location string
+	// ServiceAccount is a service account key file, as JSON. TokenURL
+	// overrides its token_uri.
+	ServiceAccount string
+	TokenURL       string
+	AccessToken    string
+	// MaxRetries bounds the retries of a request hitting a quota or a
+	// server error.
+	MaxRetries int
+}
+
+// ConfigFrom reads the keys of a connector config: api_url, project_id,
+// location, service_account (the key file as JSON text or object),
+// token_url, access_token and max_retries.
+func ConfigFrom(cfg map[string]interface{}) (Config, error) {
+	s := func(k string) string {
+		v, _ := cfg[k].(string)
+		return v
+	}
+	c := Config{
+		BaseURL:        s("api_url"),
+		Project:        s("project_id"),
+		Location:       s("location"),
+		ServiceAccount: googleauth.KeyJSON(cfg["service_account"]),
+		TokenURL:       s("token_url"),
+		AccessToken:    s("access_token"),
+		MaxRetries:     defaultRetries,
+	}
+	if n, ok := cfg["max_retries"].(float64); ok && n >= 0 {
+		c.MaxRetries = int(n)
+	}
+	switch {
+	case c.Project == "":
+		return c, errors.New("bigquery: project_id is required")
+	case c.ServiceAccount == "" && c.AccessToken == "" && c.BaseURL == "":
+		return c, errors.New("bigquery: service_account or access_token is required")
+	}
+	return c, nil
+}
+
+// Client calls the API for one connector.
+type Client struct {
+	base   *url.URL
+	http   *http.Client
+	cfg    Config
+	tokens *googleauth.Tokens // nil unless a service account authenticates
+}
+
+// New builds a client whose requests, token requests included, go through
+// transport.
+func New(c Config, transport http.RoundTripper) (*Client, error) {
+	if c.BaseURL == "" {
+		c.BaseURL = DefaultBaseURL
+	}
+	base, err := url.Parse(strings.TrimRight(c.BaseURL, "/"))
+	if err != nil || (base.Scheme != "https" && base.Scheme != "http") || base.Host == "" {
+		return nil, fmt.Errorf("bigquery: bad api_url %q", c.BaseURL)
+	}
+	cl := &Client{base: base, http: &http.Client{Transport: transport, Timeout: 10 * time.Minute}, cfg: c}
+	if c.ServiceAccount != "" {
+		sa, err := googleauth.ParseServiceAccount(c.ServiceAccount, c.TokenURL)
+		if err != nil {
+			return nil, fmt.Errorf("bigquery: %w", err)
+		}
+		cl.tokens = sa.Tokens(scope, cl.http)
+	}
+	return cl, nil
+}
+
+func (c *Client) Close() { c.http.CloseIdleConnections() }
+
+// Project is the project jobs run in and tables default to.
+func (c *Client) Project() string { return c.cfg.Project }
+
+// TableRef names a table.
+type TableRef struct {
+	ProjectID string `json:"projectId"`
+	DatasetID string `json:"datasetId"`
+	TableID   string `json:"tableId"`
+}
+
+// SQL is the table's name quoted for GoogleSQL.
+func (t TableRef) SQL() string {
+	return Quote(t.ProjectID + "." + t.DatasetID + "." + t.TableID)
+}
+
+// Quote makes a name a GoogleSQL identifier.
+func Quote(name string) string {
+	r := strings.NewReplacer(`\`, `\\`, "`", "\\`")
+	return "`" + r.Replace(name) + "`"
+}
+
+// Field is a column of a table schema. Type uses the names the API
+// answers with: INTEGER, FLOAT, BOOLEAN, NUMERIC, BIGNUMERIC, DATE,
+// TIMESTAMP, DATETIME and STRING.
+type Field struct {
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+	Mode      string `json:"mode,omitempty"`
+	Precision string `json:"precision,omitempty"`
+	Scale     string `json:"scale,omitempty"`
+}
+
+type Schema struct {
+	Fields []Field `json:"fields"`
+}
+
+type TimePartitioning struct {
+	Type  string `json:"type"`            // DAY, HOUR, MONTH or YEAR
+	Field string `json:"field,omitempty"` // ingestion time when empty
+}
+
+type Clustering struct {
+	Fields []string `json:"fields"`
+}
+
+type Table struct {
+	TableReference   TableRef          `json:"tableReference"`
+	Schema           *Schema           `json:"schema,omitempty"`
+	TimePartitioning *TimePartitioning `json:"timePartitioning,omitempty"`
+	Clustering       *Clustering       `json:"clustering,omitempty"`
+	// ExpirationTime is in milliseconds since the epoch, as a string.
+	ExpirationTime string `json:"expirationTime,omitempty"`
+}
+
+func tablePath(t TableRef) string {
+	return "/bigquery/v2/projects/" + url.PathEscape(t.ProjectID) +
+		"/datasets/" + url.PathEscape(t.DatasetID) + "/tables"
+}
+
+// GetTable reads a table's metadata; ErrNotFound when it does not exist.
+func (c *Client) GetTable(ctx context.Context, ref TableRef) (*Table, error) {
+	var t Table
+	err := c.do(ctx, http.MethodGet, tablePath(ref)+"/"+url.PathEscape(ref.TableID), nil, nil, &t, true)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (c *Client) CreateTable(ctx context.Context, t *Table) error {
+	return c.do(ctx, http.MethodPost, tablePath(t.TableReference), nil, t, nil, false)
+}
+
+// AddFields appends NULLABLE fields to a table's schema, leaving the fields
+// it has as they are.
+func (c *Client) AddFields(ctx context.Context, ref TableRef, add []Field) error {
+	path := tablePath(ref) + "/" + url.PathEscape(ref.TableID)
+	var t struct {
+		Schema struct {
+			Fields []json.RawMessage `json:"fields"`
+		} `json:"schema"`
+	}
+	if err := c.do(ctx, http.MethodGet, path, nil, nil, &t, true); err != nil {
+		return err
+	}
+	fields := t.Schema.Fields
+	for _, f := range add {
+		f.Mode = "NULLABLE"
+		b, err := json.Marshal(f)
+		if err != nil {
+			return err
+		}
+		fields = append(fields, b)
+	}
+	body := map[string]interface{}{"schema": map[string]interface{}{"fields": fields}}
+	return c.do(ctx, http.MethodPatch, path, nil, body, nil, true)
+}
+
+// Ping checks that the project can be reached with the credentials.
+func (c *Client) Ping(ctx context.Context) error {
+	q := url.Values{"maxResults": {"1"}}
+	return c.do(ctx, http.MethodGet, "/bigquery/v2/projects/"+url.PathEscape(c.cfg.Project)+"/datasets", q, nil, nil, true)
+}
+
+// DeleteTable drops a table; one that is gone already is no error.
+func (c *Client) DeleteTable(ctx context.Context, ref TableRef) error {
+	err := c.do(ctx, http.MethodDelete, tablePath(ref)+"/"+url.PathEscape(ref.TableID), nil, nil, nil, true)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	return err
+}
+
+// Load configures a load job. Schema is left out for Parquet, which
+// carries its own.
+type Load struct {
+	SourceFormat      string   `json:"sourceFormat"` // NEWLINE_DELIMITED_JSON or PARQUET
+	DestinationTable  TableRef `json:"destinationTable"`
+	Schema            *Schema  `json:"schema,omitempty"`
+	WriteDisposition  string   `json:"writeDisposition"` // WRITE_APPEND or WRITE_TRUNCATE
+	CreateDisposition string   `json:"createDisposition"`
+}
+
+// Job is the part of a job resource the client looks at.
+type Job struct {
+	JobReference struct {
+		ProjectID string `json:"projectId"`
+		JobID     string `json:"jobId"`
+		Location  string `json:"location,omitempty"`
+	} `json:"jobReference"`
+	Status struct {
+		State       string       `json:"state"`
+		ErrorResult *ErrorProto  `json:"errorResult"`
+		Errors      []ErrorProto `json:"errors"`
+	} `json:"status"`
+	Statistics struct {
+		Load *struct {
+			OutputRows string `json:"outputRows"`
+		} `json:"load"`
+		Query *struct {
+			NumDMLAffectedRows string `json:"numDmlAffectedRows"`
+		} `json:"query"`
+	} `json:"statistics"`
+}
+
+type ErrorProto struct {
+	Reason   string `json:"reason"`
+	Location string `json:"location"`
+	Message  string `json:"message"`
+}
+
+// JobError is a job that finished with an error.
+type JobError struct {
+	JobID  string
+	Result ErrorProto
+	Errors []ErrorProto
+}
+
+func (e *JobError) Error() string {
+	msg := fmt.Sprintf("bigquery: job %s: %s: %s", e.JobID, e.Result.Reason, e.Result.Message)
+	for i, pe := range e.Errors {
+		if i == 5 {
+			msg += fmt.Sprintf("; and %d more", len(e.Errors)-i)
+			break
+		}
+		if pe.Message != e.Result.Message {
+			msg += "; " + pe.Message
+		}
+	}
+	return msg
+}
+
+// OutputRows is the number of rows a finished load job wrote.
+func (j *Job) OutputRows() int64 {
+	if j.Statistics.Load == nil {
+		return 0
+	}
+	n, _ := strconv.ParseInt(j.Statistics.Load.OutputRows, 10, 64)
+	return n
+}
+
+// AffectedRows is the number of rows a finished DML query changed.
+func (j *Job) AffectedRows() int64 {
+	if j.Statistics.Query == nil {
+		return 0
+	}
+	n, _ := strconv.ParseInt(j.Statistics.Query.NumDMLAffectedRows, 10, 64)
+	return n
+}
+
+func (c *Client) newJob(config map[string]interface{}) (map[string]interface{}, string) {
+	b := make([]byte, 12)
+	rand.Read(b)
+	id := "syncloop_" + hex.EncodeToString(b)
+	ref := map[string]interface{}{"projectId": c.cfg.Project, "jobId": id}
+	if c.cfg.Location != "" {
+		ref["location"] = c.cfg.Location
+	}
+	return map[string]interface{}{"jobReference": ref, "configuration": config}, id
+}
+
+// LoadFrom runs a load job fed by size bytes of r, through a resumable
+// upload, and waits for it to finish.
+func (c *Client) LoadFrom(ctx context.Context, load Load, r io.Reader, size int64) (*Job, error) {
+	body, _ := c.newJob(map[string]interface{}{"load": load})
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	start := c.base.String() + "/upload/bigquery/v2/projects/" + url.PathEscape(c.cfg.Project) + "/jobs?uploadType=resumable"
+	resp, err := c.send(ctx, http.MethodPost, start, bytes.NewReader(payload), "application/json", -1)
+	if err != nil {
+		return nil, fmt.Errorf("bigquery: start upload: %w", err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return nil, apiError(resp)
+	}
+	session := resp.Header.Get("Location")
+	if session == "" {
+		return nil, errors.New("bigquery: start upload: no upload session")
+	}
+	// The upload is not retried; the activity is, with a new job.
+	resp, err = c.send(ctx, http.MethodPut, session, r, "application/octet-stream", size)
+	if err != nil {
+		return nil, fmt.Errorf("bigquery: upload: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return nil, apiError(resp)
+	}
+	var job Job
+	if err := json.NewDecoder(resp.Body).Decode(&job); err != nil {
+		return nil, fmt.Errorf("bigquery: upload: decode: %w", err)
+	}
+	return c.wait(ctx, &job)
+}
+
+// Query runs a GoogleSQL job and waits for it to finish. For a SELECT,
+// row is called with each result row, values as the API renders them
+// (nil for NULL), timestamps in microseconds since the epoch.
+func (c *Client) Query(ctx context.Context, sql string, row func([]*string) error) (*Job, error) {
+	body, id := c.newJob(map[string]interface{}{
+		"query": map[string]interface{}{"query": sql, "useLegacySql": false},
+	})
+	var job Job
+	err := c.do(ctx, http.MethodPost, "/bigquery/v2/projects/"+url.PathEscape(c.cfg.Project)+"/jobs", nil, body, &job, true)
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusConflict {
+		// A retried insert that had landed: the job id is ours.
+		job.JobReference.ProjectID, job.JobReference.JobID, job.JobReference.Location = c.cfg.Project, id, c.cfg.Location
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	done, err := c.wait(ctx, &job)
+	if err != nil || row == nil {
+		return done, err
+	}
+	return done, c.results(ctx, done, row)
+}
+
+func (c *Client) jobPath(j *Job) (string, url.Values) {
+	q := url.Values{}
+	if j.JobReference.Location != "" {
+		q.Set("location", j.JobReference.Location)
+	}
+	return "/bigquery/v2/projects/" + url.PathEscape(j.JobReference.ProjectID) + "/jobs/" + url.PathEscape(j.JobReference.JobID), q
+}
+
+// wait polls a job until it is DONE, backing off up to maxPoll.
+func (c *Client) wait(ctx context.Context, job *Job) (*Job, error) {
+	for attempt := 0; job.Status.State != "DONE"; attempt++ {
+		if err := retry.Sleep(ctx, min(250*time.Millisecond<<min(attempt, 6), maxPoll)); err != nil {
+			return nil, err
+		}
+		p, q := c.jobPath(job)
+		var next Job
+		if err := c.do(ctx, http.MethodGet, p, q, nil, &next, true); err != nil {
+			return nil, err
+		}
+		job = &next
+	}
+	if job.Status.ErrorResult != nil {
+		return job, &JobError{JobID: job.JobReference.JobID, Result: *job.Status.ErrorResult, Errors: job.Status.Errors}
+	}
+	return job, nil
+}
+
+// results pages through the rows of a finished query job.
+func (c *Client) results(ctx context.Context, job *Job, row func([]*string) error) error {
+	path := "/bigquery/v2/projects/" + url.PathEscape(job.JobReference.ProjectID) + "/queries/" + url.PathEscape(job.JobReference.JobID)
+	token := ""
+	for {
+		q := url.Values{"formatOptions.useInt64Timestamp": {"true"}}
+		if job.JobReference.Location != "" {
+			q.Set("location", job.JobReference.Location)
+		}
+		if token != "" {
+			q.Set("pageToken", token)
+		}
+		var page struct {
+			JobComplete bool `json:"jobComplete"`
+			Rows        []struct {
+				F []struct {
+					V *string `json:"v"`
+				} `json:"f"`
+			} `json:"rows"`
+			PageToken string `json:"pageToken"`
+		}
+		if err := c.do(ctx, http.MethodGet, path, q, nil, &page, true); err != nil {
+			return err
+		}
+		if !page.JobComplete {
+			if err := retry.Sleep(ctx, time.Second); err != nil {
+				return err
+			}
+			continue
+		}
+		for _, r := range page.Rows {
+			vals := make([]*string, len(r.F))
+			for i, f := range r.F {
+				vals[i] = f.V
+			}
+			if err := row(vals); err != nil {
+				return err
+			}
+		}
+		if page.PageToken == "" {
+			return nil
+		}
+		token = page.PageToken
+	}
+}
+
+// APIError is an error answer of the API.
+type APIError struct {
+	StatusCode int
+	Reason     string // e.g. rateLimitExceeded
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("bigquery: %d %s: %s", e.StatusCode, e.Reason, e.Message)
+}
+
+func (e *APIError) Is(target error) bool {
+	return target == ErrNotFound && e.StatusCode == http.StatusNotFound
+}
+
+// quota tells whether the request was refused for a quota or rate limit,
+// in which case nothing was done and it is safe to retry.
+func (e *APIError) quota() bool {
+	switch e.Reason {
+	case "rateLimitExceeded", "quotaExceeded", "backendError":
+		return true
+	}
+	return e.StatusCode == http.StatusTooManyRequests
+}
+
+func apiError(resp *http.Response) *APIError {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	var e struct {
+		Error struct {
+			Message string `json:"message"`
+			Errors  []struct {
+				Reason string `json:"reason"`
+			} `json:"errors"`
+		} `json:"error"`
+	}
+	out := &APIError{StatusCode: resp.StatusCode, Reason: http.StatusText(resp.StatusCode)}
+	if json.Unmarshal(body, &e) != nil {
+		out.Message = strings.TrimSpace(string(body))
+		return out
+	}
+	out.Message = e.Error.Message
+	if len(e.Error.Errors) > 0 && e.Error.Errors[0].Reason != "" {
+		out.Reason = e.Error.Errors[0].Reason
+	}
+	return out
+}
+
+// do sends a JSON request and decodes the answer into out; googleauth.Do
+// retries quota refusals, and server errors and failed connections when the
+// request is idempotent.
+func (c *Client) do(ctx context.Context, method, path string, q url.Values, body, out interface{}, idempotent bool) error {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+	target := c.base.String() + path
+	if len(q) > 0 {
+		target += "?" + q.Encode()
+	}
+	resp, err := googleauth.Do(ctx, c.tokens, c.cfg.MaxRetries, idempotent, func() (*http.Response, error) {
+		var r io.Reader
+		if payload != nil {
+			r = bytes.NewReader(payload)
+		}
+		resp, err := c.send(ctx, method, target, r, "application/json", int64(len(payload)))
+		if err != nil {
+			return nil, fmt.Errorf("bigquery: %s %s: %w", method, path, err)
+		}
+		return resp, nil
+	}, func(resp *http.Response) (bool, error) {
+		e := apiError(resp)
+		return e.quota(), e
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if out == nil {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("bigquery: %s %s: decode: %w", method, path, err)
+	}
+	return nil
+}
+
+// send makes one authenticated request; size is the body's length, or -1
+// when unknown.
+func (c *Client) send(ctx context.Context, method, u string, body io.Reader, contentType string, size int64) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", contentType)
+		if size >= 0 {
+			req.ContentLength = size
+		}
+	}
+	switch {
+	case c.tokens != nil:
+		tok, err := c.tokens.Token(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("bigquery: %w", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+tok)
+	case c.cfg.AccessToken != "":
+		req.Header.Set("Authorization", "Bearer "+c.cfg.AccessToken)
+	}
+	return c.http.Do(req)
+}
@@ -0,0 +1,127 @@
+// Package checksum computes order-independent digests over row sets so a
+// source and a destination can be compared without sorting either side.
+package checksum
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math/bits"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Canonical renders a value the way every connector writes it, so the digest
+// of a pg table matches the digest of the CSV/Parquet file it was copied to.
+// NULL and the empty string canonicalize to the same value because CSV cannot
+// tell them apart.
+func Canonical(v interface{}) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return t
+	case []byte:
+		return string(t)
+	case time.Time:
+		return t.UTC().Format(time.RFC3339Nano)
+	case bool:
+		return strconv.FormatBool(t)
+	case int:
+		return strconv.Itoa(t)
+	case int32:
+		return strconv.FormatInt(int64(t), 10)
+	case int64:
+		return strconv.FormatInt(t, 10)
+	case float32:
+		return strconv.FormatFloat(float64(t), 'f', -1, 32)
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	default:
+		return fmt.Sprint(t)
+	}
+}
+
+// Digest is an order-independent aggregate: the sum mod 2^256 of the SHA-256
+// of every row. Adding the same rows in any order yields the same Sum.
+type Digest struct {
+	acc  [4]uint64
+	rows int64
+}
+
+// Add folds one row into the digest. Column order does not matter; names are
+// part of the hash so swapped values in two columns are detected.
+func (d *Digest) Add(row map[string]interface{}) {
+	d.addHash(RowHash(row))
+}
+
+// AddStrings folds a positional row, as read back from a CSV file.
+func (d *Digest) AddStrings(cols, vals []string) {
+	row := make(map[string]interface{}, len(cols))
+	for i, c := range cols {
+		if i < len(vals) {
+			row[c] = vals[i]
+		} else {
+			row[c] = nil
+		}
+	}
+	d.Add(row)
+}
+
+func (d *Digest) addHash(h [32]byte) {
+	var carry uint64
+	for i := 3; i >= 0; i-- {
+		d.acc[i], carry = bits.Add64(d.acc[i], binary.BigEndian.Uint64(h[i*8:]), carry)
+	}
+	d.rows++
+}
+
+// Merge folds every row of o into d, as if they had been added one by one.
+func (d *Digest) Merge(o *Digest) {
+	var carry uint64
+	for i := 3; i >= 0; i-- {
+		d.acc[i], carry = bits.Add64(d.acc[i], o.acc[i], carry)
+	}
+	d.rows += o.rows
+}
+
+func (d *Digest) Rows() int64 { return d.rows }
+
+// Sum returns the digest as 64 hex characters, matching sync_run.checksum.
+func (d *Digest) Sum() string {
+	var b [32]byte
+	for i, v := range d.acc {
+		binary.BigEndian.PutUint64(b[i*8:], v)
+	}
+	return hex.EncodeToString(b[:])
+}
+
+// RowHash hashes one row in canonical form.
+func RowHash(row map[string]interface{}) [32]byte {
+	names := make([]string, 0, len(row))
+	for k := range row {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	h := sha256.New()
+	for _, k := range names {
+		h.Write([]byte(k))
+		h.Write([]byte{0x1f})
+		h.Write([]byte(Canonical(row[k])))
+		h.Write([]byte{0x1e})
+	}
+	var out [32]byte
+	copy(out[:], h.Sum(nil))
+	return out
+}
+
+// Rows digests a whole slice in one call.
+func Rows(rows []map[string]interface{}) string {
+	var d Digest
+	for _, r := range rows {
+		d.Add(r)
+	}
+	return d.Sum()
+}
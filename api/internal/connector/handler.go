@@ -1,10 +1,13 @@
 package connector
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"net/http"
 
 	"github.com/Zubimendi/sync-loop/api/internal/middleware"
+	"github.com/go-chi/chi/v5"
 )
 
 type Handler struct {
@@ -44,4 +47,39 @@ func (h *Handler) Create(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	json.NewEncoder(w).Encode(c)
-}
\ No newline at end of file
+}
+
+// POST /api/v1/connectors/{id}/test – try to connect and report the failing
+// stage (config, egress, tls or connect)
+func (h *Handler) Test(w http.ResponseWriter, r *http.Request) {
+	wid := r.Context().Value(middleware.CtxWorkspaceID).(string)
+	res, err := h.svc.Test(r.Context(), chi.URLParam(r, "id"), wid)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "connector not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(res)
+}
+
+// GET /api/v1/connectors/{id}/tables – the tables a job can copy, e.g. the
+// queryable objects of a Salesforce org
+func (h *Handler) Tables(w http.ResponseWriter, r *http.Request) {
+	wid := r.Context().Value(middleware.CtxWorkspaceID).(string)
+	tables, err := h.svc.Tables(r.Context(), chi.URLParam(r, "id"), wid)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		http.Error(w, "connector not found", http.StatusNotFound)
+		return
+	case errors.Is(err, ErrNoCatalog):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"tables": tables})
+}
@@ -2,6 +2,7 @@ package connector
 
 import (
 	"context"
+	"database/sql"
 
 	"github.com/jmoiron/sqlx"
 	"github.com/Zubimendi/sync-loop/api/internal/model"
@@ -25,7 +26,39 @@ func (r *Repo) Create(ctx context.Context, c *model.Connector) error {
 func (r *Repo) ListByWorkspace(ctx context.Context, workspaceID string) ([]model.Connector, error) {
 	cc := make([]model.Connector, 0) // non-nil empty slice
 	err := r.db.SelectContext(ctx, &cc,
-		`SELECT id,name,type,created_at,updated_at FROM connector WHERE workspace_id=$1`,
+		`SELECT id,name,type,status,created_at,updated_at FROM connector WHERE workspace_id=$1`,
 		workspaceID)
 	return cc, err
-}
\ No newline at end of file
+}
+// Get loads a connector including its still-encrypted config.
+func (r *Repo) Get(ctx context.Context, id string) (*model.Connector, error) {
+	var c model.Connector
+	err := r.db.GetContext(ctx, &c,
+		`SELECT id,name,type,config_json #>> '{}' AS config_json,created_by_user_id,workspace_id,status,created_at,updated_at
+		 FROM connector WHERE id=$1`, id)
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// UpdateConfig replaces a connector's encrypted config.
+func (r *Repo) UpdateConfig(ctx context.Context, id, workspaceID, config string) error {
+	res, err := r.db.ExecContext(ctx, `
+		UPDATE connector SET config_json = to_jsonb($3::text), updated_at = now()
+		WHERE id = $1 AND workspace_id = $2`, id, workspaceID, config)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// SetStatus marks a connector active or as needing reauthorization.
+func (r *Repo) SetStatus(ctx context.Context, id, status string) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE connector SET status = $2, updated_at = now() WHERE id = $1`, id, status)
+	return err
+}
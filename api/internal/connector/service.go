@@ -3,13 +3,25 @@ package connector
 import (
 	"context"
 	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"database/sql"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net"
+	"time"
 
+	"github.com/Zubimendi/sync-loop/api/internal/bigquery"
+	"github.com/Zubimendi/sync-loop/api/internal/egress"
 	"github.com/Zubimendi/sync-loop/api/internal/encrypt"
+	"github.com/Zubimendi/sync-loop/api/internal/kafka"
 	"github.com/Zubimendi/sync-loop/api/internal/model"
+	"github.com/Zubimendi/sync-loop/api/internal/source"
+	"github.com/Zubimendi/sync-loop/api/internal/webhook"
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
 )
 
 type Service struct {
@@ -20,20 +32,18 @@ func NewService(repo *Repo) *Service { return &Service{repo: repo} }
 
 var hardCodedTypes = map[string]bool{
 	"pg": true, "mysql": true, "s3": true, "excel": true,
-	"gsheets": true, "sf": true, "rest": true,
+	"gsheets": true, "sf": true, "rest": true, "upload": true,
+	"bq": true, "sftp": true, "file": true, "webhook": true,
+	"kafka": true,
 }
 
 func (s *Service) CreateSource(ctx context.Context, name, ctype string, config map[string]interface{}, userID, workspaceID string) (*model.Connector, error) {
 	if !hardCodedTypes[ctype] {
 		return nil, errors.New("unsupported connector type")
 	}
-	plain, err := json.Marshal(config)
+	cipher, err := sealConfig(config)
 	if err != nil {
-		return nil, fmt.Errorf("marshal config: %w", err)
-	}
-	cipher, err := encrypt.Encrypt(string(plain))
-	if err != nil {
-		return nil, fmt.Errorf("encrypt config: %w", err)
+		return nil, err
 	}
 	c := &model.Connector{
 		ID:        hex.EncodeToString(randBytes(16)),
@@ -42,6 +52,7 @@ func (s *Service) CreateSource(ctx context.Context, name, ctype string, config m
 		Config:    cipher,
 		CreatedBy: userID,
 		Workspace: workspaceID,
+		Status:    "active",
 	}
 	if err := s.repo.Create(ctx, c); err != nil {
 		return nil, fmt.Errorf("create connector: %w", err)
@@ -52,4 +63,206 @@ func (s *Service) ListSources(ctx context.Context, workspaceID string) ([]model.
 	return s.repo.ListByWorkspace(ctx, workspaceID)
 }
 
-func randBytes(n int) []byte { b := make([]byte, n); rand.Read(b); return b }
\ No newline at end of file
+func randBytes(n int) []byte { b := make([]byte, n); rand.Read(b); return b }
+// Config returns a connector with its decrypted config map.
+func (s *Service) Config(ctx context.Context, id string) (*model.Connector, map[string]interface{}, error) {
+	c, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return nil, nil, fmt.Errorf("get connector: %w", err)
+	}
+	plain, err := encrypt.Decrypt(c.Config)
+	if err != nil {
+		return nil, nil, fmt.Errorf("decrypt config: %w", err)
+	}
+	cfg := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(plain), &cfg); err != nil {
+		return nil, nil, fmt.Errorf("unmarshal config: %w", err)
+	}
+	return c, cfg, nil
+}
+
+// UpdateConfig replaces the config of a connector in the workspace.
+func (s *Service) UpdateConfig(ctx context.Context, id, workspaceID string, config map[string]interface{}) error {
+	cipher, err := sealConfig(config)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.UpdateConfig(ctx, id, workspaceID, cipher); err != nil {
+		return fmt.Errorf("update connector: %w", err)
+	}
+	return nil
+}
+
+func sealConfig(config map[string]interface{}) (string, error) {
+	plain, err := json.Marshal(config)
+	if err != nil {
+		return "", fmt.Errorf("marshal config: %w", err)
+	}
+	cipher, err := encrypt.Encrypt(string(plain))
+	if err != nil {
+		return "", fmt.Errorf("encrypt config: %w", err)
+	}
+	return cipher, nil
+}
+
+// TestResult is the outcome of a connection test. Stage names the step that
+// failed: config, egress, tls or connect.
+type TestResult struct {
+	OK    bool   `json:"ok"`
+	Stage string `json:"stage,omitempty"`
+	Error string `json:"error,omitempty"`
+	Hint  string `json:"hint,omitempty"`
+}
+
+const testTimeout = 20 * time.Second
+
+// Test connects to a connector's system the way a run would, under the
+// workspace's egress policy, and reports why it could not.
+func (s *Service) Test(ctx context.Context, id, workspaceID string) (*TestResult, error) {
+	c, cfg, err := s.Config(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if c.Workspace != workspaceID {
+		return nil, sql.ErrNoRows
+	}
+	if c.Type == "upload" {
+		return &TestResult{OK: true}, nil
+	}
+	ctx, err = s.withPolicy(ctx, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, testTimeout)
+	defer cancel()
+	switch c.Type {
+	case "bq":
+		err = pingBigQuery(ctx, cfg)
+	case "webhook":
+		err = pingWebhook(ctx, cfg)
+	case "kafka":
+		err = pingKafka(ctx, cfg)
+	default:
+		var src source.Source
+		if src, err = source.Open(ctx, c.Type, cfg); err == nil {
+			src.Close()
+		}
+	}
+	if err != nil {
+		stage, hint := testStage(err)
+		return &TestResult{Stage: stage, Error: err.Error(), Hint: hint}, nil
+	}
+	return &TestResult{OK: true}, nil
+}
+
+// pingBigQuery reaches the project of a bq connector, which only loads
+// destinations and has no source to open.
+func pingBigQuery(ctx context.Context, cfg map[string]interface{}) error {
+	bc, err := bigquery.ConfigFrom(cfg)
+	if err != nil {
+		return err
+	}
+	client, err := bigquery.New(bc, egress.FromContext(ctx).Transport())
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	return client.Ping(ctx)
+}
+
+// pingWebhook only connects to the host of a webhook connector, which
+// loads destinations; a test request could be taken for a delivery.
+func pingWebhook(ctx context.Context, cfg map[string]interface{}) error {
+	wc, err := webhook.ConfigFrom(cfg)
+	if err != nil {
+		return err
+	}
+	return webhook.Reachable(ctx, wc, egress.FromContext(ctx).DialContext)
+}
+
+// pingKafka asks a broker of a kafka connector for the cluster's metadata
+// and lists the subjects of its schema registry, if it has one. Opening
+// the source alone would not connect.
+func pingKafka(ctx context.Context, cfg map[string]interface{}) error {
+	kc, err := kafka.ConfigFrom(cfg)
+	if err != nil {
+		return err
+	}
+	p := egress.FromContext(ctx)
+	reg := kafka.NewRegistry(kc, p.Transport())
+	if reg != nil {
+		defer reg.Close()
+	}
+	return kafka.Ping(ctx, kc, p.DialContext, reg)
+}
+
+// ErrNoCatalog means a connector's source cannot list its tables.
+var ErrNoCatalog = errors.New("this connector type cannot list its tables")
+
+// Tables lists the tables of a connector's system, such as the objects of a
+// Salesforce org.
+func (s *Service) Tables(ctx context.Context, id, workspaceID string) ([]string, error) {
+	c, cfg, err := s.Config(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if c.Workspace != workspaceID {
+		return nil, sql.ErrNoRows
+	}
+	ctx, err = s.withPolicy(ctx, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	src, err := source.Open(ctx, c.Type, cfg)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+	cat, ok := src.(source.Catalog)
+	if !ok {
+		return nil, ErrNoCatalog
+	}
+	return cat.Tables(ctx)
+}
+
+func (s *Service) withPolicy(ctx context.Context, workspaceID string) (context.Context, error) {
+	policy, err := egress.NewRepo(s.repo.db).Policy(ctx, workspaceID)
+	if err != nil {
+		return nil, fmt.Errorf("egress policy: %w", err)
+	}
+	return egress.NewContext(ctx, policy), nil
+}
+
+// testStage tells TLS handshake and verification failures, egress refusals
+// and bad settings apart from other connection errors.
+func testStage(err error) (stage, hint string) {
+	var (
+		unknownCA x509.UnknownAuthorityError
+		hostname  x509.HostnameError
+		invalid   x509.CertificateInvalidError
+		header    tls.RecordHeaderError
+		remote    *net.OpError
+		verify    *tls.CertificateVerificationError
+	)
+	switch {
+	case errors.Is(err, source.ErrTLSConfig):
+		return "config", "check sslmode, ssl_root_cert, ssl_cert and ssl_key"
+	case errors.Is(err, egress.ErrBlocked):
+		return "egress", "a workspace admin can allow the address under egress settings"
+	case errors.Is(err, pq.ErrSSLNotSupported), errors.Is(err, mysql.ErrNoTLS):
+		return "tls", "the server does not accept TLS; use sslmode prefer or disable"
+	case errors.As(err, &unknownCA):
+		return "tls", "the server certificate is not signed by a trusted CA; set ssl_root_cert to its CA bundle"
+	case errors.As(err, &hostname):
+		return "tls", fmt.Sprintf("the server certificate is not valid for %s; connect by a name it lists, set ssl_server_name, or use sslmode verify-ca", hostname.Host)
+	case errors.As(err, &invalid):
+		return "tls", "the server certificate is not usable: " + invalid.Error()
+	case errors.As(err, &header):
+		return "tls", "the server did not answer with TLS"
+	case errors.As(err, &remote) && remote.Op == "remote error":
+		return "tls", "the server rejected the handshake; check that ssl_cert is a client certificate it trusts"
+	case errors.As(err, &verify):
+		return "tls", "the server certificate failed verification"
+	}
+	return "connect", ""
+}
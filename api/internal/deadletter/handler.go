@@ -0,0 +1,149 @@
+package deadletter
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/Zubimendi/sync-loop/api/internal/middleware"
+	"github.com/Zubimendi/sync-loop/api/internal/model"
+	"github.com/Zubimendi/sync-loop/api/internal/run"
+	"github.com/Zubimendi/sync-loop/api/internal/storage"
+	"github.com/Zubimendi/sync-loop/api/internal/workflow"
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
+	"go.temporal.io/sdk/client"
+)
+
+type Handler struct {
+	repo     *Repo
+	runs     *run.Repo
+	temporal client.Client
+}
+
+func NewHandler(repo *Repo, runs *run.Repo, temporal client.Client) *Handler {
+	return &Handler{repo: repo, runs: runs, temporal: temporal}
+}
+
+// GET /api/v1/runs/{id}/dead-letters
+func (h *Handler) List(w http.ResponseWriter, r *http.Request) {
+	wid := r.Context().Value(middleware.CtxWorkspaceID).(string)
+	dd, err := h.repo.ListByRun(r.Context(), chi.URLParam(r, "id"), wid)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"dead_letters": dd})
+}
+
+// GET /api/v1/runs/{id}/dead-letters/download?stage=transform – NDJSON of
+// the rejected rows, all stages unless one is given
+func (h *Handler) Download(w http.ResponseWriter, r *http.Request) {
+	wid := r.Context().Value(middleware.CtxWorkspaceID).(string)
+	runID := chi.URLParam(r, "id")
+	dd, err := h.repo.ListByRun(r.Context(), runID, wid)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	dd = filterStage(dd, r.URL.Query().Get("stage"))
+	if len(dd) == 0 {
+		http.Error(w, "no dead letters for this run", http.StatusNotFound)
+		return
+	}
+	store, err := storage.FromEnv(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", runID+"-dead-letters.ndjson"))
+	for _, d := range dd {
+		body, err := store.Get(r.Context(), d.ObjectKey)
+		if err != nil {
+			log.Error().Err(err).Str("key", d.ObjectKey).Msg("dead letter download")
+			return
+		}
+		_, err = io.Copy(w, body)
+		body.Close()
+		if err != nil {
+			return
+		}
+	}
+}
+
+// POST /api/v1/runs/{id}/dead-letters/replay?stage=transform – push the
+// rejected rows of one stage through the job again, e.g. after fixing its
+// mappings. Transform rejects are re-mapped; load rejects are only reloaded.
+func (h *Handler) Replay(w http.ResponseWriter, r *http.Request) {
+	wid := r.Context().Value(middleware.CtxWorkspaceID).(string)
+	stage := r.URL.Query().Get("stage")
+	if stage == "" {
+		stage = StageTransform
+	}
+	if stage != StageTransform && stage != StageLoad {
+		http.Error(w, "stage must be transform or load", http.StatusBadRequest)
+		return
+	}
+	sr, err := h.runs.GetRun(r.Context(), chi.URLParam(r, "id"), wid)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if sr == nil {
+		http.Error(w, "run not found", http.StatusNotFound)
+		return
+	}
+	dd, err := h.repo.ListByRun(r.Context(), sr.ID, wid)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(filterStage(dd, stage)) == 0 {
+		http.Error(w, "no dead letters for this stage", http.StatusNotFound)
+		return
+	}
+	job, err := h.runs.GetJob(r.Context(), sr.JobID, wid)
+	if err != nil || job == nil || job.Table == nil {
+		http.Error(w, "job of this run cannot be replayed", http.StatusConflict)
+		return
+	}
+	params := workflow.CopyTableParams{
+		Table:       *job.Table,
+		WorkspaceID: wid,
+		ReplayRunID: sr.ID,
+		ReplayStage: stage,
+	}
+	if job.ConnectorID != nil {
+		params.ConnectorID = *job.ConnectorID
+	}
+
+	we, err := h.temporal.ExecuteWorkflow(r.Context(), client.StartWorkflowOptions{
+		TaskQueue: "sync-loop-task-queue",
+		ID:        fmt.Sprintf("replay-%s-%s-%d", sr.ID, stage, time.Now().Unix()),
+	}, workflow.CopyTableWorkflow, params)
+	if err != nil {
+		log.Error().Err(err).Msg("execute replay workflow")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"workflow_id": we.GetID(),
+		"run_id":      we.GetRunID(),
+	})
+}
+
+func filterStage(dd []model.DeadLetter, stage string) []model.DeadLetter {
+	if stage == "" {
+		return dd
+	}
+	var out []model.DeadLetter
+	for _, d := range dd {
+		if d.Stage == stage {
+			out = append(out, d)
+		}
+	}
+	return out
+}
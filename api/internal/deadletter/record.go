@@ -0,0 +1,73 @@
+// Package deadletter keeps rows that failed transform or load out of the
+// run's way: they are written as NDJSON to the bucket, one object per run
+// and stage, together with the reason they were rejected.
+package deadletter
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+const (
+	StageTransform = "transform"
+	StageLoad      = "load"
+)
+
+type Record struct {
+	Stage string                 `json:"stage"`
+	Error string                 `json:"error"`
+	Row   map[string]interface{} `json:"row"`
+	At    time.Time              `json:"at"`
+}
+
+// Key is where the dead letters of one run and stage are stored.
+func Key(runID, stage string) string {
+	return fmt.Sprintf("sync-loop/dead-letters/%s/%s.ndjson", runID, stage)
+}
+
+// Buffer collects rejected rows of one stage in memory.
+type Buffer struct {
+	stage string
+	buf   bytes.Buffer
+	n     int64
+}
+
+func NewBuffer(stage string) *Buffer { return &Buffer{stage: stage} }
+
+func (b *Buffer) Add(row map[string]interface{}, cause error) error {
+	line, err := json.Marshal(Record{Stage: b.stage, Error: cause.Error(), Row: row, At: time.Now().UTC()})
+	if err != nil {
+		return err
+	}
+	b.buf.Write(line)
+	b.buf.WriteByte('\n')
+	b.n++
+	return nil
+}
+
+func (b *Buffer) Stage() string         { return b.stage }
+func (b *Buffer) Len() int64            { return b.n }
+func (b *Buffer) Reader() *bytes.Reader { return bytes.NewReader(b.buf.Bytes()) }
+
+// Read calls fn for every record of an NDJSON dead-letter stream.
+func Read(r io.Reader, fn func(Record) error) error {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for sc.Scan() {
+		if len(bytes.TrimSpace(sc.Bytes())) == 0 {
+			continue
+		}
+		var rec Record
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			return fmt.Errorf("decode dead letter: %w", err)
+		}
+		if err := fn(rec); err != nil {
+			return err
+		}
+	}
+	return sc.Err()
+}
@@ -0,0 +1,47 @@
+package deadletter
+
+import (
+	"context"
+
+	"github.com/Zubimendi/sync-loop/api/internal/model"
+	"github.com/jmoiron/sqlx"
+)
+
+type Repo struct {
+	db *sqlx.DB
+}
+
+func NewRepo(db *sqlx.DB) *Repo { return &Repo{db: db} }
+
+// Save records the dead-letter object of a run stage. Activity retries
+// rewrite the same object, so the row is upserted.
+func (r *Repo) Save(ctx context.Context, runID, stage, key string, rows int64) error {
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO dead_letter (run_id, stage, object_key, row_count)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (run_id, stage) DO UPDATE
+		SET object_key = EXCLUDED.object_key, row_count = EXCLUDED.row_count, created_at = now()`,
+		runID, stage, key, rows)
+	return err
+}
+
+func (r *Repo) ListByRun(ctx context.Context, runID, workspaceID string) ([]model.DeadLetter, error) {
+	dd := make([]model.DeadLetter, 0)
+	err := r.db.SelectContext(ctx, &dd, `
+		SELECT d.* FROM dead_letter d
+		JOIN sync_run sr ON sr.id = d.run_id
+		JOIN sync_job j ON j.id = sr.job_id
+		WHERE d.run_id = $1 AND j.workspace_id = $2
+		ORDER BY d.stage`, runID, workspaceID)
+	return dd, err
+}
+
+// Get loads one stage without workspace scoping, for the worker.
+func (r *Repo) Get(ctx context.Context, runID, stage string) (*model.DeadLetter, error) {
+	var d model.DeadLetter
+	if err := r.db.GetContext(ctx, &d, `
+		SELECT * FROM dead_letter WHERE run_id = $1 AND stage = $2`, runID, stage); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
@@ -0,0 +1,94 @@
+package destination
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/Zubimendi/sync-loop/api/internal/checksum"
+	"github.com/Zubimendi/sync-loop/api/internal/model"
+	"github.com/Zubimendi/sync-loop/api/internal/output"
+)
+
+// defaultBatchPath writes each run's file next to the table's earlier ones.
+const defaultBatchPath = "{table}/{table}-{run_id}"
+
+// batchFileConfig is the config of destinations that write each batch as
+// one file, sftp and file: path, where it goes under the connector's root,
+// as a template of the variables of output.Layout and without the
+// extension, and the format, compression and row_group_rows of a job's
+// output.
+type batchFileConfig struct {
+	Path   string
+	Output model.OutputOptions
+}
+
+func batchFileConfigFrom(typ string, c model.DestinationConfig) (batchFileConfig, error) {
+	s := func(k string) string {
+		v, _ := c[k].(string)
+		return v
+	}
+	bc := batchFileConfig{
+		Path:   s("path"),
+		Output: model.OutputOptions{Format: s("format"), Compression: s("compression")},
+	}
+	if n, ok := c["row_group_rows"].(float64); ok && n > 0 {
+		bc.Output.RowGroupRows = int64(n)
+	}
+	if bc.Path == "" {
+		bc.Path = defaultBatchPath
+	}
+	if _, err := output.New(bc.Output); err != nil {
+		return bc, fmt.Errorf("%s destination: %w", typ, err)
+	}
+	if _, err := output.Render(bc.Path, output.Vars{}); err != nil {
+		return bc, fmt.Errorf("%s destination: path: %w", typ, err)
+	}
+	return bc, nil
+}
+
+// batchFile is the format and key of a run's file.
+func (bc batchFileConfig) batchFile(vars output.Vars) (output.Format, string, error) {
+	format, err := output.New(bc.Output)
+	if err != nil {
+		return nil, "", err
+	}
+	key, err := output.Render(bc.Path, vars)
+	if err != nil {
+		return nil, "", err
+	}
+	return format, key + "." + format.Ext(), nil
+}
+
+// encodeBatch writes the rows in format, rejecting those it cannot hold,
+// and digests the accepted rows as the read-back will see them.
+func encodeBatch(format output.Format, cols []model.Column, rows []map[string]interface{}, reject func(map[string]interface{}, error) error) (*bytes.Buffer, *checksum.Digest, error) {
+	var buf bytes.Buffer
+	w, err := format.NewWriter(&buf, cols)
+	if err != nil {
+		return nil, nil, err
+	}
+	accepted := &checksum.Digest{}
+	for _, row := range rows {
+		err := w.Write(row)
+		var rowErr *output.RowError
+		if errors.As(err, &rowErr) {
+			if err := reject(row, err); err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("write row: %w", err)
+		}
+		kept := make(map[string]interface{}, len(cols))
+		for _, c := range cols {
+			kept[c.Name] = row[c.Name]
+		}
+		accepted.Add(kept)
+	}
+	if err := w.Close(); err != nil {
+		return nil, nil, fmt.Errorf("%s close: %w", format.Ext(), err)
+	}
+	return &buf, accepted, nil
+}
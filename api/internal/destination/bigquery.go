@@ -0,0 +1,726 @@
+package destination
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Zubimendi/sync-loop/api/internal/bigquery"
+	"github.com/Zubimendi/sync-loop/api/internal/checksum"
+	"github.com/Zubimendi/sync-loop/api/internal/egress"
+	"github.com/Zubimendi/sync-loop/api/internal/model"
+	"github.com/Zubimendi/sync-loop/api/internal/output"
+	"github.com/Zubimendi/sync-loop/api/internal/parquet"
+)
+
+// stagingLife is how long a staging table outlives a run that could not
+// drop it.
+const stagingLife = 24 * time.Hour
+
+// bqConfig is the config of a bq destination: dataset and table (in the
+// connector's project unless project is set), mode and, for merge,
+// key_column. format is how a batch is staged, ndjson or parquet.
+// partition_field, partition_type and clustering_fields shape the table
+// when the destination creates it.
+type bqConfig struct {
+	Project string
+	Dataset string
+	Table   string
+	// Mode is append (add the batch), truncate (replace the table with the
+	// batch) or merge (update rows by key_column, insert the rest).
+	Mode           string
+	KeyColumn      string
+	Format         string
+	PartitionField string
+	PartitionType  string
+	Clustering     []string
+}
+
+func bqConfigFrom(c model.DestinationConfig) (bqConfig, error) {
+	s := func(k string) string {
+		v, _ := c[k].(string)
+		return v
+	}
+	bc := bqConfig{
+		Project:        s("project"),
+		Dataset:        s("dataset"),
+		Table:          s("table"),
+		Mode:           s("mode"),
+		KeyColumn:      s("key_column"),
+		Format:         s("format"),
+		PartitionField: s("partition_field"),
+		PartitionType:  strings.ToUpper(s("partition_type")),
+	}
+	if bc.Mode == "" {
+		bc.Mode = "append"
+	}
+	if bc.Format == "" {
+		bc.Format = "ndjson"
+	}
+	if bc.PartitionType == "" && bc.PartitionField != "" {
+		bc.PartitionType = "DAY"
+	}
+	fields, _ := c["clustering_fields"].([]interface{})
+	for _, f := range fields {
+		if name, ok := f.(string); ok && name != "" {
+			bc.Clustering = append(bc.Clustering, name)
+		}
+	}
+	switch {
+	case bc.Dataset == "" || bc.Table == "":
+		return bc, errors.New("bq destination: dataset and table are required")
+	case bc.Mode != "append" && bc.Mode != "truncate" && bc.Mode != "merge":
+		return bc, fmt.Errorf("bq destination: mode %q is not append, truncate or merge", bc.Mode)
+	case bc.Mode == "merge" && bc.KeyColumn == "":
+		return bc, errors.New("bq destination: merge needs a key_column")
+	case bc.Format != "ndjson" && bc.Format != "parquet":
+		return bc, fmt.Errorf("bq destination: format %q is not ndjson or parquet", bc.Format)
+	case bc.PartitionType != "" && !strings.Contains(" DAY HOUR MONTH YEAR ", " "+bc.PartitionType+" "):
+		return bc, fmt.Errorf("bq destination: partition_type %q is not DAY, HOUR, MONTH or YEAR", bc.PartitionType)
+	case len(bc.Clustering) > 4:
+		return bc, errors.New("bq destination: at most 4 clustering_fields")
+	}
+	return bc, nil
+}
+
+type bq struct {
+	client *bigquery.Client
+	cfg    bqConfig
+}
+
+func openBigQuery(ctx context.Context, d *model.Destination, connCfg map[string]interface{}) (*bq, error) {
+	bc, err := bqConfigFrom(d.Config)
+	if err != nil {
+		return nil, err
+	}
+	cc, err := bigquery.ConfigFrom(connCfg)
+	if err != nil {
+		return nil, err
+	}
+	client, err := bigquery.New(cc, egress.FromContext(ctx).Transport())
+	if err != nil {
+		return nil, err
+	}
+	if bc.Project == "" {
+		bc.Project = client.Project()
+	}
+	return &bq{client: client, cfg: bc}, nil
+}
+
+func (b *bq) Close() error {
+	b.client.Close()
+	return nil
+}
+
+// Write stages the batch as a file and loads it with a load job: straight
+// into the table for truncate, into a staging table next to it for append
+// and merge, which a query then copies or merges in. The table is created
+// from the batch's columns when missing and gets the columns it lacks.
+func (b *bq) Write(ctx context.Context, cols []model.Column, rows []map[string]interface{}, reject func(map[string]interface{}, error) error) (*checksum.Digest, *checksum.Digest, error) {
+	bcols := make([]bqColumn, len(cols))
+	key := -1
+	for i, c := range cols {
+		bcols[i] = bqColumnOf(c)
+		if c.Name == b.cfg.KeyColumn {
+			key = i
+		}
+	}
+	if b.cfg.Mode == "merge" && key < 0 {
+		return nil, nil, fmt.Errorf("bq destination: key column %s is not in the batch", b.cfg.KeyColumn)
+	}
+	if b.cfg.Mode != "merge" {
+		key = -1
+	}
+	vals, accepted, err := b.admit(bcols, key, rows, reject)
+	if err != nil {
+		return nil, nil, err
+	}
+	target := bigquery.TableRef{ProjectID: b.cfg.Project, DatasetID: b.cfg.Dataset, TableID: b.cfg.Table}
+	if err := b.prepare(ctx, target, bcols); err != nil {
+		return nil, nil, err
+	}
+
+	names := make([]string, len(bcols))
+	for i, c := range bcols {
+		names[i] = bigquery.Quote(c.field.Name)
+	}
+	list := strings.Join(names, ", ")
+	if len(vals) == 0 {
+		if b.cfg.Mode == "truncate" {
+			if _, err := b.client.Query(ctx, "TRUNCATE TABLE "+target.SQL(), nil); err != nil {
+				return nil, nil, err
+			}
+		}
+		return &checksum.Digest{}, accepted, nil
+	}
+	if b.cfg.Mode == "truncate" {
+		if err := b.load(ctx, target, bcols, vals, "WRITE_TRUNCATE"); err != nil {
+			return nil, nil, err
+		}
+		written, err := b.readBack(ctx, "SELECT "+list+" FROM "+target.SQL(), bcols)
+		return written, accepted, err
+	}
+
+	staging := target
+	staging.TableID = target.TableID + "_syncloop_" + randomHex(6)
+	fields := make([]bigquery.Field, len(bcols))
+	for i, c := range bcols {
+		fields[i] = c.field
+	}
+	err = b.client.CreateTable(ctx, &bigquery.Table{
+		TableReference: staging,
+		Schema:         &bigquery.Schema{Fields: fields},
+		ExpirationTime: strconv.FormatInt(time.Now().Add(stagingLife).UnixMilli(), 10),
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("bq destination: staging table: %w", err)
+	}
+	defer b.client.DeleteTable(context.WithoutCancel(ctx), staging)
+	if err := b.load(ctx, staging, bcols, vals, "WRITE_TRUNCATE"); err != nil {
+		return nil, nil, err
+	}
+
+	if b.cfg.Mode == "append" {
+		written, err := b.readBack(ctx, "SELECT "+list+" FROM "+staging.SQL(), bcols)
+		if err != nil {
+			return nil, nil, err
+		}
+		job, err := b.client.Query(ctx, "INSERT INTO "+target.SQL()+" ("+list+") SELECT "+list+" FROM "+staging.SQL(), nil)
+		if err != nil {
+			return nil, nil, err
+		}
+		if n := job.AffectedRows(); n != written.Rows() {
+			return nil, nil, fmt.Errorf("bq destination: inserted %d rows of %d staged", n, written.Rows())
+		}
+		return written, accepted, nil
+	}
+
+	k := names[key]
+	var set, from []string
+	for i, n := range names {
+		from = append(from, "S."+n)
+		if i != key {
+			set = append(set, "T."+n+" = S."+n)
+		}
+	}
+	merge := "MERGE " + target.SQL() + " T USING " + staging.SQL() + " S ON T." + k + " = S." + k
+	if len(set) > 0 {
+		merge += " WHEN MATCHED THEN UPDATE SET " + strings.Join(set, ", ")
+	}
+	merge += " WHEN NOT MATCHED THEN INSERT (" + list + ") VALUES (" + strings.Join(from, ", ") + ")"
+	if _, err := b.client.Query(ctx, merge, nil); err != nil {
+		return nil, nil, err
+	}
+	written, err := b.readBack(ctx, "SELECT "+list+" FROM "+target.SQL()+" WHERE "+k+" IN (SELECT "+k+" FROM "+staging.SQL()+")", bcols)
+	return written, accepted, err
+}
+
+// prepare creates the table when it is missing and adds the batch's columns
+// it lacks. A column it has with another type fails the load.
+func (b *bq) prepare(ctx context.Context, ref bigquery.TableRef, cols []bqColumn) error {
+	t, err := b.client.GetTable(ctx, ref)
+	if errors.Is(err, bigquery.ErrNotFound) {
+		nt := &bigquery.Table{TableReference: ref, Schema: &bigquery.Schema{}}
+		for _, c := range cols {
+			nt.Schema.Fields = append(nt.Schema.Fields, c.field)
+		}
+		if b.cfg.PartitionType != "" {
+			nt.TimePartitioning = &bigquery.TimePartitioning{Type: b.cfg.PartitionType, Field: b.cfg.PartitionField}
+		}
+		if len(b.cfg.Clustering) > 0 {
+			nt.Clustering = &bigquery.Clustering{Fields: b.cfg.Clustering}
+		}
+		if err := b.client.CreateTable(ctx, nt); err != nil {
+			return fmt.Errorf("bq destination: create table %s: %w", ref.TableID, err)
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	have := map[string]string{}
+	if t.Schema != nil {
+		for _, f := range t.Schema.Fields {
+			have[strings.ToLower(f.Name)] = legacyType(f.Type)
+		}
+	}
+	var add []bigquery.Field
+	for _, c := range cols {
+		typ, ok := have[strings.ToLower(c.field.Name)]
+		switch {
+		case !ok:
+			add = append(add, c.field)
+		case typ != c.field.Type:
+			return fmt.Errorf("bq destination: column %s is %s in the table, %s in the batch", c.field.Name, typ, c.field.Type)
+		}
+	}
+	if len(add) == 0 {
+		return nil
+	}
+	return b.client.AddFields(ctx, ref, add)
+}
+
+// legacyType names a field type the way the API answers with it.
+func legacyType(t string) string {
+	switch t = strings.ToUpper(t); t {
+	case "INT64":
+		return "INTEGER"
+	case "FLOAT64":
+		return "FLOAT"
+	case "BOOL":
+		return "BOOLEAN"
+	}
+	return t
+}
+
+// load stages the values in a temporary file and runs a load job with it.
+func (b *bq) load(ctx context.Context, ref bigquery.TableRef, cols []bqColumn, vals [][]interface{}, disposition string) error {
+	f, err := os.CreateTemp("", "syncloop-bq-*."+b.cfg.Format)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	load := bigquery.Load{
+		DestinationTable:  ref,
+		WriteDisposition:  disposition,
+		CreateDisposition: "CREATE_NEVER",
+	}
+	if b.cfg.Format == "parquet" {
+		load.SourceFormat = "PARQUET"
+		err = stageParquet(f, cols, vals)
+	} else {
+		load.SourceFormat = "NEWLINE_DELIMITED_JSON"
+		load.Schema = &bigquery.Schema{}
+		for _, c := range cols {
+			load.Schema.Fields = append(load.Schema.Fields, c.field)
+		}
+		err = stageNDJSON(f, cols, vals)
+	}
+	if err != nil {
+		return fmt.Errorf("bq destination: stage: %w", err)
+	}
+	size, err := f.Seek(0, 1)
+	if err == nil {
+		_, err = f.Seek(0, 0)
+	}
+	if err != nil {
+		return err
+	}
+	job, err := b.client.LoadFrom(ctx, load, f, size)
+	if err != nil {
+		return err
+	}
+	if n := job.OutputRows(); n != int64(len(vals)) {
+		return fmt.Errorf("bq destination: load job wrote %d rows of %d", n, len(vals))
+	}
+	return nil
+}
+
+// admit converts rows to the values of their columns, rejecting those that
+// do not convert and, for merges, those without a key. Of rows repeating a
+// key the last one wins, as a merge takes one source row per key.
+func (b *bq) admit(cols []bqColumn, key int, rows []map[string]interface{}, reject func(map[string]interface{}, error) error) ([][]interface{}, *checksum.Digest, error) {
+	var (
+		out  [][]interface{}
+		src  []map[string]interface{}
+		seen = map[string]int{}
+	)
+	for _, row := range rows {
+		vals, err := bqValues(cols, row)
+		if err == nil && key >= 0 && vals[key] == nil {
+			err = &output.RowError{Column: cols[key].field.Name, Err: errors.New("key is empty")}
+		}
+		if err != nil {
+			if err := reject(row, err); err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+		if key >= 0 {
+			k := cols[key].canonical(vals[key])
+			if i, ok := seen[k]; ok {
+				if err := reject(src[i], &output.RowError{Column: cols[key].field.Name, Err: errors.New("a later row has the same key")}); err != nil {
+					return nil, nil, err
+				}
+				out[i], src[i] = vals, row
+				continue
+			}
+			seen[k] = len(out)
+		}
+		out, src = append(out, vals), append(src, row)
+	}
+	accepted := &checksum.Digest{}
+	for _, vals := range out {
+		accepted.Add(bqRow(cols, vals))
+	}
+	return out, accepted, nil
+}
+
+func bqValues(cols []bqColumn, row map[string]interface{}) ([]interface{}, error) {
+	vals := make([]interface{}, len(cols))
+	for i, c := range cols {
+		v, err := c.parse(row[c.field.Name])
+		if err != nil {
+			return nil, &output.RowError{Column: c.field.Name, Err: err}
+		}
+		vals[i] = v
+	}
+	return vals, nil
+}
+
+func bqRow(cols []bqColumn, vals []interface{}) map[string]interface{} {
+	row := make(map[string]interface{}, len(cols))
+	for i, c := range cols {
+		row[c.field.Name] = nil
+		if vals[i] != nil {
+			row[c.field.Name] = c.canonical(vals[i])
+		}
+	}
+	return row
+}
+
+// readBack digests the rows of a query, in column order.
+func (b *bq) readBack(ctx context.Context, query string, cols []bqColumn) (*checksum.Digest, error) {
+	d := &checksum.Digest{}
+	vals := make([]interface{}, len(cols))
+	_, err := b.client.Query(ctx, query, func(row []*string) error {
+		if len(row) != len(cols) {
+			return fmt.Errorf("read back %d values, want %d", len(row), len(cols))
+		}
+		for i, c := range cols {
+			v, err := c.fromAPI(row[i])
+			if err != nil {
+				return fmt.Errorf("column %s: %w", c.field.Name, err)
+			}
+			vals[i] = v
+		}
+		d.Add(bqRow(cols, vals))
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("bq destination: read back: %w", err)
+	}
+	return d, nil
+}
+
+// bqColumn is a source column as a BigQuery field.
+type bqColumn struct {
+	field     bigquery.Field
+	precision int
+	scale     int
+}
+
+// bqColumnOf maps a source column type onto a field type. Numerics without
+// a precision, json and anything not recognised are STRING, so no digit or
+// byte is lost; dates and timestamps keep microseconds, as BigQuery does.
+func bqColumnOf(c model.Column) bqColumn {
+	bc := bqColumn{field: bigquery.Field{Name: c.Name, Type: "STRING", Mode: "NULLABLE"}}
+	t := strings.ToLower(c.Type)
+	if i := strings.IndexByte(t, '('); i >= 0 {
+		t = strings.TrimSpace(t[:i])
+	}
+	switch t {
+	case "smallint", "int2", "integer", "int", "int4", "bigint", "int8":
+		bc.field.Type = "INTEGER"
+	case "double precision", "float8", "real", "float4", "float", "double":
+		bc.field.Type = "FLOAT"
+	case "boolean", "bool":
+		bc.field.Type = "BOOLEAN"
+	case "date":
+		bc.field.Type = "DATE"
+	case "timestamp with time zone", "timestamptz":
+		bc.field.Type = "TIMESTAMP"
+	case "timestamp without time zone", "timestamp":
+		bc.field.Type = "DATETIME"
+	case "numeric", "decimal":
+		p, s := c.Precision, c.Scale
+		switch {
+		case p <= 0:
+			return bc
+		case s <= 9 && p-s <= 29:
+			bc.field.Type = "NUMERIC"
+		case s <= 38 && p-s <= 38:
+			bc.field.Type = "BIGNUMERIC"
+		default:
+			return bc
+		}
+		bc.precision, bc.scale = p, s
+		// Parameterized types need a digit before the point.
+		if p > s {
+			bc.field.Precision, bc.field.Scale = strconv.Itoa(p), strconv.Itoa(s)
+		}
+	}
+	return bc
+}
+
+// parse converts a canonical source value to the column's value: int64,
+// float64, bool, *big.Rat, time.Time in UTC cut to the microsecond, or
+// string. Empty strings in typed columns are NULL, mirroring
+// checksum.Canonical.
+func (c bqColumn) parse(v interface{}) (interface{}, error) {
+	if v == nil {
+		return nil, nil
+	}
+	s := checksum.Canonical(v)
+	if c.field.Type == "STRING" {
+		if !utf8.ValidString(s) {
+			return nil, errors.New("invalid UTF-8")
+		}
+		return s, nil
+	}
+	if s == "" {
+		return nil, nil
+	}
+	switch c.field.Type {
+	case "INTEGER":
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("not an integer: %q", s)
+		}
+		return n, nil
+	case "FLOAT":
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, fmt.Errorf("not a number: %q", s)
+		}
+		return f, nil
+	case "BOOLEAN":
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return nil, fmt.Errorf("not a boolean: %q", s)
+		}
+		return b, nil
+	case "NUMERIC", "BIGNUMERIC":
+		r, ok := new(big.Rat).SetString(s)
+		if !ok {
+			return nil, fmt.Errorf("not a decimal: %q", s)
+		}
+		scaled := new(big.Rat).Mul(r, new(big.Rat).SetInt(pow10(c.scale)))
+		if !scaled.IsInt() {
+			return nil, fmt.Errorf("%s has more than %d decimals", s, c.scale)
+		}
+		if new(big.Int).Abs(scaled.Num()).Cmp(pow10(c.precision)) >= 0 {
+			return nil, fmt.Errorf("%s does not fit numeric(%d,%d)", s, c.precision, c.scale)
+		}
+		return r, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		t, err = time.Parse("2006-01-02T15:04:05.999999999", s)
+	}
+	if err != nil {
+		t, err = time.Parse("2006-01-02", s)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("not a timestamp: %q", s)
+	}
+	t = t.UTC()
+	if c.field.Type == "DATE" {
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC), nil
+	}
+	return t.Truncate(time.Microsecond), nil
+}
+
+// fromAPI converts a value as a query answers it back to the column's value.
+func (c bqColumn) fromAPI(s *string) (interface{}, error) {
+	if s == nil {
+		return nil, nil
+	}
+	switch c.field.Type {
+	case "INTEGER":
+		return strconv.ParseInt(*s, 10, 64)
+	case "FLOAT":
+		return strconv.ParseFloat(*s, 64)
+	case "BOOLEAN":
+		return strconv.ParseBool(*s)
+	case "NUMERIC", "BIGNUMERIC":
+		r, ok := new(big.Rat).SetString(*s)
+		if !ok {
+			return nil, fmt.Errorf("not a decimal: %q", *s)
+		}
+		return r, nil
+	case "DATE":
+		return time.Parse("2006-01-02", *s)
+	case "TIMESTAMP":
+		// Microseconds since the epoch, or seconds from an API that
+		// ignores formatOptions.
+		if us, err := strconv.ParseInt(*s, 10, 64); err == nil {
+			return time.UnixMicro(us).UTC(), nil
+		}
+		r, ok := new(big.Rat).SetString(*s)
+		if !ok {
+			return nil, fmt.Errorf("not a timestamp: %q", *s)
+		}
+		us := new(big.Rat).Mul(r, big.NewRat(1e6, 1))
+		return time.UnixMicro(new(big.Int).Quo(us.Num(), us.Denom()).Int64()).UTC(), nil
+	case "DATETIME":
+		return time.Parse("2006-01-02T15:04:05.999999999", strings.Replace(*s, " ", "T", 1))
+	}
+	return *s, nil
+}
+
+// canonical renders a value the same way whether it is sent or read back.
+func (c bqColumn) canonical(v interface{}) string {
+	if r, ok := v.(*big.Rat); ok {
+		return decimalText(r, c.scale)
+	}
+	return checksum.Canonical(v)
+}
+
+// decimalText renders r with up to scale decimals, without trailing zeros.
+func decimalText(r *big.Rat, scale int) string {
+	s := r.FloatString(scale)
+	if strings.Contains(s, ".") {
+		s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	}
+	if s == "-0" {
+		return "0"
+	}
+	return s
+}
+
+// stageNDJSON writes one JSON object per row in the forms BigQuery loads:
+// integers and decimals as strings so no digit is lost, timestamps with
+// their zone and datetimes without.
+func stageNDJSON(f *os.File, cols []bqColumn, vals [][]interface{}) error {
+	w := bufio.NewWriter(f)
+	keys := make([][]byte, len(cols))
+	for i, c := range cols {
+		keys[i], _ = json.Marshal(c.field.Name)
+	}
+	for _, row := range vals {
+		w.WriteByte('{')
+		for i, c := range cols {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			w.Write(keys[i])
+			w.WriteByte(':')
+			var v interface{}
+			switch x := row[i].(type) {
+			case nil, bool, string:
+				v = x
+			case int64:
+				v = strconv.FormatInt(x, 10)
+			case float64:
+				// NaN and ±Inf have no JSON number form.
+				switch {
+				case math.IsNaN(x):
+					v = "NaN"
+				case math.IsInf(x, 1):
+					v = "Infinity"
+				case math.IsInf(x, -1):
+					v = "-Infinity"
+				default:
+					v = x
+				}
+			case *big.Rat:
+				v = decimalText(x, c.scale)
+			case time.Time:
+				switch c.field.Type {
+				case "DATE":
+					v = x.Format("2006-01-02")
+				case "DATETIME":
+					v = x.Format("2006-01-02 15:04:05.999999")
+				default:
+					v = x.Format("2006-01-02 15:04:05.999999") + " UTC"
+				}
+			}
+			b, err := json.Marshal(v)
+			if err != nil {
+				return err
+			}
+			w.Write(b)
+		}
+		w.WriteString("}\n")
+	}
+	return w.Flush()
+}
+
+// stageParquet writes the rows as Parquet, every column optional; decimals
+// are as wide as their precision needs.
+func stageParquet(f *os.File, cols []bqColumn, vals [][]interface{}) error {
+	pcs := make([]parquet.Column, len(cols))
+	for i, c := range cols {
+		pc := parquet.Column{Name: c.field.Name, Optional: true}
+		switch c.field.Type {
+		case "INTEGER":
+			pc.Type = parquet.Int64
+		case "FLOAT":
+			pc.Type = parquet.Double
+		case "BOOLEAN":
+			pc.Type = parquet.Boolean
+		case "DATE":
+			pc.Type, pc.Logical = parquet.Int32, parquet.Date
+		case "TIMESTAMP":
+			pc.Type, pc.Logical = parquet.Int64, parquet.Timestamp
+		case "DATETIME":
+			pc.Type, pc.Logical = parquet.Int64, parquet.LocalTimestamp
+		case "NUMERIC", "BIGNUMERIC":
+			pc.Type, pc.Logical = parquet.FixedLenByteArray, parquet.Decimal
+			pc.Length, pc.Precision, pc.Scale = parquet.DecimalLength(c.precision), c.precision, c.scale
+		default:
+			pc.Type, pc.Logical = parquet.ByteArray, parquet.String
+		}
+		pcs[i] = pc
+	}
+	pw, err := parquet.NewWriter(f, pcs, parquet.Options{Codec: parquet.Snappy})
+	if err != nil {
+		return err
+	}
+	rec := make([]interface{}, len(cols))
+	for _, row := range vals {
+		for i, v := range row {
+			switch x := v.(type) {
+			case time.Time:
+				if cols[i].field.Type == "DATE" {
+					days := x.Unix() / 86400
+					if x.Unix() < 0 && x.Unix()%86400 != 0 {
+						days--
+					}
+					v = int32(days)
+				} else {
+					v = x.UnixMicro()
+				}
+			case *big.Rat:
+				unscaled := new(big.Rat).Mul(x, new(big.Rat).SetInt(pow10(cols[i].scale)))
+				v = signedBytes(unscaled.Num(), pcs[i].Length)
+			}
+			rec[i] = v
+		}
+		if err := pw.Write(rec); err != nil {
+			return err
+		}
+	}
+	return pw.Close()
+}
+
+// signedBytes renders x as a big-endian two's complement n bytes wide.
+func signedBytes(x *big.Int, n int) []byte {
+	if x.Sign() < 0 {
+		x = new(big.Int).Add(x, new(big.Int).Lsh(big.NewInt(1), uint(8*n)))
+	}
+	return x.FillBytes(make([]byte, n))
+}
+
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,119 @@
+// Package destination loads batches into places other than the bucket,
+// such as a shared Google Sheet, a BigQuery table, a SQLite or DuckDB file,
+// files on an SFTP server or in a directory of the worker, an HTTP endpoint
+// or a Kafka topic.
+package destination
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/Zubimendi/sync-loop/api/internal/checksum"
+	"github.com/Zubimendi/sync-loop/api/internal/model"
+	"github.com/Zubimendi/sync-loop/api/internal/output"
+)
+
+// Writer loads one batch. Rows the destination cannot hold go to reject as
+// *output.RowError and are skipped. It returns the digest of the batch as
+// read back, and of the rows it took in the form the destination keeps them.
+type Writer interface {
+	Write(ctx context.Context, cols []model.Column, rows []map[string]interface{}, reject func(map[string]interface{}, error) error) (written, accepted *checksum.Digest, err error)
+	Close() error
+}
+
+// Validate checks the config of a destination before it is saved.
+func Validate(d *model.Destination) error {
+	switch d.Type {
+	case "gsheets":
+		if d.ConnectorID == nil {
+			return errors.New("gsheets destination: connector_id is required")
+		}
+		_, err := sheetsConfigFrom(d.Config)
+		return err
+	case "bq":
+		if d.ConnectorID == nil {
+			return errors.New("bq destination: connector_id is required")
+		}
+		_, err := bqConfigFrom(d.Config)
+		return err
+	case "webhook":
+		if d.ConnectorID == nil {
+			return errors.New("webhook destination: connector_id is required")
+		}
+		_, err := webhookConfigFrom(d.Config)
+		return err
+	case "kafka":
+		if d.ConnectorID == nil {
+			return errors.New("kafka destination: connector_id is required")
+		}
+		_, err := kafkaConfigFrom(d.Config)
+		return err
+	case "sftp", "file":
+		if d.ConnectorID == nil {
+			return fmt.Errorf("%s destination: connector_id is required", d.Type)
+		}
+		_, err := batchFileConfigFrom(d.Type, d.Config)
+		return err
+	case "sqlite", "duckdb":
+		if d.ConnectorID != nil {
+			return fmt.Errorf("%s destination: takes no connector_id", d.Type)
+		}
+		dl, err := fileDialect(d.Type)
+		if err != nil {
+			return err
+		}
+		_, err = fileConfigFrom(dl, d.Config)
+		return err
+	default:
+		return fmt.Errorf("destination type %q is not supported yet", d.Type)
+	}
+}
+
+// Open builds the writer of a destination from the decrypted config of its
+// connector, nil for sqlite and duckdb. APIs are reached under the egress
+// policy of ctx. vars name the run, for destinations that write a file per
+// batch.
+func Open(ctx context.Context, d *model.Destination, connCfg map[string]interface{}, vars output.Vars) (Writer, error) {
+	switch d.Type {
+	case "gsheets":
+		return openSheets(ctx, d, connCfg)
+	case "bq":
+		return openBigQuery(ctx, d, connCfg)
+	case "sftp":
+		return openSFTP(ctx, d, connCfg, vars)
+	case "file":
+		return openLocal(d, connCfg, vars)
+	case "webhook":
+		return openWebhook(ctx, d, connCfg, vars)
+	case "kafka":
+		return openKafka(ctx, d, connCfg, vars)
+	case "sqlite", "duckdb":
+		dl, err := fileDialect(d.Type)
+		if err != nil {
+			return nil, err
+		}
+		return openFile(ctx, dl, d)
+	default:
+		return nil, fmt.Errorf("destination type %q is not supported yet", d.Type)
+	}
+}
+
+// Snapshot reads the latest file of a sqlite or duckdb destination;
+// ErrNoSnapshot when nothing was loaded into it yet.
+func Snapshot(ctx context.Context, d *model.Destination) (io.ReadCloser, error) {
+	dl, err := fileDialect(d.Type)
+	if err != nil {
+		return nil, err
+	}
+	sc, err := snapshotConfigFrom(d.Config)
+	if err != nil {
+		return nil, err
+	}
+	s, err := sc.store(ctx, d, dl.ext)
+	if err != nil {
+		return nil, err
+	}
+	return s.Open(ctx)
+}
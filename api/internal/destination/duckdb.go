@@ -0,0 +1,34 @@
+package destination
+
+import (
+	"fmt"
+
+	"github.com/Zubimendi/sync-loop/api/internal/model"
+)
+
+// duckdbDialect writes DuckDB files. Its driver needs cgo and DuckDB's own
+// library, so it is only built in with -tags duckdb (see duckdb_driver.go).
+var duckdbDialect = dialect{
+	name:  "duckdb",
+	ext:   ".duckdb",
+	typed: true,
+	columnType: func(c model.Column) string {
+		switch baseType(c) {
+		case "bigint":
+			return "BIGINT"
+		case "double precision":
+			return "DOUBLE"
+		case "numeric":
+			if fixedDecimal(c) {
+				return fmt.Sprintf("DECIMAL(%d,%d)", c.Precision, c.Scale)
+			}
+		case "boolean":
+			return "BOOLEAN"
+		case "date":
+			return "DATE"
+		case "timestamp":
+			return "TIMESTAMPTZ"
+		}
+		return "VARCHAR"
+	},
+}
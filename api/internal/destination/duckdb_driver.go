@@ -0,0 +1,9 @@
+//go:build duckdb
+
+// Build with -tags duckdb and cgo enabled to register DuckDB's driver.
+
+package destination
+
+import _ "github.com/duckdb/duckdb-go/v2"
+
+func init() { duckdbDialect.driver = "duckdb" }
@@ -0,0 +1,474 @@
+package destination
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Zubimendi/sync-loop/api/internal/checksum"
+	"github.com/Zubimendi/sync-loop/api/internal/model"
+	"github.com/Zubimendi/sync-loop/api/internal/output"
+)
+
+// readBackKeys is how many keys one read-back query looks up.
+const readBackKeys = 500
+
+// dialect is what differs between the database files a fileDB writes.
+type dialect struct {
+	name   string
+	driver string // database/sql driver; empty when this build has none
+	ext    string
+	// columnType is the SQL type a source column is created with.
+	columnType func(model.Column) string
+	// typed is true for engines with real boolean, date and timestamp
+	// types; the others keep dates and timestamps as canonical text and
+	// booleans as 0 and 1.
+	typed bool
+}
+
+// baseType names a source column type the way the dialects switch on it:
+// lower case, without length or precision, and with the Postgres and MySQL
+// names of a type folded into one.
+func baseType(c model.Column) string {
+	t := strings.ToLower(c.Type)
+	if i := strings.IndexByte(t, '('); i >= 0 {
+		t = strings.TrimSpace(t[:i])
+	}
+	switch t {
+	case "smallint", "int2", "tinyint", "mediumint", "integer", "int", "int4", "bigint", "int8", "year":
+		return "bigint"
+	case "double precision", "float8", "real", "float4", "float", "double":
+		return "double precision"
+	case "boolean", "bool":
+		return "boolean"
+	case "timestamp with time zone", "timestamptz", "timestamp without time zone", "timestamp", "datetime":
+		return "timestamp"
+	case "numeric", "decimal":
+		return "numeric"
+	}
+	return t
+}
+
+// fixedDecimal tells whether a numeric column has a precision typed engines
+// take as DECIMAL(p,s). Other numerics are kept as text, so no digit is lost.
+func fixedDecimal(c model.Column) bool {
+	return baseType(c) == "numeric" && c.Precision > 0 && c.Precision <= 38 && c.Scale >= 0 && c.Scale <= c.Precision
+}
+
+// fileConfig is the config of a sqlite or duckdb destination: table (data
+// when empty), mode and, for upsert, key_column, plus where the snapshot is
+// kept (see snapshotConfig).
+type fileConfig struct {
+	Table string
+	// Mode is overwrite (replace the table with the batch) or upsert
+	// (insert or update rows by key_column).
+	Mode      string
+	KeyColumn string
+	snapshotConfig
+}
+
+func fileConfigFrom(dl dialect, c model.DestinationConfig) (fileConfig, error) {
+	s := func(k string) string {
+		v, _ := c[k].(string)
+		return v
+	}
+	fc := fileConfig{Table: s("table"), Mode: s("mode"), KeyColumn: s("key_column")}
+	if fc.Table == "" {
+		fc.Table = "data"
+	}
+	if fc.Mode == "" {
+		fc.Mode = "overwrite"
+	}
+	var err error
+	if fc.snapshotConfig, err = snapshotConfigFrom(c); err != nil {
+		return fc, fmt.Errorf("%s destination: %w", dl.name, err)
+	}
+	switch {
+	case dl.driver == "":
+		return fc, fmt.Errorf("%s destination: this build has no %s driver; build with -tags %s", dl.name, dl.name, dl.name)
+	case fc.Mode != "overwrite" && fc.Mode != "upsert":
+		return fc, fmt.Errorf("%s destination: mode %q is not overwrite or upsert", dl.name, fc.Mode)
+	case fc.Mode == "upsert" && fc.KeyColumn == "":
+		return fc, fmt.Errorf("%s destination: upsert needs a key_column", dl.name)
+	}
+	return fc, nil
+}
+
+// fileDB loads batches into a table of a database file. Each run works on
+// a local copy of the latest snapshot and publishes it once the batch is in
+// and verified, so the snapshot is always a consistent file. Callers let
+// one run of a destination write at a time, or the last to publish drops
+// what the others loaded.
+type fileDB struct {
+	dl    dialect
+	cfg   fileConfig
+	snaps snapshotStore
+}
+
+func openFile(ctx context.Context, dl dialect, d *model.Destination) (*fileDB, error) {
+	fc, err := fileConfigFrom(dl, d.Config)
+	if err != nil {
+		return nil, err
+	}
+	snaps, err := fc.store(ctx, d, dl.ext)
+	if err != nil {
+		return nil, err
+	}
+	return &fileDB{dl: dl, cfg: fc, snaps: snaps}, nil
+}
+
+func (f *fileDB) Close() error { return nil }
+
+// Write creates the table from the batch's columns when it is missing (or,
+// for overwrite, always), adds the columns it lacks, writes the rows in one
+// transaction and reads them back before publishing the file.
+func (f *fileDB) Write(ctx context.Context, cols []model.Column, rows []map[string]interface{}, reject func(map[string]interface{}, error) error) (*checksum.Digest, *checksum.Digest, error) {
+	upsert := f.cfg.Mode == "upsert"
+	key := -1
+	for i, c := range cols {
+		if c.Name == f.cfg.KeyColumn {
+			key = i
+		}
+	}
+	if f.cfg.KeyColumn != "" && key < 0 {
+		return nil, nil, fmt.Errorf("%s destination: key column %s is not in the batch", f.dl.name, f.cfg.KeyColumn)
+	}
+
+	tmp, err := os.CreateTemp("", "syncloop-*"+f.dl.ext)
+	if err != nil {
+		return nil, nil, err
+	}
+	path := tmp.Name()
+	defer os.Remove(path)
+	defer os.Remove(path + ".wal")
+	// An overwrite replaces the table, but other tables in the file stay.
+	if err := fetch(ctx, f.snaps, tmp); err != nil {
+		tmp.Close()
+		return nil, nil, err
+	}
+	st, err := tmp.Stat()
+	if err == nil {
+		err = tmp.Close()
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if st.Size() == 0 {
+		// Let the engine create the file, as not all take an empty one.
+		os.Remove(path)
+	}
+	db, err := sql.Open(f.dl.driver, path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	args, accepted, err := f.admit(cols, key, rows, reject)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := f.load(ctx, db, cols, key, args); err != nil {
+		return nil, nil, fmt.Errorf("%s destination: %w", f.dl.name, err)
+	}
+	var keys []interface{}
+	if upsert {
+		for _, a := range args {
+			keys = append(keys, a[key])
+		}
+	}
+	written, err := f.readBack(ctx, db, cols, key, keys)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s destination: read back: %w", f.dl.name, err)
+	}
+	if err := db.Close(); err != nil {
+		return nil, nil, err
+	}
+	if err := f.snaps.Publish(ctx, path); err != nil {
+		return nil, nil, err
+	}
+	return written, accepted, nil
+}
+
+// admit converts rows to the values bound for their columns, rejecting
+// those that do not convert and, for upserts, those without a key. Of rows
+// repeating a key the last one wins.
+func (f *fileDB) admit(cols []model.Column, key int, rows []map[string]interface{}, reject func(map[string]interface{}, error) error) ([][]interface{}, *checksum.Digest, error) {
+	var (
+		out  [][]interface{}
+		src  []map[string]interface{}
+		seen = map[string]int{}
+	)
+	for _, row := range rows {
+		args, err := f.values(cols, row)
+		if err == nil && key >= 0 && args[key] == nil {
+			err = &output.RowError{Column: cols[key].Name, Err: errors.New("key is empty")}
+		}
+		if err != nil {
+			if err := reject(row, err); err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+		if key >= 0 {
+			k := f.canonical(cols[key], args[key])
+			if i, ok := seen[k]; ok {
+				if err := reject(src[i], &output.RowError{Column: cols[key].Name, Err: errors.New("a later row has the same key")}); err != nil {
+					return nil, nil, err
+				}
+				out[i], src[i] = args, row
+				continue
+			}
+			seen[k] = len(out)
+		}
+		out, src = append(out, args), append(src, row)
+	}
+	accepted := &checksum.Digest{}
+	for _, args := range out {
+		accepted.Add(f.row(cols, args))
+	}
+	return out, accepted, nil
+}
+
+// values converts a row's canonical text to what is bound for each column.
+func (f *fileDB) values(cols []model.Column, row map[string]interface{}) ([]interface{}, error) {
+	args := make([]interface{}, len(cols))
+	for i, c := range cols {
+		v, ok := row[c.Name].(string)
+		if !ok {
+			continue
+		}
+		var err error
+		if args[i], err = f.value(c, v); err != nil {
+			return nil, &output.RowError{Column: c.Name, Err: err}
+		}
+	}
+	return args, nil
+}
+
+func (f *fileDB) value(c model.Column, v string) (interface{}, error) {
+	switch baseType(c) {
+	case "bigint":
+		return strconv.ParseInt(v, 10, 64)
+	case "double precision":
+		return strconv.ParseFloat(v, 64)
+	case "numeric":
+		// Numerics are bound as text: a DECIMAL column parses them exactly.
+		r, ok := new(big.Rat).SetString(v)
+		if !ok {
+			return nil, fmt.Errorf("not a decimal: %q", v)
+		}
+		if !f.dl.typed || !fixedDecimal(c) {
+			return v, nil
+		}
+		// It is read back with the column's scale, so it must be written
+		// with it to hash the same.
+		if r.FloatString(c.Scale) != v {
+			return nil, fmt.Errorf("%s is not written with the %d decimals of numeric(%d,%d)", v, c.Scale, c.Precision, c.Scale)
+		}
+		unscaled := new(big.Rat).Mul(r, new(big.Rat).SetInt(pow10(c.Scale)))
+		if new(big.Int).Abs(unscaled.Num()).Cmp(pow10(c.Precision)) >= 0 {
+			return nil, fmt.Errorf("%s does not fit numeric(%d,%d)", v, c.Precision, c.Scale)
+		}
+		return v, nil
+	case "boolean":
+		b, err := strconv.ParseBool(v)
+		if err != nil || f.dl.typed {
+			return b, err
+		}
+		if b {
+			return int64(1), nil
+		}
+		return int64(0), nil
+	case "date":
+		// Sources render dates as midnight UTC; plain dates are taken too.
+		t, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			t, err = time.Parse("2006-01-02", v)
+		}
+		if err != nil || f.dl.typed {
+			return t, err
+		}
+		return v, nil
+	case "timestamp":
+		t, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil || f.dl.typed {
+			return t.UTC(), err
+		}
+		return checksum.Canonical(t), nil
+	}
+	return v, nil
+}
+
+// canonical is a stored value as text, whether bound or read back.
+func (f *fileDB) canonical(c model.Column, v interface{}) string {
+	switch t := v.(type) {
+	case int64:
+		if baseType(c) == "boolean" {
+			return strconv.FormatBool(t != 0)
+		}
+	case time.Time:
+		if baseType(c) == "date" {
+			return t.Format("2006-01-02")
+		}
+	}
+	s := checksum.Canonical(v)
+	if f.dl.typed && fixedDecimal(c) {
+		// Engines render decimals without trailing zeros.
+		if r, ok := new(big.Rat).SetString(s); ok {
+			return r.FloatString(c.Scale)
+		}
+	}
+	return s
+}
+
+func (f *fileDB) row(cols []model.Column, args []interface{}) map[string]interface{} {
+	row := make(map[string]interface{}, len(cols))
+	for i, c := range cols {
+		row[c.Name] = nil
+		if args[i] != nil {
+			row[c.Name] = f.canonical(c, args[i])
+		}
+	}
+	return row
+}
+
+func (f *fileDB) load(ctx context.Context, db *sql.DB, cols []model.Column, key int, args [][]interface{}) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	table := quote(f.cfg.Table)
+	if f.cfg.Mode == "overwrite" {
+		if _, err := tx.ExecContext(ctx, `DROP TABLE IF EXISTS `+table); err != nil {
+			return err
+		}
+	}
+	defs := make([]string, len(cols))
+	names := make([]string, len(cols))
+	for i, c := range cols {
+		names[i] = quote(c.Name)
+		defs[i] = names[i] + " " + f.dl.columnType(c)
+	}
+	if key >= 0 {
+		defs = append(defs, "PRIMARY KEY ("+names[key]+")")
+	}
+	if _, err := tx.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+table+` (`+strings.Join(defs, ", ")+`)`); err != nil {
+		return fmt.Errorf("create table %s: %w", f.cfg.Table, err)
+	}
+	have, err := tableColumns(ctx, tx, f.cfg.Table)
+	if err != nil {
+		return err
+	}
+	for i, c := range cols {
+		if !slices.Contains(have, c.Name) {
+			if _, err := tx.ExecContext(ctx, `ALTER TABLE `+table+` ADD COLUMN `+defs[i]); err != nil {
+				return fmt.Errorf("add column %s: %w", c.Name, err)
+			}
+		}
+	}
+
+	marks := strings.TrimSuffix(strings.Repeat("?, ", len(cols)), ", ")
+	insert := `INSERT INTO ` + table + ` (` + strings.Join(names, ", ") + `) VALUES (` + marks + `)`
+	if key >= 0 && f.cfg.Mode == "upsert" {
+		var set []string
+		for i, n := range names {
+			if i != key {
+				set = append(set, n+" = excluded."+n)
+			}
+		}
+		if len(set) == 0 {
+			insert += ` ON CONFLICT (` + names[key] + `) DO NOTHING`
+		} else {
+			insert += ` ON CONFLICT (` + names[key] + `) DO UPDATE SET ` + strings.Join(set, ", ")
+		}
+	}
+	stmt, err := tx.PrepareContext(ctx, insert)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, a := range args {
+		if _, err := stmt.ExecContext(ctx, a...); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func tableColumns(ctx context.Context, tx *sql.Tx, table string) ([]string, error) {
+	rows, err := tx.QueryContext(ctx, `SELECT name FROM pragma_table_info(?)`, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var names []string
+	for rows.Next() {
+		var n string
+		if err := rows.Scan(&n); err != nil {
+			return nil, err
+		}
+		names = append(names, n)
+	}
+	return names, rows.Err()
+}
+
+// readBack digests the batch's columns of the rows with the given keys, or
+// of the whole table after an overwrite.
+func (f *fileDB) readBack(ctx context.Context, db *sql.DB, cols []model.Column, key int, keys []interface{}) (*checksum.Digest, error) {
+	names := make([]string, len(cols))
+	for i, c := range cols {
+		names[i] = quote(c.Name)
+	}
+	q := `SELECT ` + strings.Join(names, ", ") + ` FROM ` + quote(f.cfg.Table)
+	d := &checksum.Digest{}
+	scan := func(query string, args ...interface{}) error {
+		rows, err := db.QueryContext(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		vals := make([]interface{}, len(cols))
+		ptrs := make([]interface{}, len(cols))
+		for i := range vals {
+			ptrs[i] = &vals[i]
+		}
+		for rows.Next() {
+			if err := rows.Scan(ptrs...); err != nil {
+				return err
+			}
+			for i, v := range vals {
+				if b, ok := v.([]byte); ok {
+					vals[i] = string(b)
+				}
+			}
+			d.Add(f.row(cols, vals))
+		}
+		return rows.Err()
+	}
+	if f.cfg.Mode != "upsert" {
+		return d, scan(q)
+	}
+	for len(keys) > 0 {
+		n := min(len(keys), readBackKeys)
+		marks := strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+		if err := scan(q+` WHERE `+names[key]+` IN (`+marks+`)`, keys[:n]...); err != nil {
+			return nil, err
+		}
+		keys = keys[n:]
+	}
+	return d, nil
+}
+
+// quote makes a name an SQL identifier; both engines double quotes.
+func quote(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
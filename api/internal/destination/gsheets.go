@@ -0,0 +1,330 @@
+package destination
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/Zubimendi/sync-loop/api/internal/checksum"
+	"github.com/Zubimendi/sync-loop/api/internal/egress"
+	"github.com/Zubimendi/sync-loop/api/internal/gsheets"
+	"github.com/Zubimendi/sync-loop/api/internal/model"
+	"github.com/Zubimendi/sync-loop/api/internal/output"
+)
+
+const (
+	defaultBatchRows = 500
+	// readBackRanges is how many ranges one read-back request asks for.
+	readBackRanges = 100
+)
+
+// sheetsConfig is the config of a gsheets destination: spreadsheet_id,
+// sheet (the first one when empty), mode and, for upsert, key_column.
+// batch_rows caps the rows of one write request.
+type sheetsConfig struct {
+	SpreadsheetID string
+	Sheet         string
+	// Mode is replace (clear the sheet, then write), append (add rows
+	// below) or upsert (rewrite the rows whose key_column matches, append
+	// the rest).
+	Mode      string
+	KeyColumn string
+	BatchRows int
+}
+
+func sheetsConfigFrom(c model.DestinationConfig) (sheetsConfig, error) {
+	s := func(k string) string {
+		v, _ := c[k].(string)
+		return v
+	}
+	sc := sheetsConfig{
+		SpreadsheetID: s("spreadsheet_id"),
+		Sheet:         s("sheet"),
+		Mode:          s("mode"),
+		KeyColumn:     s("key_column"),
+		BatchRows:     defaultBatchRows,
+	}
+	if n, ok := c["batch_rows"].(float64); ok && n > 0 {
+		sc.BatchRows = int(n)
+	}
+	if sc.Mode == "" {
+		sc.Mode = "append"
+	}
+	switch {
+	case sc.SpreadsheetID == "":
+		return sc, errors.New("gsheets destination: spreadsheet_id is required")
+	case sc.Mode != "replace" && sc.Mode != "append" && sc.Mode != "upsert":
+		return sc, fmt.Errorf("gsheets destination: mode %q is not replace, append or upsert", sc.Mode)
+	case sc.Mode == "upsert" && sc.KeyColumn == "":
+		return sc, errors.New("gsheets destination: upsert needs a key_column")
+	}
+	return sc, nil
+}
+
+type sheets struct {
+	client *gsheets.Client
+	cfg    sheetsConfig
+}
+
+func openSheets(ctx context.Context, d *model.Destination, connCfg map[string]interface{}) (*sheets, error) {
+	sc, err := sheetsConfigFrom(d.Config)
+	if err != nil {
+		return nil, err
+	}
+	gc, err := gsheets.ConfigFrom(connCfg)
+	if err != nil {
+		return nil, err
+	}
+	client, err := gsheets.New(gc, egress.FromContext(ctx).Transport())
+	if err != nil {
+		return nil, err
+	}
+	return &sheets{client: client, cfg: sc}, nil
+}
+
+func (s *sheets) Close() error {
+	s.client.Close()
+	return nil
+}
+
+// Write lines the batch up under the sheet's header row, adding the columns
+// it lacks, writes it in batches of rows and reads the written rows back.
+// A sheet cannot tell an empty string from NULL, so both are taken as NULL.
+func (s *sheets) Write(ctx context.Context, cols []model.Column, rows []map[string]interface{}, reject func(map[string]interface{}, error) error) (*checksum.Digest, *checksum.Digest, error) {
+	names := make([]string, len(cols))
+	for i, c := range cols {
+		names[i] = c.Name
+	}
+	upsert := s.cfg.Mode == "upsert"
+	if upsert && !slices.Contains(names, s.cfg.KeyColumn) {
+		return nil, nil, fmt.Errorf("gsheets destination: key column %s is not in the batch", s.cfg.KeyColumn)
+	}
+	rows, err := s.admit(names, rows, reject)
+	if err != nil {
+		return nil, nil, err
+	}
+	accepted := &checksum.Digest{}
+	for _, row := range rows {
+		accepted.Add(sheetValues(names, row))
+	}
+
+	id, sheet := s.cfg.SpreadsheetID, s.cfg.Sheet
+	var grid [][]string
+	switch s.cfg.Mode {
+	case "replace":
+		if err := s.client.Clear(ctx, id, gsheets.Range(sheet, "")); err != nil {
+			return nil, nil, err
+		}
+	case "append":
+		vr, err := s.client.Get(ctx, id, gsheets.Range(sheet, "1:1"))
+		if err != nil {
+			return nil, nil, err
+		}
+		grid = vr.Values
+	case "upsert":
+		vr, err := s.client.Get(ctx, id, gsheets.Range(sheet, ""))
+		if err != nil {
+			return nil, nil, err
+		}
+		grid = vr.Values
+	}
+	var hdr []string
+	if len(grid) > 0 {
+		hdr = grid[0]
+	}
+	pos, hdr, grew := align(hdr, names)
+	if grew {
+		err := s.client.BatchUpdate(ctx, id, []gsheets.ValueRange{{
+			Range: gsheets.Range(sheet, gsheets.Rows(1, 1, len(hdr))), Values: [][]string{hdr},
+		}})
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	width := len(hdr)
+
+	// Upserts rewrite whole rows, keeping the cells of columns the batch
+	// does not have.
+	existing := map[string]int{}
+	if upsert {
+		k := pos[s.cfg.KeyColumn]
+		for i := len(grid) - 1; i >= 1; i-- {
+			if k < len(grid[i]) && grid[i][k] != "" {
+				existing[grid[i][k]] = i
+			}
+		}
+	}
+	var (
+		updates []gsheets.ValueRange
+		appends [][]string
+		written []string
+	)
+	for _, row := range rows {
+		cells := make([]string, width)
+		if i, ok := existing[str(row[s.cfg.KeyColumn])]; ok && upsert {
+			copy(cells, grid[i])
+			set(cells, pos, names, row)
+			rng := gsheets.Range(sheet, gsheets.Rows(i+1, i+1, width))
+			updates = append(updates, gsheets.ValueRange{Range: rng, Values: [][]string{cells}})
+			written = append(written, rng)
+			continue
+		}
+		set(cells, pos, names, row)
+		appends = append(appends, cells)
+	}
+	for len(updates) > 0 {
+		n := min(len(updates), s.cfg.BatchRows)
+		if err := s.client.BatchUpdate(ctx, id, updates[:n]); err != nil {
+			return nil, nil, err
+		}
+		updates = updates[n:]
+	}
+	for len(appends) > 0 {
+		n := min(len(appends), s.cfg.BatchRows)
+		// A replaced sheet keeps its grid, so its rows are written over
+		// rather than inserted, or it would grow on every run.
+		rng, err := s.client.Append(ctx, id, gsheets.Range(sheet, "A1"), appends[:n], s.cfg.Mode != "replace")
+		if err != nil {
+			return nil, nil, err
+		}
+		written = append(written, rng)
+		appends = appends[n:]
+	}
+	digest, err := s.readBack(ctx, written, pos, names)
+	if err != nil {
+		return nil, nil, err
+	}
+	return digest, accepted, nil
+}
+
+// admit rejects the rows a sheet cannot hold: empty ones, which the next
+// append would write over, ones with a cell over the size limit and, for
+// upserts, ones without a key. Of rows repeating a key the last one wins.
+func (s *sheets) admit(names []string, rows []map[string]interface{}, reject func(map[string]interface{}, error) error) ([]map[string]interface{}, error) {
+	keep := make([]map[string]interface{}, 0, len(rows))
+	keys := map[string]int{}
+	for _, row := range rows {
+		err := checkRow(names, row)
+		key := str(row[s.cfg.KeyColumn])
+		if err == nil && s.cfg.Mode == "upsert" && key == "" {
+			err = &output.RowError{Column: s.cfg.KeyColumn, Err: errors.New("key is empty")}
+		}
+		if err != nil {
+			if err := reject(row, err); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if s.cfg.Mode == "upsert" {
+			if i, ok := keys[key]; ok {
+				if err := reject(keep[i], &output.RowError{Column: s.cfg.KeyColumn, Err: errors.New("a later row has the same key")}); err != nil {
+					return nil, err
+				}
+				keep[i] = row
+				continue
+			}
+			keys[key] = len(keep)
+		}
+		keep = append(keep, row)
+	}
+	return keep, nil
+}
+
+func checkRow(names []string, row map[string]interface{}) error {
+	empty := true
+	for _, n := range names {
+		v := str(row[n])
+		if utf8.RuneCountInString(v) > gsheets.MaxCellChars {
+			return &output.RowError{Column: n, Err: fmt.Errorf("value is longer than the %d characters a cell holds", gsheets.MaxCellChars)}
+		}
+		if v != "" {
+			empty = false
+		}
+	}
+	if empty && len(names) > 0 {
+		return &output.RowError{Column: names[0], Err: errors.New("every column is empty")}
+	}
+	return nil
+}
+
+// readBack digests the rows of the written ranges.
+func (s *sheets) readBack(ctx context.Context, ranges []string, pos map[string]int, names []string) (*checksum.Digest, error) {
+	d := &checksum.Digest{}
+	for len(ranges) > 0 {
+		n := min(len(ranges), readBackRanges)
+		vrs, err := s.client.BatchGet(ctx, s.cfg.SpreadsheetID, ranges[:n])
+		if err != nil {
+			return nil, fmt.Errorf("read back: %w", err)
+		}
+		for _, vr := range vrs {
+			for _, cells := range vr.Values {
+				row := make(map[string]interface{}, len(names))
+				for _, name := range names {
+					if i := pos[name]; i < len(cells) && cells[i] != "" {
+						row[name] = cells[i]
+					} else {
+						row[name] = nil
+					}
+				}
+				d.Add(row)
+			}
+		}
+		ranges = ranges[n:]
+	}
+	return d, nil
+}
+
+// align finds the batch's columns in a header row, adding those it lacks
+// at the end. Header names are matched trimmed; the first of a repeated
+// name wins.
+func align(hdr, names []string) (pos map[string]int, out []string, grew bool) {
+	pos = make(map[string]int, len(names))
+	out = append([]string(nil), hdr...)
+	for i, h := range hdr {
+		h = strings.TrimSpace(h)
+		if _, ok := pos[h]; !ok && h != "" {
+			pos[h] = i
+		}
+	}
+	for _, n := range names {
+		if _, ok := pos[n]; !ok {
+			pos[n] = len(out)
+			out = append(out, n)
+			grew = true
+		}
+	}
+	return pos, out, grew
+}
+
+func set(cells []string, pos map[string]int, names []string, row map[string]interface{}) {
+	for _, n := range names {
+		cells[pos[n]] = str(row[n])
+	}
+}
+
+// sheetValues is a row as a sheet keeps it, empty strings as NULL.
+func sheetValues(names []string, row map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(names))
+	for _, n := range names {
+		if v := str(row[n]); v != "" {
+			out[n] = v
+		} else {
+			out[n] = nil
+		}
+	}
+	return out
+}
+
+func str(v interface{}) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return t
+	default:
+		return checksum.Canonical(t)
+	}
+}
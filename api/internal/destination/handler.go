@@ -0,0 +1,118 @@
+package destination
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/Zubimendi/sync-loop/api/internal/middleware"
+	"github.com/Zubimendi/sync-loop/api/internal/model"
+	"github.com/go-chi/chi/v5"
+)
+
+type Handler struct {
+	repo *Repo
+}
+
+func NewHandler(repo *Repo) *Handler { return &Handler{repo: repo} }
+
+// GET /api/v1/destinations – destinations of the workspace
+func (h *Handler) List(w http.ResponseWriter, r *http.Request) {
+	wid := r.Context().Value(middleware.CtxWorkspaceID).(string)
+	dd, err := h.repo.ListByWorkspace(r.Context(), wid)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"destinations": dd})
+}
+
+// POST /api/v1/destinations – e.g. {"connector_id":"...","type":"gsheets",
+// "name":"Ops numbers","config":{"spreadsheet_id":"...","sheet":"Nightly",
+// "mode":"upsert","key_column":"id"}}; the connector holds the credentials.
+// A bq destination names a dataset and table of its bq connector's project:
+// {"dataset":"ops","table":"orders","mode":"merge","key_column":"id",
+// "format":"parquet","partition_field":"created_at"}. An sftp destination
+// writes a file per run under its sftp connector's root:
+// {"path":"exports/{table}/{date}/{run_id}","format":"csv","compression":"gzip"}.
+// A file destination takes the same config and writes into the directory
+// of its file connector. A webhook destination POSTs batches to the url of
+// its webhook connector: {"batch_size":200}. A kafka destination publishes
+// each row to a topic of its kafka connector's cluster: {"topic":"orders",
+// "key_column":"id","value_format":"avro","partitioner":"key"}.
+// SQLite and DuckDB destinations take no connector: {"type":"sqlite",
+// "name":"Orders","config":{"table":"orders","mode":"upsert","key_column":"id"}}
+func (h *Handler) Create(w http.ResponseWriter, r *http.Request) {
+	var d model.Destination
+	if err := json.NewDecoder(r.Body).Decode(&d); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+	if err := Validate(&d); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	wid := r.Context().Value(middleware.CtxWorkspaceID).(string)
+	err := h.repo.Create(r.Context(), &d, wid)
+	if errors.Is(err, sql.ErrNoRows) && d.ConnectorID != nil {
+		http.Error(w, "no "+d.Type+" connector with that id in this workspace", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(d)
+}
+
+// DELETE /api/v1/destinations/{id} – jobs loading into it go back to the
+// bucket
+func (h *Handler) Delete(w http.ResponseWriter, r *http.Request) {
+	wid := r.Context().Value(middleware.CtxWorkspaceID).(string)
+	n, err := h.repo.Delete(r.Context(), chi.URLParam(r, "id"), wid)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if n == 0 {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GET /api/v1/destinations/{id}/snapshot – download the latest file of a
+// sqlite or duckdb destination
+func (h *Handler) Snapshot(w http.ResponseWriter, r *http.Request) {
+	wid := r.Context().Value(middleware.CtxWorkspaceID).(string)
+	d, err := h.repo.GetInWorkspace(r.Context(), chi.URLParam(r, "id"), wid)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if d.Type != "sqlite" && d.Type != "duckdb" {
+		http.Error(w, d.Type+" destinations have no file", http.StatusBadRequest)
+		return
+	}
+	f, err := Snapshot(r.Context(), d)
+	if errors.Is(err, ErrNoSnapshot) {
+		http.Error(w, "nothing was loaded into this destination yet", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+	dl, _ := fileDialect(d.Type)
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+d.ID+dl.ext+`"`)
+	io.Copy(w, f)
+}
@@ -0,0 +1,493 @@
+package destination
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Zubimendi/sync-loop/api/internal/checksum"
+	"github.com/Zubimendi/sync-loop/api/internal/egress"
+	"github.com/Zubimendi/sync-loop/api/internal/kafka"
+	"github.com/Zubimendi/sync-loop/api/internal/model"
+	"github.com/Zubimendi/sync-loop/api/internal/output"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// kafkaDelivery bounds how long the producer retries a message, as when
+// no broker can be reached.
+const kafkaDelivery = 2 * time.Minute
+
+// kafkaReadBack bounds how long the produced messages may take to become
+// readable.
+const kafkaReadBack = 2 * time.Minute
+
+// kafkaConfig is the config of a kafka destination:
+//
+//   - topic, which must exist
+//   - key_column, the columns whose values key each message, comma
+//     separated; one column's value is the key as text, several make a JSON
+//     object. Without it messages have no key.
+//   - value_format, json or avro; avro registers the schema of the batch
+//     under <topic>-value in the connector's schema registry
+//   - envelope, row for the row itself or change for a change event
+//     {"op":"upsert","table":...,"run_id":...,"ts_ms":...,"after":{...}}
+//   - partitioner: key (the default, hashing keys as Kafka's own clients
+//     do), round_robin, sticky, or manual with the partition in
+//     partition_column
+//   - acks (all, leader or none), idempotent (on by default, and only with
+//     acks all), compression (none, gzip, snappy, lz4 or zstd) and
+//     linger_ms, for the producer
+type kafkaConfig struct {
+	Topic           string
+	KeyColumns      []string
+	ValueFormat     string
+	Envelope        string
+	Partitioner     string
+	PartitionColumn string
+	Acks            string
+	Idempotent      bool
+	Compression     string
+	LingerMS        int
+}
+
+func kafkaConfigFrom(c model.DestinationConfig) (kafkaConfig, error) {
+	s := func(k string) string {
+		v, _ := c[k].(string)
+		return strings.TrimSpace(v)
+	}
+	kc := kafkaConfig{
+		Topic:           s("topic"),
+		ValueFormat:     s("value_format"),
+		Envelope:        s("envelope"),
+		Partitioner:     s("partitioner"),
+		PartitionColumn: s("partition_column"),
+		Acks:            s("acks"),
+		Idempotent:      true,
+		Compression:     s("compression"),
+	}
+	for _, k := range strings.Split(s("key_column"), ",") {
+		if k = strings.TrimSpace(k); k != "" {
+			kc.KeyColumns = append(kc.KeyColumns, k)
+		}
+	}
+	if kc.ValueFormat == "" {
+		kc.ValueFormat = "json"
+	}
+	if kc.Envelope == "" {
+		kc.Envelope = "row"
+	}
+	if kc.Partitioner == "" {
+		kc.Partitioner = "key"
+	}
+	if kc.Acks == "" {
+		kc.Acks = "all"
+	}
+	if b, ok := c["idempotent"].(bool); ok {
+		kc.Idempotent = b
+	}
+	if n, ok := c["linger_ms"].(float64); ok {
+		if n < 0 || n != float64(int(n)) {
+			return kc, fmt.Errorf("kafka destination: linger_ms %v is not a whole number of milliseconds", n)
+		}
+		kc.LingerMS = int(n)
+	}
+	switch {
+	case kc.Topic == "":
+		return kc, errors.New("kafka destination: topic is required")
+	case kc.ValueFormat != "json" && kc.ValueFormat != "avro":
+		return kc, fmt.Errorf("kafka destination: value_format %q is not json or avro", kc.ValueFormat)
+	case kc.Envelope != "row" && kc.Envelope != "change":
+		return kc, fmt.Errorf("kafka destination: envelope %q is not row or change", kc.Envelope)
+	case kc.Envelope == "change" && kc.ValueFormat != "json":
+		return kc, errors.New("kafka destination: change events are JSON only")
+	case kc.Partitioner == "manual" && kc.PartitionColumn == "":
+		return kc, errors.New("kafka destination: the manual partitioner needs a partition_column")
+	case kc.Partitioner != "manual" && kc.PartitionColumn != "":
+		return kc, errors.New("kafka destination: partition_column is for the manual partitioner")
+	case kc.Acks != "all" && kc.Acks != "leader" && kc.Acks != "none":
+		return kc, fmt.Errorf("kafka destination: acks %q is not all, leader or none", kc.Acks)
+	case kc.Idempotent && kc.Acks != "all":
+		return kc, errors.New("kafka destination: an idempotent producer needs acks all")
+	}
+	if _, err := kc.partitioner(); err != nil {
+		return kc, err
+	}
+	if _, err := kc.compression(); err != nil {
+		return kc, err
+	}
+	return kc, nil
+}
+
+func (kc kafkaConfig) partitioner() (kgo.Partitioner, error) {
+	switch kc.Partitioner {
+	case "key":
+		return kgo.StickyKeyPartitioner(nil), nil
+	case "round_robin":
+		return kgo.RoundRobinPartitioner(), nil
+	case "sticky":
+		return kgo.StickyPartitioner(), nil
+	case "manual":
+		return kgo.ManualPartitioner(), nil
+	}
+	return nil, fmt.Errorf("kafka destination: unknown partitioner %q", kc.Partitioner)
+}
+
+func (kc kafkaConfig) compression() (kgo.CompressionCodec, error) {
+	switch kc.Compression {
+	case "", "none":
+		return kgo.NoCompression(), nil
+	case "gzip":
+		return kgo.GzipCompression(), nil
+	case "snappy":
+		return kgo.SnappyCompression(), nil
+	case "lz4":
+		return kgo.Lz4Compression(), nil
+	case "zstd":
+		return kgo.ZstdCompression(), nil
+	}
+	return kgo.CompressionCodec{}, fmt.Errorf("kafka destination: unknown compression %q", kc.Compression)
+}
+
+func (kc kafkaConfig) producerOpts() []kgo.Opt {
+	part, _ := kc.partitioner()
+	codec, _ := kc.compression()
+	opts := []kgo.Opt{
+		kgo.DefaultProduceTopic(kc.Topic),
+		kgo.RecordPartitioner(part),
+		kgo.ProducerBatchCompression(codec),
+		kgo.ProducerLinger(time.Duration(kc.LingerMS) * time.Millisecond),
+		kgo.RecordDeliveryTimeout(kafkaDelivery),
+	}
+	switch kc.Acks {
+	case "all":
+		opts = append(opts, kgo.RequiredAcks(kgo.AllISRAcks()))
+	case "leader":
+		opts = append(opts, kgo.RequiredAcks(kgo.LeaderAck()))
+	case "none":
+		opts = append(opts, kgo.RequiredAcks(kgo.NoAck()))
+	}
+	if !kc.Idempotent {
+		opts = append(opts, kgo.DisableIdempotentWrite())
+	}
+	return opts
+}
+
+// topic publishes each row as a message of a Kafka topic. The idempotent
+// producer keeps a retried send from landing twice; a retried load sends
+// the batch again, so delivery across runs is at least once and consumers
+// should dedupe on the key.
+type topic struct {
+	cfg    kafkaConfig
+	conn   kafka.Config
+	vars   output.Vars
+	client *kgo.Client
+	reg    *kafka.Registry
+	dial   func(ctx context.Context, network, addr string) (net.Conn, error)
+}
+
+func openKafka(ctx context.Context, d *model.Destination, connCfg map[string]interface{}, vars output.Vars) (*topic, error) {
+	kc, err := kafkaConfigFrom(d.Config)
+	if err != nil {
+		return nil, err
+	}
+	cc, err := kafka.ConfigFrom(connCfg)
+	if err != nil {
+		return nil, err
+	}
+	if kc.ValueFormat == "avro" && cc.Registry.URL == "" {
+		return nil, errors.New("kafka destination: avro values need a schema_registry_url on the connector")
+	}
+	p := egress.FromContext(ctx)
+	client, err := kafka.NewClient(cc, p.DialContext, kc.producerOpts()...)
+	if err != nil {
+		return nil, err
+	}
+	// The producer would retry a missing topic or an unreachable cluster
+	// until delivery times out; the metadata says why at once.
+	if _, err := kafka.Partitions(ctx, client, kc.Topic); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("kafka destination: %w", err)
+	}
+	return &topic{
+		cfg: kc, conn: cc, vars: vars, client: client,
+		reg:  kafka.NewRegistry(cc, p.Transport()),
+		dial: p.DialContext,
+	}, nil
+}
+
+func (t *topic) Close() error {
+	t.client.Close()
+	if t.reg != nil {
+		t.reg.Close()
+	}
+	return nil
+}
+
+// Write publishes the batch in order and waits until every message is
+// acknowledged, then reads the messages back from the offsets they were
+// given. With acks none there are no offsets, and the written digest is of
+// the messages as they were sent.
+func (t *topic) Write(ctx context.Context, cols []model.Column, rows []map[string]interface{}, reject func(map[string]interface{}, error) error) (*checksum.Digest, *checksum.Digest, error) {
+	enc, err := t.encoder(ctx, cols)
+	if err != nil {
+		return nil, nil, err
+	}
+	accepted := &checksum.Digest{}
+	var recs []*kgo.Record
+	for _, row := range rows {
+		r, err := enc.record(row)
+		var rowErr *output.RowError
+		if errors.As(err, &rowErr) {
+			if err := reject(row, err); err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		recs = append(recs, r)
+		kept := make(map[string]interface{}, len(cols))
+		for _, c := range cols {
+			kept[c.Name] = row[c.Name]
+		}
+		accepted.Add(kept)
+	}
+	if err := t.produce(ctx, recs); err != nil {
+		return nil, nil, err
+	}
+	if t.cfg.Acks == "none" {
+		written := &checksum.Digest{}
+		for _, r := range recs {
+			row, err := enc.decode(r.Value)
+			if err != nil {
+				return nil, nil, err
+			}
+			written.Add(row)
+		}
+		return written, accepted, nil
+	}
+	written, err := t.readBack(ctx, enc, recs)
+	if err != nil {
+		return nil, nil, fmt.Errorf("kafka destination: read back: %w", err)
+	}
+	return written, accepted, nil
+}
+
+func (t *topic) produce(ctx context.Context, recs []*kgo.Record) error {
+	var (
+		mu    sync.Mutex
+		first error
+	)
+	for _, r := range recs {
+		t.client.Produce(ctx, r, func(r *kgo.Record, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil && first == nil {
+				first = err
+			}
+		})
+	}
+	if err := t.client.Flush(ctx); err != nil {
+		return fmt.Errorf("kafka destination: %w", err)
+	}
+	if first != nil {
+		return fmt.Errorf("kafka destination: produce to %s: %w", t.cfg.Topic, first)
+	}
+	return nil
+}
+
+// readBack consumes each partition written to from the first offset the
+// batch got there to its last, keeping the batch's own messages; others
+// may have produced in between.
+func (t *topic) readBack(ctx context.Context, enc *kafkaEncoder, recs []*kgo.Record) (*checksum.Digest, error) {
+	d := &checksum.Digest{}
+	if len(recs) == 0 {
+		return d, nil
+	}
+	ours := map[int32]map[int64]bool{}
+	from := map[int32]kgo.Offset{}
+	last := map[int32]int64{}
+	for _, r := range recs {
+		if ours[r.Partition] == nil {
+			ours[r.Partition] = map[int64]bool{}
+			from[r.Partition] = kgo.NewOffset().At(r.Offset)
+			last[r.Partition] = r.Offset
+		}
+		ours[r.Partition][r.Offset] = true
+		last[r.Partition] = max(last[r.Partition], r.Offset)
+	}
+	cl, err := kafka.NewClient(t.conn, t.dial,
+		kgo.ConsumePartitions(map[string]map[int32]kgo.Offset{t.cfg.Topic: from}))
+	if err != nil {
+		return nil, err
+	}
+	defer cl.Close()
+	ctx, cancel := context.WithTimeout(ctx, kafkaReadBack)
+	defer cancel()
+	for len(last) > 0 {
+		fetches := cl.PollFetches(ctx)
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		var ferr error
+		fetches.EachError(func(_ string, p int32, err error) {
+			if ferr == nil {
+				ferr = fmt.Errorf("partition %d: %w", p, err)
+			}
+		})
+		if ferr != nil {
+			return nil, ferr
+		}
+		for it := fetches.RecordIter(); !it.Done(); {
+			r := it.Next()
+			end, ok := last[r.Partition]
+			if !ok || !ours[r.Partition][r.Offset] {
+				continue
+			}
+			row, err := enc.decode(r.Value)
+			if err != nil {
+				return nil, fmt.Errorf("message %d/%d: %w", r.Partition, r.Offset, err)
+			}
+			d.Add(row)
+			if r.Offset >= end {
+				delete(last, r.Partition)
+			}
+		}
+	}
+	return d, nil
+}
+
+// kafkaEncoder turns the rows of one batch into messages.
+type kafkaEncoder struct {
+	cfg   kafkaConfig
+	vars  output.Vars
+	value output.RecordCodec
+	key   output.RecordCodec
+	// schemaID frames avro values.
+	schemaID int
+}
+
+func (t *topic) encoder(ctx context.Context, cols []model.Column) (*kafkaEncoder, error) {
+	have := make(map[string]model.Column, len(cols))
+	for _, c := range cols {
+		have[c.Name] = c
+	}
+	var keyCols []model.Column
+	for _, k := range t.cfg.KeyColumns {
+		c, ok := have[k]
+		if !ok {
+			return nil, fmt.Errorf("kafka destination: key column %s is not in the batch", k)
+		}
+		keyCols = append(keyCols, c)
+	}
+	if _, ok := have[t.cfg.PartitionColumn]; t.cfg.PartitionColumn != "" && !ok {
+		return nil, fmt.Errorf("kafka destination: partition column %s is not in the batch", t.cfg.PartitionColumn)
+	}
+	enc := &kafkaEncoder{cfg: t.cfg, vars: t.vars}
+	var err error
+	if enc.value, err = output.NewRecordCodec(t.cfg.ValueFormat, cols); err != nil {
+		return nil, fmt.Errorf("kafka destination: %w", err)
+	}
+	if len(keyCols) > 1 {
+		if enc.key, err = output.NewRecordCodec("json", keyCols); err != nil {
+			return nil, fmt.Errorf("kafka destination: %w", err)
+		}
+	}
+	if schema := enc.value.Schema(); schema != nil {
+		if enc.schemaID, err = t.reg.Register(ctx, t.cfg.Topic+"-value", schema); err != nil {
+			return nil, fmt.Errorf("kafka destination: %w", err)
+		}
+	}
+	return enc, nil
+}
+
+func (e *kafkaEncoder) record(row map[string]interface{}) (*kgo.Record, error) {
+	r := &kgo.Record{}
+	switch {
+	case len(e.cfg.KeyColumns) == 1:
+		k := e.cfg.KeyColumns[0]
+		if row[k] == nil {
+			return nil, &output.RowError{Column: k, Err: errors.New("key is empty")}
+		}
+		r.Key = []byte(checksum.Canonical(row[k]))
+	case len(e.cfg.KeyColumns) > 1:
+		for _, k := range e.cfg.KeyColumns {
+			if row[k] == nil {
+				return nil, &output.RowError{Column: k, Err: errors.New("key is empty")}
+			}
+		}
+		b, err := e.key.Encode(row)
+		if err != nil {
+			return nil, err
+		}
+		r.Key = b
+	}
+	if c := e.cfg.PartitionColumn; c != "" {
+		p, err := strconv.ParseInt(checksum.Canonical(row[c]), 10, 32)
+		if err != nil || p < 0 {
+			return nil, &output.RowError{Column: c, Err: fmt.Errorf("partition %q is not a partition number", checksum.Canonical(row[c]))}
+		}
+		r.Partition = int32(p)
+	}
+	v, err := e.value.Encode(row)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case e.cfg.Envelope == "change":
+		if v, err = e.change(v); err != nil {
+			return nil, err
+		}
+	case e.value.Schema() != nil:
+		v = kafka.Frame(e.schemaID, v)
+	}
+	r.Value = v
+	return r, nil
+}
+
+// change wraps an encoded row in a change event.
+func (e *kafkaEncoder) change(after []byte) ([]byte, error) {
+	head, err := json.Marshal(struct {
+		Op    string `json:"op"`
+		Table string `json:"table"`
+		RunID string `json:"run_id"`
+		TsMS  int64  `json:"ts_ms"`
+	}{"upsert", e.vars.Table, e.vars.RunID, e.vars.Time.UnixMilli()})
+	if err != nil {
+		return nil, err
+	}
+	b := append(head[:len(head)-1], `,"after":`...)
+	b = append(b, after...)
+	return append(b, '}'), nil
+}
+
+// decode reads the row back out of a message value.
+func (e *kafkaEncoder) decode(v []byte) (map[string]interface{}, error) {
+	switch {
+	case e.cfg.Envelope == "change":
+		var ev struct {
+			After json.RawMessage `json:"after"`
+		}
+		if err := json.Unmarshal(v, &ev); err != nil {
+			return nil, err
+		}
+		v = ev.After
+	case e.value.Schema() != nil:
+		id, b, err := kafka.Unframe(v)
+		if err != nil {
+			return nil, err
+		}
+		if id != e.schemaID {
+			return nil, fmt.Errorf("value has schema %d, not %d", id, e.schemaID)
+		}
+		v = b
+	}
+	return e.value.Decode(v)
+}
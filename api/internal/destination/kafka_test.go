@@ -0,0 +1,272 @@
+package destination
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Zubimendi/sync-loop/api/internal/egress"
+	"github.com/Zubimendi/sync-loop/api/internal/kafka"
+	"github.com/Zubimendi/sync-loop/api/internal/model"
+	"github.com/Zubimendi/sync-loop/api/internal/output"
+	"github.com/twmb/franz-go/pkg/kfake"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// kafkaCluster starts an in-process cluster with the topic "orders" of
+// three partitions.
+func kafkaCluster(t *testing.T) []string {
+	t.Helper()
+	c, err := kfake.NewCluster(kfake.NumBrokers(1), kfake.SeedTopics(3, "orders"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(c.Close)
+	return c.ListenAddrs()
+}
+
+// consumeAll reads the first n messages of a topic, across its partitions.
+func consumeAll(t *testing.T, brokers []string, topic string, n int) []*kgo.Record {
+	t.Helper()
+	cl, err := kgo.NewClient(kgo.SeedBrokers(brokers...), kgo.ConsumeTopics(topic),
+		kgo.ConsumeResetOffset(kgo.NewOffset().AtStart()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cl.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var recs []*kgo.Record
+	for len(recs) < n {
+		fetches := cl.PollFetches(ctx)
+		if err := ctx.Err(); err != nil {
+			t.Fatalf("read %d of %d messages: %v", len(recs), n, err)
+		}
+		recs = append(recs, fetches.Records()...)
+	}
+	return recs
+}
+
+func openTestKafka(t *testing.T, brokers []string, cfg model.DestinationConfig, extra map[string]interface{}) Writer {
+	t.Helper()
+	connID := "c1"
+	d := &model.Destination{Type: "kafka", ConnectorID: &connID, Config: cfg}
+	if err := Validate(d); err != nil {
+		t.Fatal(err)
+	}
+	connCfg := map[string]interface{}{"brokers": strings.Join(brokers, ",")}
+	for k, v := range extra {
+		connCfg[k] = v
+	}
+	w, err := Open(loopback(), d, connCfg, output.Vars{Table: "orders", RunID: "run1", Time: time.UnixMilli(1700000000000)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { w.Close() })
+	return w
+}
+
+var kafkaCols = []model.Column{
+	{Name: "id", Type: "bigint"},
+	{Name: "region", Type: "text"},
+	{Name: "amount", Type: "numeric", Nullable: true},
+}
+
+func TestKafkaWrite(t *testing.T) {
+	brokers := kafkaCluster(t)
+	w := openTestKafka(t, brokers, model.DestinationConfig{"topic": "orders", "key_column": "id"}, nil)
+	rows := []map[string]interface{}{
+		{"id": "1", "region": "eu", "amount": "9.50"},
+		{"id": "2", "region": "us", "amount": nil},
+		{"id": nil, "region": "us", "amount": "1"},
+	}
+	var rejected []string
+	written, accepted, err := w.Write(loopback(), kafkaCols, rows, func(row map[string]interface{}, err error) error {
+		rejected = append(rejected, err.Error())
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rejected) != 1 || !strings.Contains(rejected[0], "key is empty") {
+		t.Errorf("rejected = %v, want the row without a key", rejected)
+	}
+	if written.Rows() != 2 || written.Sum() != accepted.Sum() {
+		t.Errorf("read back %d rows %s, accepted %d rows %s", written.Rows(), written.Sum(), accepted.Rows(), accepted.Sum())
+	}
+	got := map[string]map[string]interface{}{}
+	for _, r := range consumeAll(t, brokers, "orders", 2) {
+		var v map[string]interface{}
+		if err := json.Unmarshal(r.Value, &v); err != nil {
+			t.Fatal(err)
+		}
+		got[string(r.Key)] = v
+	}
+	if len(got) != 2 || got["1"]["region"] != "eu" || got["2"]["amount"] != nil {
+		t.Errorf("messages = %v", got)
+	}
+}
+
+func TestKafkaWriteChange(t *testing.T) {
+	brokers := kafkaCluster(t)
+	w := openTestKafka(t, brokers, model.DestinationConfig{
+		"topic": "orders", "key_column": "id, region", "envelope": "change",
+	}, nil)
+	rows := []map[string]interface{}{{"id": "7", "region": "eu", "amount": "2"}}
+	written, accepted, err := w.Write(loopback(), kafkaCols, rows, noRejects)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if written.Sum() != accepted.Sum() {
+		t.Errorf("written %s, accepted %s", written.Sum(), accepted.Sum())
+	}
+	r := consumeAll(t, brokers, "orders", 1)[0]
+	var key map[string]interface{}
+	if err := json.Unmarshal(r.Key, &key); err != nil || key["region"] != "eu" {
+		t.Errorf("key = %s, %v", r.Key, err)
+	}
+	var ev struct {
+		Op    string                 `json:"op"`
+		Table string                 `json:"table"`
+		RunID string                 `json:"run_id"`
+		TsMS  int64                  `json:"ts_ms"`
+		After map[string]interface{} `json:"after"`
+	}
+	if err := json.Unmarshal(r.Value, &ev); err != nil {
+		t.Fatal(err)
+	}
+	if ev.Op != "upsert" || ev.Table != "orders" || ev.RunID != "run1" || ev.TsMS != 1700000000000 || ev.After["region"] != "eu" {
+		t.Errorf("event = %+v", ev)
+	}
+}
+
+func TestKafkaWriteManualPartition(t *testing.T) {
+	brokers := kafkaCluster(t)
+	w := openTestKafka(t, brokers, model.DestinationConfig{
+		"topic": "orders", "partitioner": "manual", "partition_column": "id",
+	}, nil)
+	rows := []map[string]interface{}{
+		{"id": "2", "region": "eu", "amount": nil},
+		{"id": "-1", "region": "eu", "amount": nil},
+	}
+	var rowErr *output.RowError
+	_, _, err := w.Write(loopback(), kafkaCols, rows, func(row map[string]interface{}, err error) error {
+		if !errors.As(err, &rowErr) || rowErr.Column != "id" {
+			t.Errorf("rejected %v for %v", err, row)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rowErr == nil {
+		t.Error("partition -1 was not rejected")
+	}
+	if r := consumeAll(t, brokers, "orders", 1)[0]; r.Partition != 2 {
+		t.Errorf("message went to partition %d, want 2", r.Partition)
+	}
+}
+
+// registry is a schema registry that gives every schema it is sent the
+// next ID.
+type registry struct {
+	mu      sync.Mutex
+	schemas []string
+}
+
+func (reg *registry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.URL.Path != "/subjects/orders-value/versions" {
+		http.NotFound(w, r)
+		return
+	}
+	var body struct {
+		Schema string `json:"schema"`
+	}
+	b, _ := io.ReadAll(r.Body)
+	if err := json.Unmarshal(b, &body); err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	reg.mu.Lock()
+	reg.schemas = append(reg.schemas, body.Schema)
+	id := len(reg.schemas)
+	reg.mu.Unlock()
+	json.NewEncoder(w).Encode(map[string]int{"id": id})
+}
+
+func TestKafkaWriteAvro(t *testing.T) {
+	brokers := kafkaCluster(t)
+	reg := &registry{}
+	srv := httptest.NewServer(reg)
+	defer srv.Close()
+	w := openTestKafka(t, brokers, model.DestinationConfig{"topic": "orders", "value_format": "avro"},
+		map[string]interface{}{"schema_registry_url": srv.URL})
+	rows := []map[string]interface{}{{"id": "1", "region": "eu", "amount": "9.50"}}
+	written, accepted, err := w.Write(loopback(), kafkaCols, rows, noRejects)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if written.Sum() != accepted.Sum() {
+		t.Errorf("written %s, accepted %s", written.Sum(), accepted.Sum())
+	}
+	if len(reg.schemas) != 1 || !strings.Contains(reg.schemas[0], `"region"`) {
+		t.Errorf("registered %v", reg.schemas)
+	}
+	r := consumeAll(t, brokers, "orders", 1)[0]
+	if id, _, err := kafka.Unframe(r.Value); err != nil || id != 1 {
+		t.Errorf("value is framed with schema %d, %v; want 1", id, err)
+	}
+}
+
+func TestKafkaRefused(t *testing.T) {
+	brokers := kafkaCluster(t)
+	connID := "c1"
+	connCfg := map[string]interface{}{"brokers": brokers[0]}
+	d := &model.Destination{Type: "kafka", ConnectorID: &connID, Config: model.DestinationConfig{"topic": "orders"}}
+	if _, err := Open(context.Background(), d, connCfg, output.Vars{}); !errors.Is(err, egress.ErrBlocked) {
+		t.Errorf("default egress: err = %v, want egress.ErrBlocked", err)
+	}
+	d.Config["topic"] = "missing"
+	if _, err := Open(loopback(), d, connCfg, output.Vars{}); err == nil {
+		t.Error("a missing topic was accepted")
+	}
+	d.Config["value_format"] = "avro"
+	d.Config["topic"] = "orders"
+	if _, err := Open(loopback(), d, connCfg, output.Vars{}); err == nil || !strings.Contains(err.Error(), "schema_registry_url") {
+		t.Errorf("avro without a registry: err = %v", err)
+	}
+}
+
+func TestKafkaConfig(t *testing.T) {
+	for _, tc := range []struct {
+		cfg  model.DestinationConfig
+		want string
+	}{
+		{model.DestinationConfig{}, "topic is required"},
+		{model.DestinationConfig{"topic": "t", "value_format": "xml"}, "value_format"},
+		{model.DestinationConfig{"topic": "t", "envelope": "change", "value_format": "avro"}, "JSON only"},
+		{model.DestinationConfig{"topic": "t", "partitioner": "manual"}, "partition_column"},
+		{model.DestinationConfig{"topic": "t", "partition_column": "p"}, "manual partitioner"},
+		{model.DestinationConfig{"topic": "t", "acks": "leader"}, "idempotent"},
+		{model.DestinationConfig{"topic": "t", "compression": "brotli"}, "compression"},
+		{model.DestinationConfig{"topic": "t", "linger_ms": 1.5}, "linger_ms"},
+	} {
+		if _, err := kafkaConfigFrom(tc.cfg); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("kafkaConfigFrom(%v) = %v, want an error with %q", tc.cfg, err, tc.want)
+		}
+	}
+	kc, err := kafkaConfigFrom(model.DestinationConfig{"topic": "t", "acks": "none", "idempotent": false, "key_column": " a, b ,"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(kc.KeyColumns) != 2 || kc.KeyColumns[1] != "b" || kc.Partitioner != "key" {
+		t.Errorf("config = %+v", kc)
+	}
+}
@@ -0,0 +1,97 @@
+package destination
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path"
+
+	"github.com/Zubimendi/sync-loop/api/internal/checksum"
+	"github.com/Zubimendi/sync-loop/api/internal/localfs"
+	"github.com/Zubimendi/sync-loop/api/internal/model"
+	"github.com/Zubimendi/sync-loop/api/internal/output"
+)
+
+// localFile writes each batch as one file in the directory of a file
+// connector, on the worker.
+type localFile struct {
+	dir    *localfs.Dir
+	format output.Format
+	key    string
+}
+
+func openLocal(d *model.Destination, connCfg map[string]interface{}, vars output.Vars) (*localFile, error) {
+	bc, err := batchFileConfigFrom("file", d.Config)
+	if err != nil {
+		return nil, err
+	}
+	format, key, err := bc.batchFile(vars)
+	if err != nil {
+		return nil, err
+	}
+	dir, err := localfs.Open(connCfg)
+	if err != nil {
+		return nil, err
+	}
+	return &localFile{dir: dir, format: format, key: key}, nil
+}
+
+func (l *localFile) Close() error { return l.dir.Close() }
+
+// Write works as the sftp destination's does: a hidden temporary file,
+// read back, then renamed into place.
+func (l *localFile) Write(ctx context.Context, cols []model.Column, rows []map[string]interface{}, reject func(map[string]interface{}, error) error) (*checksum.Digest, *checksum.Digest, error) {
+	buf, accepted, err := encodeBatch(l.format, cols, rows, reject)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := l.dir.MkdirAll(path.Dir(l.key)); err != nil {
+		return nil, nil, fmt.Errorf("file destination: %s: %w", path.Dir(l.key), err)
+	}
+	tmp := path.Join(path.Dir(l.key), "."+path.Base(l.key)+".part-"+randomHex(6))
+	if err := l.save(tmp, buf); err != nil {
+		l.dir.Remove(tmp)
+		return nil, nil, fmt.Errorf("file destination: write %s: %w", l.key, err)
+	}
+	written, err := l.readBack(tmp)
+	if err == nil {
+		err = l.dir.Replace(tmp, l.key)
+	}
+	if err != nil {
+		l.dir.Remove(tmp)
+		return nil, nil, fmt.Errorf("file destination: %s: %w", l.key, err)
+	}
+	return written, accepted, nil
+}
+
+// save writes and syncs the file, so the rename never publishes data that
+// is not yet on disk.
+func (l *localFile) save(key string, data *bytes.Buffer) error {
+	f, err := l.dir.Create(key)
+	if err != nil {
+		return err
+	}
+	if _, err := data.WriteTo(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (l *localFile) readBack(key string) (*checksum.Digest, error) {
+	f, err := l.dir.Open(key)
+	if err != nil {
+		return nil, fmt.Errorf("read back: %w", err)
+	}
+	defer f.Close()
+	d, err := l.format.Digest(f)
+	if err != nil {
+		return nil, fmt.Errorf("read back: %w", err)
+	}
+	return d, nil
+}
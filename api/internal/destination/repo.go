@@ -0,0 +1,71 @@
+package destination
+
+import (
+	"context"
+
+	"github.com/Zubimendi/sync-loop/api/internal/model"
+	"github.com/jmoiron/sqlx"
+)
+
+type Repo struct {
+	db *sqlx.DB
+}
+
+func NewRepo(db *sqlx.DB) *Repo { return &Repo{db: db} }
+
+const columns = `id, connector_id, workspace_id, name, type, config_json, created_at`
+
+// Create adds a destination to the workspace. One with a connector must be
+// written by a connector of the workspace of the same type; sql.ErrNoRows
+// means there is no such connector.
+func (r *Repo) Create(ctx context.Context, d *model.Destination, workspaceID string) error {
+	if d.ConnectorID == nil {
+		return r.db.QueryRowxContext(ctx, `
+			INSERT INTO destination (workspace_id, name, type, config_json)
+			VALUES ($1, $2, $3, $4)
+			RETURNING `+columns, workspaceID, d.Name, d.Type, d.Config).StructScan(d)
+	}
+	return r.db.QueryRowxContext(ctx, `
+		INSERT INTO destination (connector_id, workspace_id, name, type, config_json)
+		SELECT c.id, c.workspace_id, $3, $4, $5 FROM connector c
+		WHERE c.id = $1 AND c.workspace_id = $2 AND c.type = $4
+		RETURNING `+columns,
+		d.ConnectorID, workspaceID, d.Name, d.Type, d.Config).StructScan(d)
+}
+
+func (r *Repo) ListByWorkspace(ctx context.Context, workspaceID string) ([]model.Destination, error) {
+	dd := make([]model.Destination, 0)
+	err := r.db.SelectContext(ctx, &dd, `
+		SELECT `+columns+` FROM destination
+		WHERE workspace_id = $1 ORDER BY created_at`, workspaceID)
+	return dd, err
+}
+
+// Get loads a destination by id alone, for the worker.
+func (r *Repo) Get(ctx context.Context, id string) (*model.Destination, error) {
+	var d model.Destination
+	err := r.db.GetContext(ctx, &d, `SELECT `+columns+` FROM destination WHERE id = $1`, id)
+	if err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+func (r *Repo) GetInWorkspace(ctx context.Context, id, workspaceID string) (*model.Destination, error) {
+	var d model.Destination
+	err := r.db.GetContext(ctx, &d, `
+		SELECT `+columns+` FROM destination WHERE id = $1 AND workspace_id = $2`, id, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+func (r *Repo) Delete(ctx context.Context, id, workspaceID string) (int64, error) {
+	res, err := r.db.ExecContext(ctx,
+		`DELETE FROM destination WHERE id = $1 AND workspace_id = $2`, id, workspaceID)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
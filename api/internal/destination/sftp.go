@@ -0,0 +1,94 @@
+package destination
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path"
+
+	"github.com/Zubimendi/sync-loop/api/internal/checksum"
+	"github.com/Zubimendi/sync-loop/api/internal/model"
+	"github.com/Zubimendi/sync-loop/api/internal/output"
+	"github.com/Zubimendi/sync-loop/api/internal/sftpconn"
+)
+
+// sftpFile writes each batch as one file on an SFTP server.
+type sftpFile struct {
+	conn   *sftpconn.Conn
+	format output.Format
+	key    string
+}
+
+func openSFTP(ctx context.Context, d *model.Destination, connCfg map[string]interface{}, vars output.Vars) (*sftpFile, error) {
+	bc, err := batchFileConfigFrom("sftp", d.Config)
+	if err != nil {
+		return nil, err
+	}
+	format, key, err := bc.batchFile(vars)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := sftpconn.Open(ctx, connCfg)
+	if err != nil {
+		return nil, err
+	}
+	return &sftpFile{conn: conn, format: format, key: key}, nil
+}
+
+func (s *sftpFile) Close() error { return s.conn.Close() }
+
+// Write uploads the batch under a hidden temporary name in the target's
+// directory, reads it back and only then renames it into place, so readers
+// of the directory never see a partial file. A rerun of a run replaces its
+// file.
+func (s *sftpFile) Write(ctx context.Context, cols []model.Column, rows []map[string]interface{}, reject func(map[string]interface{}, error) error) (*checksum.Digest, *checksum.Digest, error) {
+	buf, accepted, err := encodeBatch(s.format, cols, rows, reject)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dst := s.conn.Path(s.key)
+	if err := s.conn.MkdirAll(path.Dir(dst)); err != nil {
+		return nil, nil, fmt.Errorf("sftp destination: %s: %w", path.Dir(s.key), err)
+	}
+	tmp := path.Join(path.Dir(dst), "."+path.Base(dst)+".part-"+randomHex(6))
+	if err := s.upload(tmp, buf); err != nil {
+		s.conn.Remove(tmp)
+		return nil, nil, fmt.Errorf("sftp destination: upload %s: %w", s.key, err)
+	}
+	written, err := s.readBack(tmp)
+	if err == nil {
+		err = s.conn.Replace(tmp, dst)
+	}
+	if err != nil {
+		s.conn.Remove(tmp)
+		return nil, nil, fmt.Errorf("sftp destination: %s: %w", s.key, err)
+	}
+	return written, accepted, nil
+}
+
+func (s *sftpFile) upload(p string, data *bytes.Buffer) error {
+	f, err := s.conn.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_EXCL)
+	if err != nil {
+		return err
+	}
+	if _, err := f.ReadFrom(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (s *sftpFile) readBack(p string) (*checksum.Digest, error) {
+	f, err := s.conn.Open(p)
+	if err != nil {
+		return nil, fmt.Errorf("read back: %w", err)
+	}
+	defer f.Close()
+	d, err := s.format.Digest(f)
+	if err != nil {
+		return nil, fmt.Errorf("read back: %w", err)
+	}
+	return d, nil
+}
@@ -0,0 +1,93 @@
+package destination
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Zubimendi/sync-loop/api/internal/egress"
+	"github.com/Zubimendi/sync-loop/api/internal/model"
+	"github.com/Zubimendi/sync-loop/api/internal/output"
+	"github.com/Zubimendi/sync-loop/api/internal/sshtest"
+)
+
+// loopback lets destinations reach the test servers, which the default
+// egress policy refuses.
+func loopback() context.Context {
+	return egress.NewContext(context.Background(), egress.New([]netip.Prefix{netip.MustParsePrefix("127.0.0.0/8")}))
+}
+
+func noRejects(row map[string]interface{}, err error) error { return err }
+
+func TestSFTPWrite(t *testing.T) {
+	srv := sshtest.NewServer(t, "ops", "pw")
+	connCfg := srv.Config()
+	connCfg["root"] = "drop"
+	connID := "c1"
+	d := &model.Destination{
+		Type:        "sftp",
+		ConnectorID: &connID,
+		Config:      model.DestinationConfig{"path": "{table}/{table}-{run_id}", "format": "csv"},
+	}
+	if err := Validate(d); err != nil {
+		t.Fatal(err)
+	}
+	cols := []model.Column{{Name: "id", Type: "bigint"}, {Name: "name", Type: "text", Nullable: true}}
+	write := func(rows []map[string]interface{}) {
+		t.Helper()
+		w, err := Open(loopback(), d, connCfg, output.Vars{Table: "orders", RunID: "run1"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer w.Close()
+		written, accepted, err := w.Write(loopback(), cols, rows, noRejects)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if written.Rows() != int64(len(rows)) || written.Sum() != accepted.Sum() {
+			t.Errorf("read back %d rows %s, accepted %d rows %s", written.Rows(), written.Sum(), accepted.Rows(), accepted.Sum())
+		}
+	}
+	write([]map[string]interface{}{{"id": "1", "name": "ann"}, {"id": "2", "name": nil}})
+	// A rerun of the run replaces its file.
+	write([]map[string]interface{}{{"id": "3", "name": "bo"}})
+
+	dir := filepath.Join(srv.Dir, "drop", "orders")
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "orders-run1.csv" {
+		var names []string
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		t.Fatalf("files = %v, want only orders-run1.csv and no partial uploads", names)
+	}
+	b, _ := os.ReadFile(filepath.Join(dir, "orders-run1.csv"))
+	if got := string(b); !strings.Contains(got, "3,bo") || strings.Contains(got, "ann") {
+		t.Errorf("file = %q", got)
+	}
+}
+
+func TestSFTPWriteRefused(t *testing.T) {
+	srv := sshtest.NewServer(t, "ops", "pw")
+	connID := "c1"
+	d := &model.Destination{Type: "sftp", ConnectorID: &connID, Config: model.DestinationConfig{"format": "csv"}}
+	if _, err := Open(context.Background(), d, srv.Config(), output.Vars{Table: "t", RunID: "r"}); !errors.Is(err, egress.ErrBlocked) {
+		t.Errorf("default egress: err = %v, want egress.ErrBlocked", err)
+	}
+	cfg := srv.Config()
+	cfg["password"] = "guess"
+	if _, err := Open(loopback(), d, cfg, output.Vars{Table: "t", RunID: "r"}); err == nil {
+		t.Error("a wrong password was accepted")
+	}
+	d.Config["format"] = "dbf"
+	if err := Validate(d); err == nil {
+		t.Error("format dbf was accepted")
+	}
+}
@@ -0,0 +1,143 @@
+package destination
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Zubimendi/sync-loop/api/internal/model"
+	"github.com/Zubimendi/sync-loop/api/internal/storage"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// ErrNoSnapshot means nothing was loaded into a file destination yet.
+var ErrNoSnapshot = errors.New("no snapshot yet")
+
+// snapshotConfig says where a file destination's latest snapshot is kept:
+// storage s3 (the default) keeps it in the bucket under the destination's
+// id, storage volume as file in DESTINATION_DIR/<workspace id>/<destination
+// id>, under a directory shared by the worker and the API.
+type snapshotConfig struct {
+	Storage string
+	File    string
+}
+
+func snapshotConfigFrom(c model.DestinationConfig) (snapshotConfig, error) {
+	s := func(k string) string {
+		v, _ := c[k].(string)
+		return v
+	}
+	sc := snapshotConfig{Storage: s("storage"), File: s("file")}
+	switch sc.Storage {
+	case "", "s3":
+		sc.Storage = "s3"
+	case "volume":
+		if os.Getenv("DESTINATION_DIR") == "" {
+			return sc, errors.New("volume storage needs DESTINATION_DIR to be set")
+		}
+		if sc.File == "." || strings.ContainsAny(sc.File, `/\`) || !filepath.IsLocal(sc.File) {
+			return sc, errors.New("volume storage needs a file name without directories")
+		}
+	default:
+		return sc, fmt.Errorf("storage %q is not s3 or volume", sc.Storage)
+	}
+	return sc, nil
+}
+
+// snapshotStore keeps the latest file of a destination.
+type snapshotStore interface {
+	// Publish makes the file at path the latest snapshot.
+	Publish(ctx context.Context, path string) error
+	// Open reads the latest snapshot; ErrNoSnapshot when there is none.
+	Open(ctx context.Context) (io.ReadCloser, error)
+}
+
+// fetch copies the latest snapshot to w, writing nothing when there is none
+// yet.
+func fetch(ctx context.Context, s snapshotStore, w io.Writer) error {
+	r, err := s.Open(ctx)
+	if errors.Is(err, ErrNoSnapshot) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	_, err = io.Copy(w, r)
+	return err
+}
+
+func (sc snapshotConfig) store(ctx context.Context, d *model.Destination, ext string) (snapshotStore, error) {
+	if sc.Storage == "volume" {
+		return volumeSnapshot(filepath.Join(os.Getenv("DESTINATION_DIR"), d.WorkspaceID, d.ID, sc.File)), nil
+	}
+	store, err := storage.FromEnv(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &bucketSnapshot{store: store, key: "destinations/" + d.ID + "/latest" + ext}, nil
+}
+
+type bucketSnapshot struct {
+	store *storage.Store
+	key   string
+}
+
+func (b *bucketSnapshot) Publish(ctx context.Context, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return b.store.Put(ctx, b.key, f)
+}
+
+func (b *bucketSnapshot) Open(ctx context.Context) (io.ReadCloser, error) {
+	r, err := b.store.Get(ctx, b.key)
+	var missing *types.NoSuchKey
+	if errors.As(err, &missing) {
+		return nil, ErrNoSnapshot
+	}
+	return r, err
+}
+
+type volumeSnapshot string
+
+// Publish copies the file next to the snapshot and renames it into place,
+// so readers never see half a file.
+func (v volumeSnapshot) Publish(ctx context.Context, path string) error {
+	dst := string(v)
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	tmp, err := os.CreateTemp(filepath.Dir(dst), "."+filepath.Base(dst)+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, src); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), dst)
+}
+
+func (v volumeSnapshot) Open(ctx context.Context) (io.ReadCloser, error) {
+	f, err := os.Open(string(v))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNoSnapshot
+	}
+	return f, err
+}
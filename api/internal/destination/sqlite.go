@@ -0,0 +1,36 @@
+package destination
+
+import (
+	"fmt"
+
+	"github.com/Zubimendi/sync-loop/api/internal/model"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// sqliteDialect writes SQLite files. SQLite has no date, timestamp or exact
+// decimal types, so those are kept as canonical text, and booleans as 0 and
+// 1.
+var sqliteDialect = dialect{
+	name:   "sqlite",
+	driver: "sqlite3",
+	ext:    ".sqlite",
+	columnType: func(c model.Column) string {
+		switch baseType(c) {
+		case "bigint", "boolean":
+			return "INTEGER"
+		case "double precision":
+			return "REAL"
+		}
+		return "TEXT"
+	},
+}
+
+func fileDialect(typ string) (dialect, error) {
+	switch typ {
+	case "sqlite":
+		return sqliteDialect, nil
+	case "duckdb":
+		return duckdbDialect, nil
+	}
+	return dialect{}, fmt.Errorf("destination type %q is not a file database", typ)
+}
@@ -0,0 +1,123 @@
+package destination
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/Zubimendi/sync-loop/api/internal/checksum"
+	"github.com/Zubimendi/sync-loop/api/internal/egress"
+	"github.com/Zubimendi/sync-loop/api/internal/model"
+	"github.com/Zubimendi/sync-loop/api/internal/output"
+	"github.com/Zubimendi/sync-loop/api/internal/webhook"
+)
+
+const defaultWebhookBatch = 100
+
+// webhookConfig is the config of a webhook destination: batch_size, the
+// rows of one request. The url, headers and signing secret are the
+// connector's.
+type webhookConfig struct {
+	BatchSize int
+}
+
+func webhookConfigFrom(c model.DestinationConfig) (webhookConfig, error) {
+	wc := webhookConfig{BatchSize: defaultWebhookBatch}
+	if n, ok := c["batch_size"].(float64); ok {
+		if n < 1 || n != float64(int(n)) {
+			return wc, fmt.Errorf("webhook destination: batch_size %v is not a positive integer", n)
+		}
+		wc.BatchSize = int(n)
+	}
+	return wc, nil
+}
+
+// hook POSTs batches of rows to the endpoint of a webhook connector, each
+// as
+//
+//	{"run_id":"...","table":"orders","batch":0,"rows":[{"id":1,...},...]}
+//
+// with rows in the typed JSON of the ndjson output format. Every batch has
+// an idempotency key made of the run ID and its number, the same when a
+// failed load is retried, so endpoints can skip batches they already took.
+type hook struct {
+	client *webhook.Client
+	cfg    webhookConfig
+	vars   output.Vars
+	format output.Format
+}
+
+func openWebhook(ctx context.Context, d *model.Destination, connCfg map[string]interface{}, vars output.Vars) (*hook, error) {
+	wc, err := webhookConfigFrom(d.Config)
+	if err != nil {
+		return nil, err
+	}
+	cc, err := webhook.ConfigFrom(connCfg)
+	if err != nil {
+		return nil, err
+	}
+	format, err := output.New(model.OutputOptions{Format: "ndjson"})
+	if err != nil {
+		return nil, err
+	}
+	client := webhook.New(cc, egress.FromContext(ctx).Transport())
+	return &hook{client: client, cfg: wc, vars: vars, format: format}, nil
+}
+
+func (h *hook) Close() error {
+	h.client.Close()
+	return nil
+}
+
+// Write sends the batches in order and stops at the first the endpoint
+// refuses. An endpoint cannot be read back, so the written digest is of the
+// rows decoded from the requests it acknowledged.
+func (h *hook) Write(ctx context.Context, cols []model.Column, rows []map[string]interface{}, reject func(map[string]interface{}, error) error) (*checksum.Digest, *checksum.Digest, error) {
+	buf, accepted, err := encodeBatch(h.format, cols, rows, reject)
+	if err != nil {
+		return nil, nil, err
+	}
+	lines := bytes.Split(bytes.TrimSuffix(buf.Bytes(), []byte("\n")), []byte("\n"))
+	if buf.Len() == 0 {
+		lines = nil
+	}
+	written := &checksum.Digest{}
+	for n := 0; n*h.cfg.BatchSize < len(lines); n++ {
+		batch := lines[n*h.cfg.BatchSize : min((n+1)*h.cfg.BatchSize, len(lines))]
+		body, err := h.body(n, batch)
+		if err != nil {
+			return nil, nil, err
+		}
+		key := ""
+		if h.vars.RunID != "" {
+			key = fmt.Sprintf("syncloop-%s-%d", h.vars.RunID, n)
+		}
+		if err := h.client.Post(ctx, body, key); err != nil {
+			return nil, nil, fmt.Errorf("webhook destination: batch %d of %d: %w", n+1, (len(lines)+h.cfg.BatchSize-1)/h.cfg.BatchSize, err)
+		}
+		d, err := h.format.Digest(bytes.NewReader(bytes.Join(batch, []byte("\n"))))
+		if err != nil {
+			return nil, nil, err
+		}
+		written.Merge(d)
+	}
+	return written, accepted, nil
+}
+
+func (h *hook) body(n int, rows [][]byte) ([]byte, error) {
+	head, err := json.Marshal(struct {
+		RunID string `json:"run_id"`
+		Table string `json:"table"`
+		Batch int    `json:"batch"`
+	}{h.vars.RunID, h.vars.Table, n})
+	if err != nil {
+		return nil, err
+	}
+	var b bytes.Buffer
+	b.Write(head[:len(head)-1])
+	b.WriteString(`,"rows":[`)
+	b.Write(bytes.Join(rows, []byte(",")))
+	b.WriteString("]}")
+	return b.Bytes(), nil
+}
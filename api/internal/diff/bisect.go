@@ -0,0 +1,266 @@
+// Package diff compares a table or query across two connectors. Key ranges
+// whose count and hash agree on both sides are skipped; the rest are split
+// in half until they are small enough to compare row by row.
+package diff
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/Zubimendi/sync-loop/api/internal/model"
+	"github.com/Zubimendi/sync-loop/api/internal/source"
+)
+
+const (
+	Missing    = "missing"    // in source, not in target
+	Extra      = "extra"      // in target, not in source
+	Mismatched = "mismatched" // in both, values differ
+)
+
+type Options struct {
+	Key        string
+	Columns    []string // compared on both sides; defaults to the common ones
+	Tolerances []model.DiffTolerance
+	// LeafRows is the segment size below which rows are compared directly.
+	LeafRows int64
+	// Progress is called after every segment, e.g. to heartbeat.
+	Progress func(model.DiffStats)
+}
+
+type Entry struct {
+	Kind    string     `json:"kind"`
+	Key     string     `json:"key"`
+	Columns []string   `json:"columns,omitempty"`
+	Source  source.Row `json:"source,omitempty"`
+	Target  source.Row `json:"target,omitempty"`
+}
+
+type differ struct {
+	src, dst       source.Segmenter
+	srcRel, dstRel source.Relation
+	opt            Options
+	tol            map[string]tolerance
+	stats          model.DiffStats
+	emit           func(Entry) error
+}
+
+// Run diffs srcRel on src against dstRel on dst and hands every differing
+// row to emit. Rows with a NULL key are not compared.
+func Run(ctx context.Context, src, dst source.Segmenter, srcRel, dstRel source.Relation, opt Options, emit func(Entry) error) (model.DiffStats, error) {
+	if opt.Key == "" {
+		return model.DiffStats{}, fmt.Errorf("diff needs a key column")
+	}
+	if opt.LeafRows <= 0 {
+		opt.LeafRows = 1000
+	}
+	tol, err := compileTolerances(opt.Tolerances)
+	if err != nil {
+		return model.DiffStats{}, err
+	}
+	d := &differ{src: src, dst: dst, srcRel: srcRel, dstRel: dstRel, opt: opt, tol: tol, emit: emit}
+
+	srcCols, err := src.RelationColumns(ctx, srcRel)
+	if err != nil {
+		return model.DiffStats{}, err
+	}
+	dstCols, err := dst.RelationColumns(ctx, dstRel)
+	if err != nil {
+		return model.DiffStats{}, err
+	}
+	common, srcOnly, dstOnly := splitColumns(srcCols, dstCols)
+	d.stats.SourceOnlyCols, d.stats.TargetOnlyCols = srcOnly, dstOnly
+	if len(d.opt.Columns) == 0 {
+		d.opt.Columns = common
+	}
+	if !contains(common, opt.Key) {
+		return model.DiffStats{}, fmt.Errorf("key column %q must exist on both sides", opt.Key)
+	}
+
+	if err := d.segment(ctx, source.KeyRange{}, true); err != nil {
+		return d.stats, err
+	}
+	return d.stats, nil
+}
+
+func (d *differ) segment(ctx context.Context, r source.KeyRange, root bool) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	sn, sh, err := d.src.SegmentHash(ctx, d.srcRel, d.opt.Key, d.opt.Columns, r)
+	if err != nil {
+		return fmt.Errorf("source: %w", err)
+	}
+	tn, th, err := d.dst.SegmentHash(ctx, d.dstRel, d.opt.Key, d.opt.Columns, r)
+	if err != nil {
+		return fmt.Errorf("target: %w", err)
+	}
+	if root {
+		d.stats.SourceRows, d.stats.TargetRows = sn, tn
+	}
+	d.stats.SegmentsCompared++
+	defer func() {
+		if d.opt.Progress != nil {
+			d.opt.Progress(d.stats)
+		}
+	}()
+
+	if sn == tn && sh == th {
+		d.stats.SegmentsSkipped++
+		d.stats.RowsSkipped += sn
+		return nil
+	}
+	if sn+tn <= 2*d.opt.LeafRows {
+		return d.compareRows(ctx, r)
+	}
+
+	// Split at the median key of the larger side.
+	var mid string
+	if sn >= tn {
+		mid, err = d.src.SplitKey(ctx, d.srcRel, d.opt.Key, r, sn/2)
+	} else {
+		mid, err = d.dst.SplitKey(ctx, d.dstRel, d.opt.Key, r, tn/2)
+	}
+	if err != nil {
+		return err
+	}
+	// A run of duplicate keys cannot be split further.
+	if r.Lo != nil && *r.Lo == mid {
+		return d.compareRows(ctx, r)
+	}
+	if err := d.segment(ctx, source.KeyRange{Lo: r.Lo, Hi: &mid}, false); err != nil {
+		return err
+	}
+	return d.segment(ctx, source.KeyRange{Lo: &mid, Hi: r.Hi}, false)
+}
+
+func (d *differ) compareRows(ctx context.Context, r source.KeyRange) error {
+	srcRows := map[string]source.Row{}
+	var order []string
+	err := d.src.ReadRange(ctx, d.srcRel, d.opt.Key, r, func(row source.Row) error {
+		k, _ := row[d.opt.Key].(string)
+		if _, dup := srcRows[k]; !dup {
+			order = append(order, k)
+		}
+		srcRows[k] = row
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("source: %w", err)
+	}
+	err = d.dst.ReadRange(ctx, d.dstRel, d.opt.Key, r, func(row source.Row) error {
+		k, _ := row[d.opt.Key].(string)
+		s, ok := srcRows[k]
+		if !ok {
+			d.stats.Extra++
+			return d.emit(Entry{Kind: Extra, Key: k, Target: row})
+		}
+		delete(srcRows, k)
+		if cols := d.differing(s, row); len(cols) > 0 {
+			d.stats.Mismatched++
+			return d.emit(Entry{Kind: Mismatched, Key: k, Columns: cols, Source: s, Target: row})
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("target: %w", err)
+	}
+	for _, k := range order {
+		if s, ok := srcRows[k]; ok {
+			d.stats.Missing++
+			if err := d.emit(Entry{Kind: Missing, Key: k, Source: s}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (d *differ) differing(a, b source.Row) []string {
+	var cols []string
+	for _, c := range d.opt.Columns {
+		av, _ := a[c].(string)
+		bv, _ := b[c].(string)
+		if av == bv && (a[c] == nil) == (b[c] == nil) {
+			continue
+		}
+		if t, ok := d.tol[c]; ok && a[c] != nil && b[c] != nil && t.equal(av, bv) {
+			continue
+		}
+		cols = append(cols, c)
+	}
+	return cols
+}
+
+type tolerance struct {
+	numeric float64
+	drift   time.Duration
+}
+
+func compileTolerances(tt []model.DiffTolerance) (map[string]tolerance, error) {
+	out := make(map[string]tolerance, len(tt))
+	for _, t := range tt {
+		ct := tolerance{numeric: t.Numeric}
+		if t.Time != "" {
+			d, err := time.ParseDuration(t.Time)
+			if err != nil {
+				return nil, fmt.Errorf("tolerance for %s: %w", t.Column, err)
+			}
+			ct.drift = d
+		}
+		out[t.Column] = ct
+	}
+	return out, nil
+}
+
+func (t tolerance) equal(a, b string) bool {
+	if t.numeric > 0 {
+		if x, y, ok := parseFloats(a, b); ok {
+			return math.Abs(x-y) <= t.numeric
+		}
+	}
+	if t.drift > 0 {
+		if x, y, ok := parseTimes(a, b); ok {
+			delta := x.Sub(y)
+			if delta < 0 {
+				delta = -delta
+			}
+			return delta <= t.drift
+		}
+	}
+	return false
+}
+
+func splitColumns(a, b []string) (common, aOnly, bOnly []string) {
+	inB := make(map[string]bool, len(b))
+	for _, c := range b {
+		inB[c] = true
+	}
+	inA := make(map[string]bool, len(a))
+	for _, c := range a {
+		inA[c] = true
+		if inB[c] {
+			common = append(common, c)
+		} else {
+			aOnly = append(aOnly, c)
+		}
+	}
+	for _, c := range b {
+		if !inA[c] {
+			bOnly = append(bOnly, c)
+		}
+	}
+	sort.Strings(common)
+	return common, aOnly, bOnly
+}
+
+func contains(ss []string, s string) bool {
+	for _, v := range ss {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
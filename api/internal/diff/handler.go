@@ -0,0 +1,136 @@
+package diff
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Zubimendi/sync-loop/api/internal/connector"
+	"github.com/Zubimendi/sync-loop/api/internal/middleware"
+	"github.com/Zubimendi/sync-loop/api/internal/model"
+	"github.com/Zubimendi/sync-loop/api/internal/workflow"
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
+	"go.temporal.io/sdk/client"
+)
+
+type Handler struct {
+	repo     *Repo
+	conns    *connector.Repo
+	temporal client.Client
+}
+
+func NewHandler(repo *Repo, conns *connector.Repo, temporal client.Client) *Handler {
+	return &Handler{repo: repo, conns: conns, temporal: temporal}
+}
+
+type startReq struct {
+	SourceConnectorID string                `json:"source_connector_id"`
+	TargetConnectorID string                `json:"target_connector_id"`
+	SourceTable       string                `json:"source_table"`
+	SourceQuery       string                `json:"source_query"`
+	TargetTable       string                `json:"target_table"`
+	TargetQuery       string                `json:"target_query"`
+	KeyColumn         string                `json:"key_column"`
+	Columns           []string              `json:"columns"`
+	Tolerances        []model.DiffTolerance `json:"tolerances"`
+	LeafRows          int64                 `json:"leaf_rows"`
+}
+
+// POST /api/v1/diffs – start a DataDiffWorkflow between two connectors of
+// the workspace
+func (h *Handler) Start(w http.ResponseWriter, r *http.Request) {
+	var req startReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+	if req.SourceConnectorID == "" || req.TargetConnectorID == "" {
+		http.Error(w, "source_connector_id and target_connector_id are required", http.StatusBadRequest)
+		return
+	}
+	if req.SourceTable == "" && req.SourceQuery == "" {
+		http.Error(w, "source_table or source_query is required", http.StatusBadRequest)
+		return
+	}
+	if req.KeyColumn == "" {
+		http.Error(w, "key_column is required", http.StatusBadRequest)
+		return
+	}
+	for _, t := range req.Tolerances {
+		if t.Time != "" {
+			if _, err := time.ParseDuration(t.Time); err != nil {
+				http.Error(w, fmt.Sprintf("tolerance for %s: %v", t.Column, err), http.StatusBadRequest)
+				return
+			}
+		}
+	}
+	wid := r.Context().Value(middleware.CtxWorkspaceID).(string)
+	for _, id := range []string{req.SourceConnectorID, req.TargetConnectorID} {
+		c, err := h.conns.Get(r.Context(), id)
+		if errors.Is(err, sql.ErrNoRows) || (err == nil && c.Workspace != wid) {
+			http.Error(w, "connector not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	we, err := h.temporal.ExecuteWorkflow(r.Context(), client.StartWorkflowOptions{
+		TaskQueue: "sync-loop-task-queue",
+		ID:        fmt.Sprintf("diff-%s-%d", req.SourceTable, time.Now().Unix()),
+	}, workflow.DataDiffWorkflow, workflow.DataDiffParams{
+		WorkspaceID:       wid,
+		SourceConnectorID: req.SourceConnectorID,
+		TargetConnectorID: req.TargetConnectorID,
+		SourceTable:       req.SourceTable,
+		SourceQuery:       req.SourceQuery,
+		TargetTable:       req.TargetTable,
+		TargetQuery:       req.TargetQuery,
+		KeyColumn:         req.KeyColumn,
+		Columns:           req.Columns,
+		Tolerances:        req.Tolerances,
+		LeafRows:          req.LeafRows,
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("execute diff workflow")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"workflow_id": we.GetID(),
+		"run_id":      we.GetRunID(),
+	})
+}
+
+// GET /api/v1/diffs
+func (h *Handler) List(w http.ResponseWriter, r *http.Request) {
+	wid := r.Context().Value(middleware.CtxWorkspaceID).(string)
+	dd, err := h.repo.ListByWorkspace(r.Context(), wid)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"diffs": dd})
+}
+
+// GET /api/v1/diffs/{id} – summary counts; the row-level report is in the
+// bucket under report_key.
+func (h *Handler) Get(w http.ResponseWriter, r *http.Request) {
+	wid := r.Context().Value(middleware.CtxWorkspaceID).(string)
+	d, err := h.repo.Get(r.Context(), chi.URLParam(r, "id"), wid)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if d == nil {
+		http.Error(w, "diff not found", http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(d)
+}
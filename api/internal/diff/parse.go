@@ -0,0 +1,45 @@
+package diff
+
+import (
+	"strconv"
+	"time"
+)
+
+func parseFloats(a, b string) (float64, float64, bool) {
+	x, err := strconv.ParseFloat(a, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	y, err := strconv.ParseFloat(b, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	return x, y, true
+}
+
+// timeLayouts covers checksum.Canonical output plus the text forms other
+// databases commonly hand back.
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02",
+}
+
+func parseTime(s string) (time.Time, bool) {
+	for _, l := range timeLayouts {
+		if t, err := time.Parse(l, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func parseTimes(a, b string) (time.Time, time.Time, bool) {
+	x, ok := parseTime(a)
+	if !ok {
+		return time.Time{}, time.Time{}, false
+	}
+	y, ok := parseTime(b)
+	return x, y, ok
+}
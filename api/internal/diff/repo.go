@@ -0,0 +1,57 @@
+package diff
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/Zubimendi/sync-loop/api/internal/model"
+	"github.com/jmoiron/sqlx"
+)
+
+type Repo struct {
+	db *sqlx.DB
+}
+
+func NewRepo(db *sqlx.DB) *Repo { return &Repo{db: db} }
+
+func (r *Repo) Create(ctx context.Context, d *model.DataDiff) error {
+	return r.db.QueryRowxContext(ctx, `
+		INSERT INTO data_diff (workspace_id, workflow_id, source_connector_id, target_connector_id,
+		                       source_relation, target_relation, key_column, status)
+		VALUES (NULLIF($1,'')::uuid, $2, NULLIF($3,'')::uuid, NULLIF($4,'')::uuid, $5, $6, $7, 'running')
+		RETURNING id, status, started_at`,
+		deref(d.WorkspaceID), d.WorkflowID, deref(d.SourceConnectorID), deref(d.TargetConnectorID),
+		d.SourceRelation, d.TargetRelation, d.KeyColumn).Scan(&d.ID, &d.Status, &d.StartedAt)
+}
+
+func (r *Repo) Finish(ctx context.Context, id, status string, stats model.DiffStats, reportKey, errMsg string) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE data_diff
+		SET status = $2, stats_json = $3, report_key = NULLIF($4,''), error = NULLIF($5,''), finished_at = now()
+		WHERE id = $1`, id, status, stats, reportKey, errMsg)
+	return err
+}
+
+func (r *Repo) Get(ctx context.Context, id, workspaceID string) (*model.DataDiff, error) {
+	var d model.DataDiff
+	err := r.db.GetContext(ctx, &d, `SELECT * FROM data_diff WHERE id = $1 AND workspace_id = $2`, id, workspaceID)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return &d, err
+}
+
+func (r *Repo) ListByWorkspace(ctx context.Context, workspaceID string) ([]model.DataDiff, error) {
+	dd := make([]model.DataDiff, 0)
+	err := r.db.SelectContext(ctx, &dd, `
+		SELECT * FROM data_diff WHERE workspace_id = $1
+		ORDER BY started_at DESC LIMIT 100`, workspaceID)
+	return dd, err
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
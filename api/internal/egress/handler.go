@@ -0,0 +1,93 @@
+package egress
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/Zubimendi/sync-loop/api/internal/middleware"
+	"github.com/Zubimendi/sync-loop/api/internal/model"
+	"github.com/go-chi/chi/v5"
+)
+
+type Handler struct {
+	repo *Repo
+}
+
+func NewHandler(repo *Repo) *Handler { return &Handler{repo: repo} }
+
+// GET /api/v1/egress/allow – ranges the workspace's connectors may reach
+// despite the default policy
+func (h *Handler) List(w http.ResponseWriter, r *http.Request) {
+	wid := r.Context().Value(middleware.CtxWorkspaceID).(string)
+	aa, err := h.repo.List(r.Context(), wid)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"allow": aa})
+}
+
+// POST /api/v1/egress/allow – allow a CIDR or address; admins only
+func (h *Handler) Add(w http.ResponseWriter, r *http.Request) {
+	wid, uid, ok := h.admin(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		CIDR string `json:"cidr"`
+		Note string `json:"note"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+	p, err := ParsePrefix(req.CIDR)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if p.Bits() == 0 {
+		http.Error(w, "allowing every address turns the egress policy off; list the ranges instead", http.StatusBadRequest)
+		return
+	}
+	a := &model.EgressAllow{WorkspaceID: wid, CIDR: p.String(), Note: req.Note, CreatedBy: &uid}
+	if err := h.repo.Add(r.Context(), a); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(a)
+}
+
+// DELETE /api/v1/egress/allow/{id} – admins only
+func (h *Handler) Delete(w http.ResponseWriter, r *http.Request) {
+	wid, _, ok := h.admin(w, r)
+	if !ok {
+		return
+	}
+	n, err := h.repo.Delete(r.Context(), chi.URLParam(r, "id"), wid)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if n == 0 {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) admin(w http.ResponseWriter, r *http.Request) (string, string, bool) {
+	uid := r.Context().Value(middleware.CtxUserID).(string)
+	wid := r.Context().Value(middleware.CtxWorkspaceID).(string)
+	ok, err := h.repo.IsAdmin(r.Context(), wid, uid)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return "", "", false
+	}
+	if !ok {
+		http.Error(w, "only workspace admins can change the egress allowlist", http.StatusForbidden)
+		return "", "", false
+	}
+	return wid, uid, true
+}
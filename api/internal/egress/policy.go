@@ -0,0 +1,203 @@
+// Package egress decides which addresses connectors may connect to. Hosts
+// in connector configs come from workspace members, so by default the worker
+// refuses its own network: loopback, private, link-local (cloud metadata
+// included) and other special-purpose ranges. Admins allow ranges back per
+// workspace, and EGRESS_ALLOW does so for every workspace.
+package egress
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// ErrBlocked is wrapped by the error of a refused connection.
+var ErrBlocked = errors.New("egress blocked")
+
+// denied are the ranges refused unless allowed.
+var denied = []struct {
+	prefix netip.Prefix
+	reason string
+}{
+	{netip.MustParsePrefix("0.0.0.0/8"), "unspecified"},
+	{netip.MustParsePrefix("10.0.0.0/8"), "private"},
+	{netip.MustParsePrefix("100.64.0.0/10"), "shared address space"},
+	{netip.MustParsePrefix("127.0.0.0/8"), "loopback"},
+	{netip.MustParsePrefix("169.254.0.0/16"), "link-local"},
+	{netip.MustParsePrefix("172.16.0.0/12"), "private"},
+	{netip.MustParsePrefix("192.0.0.0/24"), "special purpose"},
+	{netip.MustParsePrefix("192.168.0.0/16"), "private"},
+	{netip.MustParsePrefix("198.18.0.0/15"), "benchmarking"},
+	{netip.MustParsePrefix("224.0.0.0/4"), "multicast"},
+	{netip.MustParsePrefix("240.0.0.0/4"), "reserved"},
+	{netip.MustParsePrefix("::/128"), "unspecified"},
+	{netip.MustParsePrefix("::1/128"), "loopback"},
+	{netip.MustParsePrefix("64:ff9b::/96"), "nat64"},
+	{netip.MustParsePrefix("64:ff9b:1::/48"), "nat64"},
+	{netip.MustParsePrefix("2002::/16"), "6to4"},
+	{netip.MustParsePrefix("fc00::/7"), "private"},
+	{netip.MustParsePrefix("fe80::/10"), "link-local"},
+	{netip.MustParsePrefix("ff00::/8"), "multicast"},
+}
+
+// Blocked describes a refused connection.
+type Blocked struct {
+	Addr   string // as asked for, host:port
+	IP     netip.Addr
+	Reason string
+}
+
+// Policy is the egress rule set of one workspace.
+type Policy struct {
+	allow []netip.Prefix
+	// OnBlock, when set, hears of each refused address once.
+	OnBlock func(Blocked)
+
+	mu   sync.Mutex
+	seen map[string]bool
+}
+
+// New builds a policy allowing the given ranges on top of EGRESS_ALLOW.
+func New(allow []netip.Prefix) *Policy {
+	env, _ := ParseAllow(strings.Split(os.Getenv("EGRESS_ALLOW"), ","))
+	return &Policy{allow: append(env, allow...), seen: map[string]bool{}}
+}
+
+// ParseAllow reads CIDRs or single addresses, skipping blanks.
+func ParseAllow(ss []string) ([]netip.Prefix, error) {
+	var out []netip.Prefix
+	for _, s := range ss {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		p, err := ParsePrefix(s)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	return out, nil
+}
+
+// ParsePrefix reads a CIDR, or a single address as its /32 or /128.
+func ParsePrefix(s string) (netip.Prefix, error) {
+	if !strings.Contains(s, "/") {
+		a, err := netip.ParseAddr(s)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("%q is not an address or CIDR", s)
+		}
+		a = a.Unmap()
+		return netip.PrefixFrom(a, a.BitLen()), nil
+	}
+	p, err := netip.ParsePrefix(s)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("%q is not an address or CIDR", s)
+	}
+	if p.Addr().Is4In6() {
+		p = netip.PrefixFrom(p.Addr().Unmap(), p.Bits()-96)
+	}
+	return p.Masked(), nil
+}
+
+// Check refuses an address in a denied range no allowed range covers.
+func (p *Policy) Check(ip netip.Addr) error {
+	ip = ip.Unmap().WithZone("")
+	reason := ""
+	for _, d := range denied {
+		if d.prefix.Contains(ip) {
+			reason = d.reason
+			break
+		}
+	}
+	if reason == "" {
+		return nil
+	}
+	for _, a := range p.allow {
+		if a.Contains(ip) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s is a %s address", ErrBlocked, ip, reason)
+}
+
+// DialContext dials like net.Dialer, checking every address it connects to
+// after name resolution, so a host that resolves (or later rebinds) to a
+// refused address is caught too.
+func (p *Policy) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	d := net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control: func(_, address string, _ syscall.RawConn) error {
+			ap, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return fmt.Errorf("%w: cannot parse %s", ErrBlocked, address)
+			}
+			if err := p.Check(ap.Addr()); err != nil {
+				p.blocked(addr, ap.Addr(), err)
+				return err
+			}
+			return nil
+		},
+	}
+	return d.DialContext(ctx, network, addr)
+}
+
+// Dial and DialTimeout serve drivers that dial without a context, such as
+// lib/pq.
+func (p *Policy) Dial(network, addr string) (net.Conn, error) {
+	return p.DialContext(context.Background(), network, addr)
+}
+
+func (p *Policy) DialTimeout(network, addr string, timeout time.Duration) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return p.DialContext(ctx, network, addr)
+}
+
+// Transport is an HTTP transport dialing through the policy. It ignores
+// proxy settings, which would otherwise dial on the connector's behalf.
+func (p *Policy) Transport() *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.Proxy = nil
+	t.DialContext = p.DialContext
+	return t
+}
+
+func (p *Policy) blocked(addr string, ip netip.Addr, err error) {
+	if p.OnBlock == nil {
+		return
+	}
+	key := addr + "|" + ip.String()
+	p.mu.Lock()
+	first := !p.seen[key]
+	p.seen[key] = true
+	p.mu.Unlock()
+	if first {
+		p.OnBlock(Blocked{Addr: addr, IP: ip, Reason: strings.TrimPrefix(err.Error(), ErrBlocked.Error()+": ")})
+	}
+}
+
+type ctxKey struct{}
+
+// NewContext carries a policy to the sources opened with ctx.
+func NewContext(ctx context.Context, p *Policy) context.Context {
+	return context.WithValue(ctx, ctxKey{}, p)
+}
+
+// FromContext returns the policy of ctx, or the default one allowing only
+// EGRESS_ALLOW.
+func FromContext(ctx context.Context) *Policy {
+	if p, ok := ctx.Value(ctxKey{}).(*Policy); ok && p != nil {
+		return p
+	}
+	return New(nil)
+}
@@ -0,0 +1,69 @@
+package egress
+
+import (
+	"context"
+	"net/netip"
+
+	"github.com/Zubimendi/sync-loop/api/internal/model"
+	"github.com/jmoiron/sqlx"
+)
+
+type Repo struct {
+	db *sqlx.DB
+}
+
+func NewRepo(db *sqlx.DB) *Repo { return &Repo{db: db} }
+
+func (r *Repo) List(ctx context.Context, workspaceID string) ([]model.EgressAllow, error) {
+	aa := make([]model.EgressAllow, 0)
+	err := r.db.SelectContext(ctx, &aa, `
+		SELECT id, workspace_id, cidr::text AS cidr, note, created_by_user_id, created_at
+		FROM egress_allow WHERE workspace_id = $1 ORDER BY cidr`, workspaceID)
+	return aa, err
+}
+
+// Add allows a range, updating the note of one already allowed.
+func (r *Repo) Add(ctx context.Context, a *model.EgressAllow) error {
+	return r.db.QueryRowxContext(ctx, `
+		INSERT INTO egress_allow (workspace_id, cidr, note, created_by_user_id)
+		VALUES ($1, $2::cidr, $3, $4)
+		ON CONFLICT (workspace_id, cidr) DO UPDATE SET note = EXCLUDED.note
+		RETURNING id, workspace_id, cidr::text AS cidr, note, created_by_user_id, created_at`,
+		a.WorkspaceID, a.CIDR, a.Note, a.CreatedBy).StructScan(a)
+}
+
+func (r *Repo) Delete(ctx context.Context, id, workspaceID string) (int64, error) {
+	res, err := r.db.ExecContext(ctx,
+		`DELETE FROM egress_allow WHERE id = $1 AND workspace_id = $2`, id, workspaceID)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// IsAdmin tells whether a user may change a workspace's allowlist.
+func (r *Repo) IsAdmin(ctx context.Context, workspaceID, userID string) (bool, error) {
+	var ok bool
+	err := r.db.GetContext(ctx, &ok, `
+		SELECT EXISTS (SELECT 1 FROM workspace_user
+		               WHERE workspace_id = $1 AND user_id = $2 AND role IN ('owner','admin'))`,
+		workspaceID, userID)
+	return ok, err
+}
+
+// Policy builds the egress policy of a workspace.
+func (r *Repo) Policy(ctx context.Context, workspaceID string) (*Policy, error) {
+	aa, err := r.List(ctx, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	allow := make([]netip.Prefix, 0, len(aa))
+	for _, a := range aa {
+		p, err := ParsePrefix(a.CIDR)
+		if err != nil {
+			return nil, err
+		}
+		allow = append(allow, p)
+	}
+	return New(allow), nil
+}
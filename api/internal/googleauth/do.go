@@ -0,0 +1,58 @@
+package googleauth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Zubimendi/sync-loop/api/internal/retry"
+)
+
+// maxBackoff caps the exponential backoff, as the usage limits of Google
+// APIs ask of clients.
+const maxBackoff = time.Minute
+
+// Do calls send until it gets an answer below 300, which it returns for the
+// caller to read and close. fail turns any other answer into an error and
+// tells whether it is a quota refusal, in which case nothing was done and it
+// is retried after the Retry-After the API asks for or an exponential
+// backoff. Server errors and failed connections are retried too when the
+// request is idempotent, all up to retries times. A 401 resets tokens, when
+// not nil, and is retried once: the token may have been revoked before it
+// expired. Errors of send are returned as they are.
+func Do(ctx context.Context, tokens *Tokens, retries int, idempotent bool, send func() (*http.Response, error), fail func(*http.Response) (quota bool, err error)) (*http.Response, error) {
+	reauth := tokens != nil
+	for attempt := 0; ; attempt++ {
+		resp, err := send()
+		if err != nil {
+			if ctx.Err() != nil || !idempotent || attempt >= retries {
+				return nil, err
+			}
+			if err := retry.Sleep(ctx, retry.Backoff(attempt, maxBackoff)); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if resp.StatusCode < 300 {
+			return resp, nil
+		}
+		quota, apiErr := fail(resp)
+		resp.Body.Close()
+		switch {
+		case resp.StatusCode == http.StatusUnauthorized && reauth:
+			reauth = false
+			tokens.Reset()
+			continue
+		case quota || (idempotent && resp.StatusCode >= 500):
+			if attempt >= retries {
+				return nil, fmt.Errorf("%w (after %d retries)", apiErr, attempt)
+			}
+			if err := retry.Sleep(ctx, retry.After(resp.Header.Get("Retry-After"), retry.Backoff(attempt, maxBackoff))); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		return nil, apiErr
+	}
+}
@@ -0,0 +1,174 @@
+// Package googleauth trades a Google service account key for access tokens
+// with the JWT bearer grant, for the clients of Google APIs, and retries
+// their requests the way those APIs ask.
+package googleauth
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const DefaultTokenURL = "https://oauth2.googleapis.com/token"
+
+// ServiceAccount is the part of a key file the JWT bearer grant needs.
+type ServiceAccount struct {
+	email    string
+	key      *rsa.PrivateKey
+	tokenURL string
+}
+
+// ParseServiceAccount reads a key file given as JSON. tokenURL, when set,
+// overrides its token_uri.
+func ParseServiceAccount(js, tokenURL string) (*ServiceAccount, error) {
+	var f struct {
+		Type        string `json:"type"`
+		ClientEmail string `json:"client_email"`
+		PrivateKey  string `json:"private_key"`
+		TokenURI    string `json:"token_uri"`
+	}
+	if err := json.Unmarshal([]byte(js), &f); err != nil {
+		return nil, fmt.Errorf("service_account: %w", err)
+	}
+	if f.ClientEmail == "" || f.PrivateKey == "" {
+		return nil, errors.New("service_account needs client_email and private_key")
+	}
+	block, _ := pem.Decode([]byte(f.PrivateKey))
+	if block == nil {
+		return nil, errors.New("service_account private_key is not PEM")
+	}
+	var key *rsa.PrivateKey
+	if k, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		var ok bool
+		if key, ok = k.(*rsa.PrivateKey); !ok {
+			return nil, errors.New("service_account private_key is not RSA")
+		}
+	} else if key, err = x509.ParsePKCS1PrivateKey(block.Bytes); err != nil {
+		return nil, fmt.Errorf("service_account private_key: %w", err)
+	}
+	sa := &ServiceAccount{email: f.ClientEmail, key: key, tokenURL: tokenURL}
+	if sa.tokenURL == "" {
+		sa.tokenURL = f.TokenURI
+	}
+	if sa.tokenURL == "" {
+		sa.tokenURL = DefaultTokenURL
+	}
+	return sa, nil
+}
+
+// KeyJSON takes a service_account config value, the key file as JSON text
+// or as an object, and returns it as JSON text.
+func KeyJSON(v interface{}) string {
+	switch sa := v.(type) {
+	case string:
+		return sa
+	case map[string]interface{}:
+		b, _ := json.Marshal(sa)
+		return string(b)
+	}
+	return ""
+}
+
+// assertion is the signed JWT traded for an access token.
+func (sa *ServiceAccount) assertion(scope string, now time.Time) (string, error) {
+	enc := base64.RawURLEncoding
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	claims, _ := json.Marshal(map[string]interface{}{
+		"iss":   sa.email,
+		"scope": scope,
+		"aud":   sa.tokenURL,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	signed := enc.EncodeToString(header) + "." + enc.EncodeToString(claims)
+	sum := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, sa.key, crypto.SHA256, sum[:])
+	if err != nil {
+		return "", err
+	}
+	return signed + "." + enc.EncodeToString(sig), nil
+}
+
+// Tokens hands out the service account's tokens for one scope, caching each
+// until it is about to expire.
+type Tokens struct {
+	sa    *ServiceAccount
+	scope string
+	http  *http.Client
+
+	mu    sync.Mutex
+	token string
+	until time.Time
+}
+
+// Tokens returns a token cache for scope whose token requests go through hc.
+func (sa *ServiceAccount) Tokens(scope string, hc *http.Client) *Tokens {
+	return &Tokens{sa: sa, scope: scope, http: hc}
+}
+
+// Reset drops the cached token, as when it was revoked before it expired.
+func (t *Tokens) Reset() {
+	t.mu.Lock()
+	t.token = ""
+	t.mu.Unlock()
+}
+
+// Token returns the cached token or fetches a new one.
+func (t *Tokens) Token(ctx context.Context) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.token != "" && time.Now().Before(t.until) {
+		return t.token, nil
+	}
+	jwt, err := t.sa.assertion(t.scope, time.Now())
+	if err != nil {
+		return "", fmt.Errorf("sign token request: %w", err)
+	}
+	form := url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {jwt},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.sa.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := t.http.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("token: %w", err)
+	}
+	defer resp.Body.Close()
+	var tok struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+		Error       string `json:"error"`
+		Description string `json:"error_description"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&tok); err != nil && resp.StatusCode < 300 {
+		return "", fmt.Errorf("token: %w", err)
+	}
+	if resp.StatusCode >= 300 || tok.AccessToken == "" {
+		return "", fmt.Errorf("token: %s %s %s", resp.Status, tok.Error, tok.Description)
+	}
+	life := time.Hour
+	if tok.ExpiresIn > 0 {
+		life = time.Duration(tok.ExpiresIn) * time.Second
+	}
+	// Renew a little early so a token never expires mid-request.
+	t.token, t.until = tok.AccessToken, time.Now().Add(life-min(time.Minute, life/2))
+	return t.token, nil
+}
@@ -0,0 +1,52 @@
+package gsheets
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// MaxCellChars is the most text a cell holds.
+const MaxCellChars = 50000
+
+// Range builds an A1 range on a sheet, such as 'Ops numbers'!A1:F. An empty
+// sheet means the first one; empty cells mean the whole sheet.
+func Range(sheet, cells string) string {
+	if sheet == "" {
+		return cells
+	}
+	quoted := "'" + strings.ReplaceAll(sheet, "'", "''") + "'"
+	if cells == "" {
+		return quoted
+	}
+	return quoted + "!" + cells
+}
+
+// Column returns the letters of a 0-based column index: A, ..., Z, AA, ...
+func Column(i int) string {
+	var b []byte
+	for i++; i > 0; i = (i - 1) / 26 {
+		b = append([]byte{byte('A' + (i-1)%26)}, b...)
+	}
+	return string(b)
+}
+
+// Rows returns the A1 cells of whole rows from..to (1-based, inclusive)
+// across width columns.
+func Rows(from, to, width int) string {
+	return fmt.Sprintf("A%d:%s%d", from, Column(max(width, 1)-1), to)
+}
+
+// FirstRow returns the sheet row a range such as 'S'!B3:F10 starts at, or
+// 1 when it names none.
+func FirstRow(rng string) int {
+	if i := strings.LastIndexByte(rng, '!'); i >= 0 {
+		rng = rng[i+1:]
+	}
+	from, _, _ := strings.Cut(rng, ":")
+	digits := strings.TrimLeft(strings.ToUpper(from), "$ABCDEFGHIJKLMNOPQRSTUVWXYZ")
+	if n, err := strconv.Atoi(digits); err == nil && n > 0 {
+		return n
+	}
+	return 1
+}
@@ -0,0 +1,324 @@
+// Package gsheets is a small client for the values API of Google Sheets.
+// The base URL comes from the connector config, so a local fake server can
+// stand in for Google.
+package gsheets
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Zubimendi/sync-loop/api/internal/googleauth"
+)
+
+const (
+	DefaultBaseURL = "https://sheets.googleapis.com"
+	scope          = "https://www.googleapis.com/auth/spreadsheets"
+
+	defaultRetries = 6
+)
+
+// Config is how a gsheets connector reaches the API. One of ServiceAccount,
+// AccessToken or APIKey authenticates; an API key only reads public sheets.
+type Config struct {
+	BaseURL string
+	// ServiceAccount is a service account key file, as JSON. TokenURL
+	// overrides its token_uri.
+	ServiceAccount string
+	TokenURL       string
+	AccessToken    string
+	APIKey         string
+	// MaxRetries bounds the retries of a request hitting a quota or a
+	// server error.
+	MaxRetries int
+}
+
+// ConfigFrom reads the keys of a connector config: api_url,
+// service_account (the key file as JSON text or object), token_url,
+// access_token, api_key and max_retries.
+func ConfigFrom(cfg map[string]interface{}) (Config, error) {
+	s := func(k string) string {
+		v, _ := cfg[k].(string)
+		return v
+	}
+	c := Config{
+		BaseURL:     s("api_url"),
+		TokenURL:    s("token_url"),
+		AccessToken: s("access_token"),
+		APIKey:      s("api_key"),
+		MaxRetries:  defaultRetries,
+	}
+	c.ServiceAccount = googleauth.KeyJSON(cfg["service_account"])
+	if n, ok := cfg["max_retries"].(float64); ok && n >= 0 {
+		c.MaxRetries = int(n)
+	}
+	if c.ServiceAccount == "" && c.AccessToken == "" && c.APIKey == "" {
+		return c, errors.New("gsheets: service_account, access_token or api_key is required")
+	}
+	return c, nil
+}
+
+// Client calls the values API of one connector.
+type Client struct {
+	base   *url.URL
+	http   *http.Client
+	cfg    Config
+	tokens *googleauth.Tokens // nil unless a service account authenticates
+}
+
+// New builds a client whose requests, token requests included, go through
+// transport.
+func New(c Config, transport http.RoundTripper) (*Client, error) {
+	if c.BaseURL == "" {
+		c.BaseURL = DefaultBaseURL
+	}
+	base, err := url.Parse(strings.TrimRight(c.BaseURL, "/"))
+	if err != nil || (base.Scheme != "https" && base.Scheme != "http") || base.Host == "" {
+		return nil, fmt.Errorf("gsheets: bad api_url %q", c.BaseURL)
+	}
+	cl := &Client{base: base, http: &http.Client{Transport: transport, Timeout: 2 * time.Minute}, cfg: c}
+	if c.ServiceAccount != "" {
+		sa, err := googleauth.ParseServiceAccount(c.ServiceAccount, c.TokenURL)
+		if err != nil {
+			return nil, fmt.Errorf("gsheets: %w", err)
+		}
+		cl.tokens = sa.Tokens(scope, cl.http)
+	}
+	return cl, nil
+}
+
+func (c *Client) Close() { c.http.CloseIdleConnections() }
+
+// ValueRange is a block of cells, rows first.
+type ValueRange struct {
+	Range  string     `json:"range"`
+	Values [][]string `json:"values"`
+}
+
+// Get reads a range as formatted text. Trailing empty rows and cells are
+// left out, as the API does.
+func (c *Client) Get(ctx context.Context, spreadsheet, rng string) (*ValueRange, error) {
+	var out rawRange
+	q := url.Values{"majorDimension": {"ROWS"}, "valueRenderOption": {"FORMATTED_VALUE"}}
+	if err := c.do(ctx, http.MethodGet, valuesPath(spreadsheet, rng, ""), q, nil, &out, true); err != nil {
+		return nil, err
+	}
+	return out.text(), nil
+}
+
+// BatchGet reads several ranges in one request.
+func (c *Client) BatchGet(ctx context.Context, spreadsheet string, ranges []string) ([]*ValueRange, error) {
+	var out struct {
+		ValueRanges []rawRange `json:"valueRanges"`
+	}
+	q := url.Values{"majorDimension": {"ROWS"}, "valueRenderOption": {"FORMATTED_VALUE"}, "ranges": ranges}
+	if err := c.do(ctx, http.MethodGet, valuesPath(spreadsheet, "", ":batchGet"), q, nil, &out, true); err != nil {
+		return nil, err
+	}
+	vrs := make([]*ValueRange, len(out.ValueRanges))
+	for i, r := range out.ValueRanges {
+		vrs[i] = r.text()
+	}
+	return vrs, nil
+}
+
+// BatchUpdate writes blocks of cells as given, without parsing them as
+// numbers, dates or formulas.
+func (c *Client) BatchUpdate(ctx context.Context, spreadsheet string, data []ValueRange) error {
+	body := map[string]interface{}{"valueInputOption": "RAW", "data": data}
+	return c.do(ctx, http.MethodPost, valuesPath(spreadsheet, "", ":batchUpdate"), nil, body, nil, true)
+}
+
+// Append adds rows below the table found in rng and returns the range
+// written. insert puts in new rows, pushing down whatever is below the
+// table; otherwise empty rows below it are written over.
+func (c *Client) Append(ctx context.Context, spreadsheet, rng string, values [][]string, insert bool) (string, error) {
+	var out struct {
+		Updates struct {
+			UpdatedRange string `json:"updatedRange"`
+		} `json:"updates"`
+	}
+	q := url.Values{"valueInputOption": {"RAW"}, "insertDataOption": {"OVERWRITE"}}
+	if insert {
+		q.Set("insertDataOption", "INSERT_ROWS")
+	}
+	body := ValueRange{Range: rng, Values: values}
+	// An append that failed half way may still have landed, so only
+	// rejections for quota are retried.
+	if err := c.do(ctx, http.MethodPost, valuesPath(spreadsheet, rng, ":append"), q, body, &out, false); err != nil {
+		return "", err
+	}
+	return out.Updates.UpdatedRange, nil
+}
+
+// Clear empties a range, keeping its formatting.
+func (c *Client) Clear(ctx context.Context, spreadsheet, rng string) error {
+	return c.do(ctx, http.MethodPost, valuesPath(spreadsheet, rng, ":clear"), nil, struct{}{}, nil, true)
+}
+
+// rawRange is a range as decoded; a fake server or another render option
+// may send numbers and booleans rather than text.
+type rawRange struct {
+	Range  string          `json:"range"`
+	Values [][]interface{} `json:"values"`
+}
+
+func (r rawRange) text() *ValueRange {
+	out := &ValueRange{Range: r.Range, Values: make([][]string, len(r.Values))}
+	for i, row := range r.Values {
+		out.Values[i] = make([]string, len(row))
+		for j, v := range row {
+			switch t := v.(type) {
+			case nil:
+			case string:
+				out.Values[i][j] = t
+			default:
+				out.Values[i][j] = fmt.Sprint(t)
+			}
+		}
+	}
+	return out
+}
+
+func valuesPath(spreadsheet, rng, method string) string {
+	p := "/v4/spreadsheets/" + url.PathEscape(spreadsheet) + "/values"
+	if rng != "" {
+		return p + "/" + url.PathEscape(rng) + method
+	}
+	return p + method
+}
+
+// APIError is an error answer of the API.
+type APIError struct {
+	StatusCode int
+	Status     string // e.g. RESOURCE_EXHAUSTED
+	Reason     string // e.g. rateLimitExceeded
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("gsheets: %d %s: %s", e.StatusCode, e.Status, e.Message)
+}
+
+// quota tells whether the request was refused for a quota, in which case
+// nothing was written and it is safe to retry.
+func (e *APIError) quota() bool {
+	switch {
+	case e.StatusCode == http.StatusTooManyRequests, e.Status == "RESOURCE_EXHAUSTED":
+		return true
+	case e.StatusCode == http.StatusForbidden:
+		// rateLimitExceeded, userRateLimitExceeded, RATE_LIMIT_EXCEEDED...
+		r := strings.ToLower(strings.ReplaceAll(e.Reason, "_", ""))
+		return strings.HasSuffix(r, "ratelimitexceeded") || r == "quotaexceeded"
+	}
+	return false
+}
+
+func apiError(resp *http.Response) *APIError {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	var e struct {
+		Error struct {
+			Message string `json:"message"`
+			Status  string `json:"status"`
+			Errors  []struct {
+				Reason string `json:"reason"`
+			} `json:"errors"`
+			Details []struct {
+				Reason string `json:"reason"`
+			} `json:"details"`
+		} `json:"error"`
+	}
+	out := &APIError{StatusCode: resp.StatusCode, Status: http.StatusText(resp.StatusCode)}
+	if json.Unmarshal(body, &e) != nil {
+		out.Message = strings.TrimSpace(string(body))
+		return out
+	}
+	out.Message = e.Error.Message
+	if e.Error.Status != "" {
+		out.Status = e.Error.Status
+	}
+	if len(e.Error.Errors) > 0 {
+		out.Reason = e.Error.Errors[0].Reason
+	} else if len(e.Error.Details) > 0 {
+		out.Reason = e.Error.Details[0].Reason
+	}
+	return out
+}
+
+// do sends a request and decodes the answer into out; googleauth.Do
+// retries quota refusals, and server errors and failed connections when the
+// request is idempotent.
+func (c *Client) do(ctx context.Context, method, path string, q url.Values, body, out interface{}, idempotent bool) error {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+	if c.cfg.APIKey != "" && c.tokens == nil && c.cfg.AccessToken == "" {
+		if q == nil {
+			q = url.Values{}
+		}
+		q.Set("key", c.cfg.APIKey)
+	}
+	target := c.base.String() + path
+	if len(q) > 0 {
+		target += "?" + q.Encode()
+	}
+	resp, err := googleauth.Do(ctx, c.tokens, c.cfg.MaxRetries, idempotent, func() (*http.Response, error) {
+		resp, err := c.send(ctx, method, target, payload)
+		if err != nil {
+			return nil, fmt.Errorf("gsheets: %s %s: %w", method, path, err)
+		}
+		return resp, nil
+	}, func(resp *http.Response) (bool, error) {
+		e := apiError(resp)
+		return e.quota(), e
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if out == nil {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("gsheets: %s %s: decode: %w", method, path, err)
+	}
+	return nil
+}
+
+func (c *Client) send(ctx context.Context, method, u string, payload []byte) (*http.Response, error) {
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	switch {
+	case c.tokens != nil:
+		tok, err := c.tokens.Token(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("gsheets: %w", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+tok)
+	case c.cfg.AccessToken != "":
+		req.Header.Set("Authorization", "Bearer "+c.cfg.AccessToken)
+	}
+	return c.http.Do(req)
+}
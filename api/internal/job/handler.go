@@ -2,12 +2,16 @@ package job
 
 import (
 	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"time"
 
+	"github.com/Zubimendi/sync-loop/api/internal/connector"
 	"github.com/Zubimendi/sync-loop/api/internal/middleware"
+	"github.com/Zubimendi/sync-loop/api/internal/run"
 	"github.com/Zubimendi/sync-loop/api/internal/workflow"
 	"github.com/rs/zerolog/log"
 	"go.temporal.io/api/enums/v1"
@@ -17,11 +21,31 @@ import (
 )
 
 type Handler struct {
+	conns    *connector.Repo
+	runs     *run.Repo
 	temporal client.Client
 }
 
-func NewHandler(temporal client.Client) *Handler { 
-	return &Handler{temporal: temporal} 
+func NewHandler(conns *connector.Repo, runs *run.Repo, temporal client.Client) *Handler {
+	return &Handler{conns: conns, runs: runs, temporal: temporal}
+}
+
+// checkConnector writes a 404 and returns false unless id is empty or a
+// connector of workspace wid.
+func (h *Handler) checkConnector(w http.ResponseWriter, r *http.Request, id, wid string) bool {
+	if id == "" {
+		return true
+	}
+	c, err := h.conns.Get(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && c.Workspace != wid) {
+		http.Error(w, "connector not found", http.StatusNotFound)
+		return false
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	return true
 }
 
 type JobResp struct {
@@ -94,6 +118,7 @@ func (h *Handler) List(w http.ResponseWriter, r *http.Request) {
 func (h *Handler) RunNow(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		Table       string `json:"table"`
+		ConnectorID string `json:"connector_id"` // Optional: the app database when empty
 		Incremental bool   `json:"incremental"`
 		WorkflowType string `json:"workflow_type"` // Optional: specify workflow type
 	}
@@ -109,6 +134,10 @@ func (h *Handler) RunNow(w http.ResponseWriter, r *http.Request) {
 	}
 	
 	workflowID := fmt.Sprintf("run-now-%s-%s-%d", workflowType, req.Table, time.Now().Unix())
+	wid := r.Context().Value(middleware.CtxWorkspaceID).(string)
+	if !h.checkConnector(w, r, req.ConnectorID, wid) {
+		return
+	}
 	
 	// Use appropriate workflow based on type
 	var workflowFunc interface{}
@@ -119,6 +148,8 @@ func (h *Handler) RunNow(w http.ResponseWriter, r *http.Request) {
 		workflowFunc = workflow.CopyTableWorkflow
 		workflowArgs = workflow.CopyTableParams{
 			Table:       req.Table,
+			ConnectorID: req.ConnectorID,
+			WorkspaceID: wid,
 			Incremental: req.Incremental,
 		}
 	// Add more workflow types here as you create them
@@ -194,16 +225,44 @@ func (h *Handler) Retry(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	
+	wid := r.Context().Value(middleware.CtxWorkspaceID).(string)
+	
+	// The run the workflow recorded names its job, whose connector and
+	// table the retry copies again
+	sr, err := h.runs.GetRunByWorkflow(r.Context(), req.WorkflowID, wid)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if sr == nil {
+		http.Error(w, "workflow not found", http.StatusNotFound)
+		return
+	}
+	
 	// Get original workflow info
-	_, err := h.temporal.DescribeWorkflowExecution(r.Context(), req.WorkflowID, req.RunID)
+	_, err = h.temporal.DescribeWorkflowExecution(r.Context(), req.WorkflowID, req.RunID)
 	if err != nil {
 		log.Error().Err(err).Msg("describe workflow")
 		http.Error(w, "workflow not found", http.StatusNotFound)
 		return
 	}
 	
-	// Extract table name from workflow ID
-	table := extractTableFromWorkflowID(req.WorkflowID)
+	j, err := h.runs.GetJob(r.Context(), sr.JobID, wid)
+	if err != nil || j == nil || j.Table == nil {
+		http.Error(w, "job of this workflow cannot be retried", http.StatusConflict)
+		return
+	}
+	params := workflow.CopyTableParams{
+		Table:       *j.Table,
+		WorkspaceID: wid,
+		Incremental: false, // Retry as full sync for safety
+	}
+	if j.ConnectorID != nil {
+		params.ConnectorID = *j.ConnectorID
+	}
+	if !h.checkConnector(w, r, params.ConnectorID, wid) {
+		return
+	}
 	
 	// Start new workflow with same parameters but new ID
 	newWorkflowID := fmt.Sprintf("retry-%s-%d", req.WorkflowID, time.Now().Unix())
@@ -211,10 +270,7 @@ func (h *Handler) Retry(w http.ResponseWriter, r *http.Request) {
 	we, err := h.temporal.ExecuteWorkflow(r.Context(), client.StartWorkflowOptions{
 		TaskQueue: "sync-loop-task-queue",
 		ID:        newWorkflowID,
-	}, workflow.CopyTableWorkflow, workflow.CopyTableParams{
-		Table:       table,
-		Incremental: false, // Retry as full sync for safety
-	})
+	}, workflow.CopyTableWorkflow, params)
 	
 	if err != nil {
 		log.Error().Err(err).Msg("execute retry workflow")
@@ -247,6 +303,11 @@ func (h *Handler) CreateSchedule(w http.ResponseWriter, r *http.Request) {
 		req.CronExpr = "* * * * *"
 	}
 	
+	wid := r.Context().Value(middleware.CtxWorkspaceID).(string)
+	if !h.checkConnector(w, r, req.ConnectorID, wid) {
+		return
+	}
+	
 	// Make schedule ID unique by adding timestamp
 	scheduleID := fmt.Sprintf("schedule-%s-%s-%d", req.ConnectorID, req.Table, time.Now().Unix())
 	
@@ -271,6 +332,8 @@ func (h *Handler) CreateSchedule(w http.ResponseWriter, r *http.Request) {
 			TaskQueue: "sync-loop-task-queue",
 			Args: []interface{}{workflow.CopyTableParams{
 				Table:       req.Table,
+				ConnectorID: req.ConnectorID,
+				WorkspaceID: wid,
 				Incremental: true, // Schedules default to incremental
 			}},
 		},
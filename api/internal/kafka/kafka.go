@@ -0,0 +1,208 @@
+// Package kafka connects to Kafka-compatible brokers for the kafka source
+// and destination, and to the Confluent-compatible schema registry their
+// Avro values are registered in.
+package kafka
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/sasl"
+	"github.com/twmb/franz-go/pkg/sasl/plain"
+	"github.com/twmb/franz-go/pkg/sasl/scram"
+)
+
+// Config is how a kafka connector reaches its cluster.
+type Config struct {
+	Brokers  []string
+	ClientID string
+	// TLS is on when tls is true or a CA bundle or client certificate is
+	// given. Certificates and keys are PEM text kept in the config.
+	TLS      bool
+	RootCert string
+	Cert     string
+	Key      string
+	// SASL is plain, scram-sha-256 or scram-sha-512; empty for none.
+	SASL     string
+	Username string
+	Password string
+	Registry RegistryConfig
+}
+
+// ConfigFrom reads the keys of a connector config: brokers (a list or a
+// comma separated string of host:port), client_id, tls, ssl_root_cert,
+// ssl_cert, ssl_key, sasl_mechanism, username, password, and the
+// schema_registry_url, schema_registry_username and
+// schema_registry_password of Avro values.
+func ConfigFrom(cfg map[string]interface{}) (Config, error) {
+	s := func(k string) string {
+		v, _ := cfg[k].(string)
+		return strings.TrimSpace(v)
+	}
+	c := Config{
+		ClientID: s("client_id"),
+		RootCert: s("ssl_root_cert"),
+		Cert:     s("ssl_cert"),
+		Key:      s("ssl_key"),
+		SASL:     strings.ToLower(s("sasl_mechanism")),
+		Username: s("username"),
+		Password: s("password"),
+		Registry: RegistryConfig{
+			URL:      s("schema_registry_url"),
+			Username: s("schema_registry_username"),
+			Password: s("schema_registry_password"),
+		},
+	}
+	if c.ClientID == "" {
+		c.ClientID = "syncloop"
+	}
+	switch b := cfg["brokers"].(type) {
+	case string:
+		for _, h := range strings.Split(b, ",") {
+			if h = strings.TrimSpace(h); h != "" {
+				c.Brokers = append(c.Brokers, h)
+			}
+		}
+	case []interface{}:
+		for _, h := range b {
+			if h, ok := h.(string); ok && strings.TrimSpace(h) != "" {
+				c.Brokers = append(c.Brokers, strings.TrimSpace(h))
+			}
+		}
+	}
+	if len(c.Brokers) == 0 {
+		return c, errors.New("kafka: brokers is required")
+	}
+	for _, h := range c.Brokers {
+		if _, _, err := net.SplitHostPort(h); err != nil {
+			return c, fmt.Errorf("kafka: broker %q is not host:port", h)
+		}
+	}
+	c.TLS, _ = cfg["tls"].(bool)
+	c.TLS = c.TLS || c.RootCert != "" || c.Cert != ""
+	if (c.Cert == "") != (c.Key == "") {
+		return c, errors.New("kafka: ssl_cert and ssl_key go together")
+	}
+	if c.TLS {
+		if _, err := c.tlsConfig(""); err != nil {
+			return c, err
+		}
+	}
+	switch c.SASL {
+	case "":
+	case "plain", "scram-sha-256", "scram-sha-512":
+		if c.Username == "" {
+			return c, fmt.Errorf("kafka: sasl_mechanism %s needs a username", c.SASL)
+		}
+	default:
+		return c, fmt.Errorf("kafka: unknown sasl_mechanism %q", c.SASL)
+	}
+	if c.Registry.URL != "" {
+		if err := c.Registry.check(); err != nil {
+			return c, err
+		}
+	}
+	return c, nil
+}
+
+func (c Config) tlsConfig(host string) (*tls.Config, error) {
+	tc := &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12}
+	if c.RootCert != "" {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM([]byte(c.RootCert)) {
+			return nil, errors.New("kafka: ssl_root_cert holds no PEM certificate")
+		}
+		tc.RootCAs = pool
+	}
+	if c.Cert != "" {
+		cert, err := tls.X509KeyPair([]byte(c.Cert), []byte(c.Key))
+		if err != nil {
+			return nil, fmt.Errorf("kafka: ssl_cert/ssl_key: %w", err)
+		}
+		tc.Certificates = []tls.Certificate{cert}
+	}
+	return tc, nil
+}
+
+func (c Config) mechanism() sasl.Mechanism {
+	switch c.SASL {
+	case "plain":
+		return plain.Auth{User: c.Username, Pass: c.Password}.AsMechanism()
+	case "scram-sha-256":
+		return scram.Auth{User: c.Username, Pass: c.Password}.AsSha256Mechanism()
+	case "scram-sha-512":
+		return scram.Auth{User: c.Username, Pass: c.Password}.AsSha512Mechanism()
+	}
+	return nil
+}
+
+// NewClient builds a client of the cluster whose connections, to the seed
+// brokers and to every broker the cluster then names, go through dial.
+// Topics are never created by producing to them.
+func NewClient(c Config, dial func(ctx context.Context, network, addr string) (net.Conn, error), opts ...kgo.Opt) (*kgo.Client, error) {
+	all := []kgo.Opt{
+		kgo.SeedBrokers(c.Brokers...),
+		kgo.ClientID(c.ClientID),
+		kgo.Dialer(c.dialer(dial)),
+	}
+	if m := c.mechanism(); m != nil {
+		all = append(all, kgo.SASL(m))
+	}
+	cl, err := kgo.NewClient(append(all, opts...)...)
+	if err != nil {
+		return nil, fmt.Errorf("kafka: %w", err)
+	}
+	return cl, nil
+}
+
+func (c Config) dialer(dial func(ctx context.Context, network, addr string) (net.Conn, error)) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	if !c.TLS {
+		return dial
+	}
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		tc, err := c.tlsConfig(host)
+		if err != nil {
+			return nil, err
+		}
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		tlsConn := tls.Client(conn, tc)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return tlsConn, nil
+	}
+}
+
+// Ping checks that a broker answers and, when there is one, the schema
+// registry.
+func Ping(ctx context.Context, c Config, dial func(ctx context.Context, network, addr string) (net.Conn, error), reg *Registry) error {
+	cl, err := NewClient(c, dial)
+	if err != nil {
+		return err
+	}
+	defer cl.Close()
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	if err := cl.Ping(ctx); err != nil {
+		return fmt.Errorf("kafka: %w", err)
+	}
+	if reg != nil {
+		return reg.Ping(ctx)
+	}
+	return nil
+}
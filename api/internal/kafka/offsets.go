@@ -0,0 +1,173 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/twmb/franz-go/pkg/kerr"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/kmsg"
+)
+
+// Offsets maps the partitions of a topic to an offset in each.
+type Offsets map[int32]int64
+
+// Topics lists the topics of the cluster by name, leaving out internal
+// ones such as __consumer_offsets.
+func Topics(ctx context.Context, cl *kgo.Client) ([]string, error) {
+	resp, err := kmsg.NewPtrMetadataRequest().RequestWith(ctx, cl)
+	if err != nil {
+		return nil, fmt.Errorf("kafka: metadata: %w", err)
+	}
+	var out []string
+	for _, t := range resp.Topics {
+		if t.Topic == nil || t.IsInternal || strings.HasPrefix(*t.Topic, "__") {
+			continue
+		}
+		out = append(out, *t.Topic)
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+// Partitions lists the partitions of a topic in order.
+func Partitions(ctx context.Context, cl *kgo.Client, topic string) ([]int32, error) {
+	req := kmsg.NewPtrMetadataRequest()
+	t := kmsg.NewMetadataRequestTopic()
+	t.Topic = kmsg.StringPtr(topic)
+	req.Topics = append(req.Topics, t)
+	resp, err := req.RequestWith(ctx, cl)
+	if err != nil {
+		return nil, fmt.Errorf("kafka: metadata: %w", err)
+	}
+	for _, t := range resp.Topics {
+		if t.Topic == nil || *t.Topic != topic {
+			continue
+		}
+		if err := kerr.ErrorForCode(t.ErrorCode); err != nil {
+			return nil, fmt.Errorf("kafka: topic %s: %w", topic, err)
+		}
+		out := make([]int32, 0, len(t.Partitions))
+		for _, p := range t.Partitions {
+			out = append(out, p.Partition)
+		}
+		sort.Slice(out, func(i, j int) bool { return out[i] < out[j] })
+		return out, nil
+	}
+	return nil, fmt.Errorf("kafka: topic %s: %w", topic, kerr.UnknownTopicOrPartition)
+}
+
+// StartOffsets is the first offset kept in each partition.
+func StartOffsets(ctx context.Context, cl *kgo.Client, topic string, partitions []int32) (Offsets, error) {
+	return listOffsets(ctx, cl, topic, partitions, -2)
+}
+
+// EndOffsets is the offset after the last of each partition. Only committed
+// transactions count towards it, so a read up to it never waits on an open
+// one.
+func EndOffsets(ctx context.Context, cl *kgo.Client, topic string, partitions []int32) (Offsets, error) {
+	return listOffsets(ctx, cl, topic, partitions, -1)
+}
+
+func listOffsets(ctx context.Context, cl *kgo.Client, topic string, partitions []int32, at int64) (Offsets, error) {
+	req := kmsg.NewPtrListOffsetsRequest()
+	req.ReplicaID = -1
+	req.IsolationLevel = 1
+	rt := kmsg.NewListOffsetsRequestTopic()
+	rt.Topic = topic
+	for _, p := range partitions {
+		rp := kmsg.NewListOffsetsRequestTopicPartition()
+		rp.Partition = p
+		rp.CurrentLeaderEpoch = -1
+		rp.Timestamp = at
+		rt.Partitions = append(rt.Partitions, rp)
+	}
+	req.Topics = append(req.Topics, rt)
+	resp, err := req.RequestWith(ctx, cl)
+	if err != nil {
+		return nil, fmt.Errorf("kafka: list offsets: %w", err)
+	}
+	out := Offsets{}
+	for _, t := range resp.Topics {
+		for _, p := range t.Partitions {
+			if err := kerr.ErrorForCode(p.ErrorCode); err != nil {
+				return nil, fmt.Errorf("kafka: list offsets of %s/%d: %w", topic, p.Partition, err)
+			}
+			out[p.Partition] = p.Offset
+		}
+	}
+	for _, p := range partitions {
+		if _, ok := out[p]; !ok {
+			return nil, fmt.Errorf("kafka: no offsets for %s/%d", topic, p)
+		}
+	}
+	return out, nil
+}
+
+// Committed reads the offsets group committed for topic: the next offset to
+// read in each partition. Partitions it never committed are left out.
+func Committed(ctx context.Context, cl *kgo.Client, group, topic string) (Offsets, error) {
+	req := kmsg.NewPtrOffsetFetchRequest()
+	req.Group = group
+	// No topics asks for all of them; naming one would need its partitions.
+	req.RequireStable = true
+	resp, err := req.RequestWith(ctx, cl)
+	if err != nil {
+		return nil, fmt.Errorf("kafka: fetch offsets of group %s: %w", group, err)
+	}
+	out := Offsets{}
+	// Brokers answer a group never committed to either with no offsets or,
+	// some of them, with an error.
+	if err := kerr.ErrorForCode(resp.ErrorCode); errors.Is(err, kerr.GroupIDNotFound) {
+		return out, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("kafka: fetch offsets of group %s: %w", group, err)
+	}
+	for _, t := range resp.Topics {
+		if t.Topic != topic {
+			continue
+		}
+		for _, p := range t.Partitions {
+			if err := kerr.ErrorForCode(p.ErrorCode); err != nil {
+				return nil, fmt.Errorf("kafka: fetch offset of %s/%d: %w", topic, p.Partition, err)
+			}
+			if p.Offset >= 0 {
+				out[p.Partition] = p.Offset
+			}
+		}
+	}
+	return out, nil
+}
+
+// Commit stores offsets as those of group for topic. The group has no
+// members: SyncLoop only ever reads at the offsets, it never joins.
+func Commit(ctx context.Context, cl *kgo.Client, group, topic string, offsets Offsets) error {
+	req := kmsg.NewPtrOffsetCommitRequest()
+	req.Group = group
+	req.Generation = -1
+	rt := kmsg.NewOffsetCommitRequestTopic()
+	rt.Topic = topic
+	for p, o := range offsets {
+		rp := kmsg.NewOffsetCommitRequestTopicPartition()
+		rp.Partition = p
+		rp.Offset = o
+		rp.LeaderEpoch = -1
+		rt.Partitions = append(rt.Partitions, rp)
+	}
+	req.Topics = append(req.Topics, rt)
+	resp, err := req.RequestWith(ctx, cl)
+	if err != nil {
+		return fmt.Errorf("kafka: commit offsets of group %s: %w", group, err)
+	}
+	for _, t := range resp.Topics {
+		for _, p := range t.Partitions {
+			if err := kerr.ErrorForCode(p.ErrorCode); err != nil {
+				return fmt.Errorf("kafka: commit offset of %s/%d: %w", topic, p.Partition, err)
+			}
+		}
+	}
+	return nil
+}
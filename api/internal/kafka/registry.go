@@ -0,0 +1,154 @@
+package kafka
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RegistryConfig is where Avro schemas are registered.
+type RegistryConfig struct {
+	URL      string
+	Username string
+	Password string
+}
+
+func (rc RegistryConfig) check() error {
+	u, err := url.Parse(rc.URL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return fmt.Errorf("kafka: bad schema_registry_url %q", rc.URL)
+	}
+	return nil
+}
+
+// Registry is a client of a Confluent-compatible schema registry. Schemas
+// it has fetched are kept, as an ID always names the same schema.
+type Registry struct {
+	cfg  RegistryConfig
+	http *http.Client
+
+	mu      sync.Mutex
+	schemas map[int][]byte
+}
+
+// NewRegistry builds a registry client whose requests go through transport,
+// or nil when the connector has no registry.
+func NewRegistry(c Config, transport http.RoundTripper) *Registry {
+	if c.Registry.URL == "" {
+		return nil
+	}
+	return &Registry{
+		cfg:     c.Registry,
+		http:    &http.Client{Transport: transport, Timeout: time.Minute},
+		schemas: map[int][]byte{},
+	}
+}
+
+// Register adds an Avro schema to subject, or finds it there, and returns
+// its ID.
+func (r *Registry) Register(ctx context.Context, subject string, schema []byte) (int, error) {
+	body, err := json.Marshal(map[string]string{"schema": string(schema)})
+	if err != nil {
+		return 0, err
+	}
+	var out struct {
+		ID int `json:"id"`
+	}
+	if err := r.do(ctx, http.MethodPost, "/subjects/"+url.PathEscape(subject)+"/versions", body, &out); err != nil {
+		return 0, fmt.Errorf("schema registry: register %s: %w", subject, err)
+	}
+	return out.ID, nil
+}
+
+// Schema fetches the Avro schema of an ID.
+func (r *Registry) Schema(ctx context.Context, id int) ([]byte, error) {
+	r.mu.Lock()
+	s, ok := r.schemas[id]
+	r.mu.Unlock()
+	if ok {
+		return s, nil
+	}
+	var out struct {
+		Type   string `json:"schemaType"`
+		Schema string `json:"schema"`
+	}
+	if err := r.do(ctx, http.MethodGet, fmt.Sprintf("/schemas/ids/%d", id), nil, &out); err != nil {
+		return nil, fmt.Errorf("schema registry: schema %d: %w", id, err)
+	}
+	if out.Type != "" && out.Type != "AVRO" {
+		return nil, fmt.Errorf("schema registry: schema %d is %s, not Avro", id, out.Type)
+	}
+	r.mu.Lock()
+	r.schemas[id] = []byte(out.Schema)
+	r.mu.Unlock()
+	return []byte(out.Schema), nil
+}
+
+func (r *Registry) Ping(ctx context.Context) error {
+	var subjects []string
+	if err := r.do(ctx, http.MethodGet, "/subjects", nil, &subjects); err != nil {
+		return fmt.Errorf("schema registry: %w", err)
+	}
+	return nil
+}
+
+func (r *Registry) Close() { r.http.CloseIdleConnections() }
+
+func (r *Registry) do(ctx context.Context, method, path string, body []byte, out interface{}) error {
+	var rd io.Reader
+	if body != nil {
+		rd = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(r.cfg.URL, "/")+path, rd)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.schemaregistry.v1+json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/vnd.schemaregistry.v1+json")
+	}
+	if r.cfg.Username != "" {
+		req.SetBasicAuth(r.cfg.Username, r.cfg.Password)
+	}
+	resp, err := r.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		var e struct {
+			Message string `json:"message"`
+		}
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		if json.Unmarshal(b, &e) == nil && e.Message != "" {
+			return fmt.Errorf("%s: %s", resp.Status, e.Message)
+		}
+		return errors.New(resp.Status)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 16<<20)).Decode(out)
+}
+
+// Frame prefixes an encoded value with the wire format header of the
+// registry's serializers: a zero byte and the big-endian schema ID.
+func Frame(id int, value []byte) []byte {
+	b := make([]byte, 5, 5+len(value))
+	binary.BigEndian.PutUint32(b[1:], uint32(id))
+	return append(b, value...)
+}
+
+// Unframe splits a framed value into its schema ID and the value.
+func Unframe(b []byte) (int, []byte, error) {
+	if len(b) < 5 || b[0] != 0 {
+		return 0, nil, errors.New("value is not in the schema registry wire format")
+	}
+	return int(binary.BigEndian.Uint32(b[1:5])), b[5:], nil
+}
@@ -0,0 +1,137 @@
+// Package localfs opens the directories file connectors read and write on
+// the worker. A connector's directory must lie inside one of the roots
+// listed in FILE_CONNECTOR_ROOTS, and nothing under it, symlinks included,
+// reaches outside it, so workspaces cannot read arbitrary worker files.
+package localfs
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ErrNoRoots means this host allows no file connectors.
+var ErrNoRoots = errors.New("file connector: FILE_CONNECTOR_ROOTS is not set on this host")
+
+// Roots lists the directories of FILE_CONNECTOR_ROOTS, comma separated,
+// with their symlinks resolved. Ones that do not exist are left out.
+func Roots() []string {
+	var out []string
+	for _, r := range strings.Split(os.Getenv("FILE_CONNECTOR_ROOTS"), ",") {
+		if r = strings.TrimSpace(r); r == "" || !filepath.IsAbs(r) {
+			continue
+		}
+		if real, err := filepath.EvalSymlinks(r); err == nil {
+			out = append(out, real)
+		}
+	}
+	return out
+}
+
+// Dir is a file connector's directory. Keys are slash separated paths
+// relative to it.
+type Dir struct {
+	root *os.Root
+	// path is the directory with its symlinks resolved.
+	path string
+}
+
+// Open opens the directory of a connector config: root, an absolute path
+// inside one of Roots, or the first of them when empty.
+func Open(cfg map[string]interface{}) (*Dir, error) {
+	roots := Roots()
+	if len(roots) == 0 {
+		return nil, ErrNoRoots
+	}
+	dir, _ := cfg["root"].(string)
+	if dir == "" {
+		dir = roots[0]
+	}
+	if !filepath.IsAbs(dir) {
+		return nil, fmt.Errorf("file connector: root %q is not an absolute path", dir)
+	}
+	real, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return nil, fmt.Errorf("file connector: %w", err)
+	}
+	if !within(roots, real) {
+		return nil, fmt.Errorf("file connector: %s is outside FILE_CONNECTOR_ROOTS", dir)
+	}
+	root, err := os.OpenRoot(real)
+	if err != nil {
+		return nil, fmt.Errorf("file connector: %w", err)
+	}
+	return &Dir{root: root, path: real}, nil
+}
+
+func within(roots []string, p string) bool {
+	for _, r := range roots {
+		if rel, err := filepath.Rel(r, p); err == nil && filepath.IsLocal(rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// name turns a key into a name inside the directory. Keys cannot climb out
+// of it.
+func name(key string) string {
+	k := strings.TrimPrefix(path.Clean("/"+key), "/")
+	if k == "" {
+		return "."
+	}
+	return filepath.FromSlash(k)
+}
+
+func (d *Dir) Open(key string) (*os.File, error) { return d.root.Open(name(key)) }
+
+func (d *Dir) Stat(key string) (os.FileInfo, error) { return d.root.Stat(name(key)) }
+
+func (d *Dir) Remove(key string) error { return d.root.Remove(name(key)) }
+
+// Create makes a new file, failing if key exists.
+func (d *Dir) Create(key string) (*os.File, error) {
+	return d.root.OpenFile(name(key), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+}
+
+// MkdirAll makes the directory key and any it is in.
+func (d *Dir) MkdirAll(key string) error {
+	n := name(key)
+	if n == "." {
+		return nil
+	}
+	p := ""
+	for _, seg := range strings.Split(n, string(filepath.Separator)) {
+		p = filepath.Join(p, seg)
+		if err := d.root.Mkdir(p, 0o755); err != nil && !errors.Is(err, os.ErrExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// FS is the directory as an fs.FS, for walking it.
+func (d *Dir) FS() fs.FS { return d.root.FS() }
+
+// Replace renames from to to, replacing to if it exists. Both must be in
+// the same directory, which is resolved again first so a symlink swapped
+// in since cannot move the file out of the root.
+func (d *Dir) Replace(from, to string) error {
+	if path.Dir(path.Clean("/"+from)) != path.Dir(path.Clean("/"+to)) {
+		return errors.New("file connector: can only rename within a directory")
+	}
+	dir, err := filepath.EvalSymlinks(filepath.Join(d.path, filepath.Dir(name(to))))
+	if err != nil {
+		return err
+	}
+	if !within([]string{d.path}, dir) {
+		return fmt.Errorf("file connector: %s leads outside the root", path.Dir(to))
+	}
+	return os.Rename(filepath.Join(dir, path.Base(from)), filepath.Join(dir, path.Base(to)))
+}
+
+func (d *Dir) Close() error { return d.root.Close() }
@@ -0,0 +1,69 @@
+package mapping
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/Zubimendi/sync-loop/api/internal/middleware"
+	"github.com/Zubimendi/sync-loop/api/internal/model"
+	"github.com/Zubimendi/sync-loop/api/internal/run"
+	"github.com/go-chi/chi/v5"
+)
+
+type Handler struct {
+	repo *Repo
+	runs *run.Repo
+}
+
+func NewHandler(repo *Repo, runs *run.Repo) *Handler { return &Handler{repo: repo, runs: runs} }
+
+// GET /api/v1/jobs/{id}/mappings
+func (h *Handler) List(w http.ResponseWriter, r *http.Request) {
+	job := h.job(w, r)
+	if job == nil {
+		return
+	}
+	mm, err := h.repo.ListByJob(r.Context(), job.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"mappings": mm})
+}
+
+// PUT /api/v1/jobs/{id}/mappings – replace all mappings of a job
+func (h *Handler) Replace(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Mappings []model.FieldMapping `json:"mappings"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+	if _, err := Compile(req.Mappings); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	job := h.job(w, r)
+	if job == nil {
+		return
+	}
+	if err := h.repo.Replace(r.Context(), job.ID, req.Mappings); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) job(w http.ResponseWriter, r *http.Request) *model.SyncJob {
+	wid := r.Context().Value(middleware.CtxWorkspaceID).(string)
+	job, err := h.runs.GetJob(r.Context(), chi.URLParam(r, "id"), wid)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil
+	}
+	if job == nil {
+		http.Error(w, "job not found", http.StatusNotFound)
+	}
+	return job
+}
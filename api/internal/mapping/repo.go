@@ -0,0 +1,41 @@
+package mapping
+
+import (
+	"context"
+
+	"github.com/Zubimendi/sync-loop/api/internal/model"
+	"github.com/jmoiron/sqlx"
+)
+
+type Repo struct {
+	db *sqlx.DB
+}
+
+func NewRepo(db *sqlx.DB) *Repo { return &Repo{db: db} }
+
+func (r *Repo) ListByJob(ctx context.Context, jobID string) ([]model.FieldMapping, error) {
+	mm := make([]model.FieldMapping, 0)
+	err := r.db.SelectContext(ctx, &mm,
+		`SELECT * FROM field_mapping WHERE job_id = $1 ORDER BY created_at, source_field`, jobID)
+	return mm, err
+}
+
+// Replace swaps the whole mapping set of a job in one transaction.
+func (r *Repo) Replace(ctx context.Context, jobID string, mm []model.FieldMapping) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, `DELETE FROM field_mapping WHERE job_id = $1`, jobID); err != nil {
+		return err
+	}
+	for _, m := range mm {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO field_mapping (job_id, source_field, dest_field, transform)
+			VALUES ($1, $2, $3, $4)`, jobID, m.SourceField, m.DestField, m.Transform); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,193 @@
+// Package mapping applies a job's field mappings: renames plus a small
+// pipeline of casts and checks per column.
+//
+// A transform spec is a pipe-separated list of steps applied left to right,
+// e.g. "trim|int|required". Steps: trim, lower, upper, string, int, float,
+// bool, timestamp, date, required, default:<value>.
+package mapping
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Zubimendi/sync-loop/api/internal/checksum"
+	"github.com/Zubimendi/sync-loop/api/internal/model"
+)
+
+type step func(v interface{}) (interface{}, error)
+
+type field struct {
+	source, dest string
+	steps        []step
+}
+
+// Mapper rewrites rows according to a job's mappings. Columns without a
+// mapping pass through unchanged.
+type Mapper struct {
+	fields []field
+	mapped map[string]bool
+}
+
+func Compile(mm []model.FieldMapping) (*Mapper, error) {
+	m := &Mapper{mapped: map[string]bool{}}
+	for _, fm := range mm {
+		f := field{source: fm.SourceField, dest: fm.DestField}
+		if f.dest == "" {
+			f.dest = f.source
+		}
+		if fm.Transform != nil && *fm.Transform != "" {
+			for _, s := range strings.Split(*fm.Transform, "|") {
+				st, err := compileStep(strings.TrimSpace(s))
+				if err != nil {
+					return nil, fmt.Errorf("mapping %s: %w", fm.SourceField, err)
+				}
+				f.steps = append(f.steps, st)
+			}
+		}
+		m.fields = append(m.fields, f)
+		m.mapped[fm.SourceField] = true
+	}
+	return m, nil
+}
+
+func (m *Mapper) Empty() bool { return len(m.fields) == 0 }
+
+// Apply returns the rewritten row, or an error naming the first column that
+// could not be converted.
+func (m *Mapper) Apply(row map[string]interface{}) (map[string]interface{}, error) {
+	out := make(map[string]interface{}, len(row))
+	for k, v := range row {
+		if !m.mapped[k] {
+			out[k] = v
+		}
+	}
+	for _, f := range m.fields {
+		v := row[f.source]
+		for _, st := range f.steps {
+			var err error
+			if v, err = st(v); err != nil {
+				return nil, fmt.Errorf("%s: %w", f.source, err)
+			}
+		}
+		out[f.dest] = v
+	}
+	return out, nil
+}
+
+// Columns renames and retypes a column list the same way Apply does.
+func (m *Mapper) Columns(cols []model.Column) []model.Column {
+	byName := map[string]model.Column{}
+	var out []model.Column
+	for _, c := range cols {
+		byName[c.Name] = c
+		if !m.mapped[c.Name] {
+			out = append(out, c)
+		}
+	}
+	for _, f := range m.fields {
+		c := byName[f.source]
+		c.Name = f.dest
+		out = append(out, c)
+	}
+	return out
+}
+
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+	"01/02/2006",
+}
+
+func parseTime(s string) (time.Time, error) {
+	for _, l := range timeLayouts {
+		if t, err := time.Parse(l, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("cannot parse %q as a timestamp", s)
+}
+
+func compileStep(s string) (step, error) {
+	if strings.HasPrefix(s, "default:") {
+		def := strings.TrimPrefix(s, "default:")
+		return func(v interface{}) (interface{}, error) {
+			if v == nil || v == "" {
+				return def, nil
+			}
+			return v, nil
+		}, nil
+	}
+	// Every cast leaves NULL alone; use required to reject it.
+	cast := func(f func(string) (string, error)) step {
+		return func(v interface{}) (interface{}, error) {
+			if v == nil {
+				return nil, nil
+			}
+			return f(checksum.Canonical(v))
+		}
+	}
+	switch s {
+	case "trim":
+		return cast(func(v string) (string, error) { return strings.TrimSpace(v), nil }), nil
+	case "lower":
+		return cast(func(v string) (string, error) { return strings.ToLower(v), nil }), nil
+	case "upper":
+		return cast(func(v string) (string, error) { return strings.ToUpper(v), nil }), nil
+	case "string":
+		return cast(func(v string) (string, error) { return v, nil }), nil
+	case "int":
+		return cast(func(v string) (string, error) {
+			n, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+			if err != nil {
+				return "", fmt.Errorf("cannot cast %q to int", v)
+			}
+			return strconv.FormatInt(n, 10), nil
+		}), nil
+	case "float":
+		return cast(func(v string) (string, error) {
+			f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+			if err != nil {
+				return "", fmt.Errorf("cannot cast %q to float", v)
+			}
+			return checksum.Canonical(f), nil
+		}), nil
+	case "bool":
+		return cast(func(v string) (string, error) {
+			b, err := strconv.ParseBool(strings.TrimSpace(v))
+			if err != nil {
+				return "", fmt.Errorf("cannot cast %q to bool", v)
+			}
+			return strconv.FormatBool(b), nil
+		}), nil
+	case "timestamp":
+		return cast(func(v string) (string, error) {
+			t, err := parseTime(strings.TrimSpace(v))
+			if err != nil {
+				return "", err
+			}
+			return checksum.Canonical(t), nil
+		}), nil
+	case "date":
+		return cast(func(v string) (string, error) {
+			t, err := parseTime(strings.TrimSpace(v))
+			if err != nil {
+				return "", err
+			}
+			return t.Format("2006-01-02"), nil
+		}), nil
+	case "required":
+		return func(v interface{}) (interface{}, error) {
+			if v == nil || v == "" {
+				return nil, errors.New("value is required")
+			}
+			return v, nil
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown transform step %q", s)
+}
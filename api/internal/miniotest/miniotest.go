@@ -0,0 +1,104 @@
+// Package miniotest gives the tests of S3 connectors a bucket of their own
+// on the MinIO service of docker-compose. Those tests are skipped unless
+// MINIO_ENDPOINT names the service, as in http://localhost:9000; the
+// credentials are MINIO_ROOT_USER and MINIO_ROOT_PASSWORD, or those of
+// docker-compose.
+package miniotest
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/netip"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/Zubimendi/sync-loop/api/internal/egress"
+	"github.com/Zubimendi/sync-loop/api/internal/storage"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// Bucket is an empty bucket that is removed, objects and all, when the
+// test ends.
+type Bucket struct {
+	*storage.Store
+	Endpoint  string
+	AccessKey string
+	SecretKey string
+}
+
+// New creates a bucket for t, or skips t when there is no MinIO to use.
+func New(t testing.TB) *Bucket {
+	t.Helper()
+	endpoint := os.Getenv("MINIO_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("MINIO_ENDPOINT is not set")
+	}
+	b := &Bucket{
+		Endpoint:  endpoint,
+		AccessKey: env("MINIO_ROOT_USER", "minio"),
+		SecretKey: env("MINIO_ROOT_PASSWORD", "minio123"),
+	}
+	id := make([]byte, 6)
+	rand.Read(id)
+	st, err := storage.New(context.Background(), storage.Options{
+		Endpoint:  b.Endpoint,
+		AccessKey: b.AccessKey,
+		SecretKey: b.SecretKey,
+		Bucket:    "syncloop-test-" + hex.EncodeToString(id),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Store = st
+	if _, err := st.Client.CreateBucket(context.Background(), &s3.CreateBucketInput{Bucket: aws.String(st.Bucket)}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(b.remove)
+	return b
+}
+
+func env(k, fallback string) string {
+	if v := os.Getenv(k); v != "" {
+		return v
+	}
+	return fallback
+}
+
+func (b *Bucket) remove() {
+	ctx := context.Background()
+	if objs, err := b.List(ctx, ""); err == nil {
+		for _, o := range objs {
+			b.Delete(ctx, o.Key)
+		}
+	}
+	b.Client.DeleteBucket(ctx, &s3.DeleteBucketInput{Bucket: aws.String(b.Bucket)})
+}
+
+// Put stores an object, failing t if it cannot.
+func (b *Bucket) Put(t testing.TB, key, body string) {
+	t.Helper()
+	if err := b.Store.Put(context.Background(), key, strings.NewReader(body)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Config is the config of an s3 connector reading the bucket.
+func (b *Bucket) Config() map[string]interface{} {
+	return map[string]interface{}{
+		"endpoint":   b.Endpoint,
+		"access_key": b.AccessKey,
+		"secret_key": b.SecretKey,
+		"bucket":     b.Bucket,
+	}
+}
+
+// Context lets connectors reach MinIO, wherever docker-compose put it; the
+// default egress policy refuses loopback and private addresses.
+func Context() context.Context {
+	return egress.NewContext(context.Background(), egress.New([]netip.Prefix{
+		netip.MustParsePrefix("0.0.0.0/0"), netip.MustParsePrefix("::/0"),
+	}))
+}
@@ -0,0 +1,34 @@
+package model
+
+import (
+	"database/sql/driver"
+	"time"
+)
+
+const (
+	SeverityInfo     = "info"
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+)
+
+type AlertDetails map[string]interface{}
+
+func (d AlertDetails) Value() (driver.Value, error) {
+	if d == nil {
+		return "{}", nil
+	}
+	return marshalJSON(d)
+}
+func (d *AlertDetails) Scan(src interface{}) error { return scanJSON(src, d) }
+
+type AlertEvent struct {
+	ID          string       `db:"id" json:"id"`
+	WorkspaceID *string      `db:"workspace_id" json:"workspace_id,omitempty"`
+	JobID       *string      `db:"job_id" json:"job_id,omitempty"`
+	RunID       *string      `db:"run_id" json:"run_id,omitempty"`
+	Kind        string       `db:"kind" json:"kind"`
+	Severity    string       `db:"severity" json:"severity"`
+	Message     string       `db:"message" json:"message"`
+	Details     AlertDetails `db:"details_json" json:"details"`
+	CreatedAt   time.Time    `db:"created_at" json:"created_at"`
+}
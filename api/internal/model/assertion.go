@@ -0,0 +1,44 @@
+package model
+
+import (
+	"database/sql/driver"
+	"time"
+)
+
+const (
+	AssertWarn  = "warn"  // reported, run still succeeds
+	AssertError = "error" // fails the run
+)
+
+type AssertionParams map[string]interface{}
+
+func (p AssertionParams) Value() (driver.Value, error) {
+	if p == nil {
+		return "{}", nil
+	}
+	return marshalJSON(p)
+}
+func (p *AssertionParams) Scan(src interface{}) error { return scanJSON(src, p) }
+
+type Assertion struct {
+	ID        string          `db:"id" json:"id"`
+	JobID     string          `db:"job_id" json:"job_id"`
+	Name      string          `db:"name" json:"name"`
+	Kind      string          `db:"kind" json:"kind"`
+	Column    *string         `db:"column_name" json:"column,omitempty"`
+	Params    AssertionParams `db:"params_json" json:"params"`
+	Severity  string          `db:"severity" json:"severity"`
+	Enabled   bool            `db:"enabled" json:"enabled"`
+	CreatedAt time.Time       `db:"created_at" json:"created_at"`
+}
+
+type AssertionResult struct {
+	ID          string          `db:"id" json:"id"`
+	RunID       string          `db:"run_id" json:"run_id"`
+	AssertionID string          `db:"assertion_id" json:"assertion_id"`
+	Passed      bool            `db:"passed" json:"passed"`
+	Severity    string          `db:"severity" json:"severity"`
+	Message     string          `db:"message" json:"message"`
+	Observed    AssertionParams `db:"observed_json" json:"observed"`
+	CreatedAt   time.Time       `db:"created_at" json:"created_at"`
+}
@@ -0,0 +1,29 @@
+package model
+
+import (
+	"database/sql/driver"
+	"time"
+)
+
+// Destination is somewhere other than the bucket a job can load into. Its
+// connector, if it needs one, holds the credentials; Config says what to
+// write where.
+type Destination struct {
+	ID          string            `db:"id" json:"id"`
+	ConnectorID *string           `db:"connector_id" json:"connector_id,omitempty"`
+	WorkspaceID string            `db:"workspace_id" json:"workspace_id"`
+	Name        string            `db:"name" json:"name"`
+	Type        string            `db:"type" json:"type"`
+	Config      DestinationConfig `db:"config_json" json:"config"`
+	CreatedAt   time.Time         `db:"created_at" json:"created_at"`
+}
+
+type DestinationConfig map[string]interface{}
+
+func (c DestinationConfig) Value() (driver.Value, error) {
+	if c == nil {
+		return "{}", nil
+	}
+	return marshalJSON(c)
+}
+func (c *DestinationConfig) Scan(src interface{}) error { return scanJSON(src, c) }
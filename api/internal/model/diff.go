@@ -0,0 +1,46 @@
+package model
+
+import (
+	"database/sql/driver"
+	"time"
+)
+
+// DiffTolerance relaxes equality for one column when rows are compared.
+type DiffTolerance struct {
+	Column  string  `json:"column"`
+	Numeric float64 `json:"numeric,omitempty"` // max absolute difference
+	Time    string  `json:"time,omitempty"`    // max drift, e.g. "2s"
+}
+
+type DiffStats struct {
+	SourceRows       int64    `json:"source_rows"`
+	TargetRows       int64    `json:"target_rows"`
+	Missing          int64    `json:"missing"`
+	Extra            int64    `json:"extra"`
+	Mismatched       int64    `json:"mismatched"`
+	SegmentsCompared int64    `json:"segments_compared"`
+	SegmentsSkipped  int64    `json:"segments_skipped"`
+	RowsSkipped      int64    `json:"rows_skipped"`
+	SourceOnlyCols   []string `json:"source_only_columns,omitempty"`
+	TargetOnlyCols   []string `json:"target_only_columns,omitempty"`
+}
+
+func (s DiffStats) Value() (driver.Value, error) { return marshalJSON(s) }
+func (s *DiffStats) Scan(src interface{}) error  { return scanJSON(src, s) }
+
+type DataDiff struct {
+	ID                string     `db:"id" json:"id"`
+	WorkspaceID       *string    `db:"workspace_id" json:"workspace_id,omitempty"`
+	WorkflowID        *string    `db:"workflow_id" json:"workflow_id,omitempty"`
+	SourceConnectorID *string    `db:"source_connector_id" json:"source_connector_id,omitempty"`
+	TargetConnectorID *string    `db:"target_connector_id" json:"target_connector_id,omitempty"`
+	SourceRelation    string     `db:"source_relation" json:"source_relation"`
+	TargetRelation    string     `db:"target_relation" json:"target_relation"`
+	KeyColumn         string     `db:"key_column" json:"key_column"`
+	Status            string     `db:"status" json:"status"`
+	Stats             DiffStats  `db:"stats_json" json:"stats"`
+	ReportKey         *string    `db:"report_key" json:"report_key,omitempty"`
+	Error             *string    `db:"error" json:"error,omitempty"`
+	StartedAt         time.Time  `db:"started_at" json:"started_at"`
+	FinishedAt        *time.Time `db:"finished_at" json:"finished_at,omitempty"`
+}
@@ -0,0 +1,14 @@
+package model
+
+import "time"
+
+// EgressAllow lets a workspace's connectors reach a range the egress policy
+// refuses by default.
+type EgressAllow struct {
+	ID          string    `db:"id" json:"id"`
+	WorkspaceID string    `db:"workspace_id" json:"workspace_id"`
+	CIDR        string    `db:"cidr" json:"cidr"`
+	Note        string    `db:"note" json:"note"`
+	CreatedBy   *string   `db:"created_by_user_id" json:"created_by_user_id,omitempty"`
+	CreatedAt   time.Time `db:"created_at" json:"created_at"`
+}
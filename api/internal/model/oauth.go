@@ -0,0 +1,13 @@
+package model
+
+import "time"
+
+// OAuthState is an authorization request waiting for its callback.
+type OAuthState struct {
+	State        string    `db:"state"`
+	Provider     string    `db:"provider"`
+	ConnectorID  string    `db:"connector_id"`
+	UserID       string    `db:"user_id"`
+	CodeVerifier string    `db:"code_verifier"`
+	ExpiresAt    time.Time `db:"expires_at"`
+}
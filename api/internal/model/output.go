@@ -0,0 +1,36 @@
+package model
+
+import "database/sql/driver"
+
+// OutputOptions controls how a job's rows are written to the bucket. The
+// zero value writes a single uncompressed CSV part.
+type OutputOptions struct {
+	Format string `json:"format,omitempty"` // csv | ndjson | parquet | avro | xlsx
+	// Compression is gzip | zstd | none for every format, plus snappy for
+	// parquet (its default) and avro.
+	Compression  string `json:"compression,omitempty"`
+	RowGroupRows int64  `json:"row_group_rows,omitempty"` // parquet: rows per row group
+	// A batch is split into parts of at most this many rows / bytes.
+	MaxFileRows  int64 `json:"max_file_rows,omitempty"`
+	MaxFileBytes int64 `json:"max_file_bytes,omitempty"`
+	// KeyTemplate is where a batch's parts are written; see output.Layout
+	// for the variables.
+	KeyTemplate string           `json:"key_template,omitempty"`
+	PartitionBy []PartitionField `json:"partition_by,omitempty"`
+	// Latest also writes a _latest.json pointer to the newest manifest.
+	Latest bool `json:"latest,omitempty"`
+	// Sheet names the xlsx sheet, Sheet1 by default; SheetBy writes a sheet
+	// per value of a column instead.
+	Sheet   string `json:"sheet,omitempty"`
+	SheetBy string `json:"sheet_by,omitempty"`
+}
+
+// PartitionField is one Hive-style name=value path segment.
+type PartitionField struct {
+	Name      string `json:"name"` // e.g. dt
+	Column    string `json:"column"`
+	Transform string `json:"transform,omitempty"` // identity | year | month | day | hour
+}
+
+func (o OutputOptions) Value() (driver.Value, error) { return marshalJSON(o) }
+func (o *OutputOptions) Scan(src interface{}) error  { return scanJSON(src, o) }
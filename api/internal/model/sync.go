@@ -0,0 +1,141 @@
+package model
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+type SyncJob struct {
+	ID           string     `db:"id" json:"id"`
+	WorkspaceID  *string    `db:"workspace_id" json:"workspace_id,omitempty"`
+	ConnectorID  *string    `db:"connector_id" json:"connector_id,omitempty"`
+	Table        *string    `db:"table_name" json:"table,omitempty"`
+	ScheduleCron *string    `db:"schedule_cron" json:"schedule_cron,omitempty"`
+	LastRunAt    *time.Time `db:"last_run_at" json:"last_run_at,omitempty"`
+	NextRunAt    *time.Time `db:"next_run_at" json:"next_run_at,omitempty"`
+	LastSyncAt   *time.Time `db:"last_sync_at" json:"last_sync_at,omitempty"`
+	Status       string     `db:"status" json:"status"`
+	CreatedAt    time.Time  `db:"created_at" json:"created_at"`
+	// AnomalyMode is off, rolling or weekday; see package anomaly.
+	AnomalyMode      string   `db:"anomaly_mode" json:"anomaly_mode"`
+	AnomalyThreshold *float64 `db:"anomaly_threshold" json:"anomaly_threshold,omitempty"`
+	// Error budget: rows that may be dead-lettered before the run fails.
+	MaxErrorRows int64         `db:"max_error_rows" json:"max_error_rows"`
+	MaxErrorPct  float64       `db:"max_error_pct" json:"max_error_pct"`
+	Output       OutputOptions `db:"output_json" json:"output"`
+	// DestinationID, when set, sends loads to a destination instead of the
+	// bucket.
+	DestinationID *string `db:"destination_id" json:"destination_id,omitempty"`
+}
+
+type SyncRun struct {
+	ID           string     `db:"id" json:"id"`
+	JobID        string     `db:"job_id" json:"job_id"`
+	WorkflowID   *string    `db:"workflow_id" json:"workflow_id,omitempty"`
+	StartedAt    time.Time  `db:"started_at" json:"started_at"`
+	FinishedAt   *time.Time `db:"finished_at" json:"finished_at,omitempty"`
+	Status       string     `db:"status" json:"status"`
+	RowsRead     *int64     `db:"rows_read" json:"rows_read,omitempty"`
+	RowsWritten  *int64     `db:"rows_written" json:"rows_written,omitempty"`
+	Checksum     *string    `db:"checksum" json:"checksum,omitempty"`
+	DestChecksum *string    `db:"dest_checksum" json:"dest_checksum,omitempty"`
+	LogURL       *string    `db:"log_url" json:"log_url,omitempty"`
+	Error        *string    `db:"error" json:"error,omitempty"`
+	CreatedAt    time.Time  `db:"created_at" json:"created_at"`
+	Anomaly      bool       `db:"anomaly" json:"anomaly"`
+	AnomalyScore *float64   `db:"anomaly_score" json:"anomaly_score,omitempty"`
+	ExpectedRows *float64   `db:"expected_rows" json:"expected_rows,omitempty"`
+	ErrorRows    int64      `db:"error_rows" json:"error_rows"`
+}
+
+type FieldMapping struct {
+	ID          string    `db:"id" json:"id"`
+	JobID       string    `db:"job_id" json:"job_id"`
+	SourceField string    `db:"source_field" json:"source_field"`
+	DestField   string    `db:"dest_field" json:"dest_field"`
+	Transform   *string   `db:"transform" json:"transform,omitempty"`
+	CreatedAt   time.Time `db:"created_at" json:"created_at"`
+}
+
+type DeadLetter struct {
+	ID        string    `db:"id" json:"id"`
+	RunID     string    `db:"run_id" json:"run_id"`
+	Stage     string    `db:"stage" json:"stage"`
+	ObjectKey string    `db:"object_key" json:"object_key"`
+	RowCount  int64     `db:"row_count" json:"row_count"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+}
+
+// SourceFile is a file a job has already loaded, by the version it read.
+type SourceFile struct {
+	ID           string     `db:"id" json:"id"`
+	JobID        string     `db:"job_id" json:"job_id"`
+	RunID        *string    `db:"run_id" json:"run_id,omitempty"`
+	Key          string     `db:"object_key" json:"key"`
+	ETag         string     `db:"etag" json:"etag"`
+	LastModified *time.Time `db:"last_modified" json:"last_modified,omitempty"`
+	Size         int64      `db:"size_bytes" json:"size"`
+	ProcessedAt  time.Time  `db:"processed_at" json:"processed_at"`
+}
+
+// Column describes one source column as seen at extract time.
+type Column struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Nullable bool   `json:"nullable"`
+	// Precision and Scale are set for constrained numeric columns.
+	Precision int `json:"precision,omitempty"`
+	Scale     int `json:"scale,omitempty"`
+}
+
+type ColumnList []Column
+
+func (l ColumnList) Value() (driver.Value, error) { return marshalJSON(l) }
+func (l *ColumnList) Scan(src interface{}) error  { return scanJSON(src, l) }
+
+type SchemaChange struct {
+	Kind    string `json:"kind"` // column_added | column_removed | type_changed | nullability_changed
+	Column  string `json:"column"`
+	OldType string `json:"old_type,omitempty"`
+	NewType string `json:"new_type,omitempty"`
+	// Nullable is set by nullability_changed.
+	Nullable *bool `json:"nullable,omitempty"`
+}
+
+type SchemaChangeList []SchemaChange
+
+func (l SchemaChangeList) Value() (driver.Value, error) { return marshalJSON(l) }
+func (l *SchemaChangeList) Scan(src interface{}) error  { return scanJSON(src, l) }
+
+type SchemaSnapshot struct {
+	ID        string           `db:"id" json:"id"`
+	JobID     string           `db:"job_id" json:"job_id"`
+	RunID     *string          `db:"run_id" json:"run_id,omitempty"`
+	Hash      string           `db:"schema_hash" json:"schema_hash"`
+	Columns   ColumnList       `db:"columns_json" json:"columns"`
+	Changes   SchemaChangeList `db:"changes_json" json:"changes"`
+	CreatedAt time.Time        `db:"created_at" json:"created_at"`
+}
+
+func marshalJSON(v interface{}) (driver.Value, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+func scanJSON(src interface{}, v interface{}) error {
+	switch s := src.(type) {
+	case nil:
+		return nil
+	case []byte:
+		return json.Unmarshal(s, v)
+	case string:
+		return json.Unmarshal([]byte(s), v)
+	default:
+		return fmt.Errorf("cannot scan %T into %T", src, v)
+	}
+}
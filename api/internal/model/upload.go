@@ -0,0 +1,37 @@
+package model
+
+import (
+	"database/sql/driver"
+	"time"
+)
+
+// Upload is a file sent to the API to be used as an ad-hoc source.
+type Upload struct {
+	ID          string        `db:"id" json:"id"`
+	WorkspaceID string        `db:"workspace_id" json:"workspace_id"`
+	CreatedBy   *string       `db:"created_by_user_id" json:"created_by_user_id,omitempty"`
+	Filename    string        `db:"filename" json:"filename"`
+	Size        int64         `db:"size_bytes" json:"size"`
+	Key         string        `db:"object_key" json:"-"`
+	S3UploadID  string        `db:"s3_upload_id" json:"-"`
+	PartSize    int64         `db:"part_size" json:"part_size,omitempty"`
+	Status      string        `db:"status" json:"status"` // uploading | ready | aborted
+	Options     UploadOptions `db:"options_json" json:"options"`
+	CreatedAt   time.Time     `db:"created_at" json:"created_at"`
+	CompletedAt *time.Time    `db:"completed_at" json:"completed_at,omitempty"`
+}
+
+// UploadOptions say how an uploaded file is parsed; see source.FileOptions.
+// Types overrides the inferred type of columns by name.
+type UploadOptions struct {
+	Format    string            `json:"format,omitempty"`
+	Delimiter string            `json:"delimiter,omitempty"`
+	Header    *bool             `json:"header,omitempty"`
+	Sheet     string            `json:"sheet,omitempty"`
+	Range     string            `json:"range,omitempty"`
+	HeaderRow int               `json:"header_row,omitempty"`
+	Types     map[string]string `json:"types,omitempty"`
+}
+
+func (o UploadOptions) Value() (driver.Value, error) { return marshalJSON(o) }
+func (o *UploadOptions) Scan(src interface{}) error  { return scanJSON(src, o) }
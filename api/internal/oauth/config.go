@@ -0,0 +1,39 @@
+package oauth
+
+import "time"
+
+// grant is what a connector config keeps under "oauth". The access token
+// sits at the top level as access_token, where the sources look for it.
+type grant struct {
+	Provider     string
+	RefreshToken string
+	Expiry       time.Time
+}
+
+func grantOf(cfg map[string]interface{}) (grant, bool) {
+	m, ok := cfg["oauth"].(map[string]interface{})
+	if !ok {
+		return grant{}, false
+	}
+	g := grant{}
+	g.Provider, _ = m["provider"].(string)
+	g.RefreshToken, _ = m["refresh_token"].(string)
+	if s, ok := m["expiry"].(string); ok {
+		g.Expiry, _ = time.Parse(time.RFC3339, s)
+	}
+	return g, g.Provider != "" && g.RefreshToken != ""
+}
+
+// apply stores tokens in a connector config. A Salesforce token names its
+// org, which is used unless the config already points elsewhere.
+func apply(cfg map[string]interface{}, p Provider, tok *Token) {
+	cfg["access_token"] = tok.AccessToken
+	if s, _ := cfg["instance_url"].(string); s == "" && tok.InstanceURL != "" {
+		cfg["instance_url"] = tok.InstanceURL
+	}
+	cfg["oauth"] = map[string]interface{}{
+		"provider":      p.Name,
+		"refresh_token": tok.RefreshToken,
+		"expiry":        tok.Expiry.UTC().Format(time.RFC3339),
+	}
+}
@@ -0,0 +1,103 @@
+package oauth
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Zubimendi/sync-loop/api/internal/middleware"
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
+)
+
+type Handler struct {
+	svc *Service
+}
+
+func NewHandler(svc *Service) *Handler { return &Handler{svc: svc} }
+
+// stateCookie ties a callback to the browser that started the request. It
+// is SameSite=Lax, which browsers still send on the top-level GET the
+// provider redirects back with.
+const stateCookie = "oauth_state"
+
+// GET /api/v1/oauth/{provider}/start?connector_id=... – send the browser to
+// the provider to connect the connector
+func (h *Handler) Start(w http.ResponseWriter, r *http.Request) {
+	uid := r.Context().Value(middleware.CtxUserID).(string)
+	wid := r.Context().Value(middleware.CtxWorkspaceID).(string)
+	u, b, err := h.svc.Start(r.Context(), chi.URLParam(r, "provider"), r.URL.Query().Get("connector_id"), uid, wid)
+	switch {
+	case errors.Is(err, ErrUnknownProvider), errors.Is(err, sql.ErrNoRows):
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     stateCookie,
+		Value:    b,
+		Path:     "/api/v1/oauth/",
+		MaxAge:   int(stateLife / time.Second),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, u, http.StatusFound)
+}
+
+// GET /api/v1/oauth/{provider}/callback – where the provider sends the
+// browser back; the state identifies the request and the state cookie
+// proves this browser started it
+func (h *Handler) Callback(w http.ResponseWriter, r *http.Request) {
+	var b string
+	if c, err := r.Cookie(stateCookie); err == nil {
+		b = c.Value
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     stateCookie,
+		Path:     "/api/v1/oauth/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	q := r.URL.Query()
+	providerErr := q.Get("error")
+	if d := q.Get("error_description"); d != "" {
+		providerErr += ": " + d
+	}
+	cid, err := h.svc.Callback(r.Context(), chi.URLParam(r, "provider"), q.Get("state"), b, q.Get("code"), providerErr)
+	if err != nil {
+		log.Warn().Err(err).Str("connector_id", cid).Msg("oauth callback")
+	}
+	// OAUTH_RETURN_URL is the app page to land on; without it the outcome
+	// is answered as JSON.
+	if ret := os.Getenv("OAUTH_RETURN_URL"); ret != "" && !errors.Is(err, ErrBadState) {
+		v := url.Values{"connector_id": {cid}, "status": {"connected"}}
+		if err != nil {
+			v.Set("status", "error")
+			v.Set("error", err.Error())
+		}
+		sep := "?"
+		if strings.Contains(ret, "?") {
+			sep = "&"
+		}
+		http.Redirect(w, r, ret+sep+v.Encode(), http.StatusFound)
+		return
+	}
+	switch {
+	case errors.Is(err, ErrBadState):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusBadGateway)
+	default:
+		json.NewEncoder(w).Encode(map[string]string{"connector_id": cid, "status": "connected"})
+	}
+}
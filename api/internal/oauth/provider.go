@@ -0,0 +1,88 @@
+// Package oauth connects SaaS connectors by the OAuth2 authorization-code
+// flow with PKCE, and keeps their access tokens fresh for the worker.
+package oauth
+
+import (
+	"os"
+	"strings"
+	"time"
+)
+
+// Provider is an authorization server and the connector type it signs in.
+// Every URL and credential comes from the environment, so a local stand-in
+// can replace the real server: OAUTH_<NAME>_CLIENT_ID, _CLIENT_SECRET,
+// _AUTH_URL and _TOKEN_URL.
+type Provider struct {
+	Name          string
+	ConnectorType string
+	AuthURL       string
+	TokenURL      string
+	ClientID      string
+	ClientSecret  string
+	Scopes        []string
+	// AuthParams are added to the authorization URL, e.g. to ask for a
+	// refresh token.
+	AuthParams map[string]string
+	// TokenLife is assumed for access tokens answered without expires_in.
+	TokenLife time.Duration
+}
+
+var defaults = []Provider{
+	{
+		Name:          "google",
+		ConnectorType: "gsheets",
+		AuthURL:       "https://accounts.google.com/o/oauth2/v2/auth",
+		TokenURL:      "https://oauth2.googleapis.com/token",
+		Scopes:        []string{"https://www.googleapis.com/auth/spreadsheets"},
+		// Google only hands out a refresh token on consent.
+		AuthParams: map[string]string{"access_type": "offline", "prompt": "consent"},
+		TokenLife:  time.Hour,
+	},
+	{
+		Name:          "salesforce",
+		ConnectorType: "sf",
+		AuthURL:       "https://login.salesforce.com/services/oauth2/authorize",
+		TokenURL:      "https://login.salesforce.com/services/oauth2/token",
+		Scopes:        []string{"api", "refresh_token"},
+		// Salesforce does not say; sessions time out after two hours by
+		// default.
+		TokenLife: time.Hour,
+	},
+}
+
+// Lookup returns a provider with its environment applied. ok is false for
+// unknown providers and for ones without a client id.
+func Lookup(name string) (Provider, bool) {
+	for _, p := range defaults {
+		if p.Name != name {
+			continue
+		}
+		env := func(k string) string { return os.Getenv("OAUTH_" + strings.ToUpper(p.Name) + "_" + k) }
+		p.ClientID, p.ClientSecret = env("CLIENT_ID"), env("CLIENT_SECRET")
+		if u := env("AUTH_URL"); u != "" {
+			p.AuthURL = u
+		}
+		if u := env("TOKEN_URL"); u != "" {
+			p.TokenURL = u
+		}
+		return p, p.ClientID != ""
+	}
+	return Provider{}, false
+}
+
+// ForType returns the provider of a connector type.
+func ForType(ctype string) (Provider, bool) {
+	for _, p := range defaults {
+		if p.ConnectorType == ctype {
+			return Lookup(p.Name)
+		}
+	}
+	return Provider{}, false
+}
+
+// redirectURI is where the provider sends the browser back to. It must be
+// registered with the provider as is; OAUTH_CALLBACK_BASE is the public
+// base URL of the API.
+func (p Provider) redirectURI() string {
+	return strings.TrimRight(os.Getenv("OAUTH_CALLBACK_BASE"), "/") + "/api/v1/oauth/" + p.Name + "/callback"
+}
@@ -0,0 +1,39 @@
+package oauth
+
+import (
+	"context"
+
+	"github.com/Zubimendi/sync-loop/api/internal/model"
+	"github.com/jmoiron/sqlx"
+)
+
+type Repo struct {
+	db *sqlx.DB
+}
+
+func NewRepo(db *sqlx.DB) *Repo { return &Repo{db: db} }
+
+// SaveState records a request in flight, dropping expired ones.
+func (r *Repo) SaveState(ctx context.Context, s *model.OAuthState) error {
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM oauth_state WHERE expires_at < now()`); err != nil {
+		return err
+	}
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO oauth_state (state, provider, connector_id, user_id, code_verifier, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)`,
+		s.State, s.Provider, s.ConnectorID, s.UserID, s.CodeVerifier, s.ExpiresAt)
+	return err
+}
+
+// TakeState removes and returns a request of the provider that has not
+// expired, so a state works once; sql.ErrNoRows when there is none.
+func (r *Repo) TakeState(ctx context.Context, state, provider string) (*model.OAuthState, error) {
+	var s model.OAuthState
+	err := r.db.GetContext(ctx, &s, `
+		DELETE FROM oauth_state WHERE state = $1 AND provider = $2 AND expires_at > now()
+		RETURNING state, provider, connector_id, user_id, code_verifier, expires_at`, state, provider)
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
@@ -0,0 +1,161 @@
+package oauth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Zubimendi/sync-loop/api/internal/connector"
+	"github.com/Zubimendi/sync-loop/api/internal/model"
+)
+
+const (
+	stateLife = 10 * time.Minute
+	// refreshMargin is how long before it expires an access token is
+	// replaced, so it outlasts the run about to use it.
+	refreshMargin = 10 * time.Minute
+
+	StatusActive         = "active"
+	StatusReauthRequired = "reauth_required"
+)
+
+var (
+	ErrUnknownProvider = errors.New("unknown or unconfigured oauth provider")
+	ErrBadState        = errors.New("unknown or expired oauth state")
+	// ErrReauthRequired is wrapped by the errors of connectors whose
+	// refresh token stopped working.
+	ErrReauthRequired = errors.New("connector needs to be authorized again")
+)
+
+type Service struct {
+	repo  *Repo
+	conns *connector.Repo
+}
+
+func NewService(repo *Repo, conns *connector.Repo) *Service {
+	return &Service{repo: repo, conns: conns}
+}
+
+// Start begins connecting a connector of the workspace and returns the URL
+// to send the browser to, and the binding to keep in that browser's cookie
+// for Callback.
+func (s *Service) Start(ctx context.Context, provider, connectorID, userID, workspaceID string) (string, string, error) {
+	p, ok := Lookup(provider)
+	if !ok {
+		return "", "", ErrUnknownProvider
+	}
+	c, _, err := connector.NewService(s.conns).Config(ctx, connectorID)
+	if err != nil {
+		return "", "", err
+	}
+	if c.Workspace != workspaceID {
+		return "", "", sql.ErrNoRows
+	}
+	if c.Type != p.ConnectorType {
+		return "", "", fmt.Errorf("%s signs in %s connectors, not %s", p.Name, p.ConnectorType, c.Type)
+	}
+	st := &model.OAuthState{
+		State:        randomString(32),
+		Provider:     p.Name,
+		ConnectorID:  c.ID,
+		UserID:       userID,
+		CodeVerifier: randomString(48),
+		ExpiresAt:    time.Now().Add(stateLife),
+	}
+	if err := s.repo.SaveState(ctx, st); err != nil {
+		return "", "", err
+	}
+	return p.AuthorizeURL(st.State, st.CodeVerifier), binding(st.State), nil
+}
+
+// binding hashes a state for the cookie of the browser that started it, so
+// the cookie alone cannot be replayed as a state.
+func binding(state string) string {
+	sum := sha256.Sum256([]byte("oauth-state:" + state))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// Callback finishes a request: it trades the code for tokens and stores
+// them on the connector. The state must come with the binding Start gave
+// the browser; otherwise the callback is someone else's, as in a login CSRF
+// handing the victim's connector the attacker's account, and the state is
+// left alone. A provider error (the user said no) only uses up the state.
+// It returns the connector's id whenever the state was good.
+func (s *Service) Callback(ctx context.Context, provider, state, browserBinding, code, providerErr string) (string, error) {
+	if state == "" || subtle.ConstantTimeCompare([]byte(binding(state)), []byte(browserBinding)) != 1 {
+		return "", ErrBadState
+	}
+	st, err := s.repo.TakeState(ctx, state, provider)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrBadState
+	}
+	if err != nil {
+		return "", err
+	}
+	if providerErr != "" {
+		return st.ConnectorID, fmt.Errorf("%s: %s", provider, providerErr)
+	}
+	p, ok := Lookup(provider)
+	if !ok {
+		return st.ConnectorID, ErrUnknownProvider
+	}
+	tok, err := p.Exchange(ctx, code, st.CodeVerifier)
+	if err != nil {
+		return st.ConnectorID, err
+	}
+	return st.ConnectorID, s.store(ctx, st.ConnectorID, p, tok)
+}
+
+// Fresh returns the config of a connector with an access token that will
+// not expire soon, refreshing and storing it when needed. A refused refresh
+// token marks the connector reauth_required. Configs not connected by OAuth
+// come back as they are.
+func (s *Service) Fresh(ctx context.Context, c *model.Connector, cfg map[string]interface{}) (map[string]interface{}, error) {
+	if c.Status == StatusReauthRequired {
+		return nil, fmt.Errorf("connector %s: %w", c.Name, ErrReauthRequired)
+	}
+	g, ok := grantOf(cfg)
+	if !ok || time.Until(g.Expiry) > refreshMargin {
+		return cfg, nil
+	}
+	p, ok := Lookup(g.Provider)
+	if !ok {
+		return nil, fmt.Errorf("connector %s: %w: %s", c.Name, ErrUnknownProvider, g.Provider)
+	}
+	tok, err := p.Refresh(ctx, g.RefreshToken)
+	if errors.Is(err, ErrRevoked) {
+		if err := s.conns.SetStatus(ctx, c.ID, StatusReauthRequired); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("connector %s: %w: %v", c.Name, ErrReauthRequired, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	apply(cfg, p, tok)
+	if err := connector.NewService(s.conns).UpdateConfig(ctx, c.ID, c.Workspace, cfg); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func (s *Service) store(ctx context.Context, connectorID string, p Provider, tok *Token) error {
+	svc := connector.NewService(s.conns)
+	c, cfg, err := svc.Config(ctx, connectorID)
+	if err != nil {
+		return err
+	}
+	if tok.RefreshToken == "" {
+		return fmt.Errorf("%s answered without a refresh token", p.Name)
+	}
+	apply(cfg, p, tok)
+	if err := svc.UpdateConfig(ctx, c.ID, c.Workspace, cfg); err != nil {
+		return err
+	}
+	return s.conns.SetStatus(ctx, c.ID, StatusActive)
+}
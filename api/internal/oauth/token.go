@@ -0,0 +1,140 @@
+package oauth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ErrRevoked means the provider refused a refresh token: the connector has
+// to be authorized again.
+var ErrRevoked = errors.New("refresh token refused")
+
+// Token is what a token endpoint answers.
+type Token struct {
+	AccessToken  string
+	RefreshToken string
+	Expiry       time.Time
+	// InstanceURL is the org a Salesforce token belongs to.
+	InstanceURL string
+}
+
+// The provider endpoints are set by the operator, not by workspace members,
+// so they are reached without the egress policy.
+var client = &http.Client{Timeout: 30 * time.Second}
+
+// randomString is n random bytes, base64url encoded.
+func randomString(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// challenge is the S256 PKCE challenge of a verifier.
+func challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// AuthorizeURL is where the browser goes to consent.
+func (p Provider) AuthorizeURL(state, verifier string) string {
+	q := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.ClientID},
+		"redirect_uri":          {p.redirectURI()},
+		"scope":                 {strings.Join(p.Scopes, " ")},
+		"state":                 {state},
+		"code_challenge":        {challenge(verifier)},
+		"code_challenge_method": {"S256"},
+	}
+	for k, v := range p.AuthParams {
+		q.Set(k, v)
+	}
+	sep := "?"
+	if strings.Contains(p.AuthURL, "?") {
+		sep = "&"
+	}
+	return p.AuthURL + sep + q.Encode()
+}
+
+// Exchange trades an authorization code for tokens.
+func (p Provider) Exchange(ctx context.Context, code, verifier string) (*Token, error) {
+	return p.token(ctx, url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.redirectURI()},
+		"code_verifier": {verifier},
+	})
+}
+
+// Refresh gets a new access token. Providers that do not rotate refresh
+// tokens answer without one, so the old one is kept.
+func (p Provider) Refresh(ctx context.Context, refreshToken string) (*Token, error) {
+	tok, err := p.token(ctx, url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {refreshToken},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if tok.RefreshToken == "" {
+		tok.RefreshToken = refreshToken
+	}
+	return tok, nil
+}
+
+func (p Provider) token(ctx context.Context, form url.Values) (*Token, error) {
+	form.Set("client_id", p.ClientID)
+	if p.ClientSecret != "" {
+		form.Set("client_secret", p.ClientSecret)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s token: %w", p.Name, err)
+	}
+	defer resp.Body.Close()
+	var body struct {
+		AccessToken  string      `json:"access_token"`
+		RefreshToken string      `json:"refresh_token"`
+		ExpiresIn    json.Number `json:"expires_in"`
+		InstanceURL  string      `json:"instance_url"`
+		Error        string      `json:"error"`
+		Description  string      `json:"error_description"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&body); err != nil && resp.StatusCode < 300 {
+		return nil, fmt.Errorf("%s token: %w", p.Name, err)
+	}
+	switch {
+	case resp.StatusCode == http.StatusBadRequest || resp.StatusCode == http.StatusUnauthorized:
+		// invalid_grant and friends: the grant is no good, trying again
+		// will not help.
+		return nil, fmt.Errorf("%s token: %w: %s %s", p.Name, ErrRevoked, body.Error, body.Description)
+	case resp.StatusCode >= 300 || body.AccessToken == "":
+		return nil, fmt.Errorf("%s token: %s %s %s", p.Name, resp.Status, body.Error, body.Description)
+	}
+	life := p.TokenLife
+	if n, err := body.ExpiresIn.Int64(); err == nil && n > 0 {
+		life = time.Duration(n) * time.Second
+	}
+	return &Token{
+		AccessToken:  body.AccessToken,
+		RefreshToken: body.RefreshToken,
+		Expiry:       time.Now().Add(life),
+		InstanceURL:  body.InstanceURL,
+	}, nil
+}
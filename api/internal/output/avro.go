@@ -0,0 +1,294 @@
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/Zubimendi/sync-loop/api/internal/checksum"
+	"github.com/Zubimendi/sync-loop/api/internal/model"
+	"github.com/hamba/avro/v2"
+	"github.com/hamba/avro/v2/ocf"
+)
+
+// avroBlockBytes is the uncompressed size at which a data block is closed.
+const avroBlockBytes = 1 << 20
+
+// avroFormat writes Avro Object Container Files with a record schema derived
+// from the source column types. Nullable columns are ["null", T] unions.
+// github.com/hamba/avro does the encoding.
+type avroFormat struct {
+	codec ocf.CodecName
+}
+
+func newAvro(o model.OutputOptions) (Format, error) {
+	switch strings.ToLower(o.Compression) {
+	case "", "none":
+		return avroFormat{codec: ocf.Null}, nil
+	case "gzip", "deflate":
+		return avroFormat{codec: ocf.Deflate}, nil
+	case "zstd":
+		return avroFormat{codec: ocf.ZStandard}, nil
+	case "snappy":
+		return avroFormat{codec: ocf.Snappy}, nil
+	}
+	return nil, fmt.Errorf("unknown avro compression %q", o.Compression)
+}
+
+func (avroFormat) Ext() string { return "avro" }
+
+var avroInvalid = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// avroName turns a column name into a valid Avro name. The original is kept
+// in the field's "sql_name" attribute.
+func avroName(s string) string {
+	s = avroInvalid.ReplaceAllString(s, "_")
+	if s == "" || (s[0] >= '0' && s[0] <= '9') {
+		s = "_" + s
+	}
+	return s
+}
+
+func avroType(c colType) interface{} {
+	var t interface{}
+	switch c.Kind {
+	case kindInt32:
+		t = "int"
+	case kindInt64:
+		t = "long"
+	case kindDouble:
+		t = "double"
+	case kindBool:
+		t = "boolean"
+	case kindDate:
+		t = map[string]interface{}{"type": "int", "logicalType": "date"}
+	case kindTimestamp:
+		t = map[string]interface{}{"type": "long", "logicalType": "timestamp-micros"}
+	case kindLocalTimestamp:
+		t = map[string]interface{}{"type": "long", "logicalType": "local-timestamp-micros"}
+	case kindDecimal:
+		t = map[string]interface{}{"type": "bytes", "logicalType": "decimal", "precision": c.Precision, "scale": c.Scale}
+	case kindJSON:
+		t = map[string]interface{}{"type": "string", "sqlType": "json"}
+	default:
+		t = "string"
+	}
+	if c.Nullable {
+		return []interface{}{"null", t}
+	}
+	return t
+}
+
+func avroSchema(types []colType) ([]byte, error) {
+	fields := make([]map[string]interface{}, len(types))
+	seen := make(map[string]bool, len(types))
+	for i, t := range types {
+		name := avroName(t.Name)
+		if seen[name] {
+			return nil, fmt.Errorf("columns collide as avro field %q", name)
+		}
+		seen[name] = true
+		f := map[string]interface{}{"name": name, "type": avroType(t)}
+		if name != t.Name {
+			f["sql_name"] = t.Name
+		}
+		fields[i] = f
+	}
+	return json.Marshal(map[string]interface{}{
+		"type":   "record",
+		"name":   "Row",
+		"fields": fields,
+	})
+}
+
+// parseAvro parses a record schema on its own, as every table's schema is
+// a record named Row and the library's shared cache would mix them up.
+func parseAvro(schema []byte) (avro.Schema, error) {
+	s, err := avro.ParseBytesWithCache(schema, "", &avro.SchemaCache{})
+	if err != nil {
+		return nil, fmt.Errorf("avro schema: %w", err)
+	}
+	return s, nil
+}
+
+func (f avroFormat) NewWriter(w io.Writer, cols []model.Column) (Writer, error) {
+	types := typesOf(cols)
+	schema, err := avroSchema(types)
+	if err != nil {
+		return nil, err
+	}
+	s, err := parseAvro(schema)
+	if err != nil {
+		return nil, err
+	}
+	enc, err := ocf.NewEncoderWithSchema(s, w,
+		ocf.WithCodec(f.codec),
+		ocf.WithBlockLength(math.MaxInt),
+		ocf.WithBlockSize(avroBlockBytes),
+		ocf.WithEncoderSchemaCache(&avro.SchemaCache{}),
+		// The library writes the canonical form by default, which drops
+		// the sql_name attributes Digest maps fields back with.
+		ocf.WithSchemaMarshaler(func(avro.Schema) ([]byte, error) { return schema, nil }),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &avroWriter{enc: enc, types: types}, nil
+}
+
+type avroWriter struct {
+	enc   *ocf.Encoder
+	types []colType
+}
+
+func (aw *avroWriter) Write(row map[string]interface{}) error {
+	rec, err := avroRecord(aw.types, row)
+	if err != nil {
+		return err
+	}
+	return aw.enc.Encode(rec)
+}
+
+func (aw *avroWriter) Close() error { return aw.enc.Close() }
+
+// avroRecord converts a row to the values the library encodes the record
+// schema of types with: time.Time for dates and timestamps and *big.Rat for
+// decimals.
+func avroRecord(types []colType, row map[string]interface{}) (map[string]interface{}, error) {
+	rec := make(map[string]interface{}, len(types))
+	for _, t := range types {
+		v, err := encodeValue(t, row[t.Name])
+		if err != nil {
+			return nil, &RowError{Column: t.Name, Err: err}
+		}
+		switch x := v.(type) {
+		case *big.Int:
+			v = new(big.Rat).SetFrac(x, pow10(t.Scale))
+		case int32:
+			if t.Kind == kindDate {
+				v = time.Unix(int64(x)*86400, 0).UTC()
+			}
+		case int64:
+			switch {
+			case t.Kind == kindTimestamp:
+				v = time.UnixMicro(x).UTC()
+			case t.Kind == kindLocalTimestamp && t.Nullable:
+				// The library cannot pick the union branch of a
+				// local timestamp from its Go type, so it is named.
+				v = map[string]interface{}{"long.local-timestamp-micros": time.UnixMicro(x).UTC()}
+			case t.Kind == kindLocalTimestamp:
+				v = time.UnixMicro(x).UTC()
+			}
+		}
+		rec[avroName(t.Name)] = v
+	}
+	return rec, nil
+}
+
+// avroField is a field of a writer schema as far as Digest needs it.
+type avroField struct {
+	name    string // the field's name in the record
+	sqlName string // the column it holds
+	decimal bool
+	scale   int
+}
+
+// avroFields lists the fields of a record schema whose types rows can
+// hold: primitives, their logical types and [null, T] unions.
+func avroFields(s avro.Schema) ([]avroField, error) {
+	rec, ok := s.(*avro.RecordSchema)
+	if !ok {
+		return nil, fmt.Errorf("avro schema is a %s, not a record", s.Type())
+	}
+	out := make([]avroField, len(rec.Fields()))
+	for i, f := range rec.Fields() {
+		af := avroField{name: f.Name(), sqlName: f.Name()}
+		if n, ok := f.Prop("sql_name").(string); ok && n != "" {
+			af.sqlName = n
+		}
+		t := f.Type()
+		if u, ok := t.(*avro.UnionSchema); ok {
+			if !u.Nullable() {
+				return nil, fmt.Errorf("field %s: only [null, T] unions are supported", f.Name())
+			}
+			for _, ut := range u.Types() {
+				if ut.Type() != avro.Null {
+					t = ut
+				}
+			}
+		}
+		switch t.Type() {
+		case avro.Int, avro.Long, avro.Float, avro.Double, avro.Boolean, avro.String:
+		case avro.Bytes:
+			if ls, ok := t.(avro.LogicalTypeSchema); ok && ls.Logical() != nil {
+				if d, ok := ls.Logical().(*avro.DecimalLogicalSchema); ok {
+					af.decimal, af.scale = true, d.Scale()
+				}
+			}
+		default:
+			return nil, fmt.Errorf("field %s: unsupported avro type %s", f.Name(), t.Type())
+		}
+		out[i] = af
+	}
+	return out, nil
+}
+
+// avroRow renders a decoded record the way checksum.Canonical renders the
+// source values, keyed by column name.
+func avroRow(fields []avroField, rec map[string]interface{}) map[string]interface{} {
+	row := make(map[string]interface{}, len(fields))
+	for _, f := range fields {
+		v := rec[f.name]
+		if branch, ok := v.(map[string]interface{}); ok && len(branch) == 1 {
+			// A union value the library did not map to a Go type comes
+			// back keyed by its branch.
+			for _, bv := range branch {
+				v = bv
+			}
+		}
+		switch x := v.(type) {
+		case time.Time:
+			v = checksum.Canonical(x)
+		case *big.Rat:
+			v = x.FloatString(f.scale)
+		case []byte:
+			v = string(x)
+		case int:
+			v = int64(x)
+		case float32:
+			v = float64(x)
+		}
+		row[f.sqlName] = v
+	}
+	return row
+}
+
+// Digest decodes the container with its own writer schema, so it checks
+// what was written rather than what was intended.
+func (avroFormat) Digest(r io.Reader) (*checksum.Digest, error) {
+	dec, err := ocf.NewDecoder(r, ocf.WithDecoderSchemaCache(&avro.SchemaCache{}))
+	if err != nil {
+		return nil, err
+	}
+	fields, err := avroFields(dec.Schema())
+	if err != nil {
+		return nil, err
+	}
+	var d checksum.Digest
+	for dec.HasNext() {
+		var rec map[string]interface{}
+		if err := dec.Decode(&rec); err != nil {
+			return nil, err
+		}
+		d.Add(avroRow(fields, rec))
+	}
+	if err := dec.Error(); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
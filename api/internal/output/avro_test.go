@@ -0,0 +1,164 @@
+package output
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Zubimendi/sync-loop/api/internal/checksum"
+	"github.com/Zubimendi/sync-loop/api/internal/model"
+	"github.com/hamba/avro/v2"
+	"github.com/hamba/avro/v2/ocf"
+)
+
+var avroCols = []model.Column{
+	{Name: "id", Type: "bigint"},
+	{Name: "qty", Type: "integer", Nullable: true},
+	{Name: "price", Type: "numeric", Precision: 10, Scale: 2, Nullable: true},
+	{Name: "ratio", Type: "double precision", Nullable: true},
+	{Name: "ok", Type: "boolean", Nullable: true},
+	{Name: "day", Type: "date", Nullable: true},
+	{Name: "at", Type: "timestamp with time zone", Nullable: true},
+	{Name: "local at", Type: "timestamp without time zone", Nullable: true},
+	{Name: "doc", Type: "jsonb", Nullable: true},
+	{Name: "name", Type: "text", Nullable: true},
+}
+
+func avroRows() []map[string]interface{} {
+	return []map[string]interface{}{
+		{
+			"id": int64(1), "qty": int32(3), "price": "-12345678.90", "ratio": 0.25, "ok": true,
+			"day":      time.Date(1969, 12, 31, 0, 0, 0, 0, time.UTC),
+			"at":       time.Date(2024, 2, 29, 23, 59, 59, 123456000, time.UTC),
+			"local at": time.Date(2262, 4, 12, 0, 0, 0, 0, time.UTC),
+			"doc":      `{"a":[1,2]}`, "name": "héllo",
+		},
+		{"id": int64(2), "qty": nil, "price": nil, "ratio": nil, "ok": nil, "day": nil, "at": nil, "local at": nil, "doc": nil, "name": nil},
+	}
+}
+
+func TestAvroRoundTrip(t *testing.T) {
+	for _, codec := range []string{"", "deflate", "zstd", "snappy"} {
+		t.Run(codec, func(t *testing.T) {
+			f, err := New(model.OutputOptions{Format: "avro", Compression: codec})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var buf bytes.Buffer
+			w, err := f.NewWriter(&buf, avroCols)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var want checksum.Digest
+			for _, row := range avroRows() {
+				if err := w.Write(row); err != nil {
+					t.Fatal(err)
+				}
+				want.Add(row)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+			got, err := f.Digest(bytes.NewReader(buf.Bytes()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Rows() != 2 || got.Sum() != want.Sum() {
+				t.Errorf("digest = %d rows %s, want 2 rows %s", got.Rows(), got.Sum(), want.Sum())
+			}
+		})
+	}
+}
+
+// TestAvroReadable decodes a written file with the library directly, as any
+// other Avro reader would see it.
+func TestAvroReadable(t *testing.T) {
+	f, _ := New(model.OutputOptions{Format: "avro"})
+	var buf bytes.Buffer
+	w, _ := f.NewWriter(&buf, avroCols)
+	for _, row := range avroRows() {
+		if err := w.Write(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w.Close()
+
+	dec, err := ocf.NewDecoder(&buf, ocf.WithDecoderSchemaCache(&avro.SchemaCache{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := dec.Schema().(*avro.RecordSchema)
+	if got := rec.Fields()[7]; got.Name() != "local_at" || got.Prop("sql_name") != "local at" {
+		t.Errorf("field 7 = %s (sql_name %v), want local_at (sql_name local at)", got.Name(), got.Prop("sql_name"))
+	}
+	var first map[string]interface{}
+	if !dec.HasNext() {
+		t.Fatal(dec.Error())
+	}
+	if err := dec.Decode(&first); err != nil {
+		t.Fatal(err)
+	}
+	if at, ok := first["at"].(time.Time); !ok || !at.Equal(time.Date(2024, 2, 29, 23, 59, 59, 123456000, time.UTC)) {
+		t.Errorf("at = %v", first["at"])
+	}
+	if first["name"] != "héllo" || first["id"] != int64(1) {
+		t.Errorf("row = %v", first)
+	}
+}
+
+func TestAvroRejectsRow(t *testing.T) {
+	f, _ := New(model.OutputOptions{Format: "avro"})
+	var buf bytes.Buffer
+	w, _ := f.NewWriter(&buf, avroCols)
+	for _, row := range []map[string]interface{}{
+		{"id": nil},
+		{"id": int64(1), "price": "123456789.00"},
+		{"id": int64(1), "price": "1.005"},
+		{"id": int64(1), "qty": "three"},
+	} {
+		var rowErr *RowError
+		if err := w.Write(row); !errors.As(err, &rowErr) {
+			t.Errorf("Write(%v) = %v, want a *RowError", row, err)
+		}
+	}
+	if err := w.Write(avroRows()[1]); err != nil {
+		t.Fatalf("writer unusable after a rejected row: %v", err)
+	}
+	w.Close()
+	d, err := f.Digest(&buf)
+	if err != nil || d.Rows() != 1 {
+		t.Fatalf("Digest = %v, %v; want 1 row", d, err)
+	}
+}
+
+func TestAvroRecordCodec(t *testing.T) {
+	c, err := NewRecordCodec("avro", avroCols)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dec, err := NewAvroDecoder(c.Schema())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range avroRows() {
+		b, err := c.Encode(row)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := dec.Decode(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if checksum.RowHash(got) != checksum.RowHash(row) {
+			t.Errorf("decoded %v, want %v", got, row)
+		}
+	}
+}
+
+func TestAvroDecoderRejectsUnions(t *testing.T) {
+	_, err := NewAvroDecoder([]byte(`{"type":"record","name":"R","fields":[{"name":"a","type":["string","long"]}]}`))
+	if err == nil {
+		t.Error("a [string, long] union was accepted")
+	}
+}
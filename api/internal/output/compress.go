@@ -0,0 +1,83 @@
+package output
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/Zubimendi/sync-loop/api/internal/checksum"
+	"github.com/Zubimendi/sync-loop/api/internal/model"
+	"github.com/klauspost/compress/zstd"
+)
+
+// compressedFormat compresses a whole text file with gzip or zstd. Binary
+// formats compress internally instead (Parquet pages, Avro blocks).
+type compressedFormat struct {
+	Format
+	codec string
+}
+
+func compressed(f Format, codec string) (Format, error) {
+	switch c := strings.ToLower(codec); c {
+	case "", "none":
+		return f, nil
+	case "gzip", "zstd":
+		return compressedFormat{Format: f, codec: c}, nil
+	}
+	return nil, fmt.Errorf("unknown %s compression %q", f.Ext(), codec)
+}
+
+func (f compressedFormat) Ext() string {
+	if f.codec == "gzip" {
+		return f.Format.Ext() + ".gz"
+	}
+	return f.Format.Ext() + ".zst"
+}
+
+func (f compressedFormat) NewWriter(w io.Writer, cols []model.Column) (Writer, error) {
+	var zw io.WriteCloser
+	if f.codec == "gzip" {
+		zw = gzip.NewWriter(w)
+	} else {
+		enc, err := zstd.NewWriter(w)
+		if err != nil {
+			return nil, err
+		}
+		zw = enc
+	}
+	inner, err := f.Format.NewWriter(zw, cols)
+	if err != nil {
+		return nil, err
+	}
+	return &compressedWriter{Writer: inner, zw: zw}, nil
+}
+
+type compressedWriter struct {
+	Writer
+	zw io.WriteCloser
+}
+
+func (w *compressedWriter) Close() error {
+	if err := w.Writer.Close(); err != nil {
+		return err
+	}
+	return w.zw.Close()
+}
+
+func (f compressedFormat) Digest(r io.Reader) (*checksum.Digest, error) {
+	if f.codec == "gzip" {
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		return f.Format.Digest(zr)
+	}
+	zr, err := zstd.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return f.Format.Digest(zr)
+}
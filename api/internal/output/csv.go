@@ -0,0 +1,68 @@
+package output
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"unicode/utf8"
+
+	"github.com/Zubimendi/sync-loop/api/internal/checksum"
+	"github.com/Zubimendi/sync-loop/api/internal/model"
+)
+
+// csvFormat writes untyped CSV with a header row. NULL and the empty string
+// are both written as an empty field.
+type csvFormat struct{}
+
+func (csvFormat) Ext() string { return "csv" }
+
+func (csvFormat) NewWriter(w io.Writer, cols []model.Column) (Writer, error) {
+	cw := &csvWriter{w: csv.NewWriter(w), names: names(cols)}
+	cw.rec = make([]string, len(cw.names))
+	if err := cw.w.Write(cw.names); err != nil {
+		return nil, err
+	}
+	return cw, nil
+}
+
+type csvWriter struct {
+	w     *csv.Writer
+	names []string
+	rec   []string
+}
+
+func (cw *csvWriter) Write(row map[string]interface{}) error {
+	for i, n := range cw.names {
+		cw.rec[i] = checksum.Canonical(row[n])
+		if !utf8.ValidString(cw.rec[i]) {
+			return &RowError{Column: n, Err: errors.New("invalid UTF-8")}
+		}
+	}
+	return cw.w.Write(cw.rec)
+}
+
+func (cw *csvWriter) Close() error {
+	cw.w.Flush()
+	return cw.w.Error()
+}
+
+// Digest digests a CSV stream whose first record is the header.
+func (csvFormat) Digest(r io.Reader) (*checksum.Digest, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err != nil {
+		return nil, err
+	}
+	var d checksum.Digest
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			return &d, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		d.AddStrings(header, rec)
+	}
+}
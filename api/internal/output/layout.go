@@ -0,0 +1,243 @@
+package output
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/Zubimendi/sync-loop/api/internal/checksum"
+	"github.com/Zubimendi/sync-loop/api/internal/model"
+)
+
+// DefaultKeyTemplate keeps every table under its own prefix.
+const DefaultKeyTemplate = "sync-loop/{table}/{partition}"
+
+// hiveDefaultPartition is the value Hive uses for a NULL partition column.
+const hiveDefaultPartition = "__HIVE_DEFAULT_PARTITION__"
+
+var templateVar = regexp.MustCompile(`\{([a-z_]+)\}`)
+
+var templateVars = map[string]bool{
+	"workspace": true, "connector": true, "job": true, "table": true, "run_id": true,
+	"date": true, "yyyy": true, "mm": true, "dd": true, "hh": true, "partition": true,
+}
+
+// Vars are the values a key template is rendered with.
+type Vars struct {
+	Workspace string
+	Connector string
+	Job       string
+	Table     string
+	RunID     string
+	Time      time.Time
+}
+
+// batchVars change from one batch to the next; the table root is the part of
+// the template before the first of them.
+var batchVars = map[string]bool{
+	"run_id": true, "date": true, "yyyy": true, "mm": true, "dd": true, "hh": true, "partition": true,
+}
+
+// Layout decides the object keys of a batch. A key template such as
+//
+//	exports/{workspace}/{table}/{partition}
+//
+// may use {workspace}, {connector}, {job}, {table}, {run_id}, {date},
+// {yyyy}, {mm}, {dd}, {hh} (the load time, UTC) and {partition}, the
+// name=value segments of the job's partition fields. Parts are named
+// part-<run_id>-<n>.<ext>, so reruns of a run overwrite rather than
+// duplicate. The directories before the first per-batch variable are the
+// table root, which also holds the underscore-prefixed bookkeeping objects
+// query engines skip: _staging/<run_id>/ while a batch is written,
+// _manifests/<run_id>.json and the optional _latest.json.
+type Layout struct {
+	tmpl       string
+	vals       map[string]string
+	root       string
+	partitions []model.PartitionField
+	runID      string
+}
+
+func checkTemplate(tmpl string, partitions []model.PartitionField) error {
+	for _, m := range templateVar.FindAllStringSubmatch(tmpl, -1) {
+		if !templateVars[m[1]] {
+			return fmt.Errorf("unknown key template variable {%s}", m[1])
+		}
+	}
+	if strings.Count(tmpl, "{partition}") > 1 {
+		return errors.New("{partition} may appear once in the key template")
+	}
+	seen := map[string]bool{}
+	for _, p := range partitions {
+		if p.Name == "" || p.Column == "" {
+			return errors.New("partition fields need a name and a column")
+		}
+		if seen[p.Name] {
+			return fmt.Errorf("duplicate partition %q", p.Name)
+		}
+		seen[p.Name] = true
+		switch p.Transform {
+		case "", "identity", "year", "month", "day", "hour":
+		default:
+			return fmt.Errorf("unknown partition transform %q", p.Transform)
+		}
+	}
+	return nil
+}
+
+// NewLayout renders a job's key template. Templates without {partition}
+// get it appended when the job is partitioned.
+func NewLayout(o model.OutputOptions, v Vars) (*Layout, error) {
+	tmpl := o.KeyTemplate
+	if tmpl == "" {
+		tmpl = DefaultKeyTemplate
+	}
+	if err := checkTemplate(tmpl, o.PartitionBy); err != nil {
+		return nil, err
+	}
+	if !strings.Contains(tmpl, "{partition}") {
+		tmpl += "/{partition}"
+	}
+	if v.RunID == "" {
+		v.RunID = fmt.Sprintf("%d", v.Time.UnixNano())
+	}
+	t := v.Time.UTC()
+	vals := map[string]string{
+		"workspace": v.Workspace, "connector": v.Connector, "job": v.Job,
+		"table": v.Table, "run_id": v.RunID,
+		"date": t.Format("2006-01-02"), "yyyy": t.Format("2006"),
+		"mm": t.Format("01"), "dd": t.Format("02"), "hh": t.Format("15"),
+	}
+	l := &Layout{tmpl: tmpl, vals: vals, partitions: o.PartitionBy, runID: v.RunID}
+	root := tmpl
+	for _, m := range templateVar.FindAllStringSubmatchIndex(tmpl, -1) {
+		if batchVars[tmpl[m[2]:m[3]]] {
+			root = tmpl[:m[0]]
+			break
+		}
+	}
+	if i := strings.LastIndexByte(root, '/'); i >= 0 {
+		root = root[:i]
+	} else {
+		root = ""
+	}
+	l.root = cleanKey(l.render(root, ""))
+	return l, nil
+}
+
+// Render fills a template of the variables of Layout but {partition}, for
+// destinations that name one file per batch.
+func Render(tmpl string, v Vars) (string, error) {
+	if strings.Contains(tmpl, "{partition}") {
+		return "", errors.New("{partition} is only for partitioned bucket output")
+	}
+	l, err := NewLayout(model.OutputOptions{KeyTemplate: tmpl}, v)
+	if err != nil {
+		return "", err
+	}
+	return cleanKey(l.render(tmpl, "")), nil
+}
+
+func (l *Layout) render(s, partition string) string {
+	return templateVar.ReplaceAllStringFunc(s, func(m string) string {
+		name := m[1 : len(m)-1]
+		if name == "partition" {
+			return partition
+		}
+		return escapePath(l.vals[name])
+	})
+}
+
+// Partition returns the name=value path of the partition row belongs to,
+// or "" for an unpartitioned job.
+func (l *Layout) Partition(row map[string]interface{}) (string, error) {
+	segs := make([]string, len(l.partitions))
+	for i, p := range l.partitions {
+		v, err := partitionValue(p, row[p.Column])
+		if err != nil {
+			return "", &RowError{Column: p.Column, Err: err}
+		}
+		segs[i] = escapePath(p.Name) + "=" + v
+	}
+	return strings.Join(segs, "/"), nil
+}
+
+func partitionValue(p model.PartitionField, v interface{}) (string, error) {
+	s := checksum.Canonical(v)
+	if s == "" {
+		return hiveDefaultPartition, nil
+	}
+	layout := ""
+	switch p.Transform {
+	case "", "identity":
+		return escapePath(s), nil
+	case "year":
+		layout = "2006"
+	case "month":
+		layout = "2006-01"
+	case "day":
+		layout = "2006-01-02"
+	case "hour":
+		layout = "2006-01-02-15"
+	}
+	t, err := parseTime(s)
+	if err != nil {
+		return "", fmt.Errorf("partition %s: %w", p.Name, err)
+	}
+	return t.UTC().Format(layout), nil
+}
+
+// Key is the final key of the nth part of a partition.
+func (l *Layout) Key(partition string, n int, ext string) string {
+	return cleanKey(path.Join(l.render(l.tmpl, partition), fmt.Sprintf("part-%s-%05d.%s", l.runID, n, ext)))
+}
+
+// Staging is where a final key is written before the batch is published.
+func (l *Layout) Staging(key string) string {
+	return cleanKey(path.Join(l.root, "_staging", l.runID, strings.TrimPrefix(key, l.root)))
+}
+
+// IsRunPart reports whether key is a published part of this layout's run,
+// including parts an earlier attempt of the run wrote under other
+// partitions or part numbers.
+func (l *Layout) IsRunPart(key string) bool {
+	if l.root != "" && !strings.HasPrefix(key, l.root+"/") {
+		return false
+	}
+	if strings.HasPrefix(strings.TrimPrefix(key, l.root+"/"), "_staging/") {
+		return false
+	}
+	return strings.HasPrefix(path.Base(key), "part-"+l.runID+"-")
+}
+
+// Root is the table root; see Layout.
+func (l *Layout) Root() string { return l.root }
+
+func (l *Layout) ManifestKey() string {
+	return cleanKey(path.Join(l.root, "_manifests", l.runID+".json"))
+}
+
+func (l *Layout) LatestKey() string { return cleanKey(path.Join(l.root, "_latest.json")) }
+
+func cleanKey(k string) string {
+	k = path.Clean("/" + k)
+	return strings.TrimPrefix(k, "/")
+}
+
+// escapePath escapes a value the way Hive escapes partition path names, so
+// values holding '/' or '=' stay one segment.
+func escapePath(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c < 0x20 || c == 0x7f || strings.IndexByte("\"#%'*/:=?\\{[]^", c) >= 0 {
+			fmt.Fprintf(&b, "%%%02X", c)
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
@@ -0,0 +1,37 @@
+package output
+
+import (
+	"time"
+
+	"github.com/Zubimendi/sync-loop/api/internal/model"
+)
+
+// Manifest lists the parts of one batch. It is written after every part is
+// in place, so consumers can treat its presence as the batch being complete.
+type Manifest struct {
+	Table     string         `json:"table"`
+	RunID     string         `json:"run_id,omitempty"`
+	Format    string         `json:"format"`
+	Columns   []model.Column `json:"columns"`
+	Rows      int64          `json:"rows"`
+	Checksum  string         `json:"checksum"`
+	CreatedAt time.Time      `json:"created_at"`
+	Parts     []ManifestPart `json:"parts"`
+}
+
+// ManifestPart describes one object; Checksum is the digest of its rows as
+// read back from the bucket.
+type ManifestPart struct {
+	Key       string `json:"key"`
+	Partition string `json:"partition,omitempty"`
+	Rows      int64  `json:"rows"`
+	Bytes     int64  `json:"bytes"`
+	Checksum  string `json:"checksum"`
+}
+
+// Latest is the body of the _latest.json pointer.
+type Latest struct {
+	Manifest  string    `json:"manifest"`
+	RunID     string    `json:"run_id,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,149 @@
+package output
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"strconv"
+
+	"github.com/Zubimendi/sync-loop/api/internal/checksum"
+	"github.com/Zubimendi/sync-loop/api/internal/model"
+)
+
+// ndjsonFormat writes one JSON object per line, keys in column order.
+// Integers, doubles and booleans are JSON scalars; everything else,
+// including json/jsonb columns, is a string so it reads back byte for byte.
+type ndjsonFormat struct{}
+
+func (ndjsonFormat) Ext() string { return "ndjson" }
+
+func (ndjsonFormat) NewWriter(w io.Writer, cols []model.Column) (Writer, error) {
+	enc, err := newJSONObject(cols)
+	if err != nil {
+		return nil, err
+	}
+	return &ndjsonWriter{w: bufio.NewWriter(w), enc: enc}, nil
+}
+
+type ndjsonWriter struct {
+	w    *bufio.Writer
+	enc  *jsonObject
+	line bytes.Buffer
+}
+
+func (nw *ndjsonWriter) Write(row map[string]interface{}) error {
+	nw.line.Reset()
+	if err := nw.enc.encode(&nw.line, row); err != nil {
+		return err
+	}
+	nw.line.WriteByte('\n')
+	_, err := nw.w.Write(nw.line.Bytes())
+	return err
+}
+
+// jsonObject encodes a row as a JSON object, the lines of ndjson.
+type jsonObject struct {
+	types []colType
+	keys  [][]byte
+}
+
+func newJSONObject(cols []model.Column) (*jsonObject, error) {
+	jo := &jsonObject{types: typesOf(cols)}
+	jo.keys = make([][]byte, len(jo.types))
+	for i, t := range jo.types {
+		k, err := json.Marshal(t.Name)
+		if err != nil {
+			return nil, err
+		}
+		jo.keys[i] = k
+	}
+	return jo, nil
+}
+
+func (jo *jsonObject) encode(b *bytes.Buffer, row map[string]interface{}) error {
+	b.WriteByte('{')
+	for i, t := range jo.types {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.Write(jo.keys[i])
+		b.WriteByte(':')
+		if err := jsonValue(b, t, row[t.Name]); err != nil {
+			return &RowError{Column: t.Name, Err: err}
+		}
+	}
+	b.WriteByte('}')
+	return nil
+}
+
+func jsonValue(b *bytes.Buffer, t colType, v interface{}) error {
+	// Only the scalar kinds are typed; the rest keep their canonical text.
+	switch t.Kind {
+	case kindInt32, kindInt64, kindDouble, kindBool:
+	default:
+		t.Kind = kindText
+	}
+	ev, err := encodeValue(t, v)
+	if err != nil {
+		return err
+	}
+	switch x := ev.(type) {
+	case nil:
+		b.WriteString("null")
+	case int32:
+		b.WriteString(strconv.FormatInt(int64(x), 10))
+	case int64:
+		b.WriteString(strconv.FormatInt(x, 10))
+	case bool:
+		b.WriteString(strconv.FormatBool(x))
+	case float64:
+		s := checksum.Canonical(x)
+		if !json.Valid([]byte(s)) {
+			// NaN and ±Inf have no JSON number form.
+			s = strconv.Quote(s)
+		}
+		b.WriteString(s)
+	default:
+		enc, err := json.Marshal(x)
+		if err != nil {
+			return err
+		}
+		b.Write(enc)
+	}
+	return nil
+}
+
+func (nw *ndjsonWriter) Close() error { return nw.w.Flush() }
+
+// Digest digests an NDJSON stream. Numbers are taken verbatim, so a value
+// that lost precision on the way out is caught.
+func (ndjsonFormat) Digest(r io.Reader) (*checksum.Digest, error) {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	var d checksum.Digest
+	for {
+		var obj map[string]interface{}
+		err := dec.Decode(&obj)
+		if err == io.EOF {
+			return &d, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		d.Add(jsonRow(obj))
+	}
+}
+
+// jsonRow takes the numbers of a decoded object verbatim.
+func jsonRow(obj map[string]interface{}) map[string]interface{} {
+	row := make(map[string]interface{}, len(obj))
+	for k, v := range obj {
+		if n, ok := v.(json.Number); ok {
+			row[k] = n.String()
+			continue
+		}
+		row[k] = v
+	}
+	return row
+}
@@ -0,0 +1,89 @@
+// Package output encodes rows into the objects a job writes to the bucket
+// and decodes them again so the load can be verified against the source.
+package output
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/Zubimendi/sync-loop/api/internal/checksum"
+	"github.com/Zubimendi/sync-loop/api/internal/model"
+)
+
+// RowError reports a row the format cannot hold. The row is skipped and the
+// writer stays usable, so callers can dead-letter it and carry on.
+type RowError struct {
+	Column string
+	Err    error
+}
+
+func (e *RowError) Error() string { return fmt.Sprintf("column %s: %v", e.Column, e.Err) }
+func (e *RowError) Unwrap() error { return e.Err }
+
+type Writer interface {
+	Write(row map[string]interface{}) error
+	Close() error
+}
+
+type Format interface {
+	// Ext is the file extension, without the dot.
+	Ext() string
+	NewWriter(w io.Writer, cols []model.Column) (Writer, error)
+	// Digest reads an object written in this format back into a digest of
+	// canonical rows.
+	Digest(r io.Reader) (*checksum.Digest, error)
+}
+
+// New returns the format selected by a job's output options.
+func New(o model.OutputOptions) (Format, error) {
+	if o.MaxFileRows < 0 || o.MaxFileBytes < 0 {
+		return nil, errors.New("max_file_rows and max_file_bytes must not be negative")
+	}
+	if err := checkTemplate(o.KeyTemplate, o.PartitionBy); err != nil {
+		return nil, err
+	}
+	switch strings.ToLower(o.Format) {
+	case "", "csv":
+		return compressed(csvFormat{}, o.Compression)
+	case "ndjson", "jsonl":
+		return compressed(ndjsonFormat{}, o.Compression)
+	case "parquet":
+		return newParquet(o)
+	case "avro":
+		return newAvro(o)
+	case "xlsx", "excel":
+		return newXLSX(o)
+	}
+	return nil, fmt.Errorf("unknown output format %q", o.Format)
+}
+
+// Columns keeps the source column order when it is known; otherwise it
+// falls back to the keys of the first row, typed as nullable text.
+func Columns(cols []model.Column, data []map[string]interface{}) []model.Column {
+	if len(cols) > 0 {
+		return cols
+	}
+	var names []string
+	if len(data) > 0 {
+		for k := range data[0] {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+	}
+	out := make([]model.Column, len(names))
+	for i, n := range names {
+		out[i] = model.Column{Name: n, Type: "text", Nullable: true}
+	}
+	return out
+}
+
+func names(cols []model.Column) []string {
+	nn := make([]string, len(cols))
+	for i, c := range cols {
+		nn[i] = c.Name
+	}
+	return nn
+}
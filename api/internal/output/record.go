@@ -0,0 +1,124 @@
+package output
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Zubimendi/sync-loop/api/internal/model"
+	"github.com/hamba/avro/v2"
+)
+
+// RecordDecoder decodes one encoded row back into values Digest takes.
+type RecordDecoder interface {
+	Decode(b []byte) (map[string]interface{}, error)
+}
+
+// RecordCodec encodes rows one at a time, as the messages of destinations
+// that publish each row on its own rather than write files.
+type RecordCodec interface {
+	RecordDecoder
+	// Encode fails with a *RowError for rows the codec cannot hold.
+	Encode(row map[string]interface{}) ([]byte, error)
+	// Schema is the Avro schema of the records, nil for JSON.
+	Schema() []byte
+}
+
+// NewRecordCodec returns the codec of format, json or avro, for rows of
+// cols. Values are typed as the ndjson and avro formats type them.
+func NewRecordCodec(format string, cols []model.Column) (RecordCodec, error) {
+	switch strings.ToLower(format) {
+	case "", "json":
+		enc, err := newJSONObject(cols)
+		if err != nil {
+			return nil, err
+		}
+		return jsonCodec{enc}, nil
+	case "avro":
+		types := typesOf(cols)
+		schema, err := avroSchema(types)
+		if err != nil {
+			return nil, err
+		}
+		s, err := parseAvro(schema)
+		if err != nil {
+			return nil, err
+		}
+		fields, err := avroFields(s)
+		if err != nil {
+			return nil, err
+		}
+		return avroCodec{types: types, schema: schema, avroDecoder: avroDecoder{s, fields}}, nil
+	}
+	return nil, fmt.Errorf("unknown record format %q", format)
+}
+
+// NewAvroDecoder decodes records written with an Avro record schema, such
+// as one fetched from a schema registry.
+func NewAvroDecoder(schema []byte) (RecordDecoder, error) {
+	s, err := parseAvro(schema)
+	if err != nil {
+		return nil, err
+	}
+	fields, err := avroFields(s)
+	if err != nil {
+		return nil, err
+	}
+	return avroDecoder{s, fields}, nil
+}
+
+type jsonCodec struct{ enc *jsonObject }
+
+func (c jsonCodec) Encode(row map[string]interface{}) ([]byte, error) {
+	var b bytes.Buffer
+	if err := c.enc.encode(&b, row); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+func (jsonCodec) Decode(b []byte) (map[string]interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var obj map[string]interface{}
+	if err := dec.Decode(&obj); err != nil {
+		return nil, err
+	}
+	if obj == nil {
+		return nil, errors.New("not a JSON object")
+	}
+	return jsonRow(obj), nil
+}
+
+func (jsonCodec) Schema() []byte { return nil }
+
+type avroCodec struct {
+	types  []colType
+	schema []byte
+	avroDecoder
+}
+
+func (c avroCodec) Encode(row map[string]interface{}) ([]byte, error) {
+	rec, err := avroRecord(c.types, row)
+	if err != nil {
+		return nil, err
+	}
+	return avro.Marshal(c.avroDecoder.schema, rec)
+}
+
+func (c avroCodec) Schema() []byte { return c.schema }
+
+type avroDecoder struct {
+	schema avro.Schema
+	fields []avroField
+}
+
+func (d avroDecoder) Decode(b []byte) (map[string]interface{}, error) {
+	var rec map[string]interface{}
+	if err := avro.Unmarshal(d.schema, b, &rec); err != nil {
+		return nil, err
+	}
+	return avroRow(d.fields, rec), nil
+}
@@ -0,0 +1,87 @@
+package output
+
+import (
+	"bytes"
+
+	"github.com/Zubimendi/sync-loop/api/internal/model"
+)
+
+// Limits bound the size of one part. Zero means unlimited.
+type Limits struct {
+	MaxRows  int64
+	MaxBytes int64
+}
+
+// Part is one finished object of a batch.
+type Part struct {
+	Data []byte
+	Rows int64
+}
+
+// Splitter writes rows into consecutive parts, closing the current part as
+// soon as it reaches a limit. MaxBytes is checked against what the writer
+// has emitted so far; formats that buffer (compression, Parquet row groups,
+// Avro blocks) can overshoot it by one buffer.
+type Splitter struct {
+	format Format
+	cols   []model.Column
+	limits Limits
+
+	buf   bytes.Buffer
+	w     Writer
+	rows  int64
+	parts []Part
+}
+
+func NewSplitter(f Format, cols []model.Column, l Limits) *Splitter {
+	return &Splitter{format: f, cols: cols, limits: l}
+}
+
+// Write adds a row to the current part. A *RowError leaves the splitter
+// usable; the row is simply not written.
+func (s *Splitter) Write(row map[string]interface{}) error {
+	if s.w == nil {
+		w, err := s.format.NewWriter(&s.buf, s.cols)
+		if err != nil {
+			return err
+		}
+		s.w = w
+	}
+	if err := s.w.Write(row); err != nil {
+		return err
+	}
+	s.rows++
+	if (s.limits.MaxRows > 0 && s.rows >= s.limits.MaxRows) ||
+		(s.limits.MaxBytes > 0 && int64(s.buf.Len()) >= s.limits.MaxBytes) {
+		return s.finish()
+	}
+	return nil
+}
+
+func (s *Splitter) finish() error {
+	if err := s.w.Close(); err != nil {
+		return err
+	}
+	s.parts = append(s.parts, Part{Data: append([]byte(nil), s.buf.Bytes()...), Rows: s.rows})
+	s.buf.Reset()
+	s.w, s.rows = nil, 0
+	return nil
+}
+
+// Close finishes the last part and returns all of them. A batch without
+// rows still yields one empty part, so every load leaves an object behind.
+func (s *Splitter) Close() ([]Part, error) {
+	if s.w == nil && len(s.parts) == 0 {
+		w, err := s.format.NewWriter(&s.buf, s.cols)
+		if err != nil {
+			return nil, err
+		}
+		s.w = w
+	}
+	if s.w != nil {
+		if err := s.finish(); err != nil {
+			return nil, err
+		}
+	}
+	return s.parts, nil
+}
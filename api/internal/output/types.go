@@ -0,0 +1,192 @@
+package output
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Zubimendi/sync-loop/api/internal/checksum"
+	"github.com/Zubimendi/sync-loop/api/internal/model"
+)
+
+// maxDecimalPrecision is the widest numeric written as a typed decimal.
+// Wider or unconstrained numerics are written as strings so no digit is lost.
+const maxDecimalPrecision = 38
+
+// kind is the value type a column is written as by the typed formats.
+type kind int
+
+const (
+	kindText kind = iota
+	kindJSON
+	kindInt32
+	kindInt64
+	kindDouble
+	kindBool
+	kindDate
+	kindTimestamp      // an instant, written as UTC
+	kindLocalTimestamp // a wall-clock time without zone
+	kindDecimal
+)
+
+type colType struct {
+	Name      string
+	Kind      kind
+	Nullable  bool
+	Precision int
+	Scale     int
+}
+
+// typeOf maps a source column type onto a kind. Anything not recognised is
+// text.
+func typeOf(c model.Column) colType {
+	ct := colType{Name: c.Name, Nullable: c.Nullable}
+	t := strings.ToLower(c.Type)
+	if i := strings.IndexByte(t, '('); i >= 0 {
+		t = strings.TrimSpace(t[:i])
+	}
+	switch t {
+	case "smallint", "int2", "integer", "int", "int4":
+		ct.Kind = kindInt32
+	case "bigint", "int8":
+		ct.Kind = kindInt64
+	case "double precision", "float8", "real", "float4", "float", "double":
+		ct.Kind = kindDouble
+	case "boolean", "bool":
+		ct.Kind = kindBool
+	case "date":
+		ct.Kind = kindDate
+	case "timestamp with time zone", "timestamptz":
+		ct.Kind = kindTimestamp
+	case "timestamp without time zone", "timestamp":
+		ct.Kind = kindLocalTimestamp
+	case "json", "jsonb":
+		ct.Kind = kindJSON
+	case "numeric", "decimal":
+		if c.Precision > 0 && c.Precision <= maxDecimalPrecision {
+			ct.Kind, ct.Precision, ct.Scale = kindDecimal, c.Precision, c.Scale
+		}
+	}
+	return ct
+}
+
+func typesOf(cols []model.Column) []colType {
+	out := make([]colType, len(cols))
+	for i, c := range cols {
+		out[i] = typeOf(c)
+	}
+	return out
+}
+
+// encodeValue converts a canonical value to the Go type of its kind: string,
+// int32, int64, float64, bool, int32 days since the epoch for dates, int64
+// microseconds since the epoch for timestamps and the unscaled *big.Int of a
+// decimal. Empty strings in typed columns are NULL, mirroring
+// checksum.Canonical.
+func encodeValue(c colType, v interface{}) (interface{}, error) {
+	s := ""
+	if v != nil {
+		s = checksum.Canonical(v)
+	}
+	text := c.Kind == kindText || c.Kind == kindJSON
+	if v == nil || (s == "" && !text) {
+		if !c.Nullable {
+			return nil, errors.New("NULL in a non-nullable column")
+		}
+		return nil, nil
+	}
+	switch c.Kind {
+	case kindText, kindJSON:
+		if !utf8.ValidString(s) {
+			return nil, errors.New("invalid UTF-8")
+		}
+		return s, nil
+	case kindDecimal:
+		r, ok := new(big.Rat).SetString(s)
+		if !ok {
+			return nil, fmt.Errorf("not a decimal: %q", s)
+		}
+		scaled := new(big.Rat).Mul(r, new(big.Rat).SetInt(pow10(c.Scale)))
+		if !scaled.IsInt() {
+			return nil, fmt.Errorf("%s has more than %d decimals", s, c.Scale)
+		}
+		if new(big.Int).Abs(scaled.Num()).Cmp(pow10(c.Precision)) >= 0 {
+			return nil, fmt.Errorf("%s does not fit numeric(%d,%d)", s, c.Precision, c.Scale)
+		}
+		return new(big.Int).Set(scaled.Num()), nil
+	case kindDate:
+		t, err := parseTime(s)
+		if err != nil {
+			return nil, err
+		}
+		days := t.Unix() / 86400
+		if t.Unix() < 0 && t.Unix()%86400 != 0 {
+			days--
+		}
+		return int32(days), nil
+	case kindTimestamp, kindLocalTimestamp:
+		t, err := parseTime(s)
+		if err != nil {
+			return nil, err
+		}
+		return t.UnixMicro(), nil
+	case kindInt32:
+		n, err := strconv.ParseInt(s, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("not an integer: %q", s)
+		}
+		return int32(n), nil
+	case kindInt64:
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("not an integer: %q", s)
+		}
+		return n, nil
+	case kindDouble:
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, fmt.Errorf("not a number: %q", s)
+		}
+		return f, nil
+	case kindBool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return nil, fmt.Errorf("not a boolean: %q", s)
+		}
+		return b, nil
+	}
+	return s, nil
+}
+
+func parseTime(s string) (time.Time, error) {
+	for _, l := range []string{time.RFC3339Nano, "2006-01-02"} {
+		if t, err := time.Parse(l, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("not a timestamp: %q", s)
+}
+
+// canonicalMicros renders a read-back timestamp the way checksum.Canonical
+// renders the source values.
+func canonicalMicros(us int64) string { return checksum.Canonical(time.UnixMicro(us)) }
+
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
+
+// twosComplement renders x big-endian in exactly width bytes.
+func twosComplement(x *big.Int, width int) ([]byte, bool) {
+	limit := new(big.Int).Lsh(big.NewInt(1), uint(8*width-1))
+	if x.Cmp(limit) >= 0 || x.Cmp(new(big.Int).Neg(limit)) < 0 {
+		return nil, false
+	}
+	if x.Sign() < 0 {
+		x = new(big.Int).Add(x, new(big.Int).Lsh(big.NewInt(1), uint(8*width)))
+	}
+	return x.FillBytes(make([]byte, width)), true
+}
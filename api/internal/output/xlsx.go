@@ -0,0 +1,391 @@
+package output
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"github.com/xuri/excelize/v2"
+
+	"github.com/Zubimendi/sync-loop/api/internal/checksum"
+	"github.com/Zubimendi/sync-loop/api/internal/model"
+	"github.com/Zubimendi/sync-loop/api/internal/xlsx"
+)
+
+// maxSheets bounds how many sheets sheet_by may open in one workbook.
+const maxSheets = 500
+
+// xlsxFormat writes an Excel workbook. Every sheet starts with a bold,
+// frozen header row carrying an auto-filter, and cells are typed so numbers,
+// dates and booleans sort and sum in Excel. A value Excel cannot hold
+// exactly, such as an integer past 15 digits, is written as text instead so
+// nothing is lost. A sheet that fills up continues on "<name> (2)".
+type xlsxFormat struct {
+	sheet   string
+	sheetBy string
+}
+
+func newXLSX(o model.OutputOptions) (Format, error) {
+	switch strings.ToLower(o.Compression) {
+	case "", "none":
+	default:
+		return nil, fmt.Errorf("xlsx is compressed already; compression %q does not apply", o.Compression)
+	}
+	if o.MaxFileBytes > 0 {
+		return nil, errors.New("xlsx workbooks are built whole; split them with max_file_rows")
+	}
+	name := o.Sheet
+	if name == "" {
+		name = "Sheet1"
+	}
+	if xlsx.SheetName(name, map[string]bool{}) != name {
+		return nil, fmt.Errorf("invalid sheet name %q", name)
+	}
+	return xlsxFormat{sheet: name, sheetBy: o.SheetBy}, nil
+}
+
+func (xlsxFormat) Ext() string { return "xlsx" }
+
+func (x xlsxFormat) NewWriter(w io.Writer, cols []model.Column) (Writer, error) {
+	xw := &xlsxWriter{
+		w:       w,
+		f:       excelize.NewFile(),
+		format:  x,
+		cols:    cols,
+		types:   typesOf(cols),
+		groups:  map[string]*xlsxGroup{},
+		taken:   map[string]bool{},
+		decimal: map[int]int{},
+		by:      -1,
+	}
+	if x.sheetBy != "" {
+		for i, c := range cols {
+			if c.Name == x.sheetBy {
+				xw.by = i
+			}
+		}
+		if xw.by < 0 {
+			return nil, fmt.Errorf("sheet_by column %q is not in the table", x.sheetBy)
+		}
+	}
+	styles := []struct {
+		id    *int
+		style excelize.Style
+	}{
+		{&xw.header, excelize.Style{Font: &excelize.Font{Bold: true}}},
+		{&xw.integer, excelize.Style{NumFmt: 1}},
+		{&xw.date, excelize.Style{CustomNumFmt: strPtr("yyyy-mm-dd")}},
+		{&xw.seconds, excelize.Style{CustomNumFmt: strPtr("yyyy-mm-dd hh:mm:ss")}},
+		{&xw.millis, excelize.Style{CustomNumFmt: strPtr("yyyy-mm-dd hh:mm:ss.000")}},
+	}
+	for _, s := range styles {
+		id, err := xw.f.NewStyle(&s.style)
+		if err != nil {
+			return nil, err
+		}
+		*s.id = id
+	}
+	return xw, nil
+}
+
+type xlsxWriter struct {
+	w      io.Writer
+	f      *excelize.File
+	format xlsxFormat
+	cols   []model.Column
+	types  []colType
+	by     int // index of the sheet_by column, or -1
+
+	groups map[string]*xlsxGroup // by sheet_by value
+	order  []*xlsxSheet
+	taken  map[string]bool
+
+	header, integer, date, seconds, millis int
+	decimal                                map[int]int // style by decimal places
+}
+
+// xlsxGroup is the run of sheets one sheet_by value fills.
+type xlsxGroup struct {
+	base  string
+	sheet *xlsxSheet
+}
+
+type xlsxSheet struct {
+	name string
+	sw   *excelize.StreamWriter
+	rows int // the header included
+}
+
+func (xw *xlsxWriter) Write(row map[string]interface{}) error {
+	vals := make([]interface{}, len(xw.types))
+	for i, t := range xw.types {
+		v, err := xw.cell(i, t, row[t.Name])
+		if err != nil {
+			return &RowError{Column: t.Name, Err: err}
+		}
+		vals[i] = v
+	}
+	key, base := "", xw.format.sheet
+	if xw.by >= 0 {
+		key = xw.sheetValue(row[xw.cols[xw.by].Name])
+		base = key
+		if base == "" {
+			base = "(blank)"
+		}
+	}
+	g := xw.groups[key]
+	if g == nil {
+		if len(xw.order) >= maxSheets {
+			return &RowError{Column: xw.format.sheetBy, Err: fmt.Errorf("more than %d sheets", maxSheets)}
+		}
+		g = &xlsxGroup{base: base}
+		xw.groups[key] = g
+	}
+	if g.sheet == nil || g.sheet.rows >= xlsx.MaxRows {
+		s, err := xw.addSheet(g.base)
+		if err != nil {
+			return err
+		}
+		g.sheet = s
+	}
+	s := g.sheet
+	s.rows++
+	return s.sw.SetRow("A"+strconv.Itoa(s.rows), vals)
+}
+
+// sheetValue is the sheet_by value a sheet is named after; dates drop
+// their time of day.
+func (xw *xlsxWriter) sheetValue(v interface{}) string {
+	s := checksum.Canonical(v)
+	if xw.types[xw.by].Kind == kindDate {
+		if t, err := parseTime(s); err == nil {
+			return t.Format("2006-01-02")
+		}
+	}
+	return s
+}
+
+// addSheet opens a sheet and writes its header. The first one takes over
+// the Sheet1 every new workbook starts with.
+func (xw *xlsxWriter) addSheet(base string) (*xlsxSheet, error) {
+	name := xlsx.SheetName(base, xw.taken)
+	if len(xw.order) == 0 {
+		if err := xw.f.SetSheetName("Sheet1", name); err != nil {
+			return nil, err
+		}
+	} else if _, err := xw.f.NewSheet(name); err != nil {
+		return nil, err
+	}
+	sw, err := xw.f.NewStreamWriter(name)
+	if err != nil {
+		return nil, err
+	}
+	if err := sw.SetPanes(&excelize.Panes{Freeze: true, YSplit: 1, TopLeftCell: "A2", ActivePane: "bottomLeft"}); err != nil {
+		return nil, err
+	}
+	hdr := make([]interface{}, len(xw.cols))
+	for i, c := range xw.cols {
+		width := float64(len([]rune(c.Name)) + 4)
+		switch xw.types[i].Kind {
+		case kindDate:
+			width = max(width, 12)
+		case kindTimestamp, kindLocalTimestamp:
+			width = max(width, 20)
+		}
+		if err := sw.SetColWidth(i+1, i+1, min(max(width, 10), 60)); err != nil {
+			return nil, err
+		}
+		hdr[i] = excelize.Cell{StyleID: xw.header, Value: c.Name}
+	}
+	if err := sw.SetRow("A1", hdr); err != nil {
+		return nil, err
+	}
+	s := &xlsxSheet{name: name, sw: sw, rows: 1}
+	xw.order = append(xw.order, s)
+	return s, nil
+}
+
+// cell converts a value to what the stream writer stores: a styled number,
+// a bool, a string or nil for an empty cell.
+func (xw *xlsxWriter) cell(i int, t colType, v interface{}) (interface{}, error) {
+	numeric := isNumeric(xw.cols[i])
+	if numeric || t.Kind == kindDecimal {
+		// Decimals are checked here rather than by encodeValue so each
+		// keeps its own scale on screen.
+		t.Kind = kindText
+	}
+	ev, err := encodeValue(t, v)
+	if err != nil || ev == nil {
+		return nil, err
+	}
+	switch t.Kind {
+	case kindInt32, kindInt64:
+		s := checksum.Canonical(ev)
+		if n, ok := exactNumber(s, 0); ok {
+			return excelize.Cell{StyleID: xw.integer, Value: n}, nil
+		}
+		return s, nil
+	case kindDouble:
+		s := checksum.Canonical(ev)
+		if n, ok := exactNumber(s, -1); ok {
+			return n, nil
+		}
+		return s, nil
+	case kindBool:
+		return ev, nil
+	case kindDate:
+		tm := time.Unix(int64(ev.(int32))*86400, 0).UTC()
+		if serial, ok := xlsx.Serial(tm, false); ok {
+			return excelize.Cell{StyleID: xw.date, Value: serial}, nil
+		}
+		return checksum.Canonical(tm), nil
+	case kindTimestamp, kindLocalTimestamp:
+		us := ev.(int64)
+		tm := time.UnixMicro(us).UTC()
+		if serial, ok := xlsx.Serial(tm, false); ok && xlsx.TimeOf(serial, false).Equal(tm) {
+			style := xw.seconds
+			if us%1e6 != 0 {
+				style = xw.millis
+			}
+			return excelize.Cell{StyleID: style, Value: serial}, nil
+		}
+		return canonicalMicros(us), nil
+	}
+	s := ev.(string)
+	if numeric {
+		_, frac, _ := strings.Cut(s, ".")
+		if n, ok := exactNumber(s, len(frac)); ok {
+			style, err := xw.decimalStyle(len(frac))
+			if err != nil {
+				return nil, err
+			}
+			return excelize.Cell{StyleID: style, Value: n}, nil
+		}
+		return s, nil
+	}
+	return s, checkText(s)
+}
+
+// exactNumber parses s if Excel shows it back exactly as s.
+func exactNumber(s string, decimals int) (float64, bool) {
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || xlsx.FormatNumber(n, decimals) != s {
+		return 0, false
+	}
+	return n, true
+}
+
+func (xw *xlsxWriter) decimalStyle(places int) (int, error) {
+	if places == 0 {
+		return xw.integer, nil
+	}
+	if id, ok := xw.decimal[places]; ok {
+		return id, nil
+	}
+	id, err := xw.f.NewStyle(&excelize.Style{CustomNumFmt: strPtr("0." + strings.Repeat("0", places))})
+	if err != nil {
+		return 0, err
+	}
+	xw.decimal[places] = id
+	return id, nil
+}
+
+// checkText rejects text a cell cannot hold: past Excel's length limit, or
+// with control characters XML has no way to write.
+func checkText(s string) error {
+	if len(s) > xlsx.MaxCellChars && len(utf16.Encode([]rune(s))) > xlsx.MaxCellChars {
+		return fmt.Errorf("text longer than the %d characters a cell holds", xlsx.MaxCellChars)
+	}
+	for _, r := range s {
+		if (r < 0x20 && r != '\t' && r != '\n' && r != '\r') || r == 0xfffe || r == 0xffff {
+			return fmt.Errorf("control character %U cannot be written to a cell", r)
+		}
+	}
+	return nil
+}
+
+func isNumeric(c model.Column) bool {
+	t := strings.ToLower(c.Type)
+	return strings.HasPrefix(t, "numeric") || strings.HasPrefix(t, "decimal")
+}
+
+func strPtr(s string) *string { return &s }
+
+// Close sets the auto-filters over the finished ranges, flushes every sheet
+// and writes the workbook out. A workbook without rows still gets its
+// header sheet.
+func (xw *xlsxWriter) Close() error {
+	defer xw.f.Close()
+	if len(xw.order) == 0 {
+		if _, err := xw.addSheet(xw.format.sheet); err != nil {
+			return err
+		}
+	}
+	last, err := excelize.ColumnNumberToName(max(len(xw.cols), 1))
+	if err != nil {
+		return err
+	}
+	for _, s := range xw.order {
+		// A stream writes out the sheet's settings on Flush, so the filter
+		// goes in first.
+		if len(xw.cols) > 0 {
+			if err := xw.f.AutoFilter(s.name, fmt.Sprintf("A1:%s%d", last, s.rows), nil); err != nil {
+				return err
+			}
+		}
+		if err := s.sw.Flush(); err != nil {
+			return err
+		}
+	}
+	_, err = xw.f.WriteTo(xw.w)
+	return err
+}
+
+// Digest reads every sheet back, naming each row's cells after the sheet's
+// header row.
+func (xlsxFormat) Digest(r io.Reader) (*checksum.Digest, error) {
+	f, err := xlsx.Open(r)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var d checksum.Digest
+	for _, sheet := range f.GetSheetList() {
+		grid, err := xlsx.ReadSheet(f, sheet)
+		if err != nil {
+			return nil, err
+		}
+		if len(grid) == 0 {
+			continue
+		}
+		names := make([]string, len(grid[0]))
+		for i, c := range grid[0] {
+			names[i] = c.Value
+		}
+		for _, rec := range grid[1:] {
+			row := make(map[string]interface{}, len(names))
+			for i, n := range names {
+				row[n] = nil
+				if i < len(rec) {
+					row[n] = canonicalCell(rec[i])
+				}
+			}
+			d.Add(row)
+		}
+	}
+	return &d, nil
+}
+
+func canonicalCell(c xlsx.Cell) interface{} {
+	switch c.Kind {
+	case xlsx.Empty:
+		return nil
+	case xlsx.Date, xlsx.DateTime, xlsx.Time:
+		return checksum.Canonical(c.Time)
+	}
+	return c.Value
+}
@@ -0,0 +1,226 @@
+// Package parquet writes and reads flat Parquet files: a single level of
+// columns and no nested groups. It maps the column types SyncLoop deals in
+// onto github.com/parquet-go/parquet-go, which does the encoding, and hands
+// rows back as plain Go values.
+package parquet
+
+import (
+	"fmt"
+	"math/big"
+	"reflect"
+
+	parquetgo "github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/compress"
+	"github.com/parquet-go/parquet-go/encoding"
+)
+
+// Type is the physical type of a column.
+type Type int32
+
+const (
+	Boolean           Type = 0
+	Int32             Type = 1
+	Int64             Type = 2
+	Int96             Type = 3
+	Float             Type = 4
+	Double            Type = 5
+	ByteArray         Type = 6
+	FixedLenByteArray Type = 7
+)
+
+// Logical annotates how a physical type is to be read. Timestamps are
+// microseconds since the epoch.
+type Logical int
+
+const (
+	None Logical = iota
+	String
+	Decimal
+	Date
+	Timestamp      // adjusted to UTC
+	LocalTimestamp // wall clock, no zone
+	JSON
+)
+
+type Column struct {
+	Name     string
+	Type     Type
+	Length   int // width of a FixedLenByteArray
+	Optional bool
+	Logical  Logical
+	// Scale and Precision describe a Decimal, which is an Int32, Int64 or
+	// FixedLenByteArray; see DecimalLength.
+	Scale     int
+	Precision int
+
+	// unit is the length of one timestamp tick in nanoseconds when read
+	// from a file; written files always use microseconds.
+	unit int64
+}
+
+// TimeUnit is the length of one tick of a Timestamp or LocalTimestamp
+// column in nanoseconds.
+func (c Column) TimeUnit() int64 {
+	if c.unit == 0 {
+		return 1000
+	}
+	return c.unit
+}
+
+// DecimalLength is the smallest FixedLenByteArray width holding precision
+// decimal digits in two's complement.
+func DecimalLength(precision int) int {
+	max := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(precision)), nil)
+	for n := 1; ; n++ {
+		if new(big.Int).Lsh(big.NewInt(1), uint(8*n-1)).Cmp(max) >= 0 {
+			return n
+		}
+	}
+}
+
+// Codec is the page compression codec.
+type Codec int32
+
+const (
+	Uncompressed Codec = 0
+	Snappy       Codec = 1
+	Gzip         Codec = 2
+	Zstd         Codec = 6
+)
+
+func (c Codec) codec() (compress.Codec, error) {
+	switch c {
+	case Uncompressed:
+		return &parquetgo.Uncompressed, nil
+	case Snappy:
+		return &parquetgo.Snappy, nil
+	case Gzip:
+		return &parquetgo.Gzip, nil
+	case Zstd:
+		return &parquetgo.Zstd, nil
+	}
+	return nil, fmt.Errorf("parquet: unsupported codec %d", c)
+}
+
+func (t Type) leaf(length int) parquetgo.Type {
+	switch t {
+	case Boolean:
+		return parquetgo.BooleanType
+	case Int32:
+		return parquetgo.Int32Type
+	case Int64:
+		return parquetgo.Int64Type
+	case Int96:
+		return parquetgo.Int96Type
+	case Float:
+		return parquetgo.FloatType
+	case Double:
+		return parquetgo.DoubleType
+	case ByteArray:
+		return parquetgo.ByteArrayType
+	case FixedLenByteArray:
+		return parquetgo.FixedLenByteArrayType(length)
+	}
+	return nil
+}
+
+// node is the schema node of a column.
+func (c Column) node() (parquetgo.Node, error) {
+	typ := c.Type.leaf(c.Length)
+	if typ == nil {
+		return nil, fmt.Errorf("parquet: column %s has unknown type %d", c.Name, c.Type)
+	}
+	if c.Type == FixedLenByteArray && c.Length <= 0 {
+		return nil, fmt.Errorf("parquet: column %s needs a length", c.Name)
+	}
+	var n parquetgo.Node
+	switch c.Logical {
+	case None:
+		n = parquetgo.Leaf(typ)
+	case String:
+		n = parquetgo.String()
+	case JSON:
+		n = parquetgo.JSON()
+	case Date:
+		n = parquetgo.Date()
+	case Timestamp:
+		n = parquetgo.Timestamp(parquetgo.Microsecond)
+	case LocalTimestamp:
+		n = parquetgo.TimestampAdjusted(parquetgo.Microsecond, false)
+	case Decimal:
+		switch c.Type {
+		case Int32, Int64, FixedLenByteArray:
+			n = parquetgo.Decimal(c.Scale, c.Precision, typ)
+		}
+	}
+	if n == nil || n.Type().Kind() != typ.Kind() {
+		return nil, fmt.Errorf("parquet: column %s cannot be %s with logical type %d", c.Name, typ, c.Logical)
+	}
+	// PLAIN pages are read by every engine; parquet-go would otherwise pick
+	// delta encodings for some types.
+	n = parquetgo.Encoded(n, &parquetgo.Plain)
+	if c.Optional {
+		return parquetgo.Optional(n), nil
+	}
+	return parquetgo.Required(n), nil
+}
+
+// columnOf reads a column back from the schema of a file.
+func columnOf(f parquetgo.Field) Column {
+	t := f.Type()
+	c := Column{Name: f.Name(), Type: Type(t.Kind()), Optional: f.Optional()}
+	if c.Type == FixedLenByteArray {
+		c.Length = t.Length()
+	}
+	lt := t.LogicalType()
+	switch {
+	case lt == nil:
+	case lt.UTF8 != nil:
+		c.Logical = String
+	case lt.Decimal != nil:
+		c.Logical, c.Scale, c.Precision = Decimal, int(lt.Decimal.Scale), int(lt.Decimal.Precision)
+	case lt.Date != nil:
+		c.Logical = Date
+	case lt.Timestamp != nil:
+		c.Logical = LocalTimestamp
+		if lt.Timestamp.IsAdjustedToUTC {
+			c.Logical = Timestamp
+		}
+		switch u := lt.Timestamp.Unit; {
+		case u.Millis != nil:
+			c.unit = 1e6
+		case u.Nanos != nil:
+			c.unit = 1
+		}
+	case lt.Json != nil:
+		c.Logical = JSON
+	}
+	return c
+}
+
+// group is the root of a written schema. parquet-go's Group sorts its
+// fields by name; files keep the order of the columns instead.
+type group []parquetgo.Field
+
+func (g group) ID() int                     { return 0 }
+func (g group) String() string              { return parquetgo.Group{}.String() }
+func (g group) Type() parquetgo.Type        { return parquetgo.Group{}.Type() }
+func (g group) Optional() bool              { return false }
+func (g group) Repeated() bool              { return false }
+func (g group) Required() bool              { return true }
+func (g group) Leaf() bool                  { return false }
+func (g group) Fields() []parquetgo.Field   { return g }
+func (g group) Encoding() encoding.Encoding { return nil }
+func (g group) Compression() compress.Codec { return nil }
+func (g group) GoType() reflect.Type        { return reflect.TypeOf(map[string]interface{}(nil)) }
+
+type field struct {
+	parquetgo.Node
+	name string
+}
+
+func (f field) Name() string { return f.name }
+
+func (f field) Value(base reflect.Value) reflect.Value {
+	return base.MapIndex(reflect.ValueOf(f.name))
+}
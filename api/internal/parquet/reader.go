@@ -0,0 +1,165 @@
+package parquet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"time"
+
+	parquetgo "github.com/parquet-go/parquet-go"
+)
+
+// File is a Parquet file held in memory.
+type File struct {
+	Columns []Column
+	NumRows int64
+
+	file *parquetgo.File
+}
+
+// Open parses the footer of a flat Parquet file.
+func Open(data []byte) (f *File, err error) {
+	// parquet-go panics on some schemas it does not support, such as
+	// decimals annotated on BYTE_ARRAY.
+	defer func() {
+		if r := recover(); r != nil {
+			f, err = nil, fmt.Errorf("parquet: %v", r)
+		}
+	}()
+	pf, err := parquetgo.OpenFile(bytes.NewReader(data), int64(len(data)),
+		parquetgo.SkipPageIndex(true), parquetgo.SkipBloomFilters(true))
+	if err != nil {
+		return nil, fmt.Errorf("parquet: %w", err)
+	}
+	f = &File{NumRows: pf.NumRows(), file: pf}
+	for _, fl := range pf.Schema().Fields() {
+		if !fl.Leaf() || fl.Repeated() {
+			return nil, errors.New("parquet: nested schemas are not supported")
+		}
+		f.Columns = append(f.Columns, columnOf(fl))
+	}
+	return f, nil
+}
+
+// Rows calls fn for every row. Values have the Go type of their physical
+// column type, with []byte for byte arrays and nil for NULL. The slice, and
+// the bytes in it, are reused between calls.
+func (f *File) Rows(fn func(row []interface{}) error) error {
+	row := make([]interface{}, len(f.Columns))
+	buf := make([]parquetgo.Row, 256)
+	for _, g := range f.file.RowGroups() {
+		if err := readRows(g.Rows(), buf, row, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readRows(rows parquetgo.Rows, buf []parquetgo.Row, row []interface{}, fn func([]interface{}) error) error {
+	defer rows.Close()
+	for {
+		n, err := rows.ReadRows(buf)
+		for _, r := range buf[:n] {
+			for i := range row {
+				row[i] = nil
+			}
+			for _, v := range r {
+				if c := v.Column(); c >= 0 && c < len(row) {
+					row[c] = goValue(v)
+				}
+			}
+			if err := fn(row); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("parquet: %w", err)
+		}
+	}
+}
+
+func goValue(v parquetgo.Value) interface{} {
+	if v.IsNull() {
+		return nil
+	}
+	switch v.Kind() {
+	case parquetgo.Boolean:
+		return v.Boolean()
+	case parquetgo.Int32:
+		return v.Int32()
+	case parquetgo.Int64:
+		return v.Int64()
+	case parquetgo.Int96:
+		i := v.Int96()
+		b := make([]byte, 12)
+		for k, w := range i {
+			binary.LittleEndian.PutUint32(b[4*k:], w)
+		}
+		return b
+	case parquetgo.Float:
+		return v.Float()
+	case parquetgo.Double:
+		return v.Double()
+	}
+	return v.ByteArray()
+}
+
+// julianEpoch is the Julian day number of 1970-01-01, used by INT96
+// timestamps.
+const julianEpoch = 2440588
+
+// Native converts a value as returned by Rows to its natural Go type:
+// time.Time (UTC) for dates and timestamps, including legacy INT96 ones, a
+// fixed-point decimal string for decimals, string for text and the physical
+// value otherwise.
+func (c Column) Native(v interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+	switch c.Logical {
+	case Timestamp, LocalTimestamp:
+		if n, ok := v.(int64); ok {
+			// Split off whole seconds first: n times the unit overflows
+			// int64 for nanoseconds past 2262.
+			perSec := int64(time.Second) / c.TimeUnit()
+			return time.Unix(n/perSec, n%perSec*c.TimeUnit()).UTC()
+		}
+	case Date:
+		if n, ok := v.(int32); ok {
+			return time.Unix(int64(n)*86400, 0).UTC()
+		}
+	case Decimal:
+		var unscaled *big.Int
+		switch t := v.(type) {
+		case int32:
+			unscaled = big.NewInt(int64(t))
+		case int64:
+			unscaled = big.NewInt(t)
+		case []byte:
+			unscaled = new(big.Int).SetBytes(t)
+			if len(t) > 0 && t[0]&0x80 != 0 {
+				unscaled.Sub(unscaled, new(big.Int).Lsh(big.NewInt(1), uint(len(t)*8)))
+			}
+		}
+		scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(c.Scale)), nil)
+		return new(big.Rat).SetFrac(unscaled, scale).FloatString(c.Scale)
+	}
+	switch t := v.(type) {
+	case []byte:
+		if c.Type == Int96 && len(t) == 12 {
+			nanos := int64(binary.LittleEndian.Uint64(t))
+			days := int64(binary.LittleEndian.Uint32(t[8:])) - julianEpoch
+			return time.Unix(days*86400, nanos).UTC()
+		}
+		return string(t)
+	case float32:
+		return float64(t)
+	}
+	return v
+}
@@ -0,0 +1,161 @@
+package parquet
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	parquetgo "github.com/parquet-go/parquet-go"
+)
+
+// DefaultRowGroupRows is used when Options.RowGroupRows is zero.
+const DefaultRowGroupRows = 100000
+
+type Options struct {
+	Codec        Codec
+	RowGroupRows int64
+}
+
+// Writer writes rows into row groups of at most Options.RowGroupRows rows.
+type Writer struct {
+	pw     *parquetgo.Writer
+	cols   []Column
+	rows   []parquetgo.Row
+	closed bool
+}
+
+func NewWriter(w io.Writer, cols []Column, o Options) (*Writer, error) {
+	if len(cols) == 0 {
+		return nil, errors.New("parquet: no columns")
+	}
+	root := make(group, len(cols))
+	seen := map[string]bool{}
+	for i, c := range cols {
+		if seen[c.Name] {
+			return nil, fmt.Errorf("parquet: duplicate column %s", c.Name)
+		}
+		seen[c.Name] = true
+		n, err := c.node()
+		if err != nil {
+			return nil, err
+		}
+		root[i] = field{Node: n, name: c.Name}
+	}
+	codec, err := o.Codec.codec()
+	if err != nil {
+		return nil, err
+	}
+	if o.RowGroupRows <= 0 {
+		o.RowGroupRows = DefaultRowGroupRows
+	}
+	cfg, err := parquetgo.NewWriterConfig(
+		parquetgo.NewSchema("schema", root),
+		parquetgo.Compression(codec),
+		parquetgo.MaxRowsPerRowGroup(o.RowGroupRows),
+		parquetgo.CreatedBy("syncloop", "", ""),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("parquet: %w", err)
+	}
+	return &Writer{
+		pw:   parquetgo.NewWriter(w, cfg),
+		cols: cols,
+		rows: []parquetgo.Row{make(parquetgo.Row, len(cols))},
+	}, nil
+}
+
+// Write appends one row. Values must match the physical type of their
+// column: bool, int32, int64, float32, float64, or []byte/string for byte
+// arrays. nil is only allowed in optional columns.
+func (w *Writer) Write(row []interface{}) error {
+	if w.closed {
+		return errors.New("parquet: write after close")
+	}
+	if len(row) != len(w.cols) {
+		return fmt.Errorf("parquet: row has %d values, want %d", len(row), len(w.cols))
+	}
+	rec := w.rows[0]
+	for i, c := range w.cols {
+		if err := checkValue(c, row[i]); err != nil {
+			return err
+		}
+		def := 0
+		if c.Optional && row[i] != nil {
+			def = 1
+		}
+		rec[i] = value(c, row[i]).Level(0, def, i)
+	}
+	_, err := w.pw.WriteRows(w.rows)
+	return err
+}
+
+func checkValue(c Column, v interface{}) error {
+	if v == nil {
+		if !c.Optional {
+			return fmt.Errorf("parquet: NULL in required column %s", c.Name)
+		}
+		return nil
+	}
+	ok := false
+	switch c.Type {
+	case Boolean:
+		_, ok = v.(bool)
+	case Int32:
+		_, ok = v.(int32)
+	case Int64:
+		_, ok = v.(int64)
+	case Float:
+		_, ok = v.(float32)
+	case Double:
+		_, ok = v.(float64)
+	case ByteArray:
+		switch v.(type) {
+		case []byte, string:
+			ok = true
+		}
+	case FixedLenByteArray:
+		b, isBytes := v.([]byte)
+		ok = isBytes && len(b) == c.Length
+	}
+	if !ok {
+		return fmt.Errorf("parquet: %T is not a valid value for column %s", v, c.Name)
+	}
+	return nil
+}
+
+// value wraps a value checkValue accepted.
+func value(c Column, v interface{}) parquetgo.Value {
+	switch x := v.(type) {
+	case bool:
+		return parquetgo.BooleanValue(x)
+	case int32:
+		return parquetgo.Int32Value(x)
+	case int64:
+		return parquetgo.Int64Value(x)
+	case float32:
+		return parquetgo.FloatValue(x)
+	case float64:
+		return parquetgo.DoubleValue(x)
+	case string:
+		return parquetgo.ByteArrayValue([]byte(x))
+	case []byte:
+		if c.Type == FixedLenByteArray {
+			return parquetgo.FixedLenByteArrayValue(x)
+		}
+		return parquetgo.ByteArrayValue(x)
+	}
+	return parquetgo.Value{}
+}
+
+// Flush ends the current row group. It is a no-op when no rows are buffered.
+func (w *Writer) Flush() error {
+	return w.pw.Flush()
+}
+
+func (w *Writer) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	return w.pw.Close()
+}
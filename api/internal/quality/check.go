@@ -0,0 +1,203 @@
+// Package quality evaluates per-job data assertions against the rows a run
+// just loaded.
+package quality
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/Zubimendi/sync-loop/api/internal/model"
+)
+
+const (
+	NotNull        = "not_null"
+	Unique         = "unique"
+	AcceptedValues = "accepted_values"
+	RowCountDelta  = "row_count_delta"
+	Freshness      = "freshness"
+	CustomSQL      = "custom_sql"
+)
+
+// Input is everything an assertion may look at.
+type Input struct {
+	Table    string
+	Rows     []map[string]interface{}
+	RowCount int64
+	// PreviousRowCount is the row count of the last successful run, if any.
+	PreviousRowCount *int64
+	// Query returns how many rows a SQL statement yields on the source.
+	Query func(ctx context.Context, sql string) (int64, error)
+	Now   time.Time
+}
+
+// Validate rejects assertions that could never be evaluated.
+func Validate(a *model.Assertion) error {
+	if a.Severity == "" {
+		a.Severity = model.AssertError
+	}
+	if a.Severity != model.AssertWarn && a.Severity != model.AssertError {
+		return errors.New("severity must be warn or error")
+	}
+	col := a.Column != nil && *a.Column != ""
+	switch a.Kind {
+	case NotNull, Unique:
+		if !col {
+			return fmt.Errorf("%s needs a column", a.Kind)
+		}
+	case AcceptedValues:
+		if !col {
+			return fmt.Errorf("%s needs a column", a.Kind)
+		}
+		if _, ok := a.Params["values"].([]interface{}); !ok {
+			return errors.New("accepted_values needs params.values")
+		}
+	case RowCountDelta:
+		if _, ok := a.Params["pct"].(float64); !ok {
+			return errors.New("row_count_delta needs params.pct")
+		}
+	case Freshness:
+		if !col {
+			return fmt.Errorf("%s needs a column", a.Kind)
+		}
+		s, _ := a.Params["max_age"].(string)
+		if _, err := time.ParseDuration(s); err != nil {
+			return fmt.Errorf("freshness needs params.max_age: %w", err)
+		}
+	case CustomSQL:
+		if s, _ := a.Params["sql"].(string); strings.TrimSpace(s) == "" {
+			return errors.New("custom_sql needs params.sql")
+		}
+	default:
+		return fmt.Errorf("unknown assertion kind %q", a.Kind)
+	}
+	return nil
+}
+
+// Evaluate runs one assertion. Failures to evaluate (bad SQL, unparsable
+// timestamps) count as a failed assertion rather than an error.
+func Evaluate(ctx context.Context, a model.Assertion, in Input) model.AssertionResult {
+	res := model.AssertionResult{AssertionID: a.ID, Severity: a.Severity, Observed: model.AssertionParams{}}
+	col := ""
+	if a.Column != nil {
+		col = *a.Column
+	}
+	pass := func(msg string) model.AssertionResult {
+		res.Passed, res.Message = true, msg
+		return res
+	}
+	fail := func(format string, args ...interface{}) model.AssertionResult {
+		res.Passed, res.Message = false, fmt.Sprintf(format, args...)
+		return res
+	}
+
+	switch a.Kind {
+	case NotNull:
+		var nulls int64
+		for _, r := range in.Rows {
+			if r[col] == nil {
+				nulls++
+			}
+		}
+		res.Observed["nulls"] = nulls
+		if nulls > 0 {
+			return fail("%d rows have NULL %s", nulls, col)
+		}
+		return pass(fmt.Sprintf("%s has no NULLs", col))
+
+	case Unique:
+		seen := make(map[string]bool, len(in.Rows))
+		var dups int64
+		for _, r := range in.Rows {
+			v, ok := r[col].(string)
+			if !ok {
+				continue
+			}
+			if seen[v] {
+				dups++
+			}
+			seen[v] = true
+		}
+		res.Observed["duplicates"] = dups
+		if dups > 0 {
+			return fail("%d duplicate values in %s", dups, col)
+		}
+		return pass(fmt.Sprintf("%s is unique", col))
+
+	case AcceptedValues:
+		accepted := map[string]bool{}
+		vals, _ := a.Params["values"].([]interface{})
+		for _, v := range vals {
+			accepted[fmt.Sprint(v)] = true
+		}
+		bad := map[string]int64{}
+		for _, r := range in.Rows {
+			v, ok := r[col].(string)
+			if ok && !accepted[v] {
+				bad[v]++
+			}
+		}
+		res.Observed["unexpected"] = bad
+		if len(bad) > 0 {
+			return fail("%s has %d unexpected values", col, len(bad))
+		}
+		return pass(fmt.Sprintf("%s only holds accepted values", col))
+
+	case RowCountDelta:
+		pct, _ := a.Params["pct"].(float64)
+		res.Observed["rows"] = in.RowCount
+		if in.PreviousRowCount == nil || *in.PreviousRowCount == 0 {
+			return pass("no previous run to compare against")
+		}
+		prev := *in.PreviousRowCount
+		delta := 100 * math.Abs(float64(in.RowCount-prev)) / float64(prev)
+		res.Observed["previous_rows"] = prev
+		res.Observed["delta_pct"] = delta
+		if delta > pct {
+			return fail("row count %d is %.1f%% off the previous %d (limit ±%.1f%%)", in.RowCount, delta, prev, pct)
+		}
+		return pass(fmt.Sprintf("row count within ±%.1f%% of previous run", pct))
+
+	case Freshness:
+		maxAge, _ := time.ParseDuration(fmt.Sprint(a.Params["max_age"]))
+		var newest time.Time
+		for _, r := range in.Rows {
+			s, ok := r[col].(string)
+			if !ok {
+				continue
+			}
+			if t, err := time.Parse(time.RFC3339Nano, s); err == nil && t.After(newest) {
+				newest = t
+			}
+		}
+		if newest.IsZero() {
+			return fail("no timestamps found in %s", col)
+		}
+		age := in.Now.Sub(newest)
+		res.Observed["newest"] = newest
+		res.Observed["age"] = age.String()
+		if age > maxAge {
+			return fail("newest %s is %s old (limit %s)", col, age.Round(time.Second), maxAge)
+		}
+		return pass(fmt.Sprintf("%s is fresh", col))
+
+	case CustomSQL:
+		if in.Query == nil {
+			return fail("custom SQL needs a job reading from a Postgres connector")
+		}
+		q := strings.ReplaceAll(fmt.Sprint(a.Params["sql"]), "{table}", in.Table)
+		n, err := in.Query(ctx, q)
+		if err != nil {
+			return fail("custom SQL failed: %v", err)
+		}
+		res.Observed["rows"] = n
+		if n > 0 {
+			return fail("custom SQL returned %d rows", n)
+		}
+		return pass("custom SQL returned no rows")
+	}
+	return fail("unknown assertion kind %q", a.Kind)
+}
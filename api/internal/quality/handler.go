@@ -0,0 +1,105 @@
+package quality
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/Zubimendi/sync-loop/api/internal/middleware"
+	"github.com/Zubimendi/sync-loop/api/internal/model"
+	"github.com/Zubimendi/sync-loop/api/internal/run"
+	"github.com/go-chi/chi/v5"
+)
+
+type Handler struct {
+	repo *Repo
+	runs *run.Repo
+}
+
+func NewHandler(repo *Repo, runs *run.Repo) *Handler { return &Handler{repo: repo, runs: runs} }
+
+// GET /api/v1/jobs/{id}/assertions
+func (h *Handler) List(w http.ResponseWriter, r *http.Request) {
+	wid := r.Context().Value(middleware.CtxWorkspaceID).(string)
+	aa, err := h.repo.ListByJob(r.Context(), chi.URLParam(r, "id"), wid)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"assertions": aa})
+}
+
+type createReq struct {
+	Name     string                 `json:"name"`
+	Kind     string                 `json:"kind"`
+	Column   string                 `json:"column"`
+	Params   map[string]interface{} `json:"params"`
+	Severity string                 `json:"severity"`
+}
+
+// POST /api/v1/jobs/{id}/assertions
+func (h *Handler) Create(w http.ResponseWriter, r *http.Request) {
+	var req createReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+	wid := r.Context().Value(middleware.CtxWorkspaceID).(string)
+	job, err := h.runs.GetJob(r.Context(), chi.URLParam(r, "id"), wid)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if job == nil {
+		http.Error(w, "job not found", http.StatusNotFound)
+		return
+	}
+	a := &model.Assertion{
+		JobID:    job.ID,
+		Name:     req.Name,
+		Kind:     req.Kind,
+		Params:   req.Params,
+		Severity: req.Severity,
+		Enabled:  true,
+	}
+	if req.Column != "" {
+		a.Column = &req.Column
+	}
+	if a.Name == "" {
+		a.Name = a.Kind
+	}
+	if err := Validate(a); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := h.repo.Create(r.Context(), a); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(a)
+}
+
+// DELETE /api/v1/assertions/{id}
+func (h *Handler) Delete(w http.ResponseWriter, r *http.Request) {
+	wid := r.Context().Value(middleware.CtxWorkspaceID).(string)
+	ok, err := h.repo.Delete(r.Context(), chi.URLParam(r, "id"), wid)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		http.Error(w, "assertion not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GET /api/v1/runs/{id}/assertions – results recorded for one run
+func (h *Handler) Results(w http.ResponseWriter, r *http.Request) {
+	wid := r.Context().Value(middleware.CtxWorkspaceID).(string)
+	rr, err := h.repo.ResultsByRun(r.Context(), chi.URLParam(r, "id"), wid)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"results": rr})
+}
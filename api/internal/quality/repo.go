@@ -0,0 +1,71 @@
+package quality
+
+import (
+	"context"
+
+	"github.com/Zubimendi/sync-loop/api/internal/model"
+	"github.com/jmoiron/sqlx"
+)
+
+type Repo struct {
+	db *sqlx.DB
+}
+
+func NewRepo(db *sqlx.DB) *Repo { return &Repo{db: db} }
+
+func (r *Repo) Create(ctx context.Context, a *model.Assertion) error {
+	return r.db.QueryRowxContext(ctx, `
+		INSERT INTO job_assertion (job_id, name, kind, column_name, params_json, severity, enabled)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at`,
+		a.JobID, a.Name, a.Kind, a.Column, a.Params, a.Severity, a.Enabled).Scan(&a.ID, &a.CreatedAt)
+}
+
+func (r *Repo) ListByJob(ctx context.Context, jobID, workspaceID string) ([]model.Assertion, error) {
+	aa := make([]model.Assertion, 0)
+	err := r.db.SelectContext(ctx, &aa, `
+		SELECT a.* FROM job_assertion a
+		JOIN sync_job j ON j.id = a.job_id
+		WHERE a.job_id = $1 AND j.workspace_id = $2
+		ORDER BY a.created_at`, jobID, workspaceID)
+	return aa, err
+}
+
+// Enabled returns the assertions a run must evaluate; used by the worker,
+// which has no workspace to scope by.
+func (r *Repo) Enabled(ctx context.Context, jobID string) ([]model.Assertion, error) {
+	aa := make([]model.Assertion, 0)
+	err := r.db.SelectContext(ctx, &aa, `
+		SELECT * FROM job_assertion WHERE job_id = $1 AND enabled ORDER BY created_at`, jobID)
+	return aa, err
+}
+
+func (r *Repo) Delete(ctx context.Context, id, workspaceID string) (bool, error) {
+	res, err := r.db.ExecContext(ctx, `
+		DELETE FROM job_assertion a USING sync_job j
+		WHERE a.id = $1 AND j.id = a.job_id AND j.workspace_id = $2`, id, workspaceID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (r *Repo) SaveResult(ctx context.Context, res *model.AssertionResult) error {
+	return r.db.QueryRowxContext(ctx, `
+		INSERT INTO assertion_result (run_id, assertion_id, passed, severity, message, observed_json)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at`,
+		res.RunID, res.AssertionID, res.Passed, res.Severity, res.Message, res.Observed).Scan(&res.ID, &res.CreatedAt)
+}
+
+func (r *Repo) ResultsByRun(ctx context.Context, runID, workspaceID string) ([]model.AssertionResult, error) {
+	rr := make([]model.AssertionResult, 0)
+	err := r.db.SelectContext(ctx, &rr, `
+		SELECT ar.* FROM assertion_result ar
+		JOIN sync_run sr ON sr.id = ar.run_id
+		JOIN sync_job j ON j.id = sr.job_id
+		WHERE ar.run_id = $1 AND j.workspace_id = $2
+		ORDER BY ar.created_at`, runID, workspaceID)
+	return rr, err
+}
@@ -0,0 +1,49 @@
+// Package retry holds the waits shared by the HTTP clients that retry rate
+// limited and failed requests.
+package retry
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaxWait caps how long a Retry-After header can hold a request back.
+const MaxWait = 5 * time.Minute
+
+// Backoff doubles from a second with each attempt, up to max.
+func Backoff(attempt int, max time.Duration) time.Duration {
+	return min(time.Second<<min(attempt, 16), max)
+}
+
+// After reads a Retry-After header, in seconds or as an HTTP date, capped
+// at MaxWait. An empty or unreadable header gives fallback.
+func After(h string, fallback time.Duration) time.Duration {
+	h = strings.TrimSpace(h)
+	if h == "" {
+		return fallback
+	}
+	var d time.Duration
+	if n, err := strconv.Atoi(h); err == nil {
+		d = time.Duration(min(n, int(MaxWait/time.Second))) * time.Second
+	} else if t, err := http.ParseTime(h); err == nil {
+		d = time.Until(t)
+	} else {
+		return fallback
+	}
+	return max(0, min(d, MaxWait))
+}
+
+// Sleep waits for d or until ctx is done.
+func Sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,143 @@
+package run
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/Zubimendi/sync-loop/api/internal/anomaly"
+	"github.com/Zubimendi/sync-loop/api/internal/middleware"
+	"github.com/Zubimendi/sync-loop/api/internal/model"
+	"github.com/Zubimendi/sync-loop/api/internal/output"
+	"github.com/go-chi/chi/v5"
+)
+
+type Handler struct {
+	repo *Repo
+}
+
+func NewHandler(repo *Repo) *Handler { return &Handler{repo: repo} }
+
+// GET /api/v1/jobs/{id}/runs?limit=50 – run history, anomaly flags included
+func (h *Handler) List(w http.ResponseWriter, r *http.Request) {
+	wid := r.Context().Value(middleware.CtxWorkspaceID).(string)
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit <= 0 || limit > 500 {
+		limit = 50
+	}
+	rr, err := h.repo.ListRuns(r.Context(), chi.URLParam(r, "id"), wid, limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"runs": rr})
+}
+
+// PUT /api/v1/jobs/{id}/anomaly – choose the baseline and threshold
+func (h *Handler) SetAnomaly(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Mode      string   `json:"mode"`
+		Threshold *float64 `json:"threshold"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+	switch req.Mode {
+	case anomaly.ModeOff, anomaly.ModeRolling, anomaly.ModeWeekday:
+	default:
+		http.Error(w, "mode must be off, rolling or weekday", http.StatusBadRequest)
+		return
+	}
+	if req.Threshold != nil && *req.Threshold <= 0 {
+		http.Error(w, "threshold must be positive", http.StatusBadRequest)
+		return
+	}
+	wid := r.Context().Value(middleware.CtxWorkspaceID).(string)
+	ok, err := h.repo.SetAnomalySettings(r.Context(), chi.URLParam(r, "id"), wid, req.Mode, req.Threshold)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		http.Error(w, "job not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// PUT /api/v1/jobs/{id}/error-budget – rows a run may dead-letter before it
+// fails, as a count and/or a percentage of rows read
+func (h *Handler) SetErrorBudget(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		MaxRows int64   `json:"max_rows"`
+		MaxPct  float64 `json:"max_pct"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+	if req.MaxRows < 0 || req.MaxPct < 0 || req.MaxPct > 100 {
+		http.Error(w, "max_rows must be >= 0 and max_pct between 0 and 100", http.StatusBadRequest)
+		return
+	}
+	wid := r.Context().Value(middleware.CtxWorkspaceID).(string)
+	ok, err := h.repo.SetErrorBudget(r.Context(), chi.URLParam(r, "id"), wid, req.MaxRows, req.MaxPct)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		http.Error(w, "job not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// PUT /api/v1/jobs/{id}/output – object format written by the job's loads,
+// e.g. {"format":"avro","compression":"zstd","max_file_rows":1000000}
+func (h *Handler) SetOutput(w http.ResponseWriter, r *http.Request) {
+	var req model.OutputOptions
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+	if _, err := output.New(req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	wid := r.Context().Value(middleware.CtxWorkspaceID).(string)
+	ok, err := h.repo.SetOutput(r.Context(), chi.URLParam(r, "id"), wid, req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		http.Error(w, "job not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// PUT /api/v1/jobs/{id}/destination – load into a destination instead of
+// the bucket, e.g. {"destination_id":"..."}; null goes back to the bucket
+func (h *Handler) SetDestination(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		DestinationID *string `json:"destination_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+	wid := r.Context().Value(middleware.CtxWorkspaceID).(string)
+	ok, err := h.repo.SetDestination(r.Context(), chi.URLParam(r, "id"), wid, req.DestinationID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		http.Error(w, "job or destination not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,229 @@
+package run
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/Zubimendi/sync-loop/api/internal/model"
+	"github.com/jmoiron/sqlx"
+)
+
+type Repo struct {
+	db *sqlx.DB
+}
+
+func NewRepo(db *sqlx.DB) *Repo { return &Repo{db: db} }
+
+// EnsureJob returns the sync_job for a connector/table pair, creating it on
+// the first run. Jobs started without a connector share a NULL connector_id.
+func (r *Repo) EnsureJob(ctx context.Context, workspaceID, connectorID, table string) (string, error) {
+	var id string
+	err := r.db.GetContext(ctx, &id, `
+		SELECT id FROM sync_job
+		WHERE connector_id IS NOT DISTINCT FROM NULLIF($1,'')::uuid
+		  AND workspace_id IS NOT DISTINCT FROM NULLIF($2,'')::uuid
+		  AND table_name = $3
+		LIMIT 1`, connectorID, workspaceID, table)
+	if err == nil {
+		return id, nil
+	}
+	if err != sql.ErrNoRows {
+		return "", err
+	}
+	err = r.db.GetContext(ctx, &id, `
+		INSERT INTO sync_job (connector_id, workspace_id, table_name)
+		VALUES (NULLIF($1,'')::uuid, NULLIF($2,'')::uuid, $3)
+		RETURNING id`, connectorID, workspaceID, table)
+	return id, err
+}
+
+func (r *Repo) GetJob(ctx context.Context, id, workspaceID string) (*model.SyncJob, error) {
+	var j model.SyncJob
+	err := r.db.GetContext(ctx, &j, `
+		SELECT * FROM sync_job WHERE id = $1 AND workspace_id = $2`, id, workspaceID)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return &j, err
+}
+
+func (r *Repo) StartRun(ctx context.Context, jobID, workflowID string) (*model.SyncRun, error) {
+	var run model.SyncRun
+	err := r.db.QueryRowxContext(ctx, `
+		INSERT INTO sync_run (job_id, workflow_id, started_at, status)
+		VALUES ($1, NULLIF($2,''), now(), 'running')
+		RETURNING *`,
+		jobID, workflowID).StructScan(&run)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := r.db.ExecContext(ctx, `UPDATE sync_job SET last_run_at = $2 WHERE id = $1`, jobID, run.StartedAt); err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
+
+// Outcome is what a finished run reports back.
+type Outcome struct {
+	Status       string
+	RowsRead     int64
+	RowsWritten  int64
+	Checksum     string
+	DestChecksum string
+	Error        string
+	ErrorRows    int64
+}
+
+func (r *Repo) FinishRun(ctx context.Context, runID string, o Outcome) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE sync_run
+		SET finished_at = now(), status = $2, rows_read = $3, rows_written = $4,
+		    checksum = NULLIF($5,''), dest_checksum = NULLIF($6,''), error = NULLIF($7,''), error_rows = $8
+		WHERE id = $1`, runID, o.Status, o.RowsRead, o.RowsWritten, o.Checksum, o.DestChecksum, o.Error, o.ErrorRows)
+	return err
+}
+
+// PreviousRowsWritten returns rows_written of the latest successful (or
+// partially successful) run of a job other than runID, or nil when there is
+// none.
+func (r *Repo) PreviousRowsWritten(ctx context.Context, jobID, runID string) (*int64, error) {
+	var n int64
+	err := r.db.GetContext(ctx, &n, `
+		SELECT coalesce(rows_written, 0) FROM sync_run
+		WHERE job_id = $1 AND id <> $2 AND status IN ('success','partial_success')
+		ORDER BY started_at DESC
+		LIMIT 1`, jobID, runID)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &n, nil
+}
+
+// History returns the row counts of finished, non-failed runs of a job that
+// started before runID, newest first.
+func (r *Repo) History(ctx context.Context, jobID, runID string, limit int) ([]model.SyncRun, error) {
+	rr := make([]model.SyncRun, 0)
+	err := r.db.SelectContext(ctx, &rr, `
+		SELECT * FROM sync_run
+		WHERE job_id = $1 AND id <> $2
+		  AND status IN ('success','partial_success','unverified') AND rows_read IS NOT NULL
+		  AND started_at < (SELECT started_at FROM sync_run WHERE id = $2)
+		ORDER BY started_at DESC
+		LIMIT $3`, jobID, runID, limit)
+	return rr, err
+}
+
+func (r *Repo) MarkAnomaly(ctx context.Context, runID string, anomalous bool, score, expected float64) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE sync_run SET anomaly = $2, anomaly_score = $3, expected_rows = $4
+		WHERE id = $1`, runID, anomalous, score, expected)
+	return err
+}
+
+func (r *Repo) ListRuns(ctx context.Context, jobID, workspaceID string, limit int) ([]model.SyncRun, error) {
+	rr := make([]model.SyncRun, 0)
+	err := r.db.SelectContext(ctx, &rr, `
+		SELECT sr.* FROM sync_run sr
+		JOIN sync_job j ON j.id = sr.job_id
+		WHERE sr.job_id = $1 AND j.workspace_id = $2
+		ORDER BY sr.started_at DESC
+		LIMIT $3`, jobID, workspaceID, limit)
+	return rr, err
+}
+
+// GetJobByID loads a job without workspace scoping, for the worker.
+func (r *Repo) GetJobByID(ctx context.Context, id string) (*model.SyncJob, error) {
+	var j model.SyncJob
+	if err := r.db.GetContext(ctx, &j, `SELECT * FROM sync_job WHERE id = $1`, id); err != nil {
+		return nil, err
+	}
+	return &j, nil
+}
+
+func (r *Repo) SetAnomalySettings(ctx context.Context, jobID, workspaceID, mode string, threshold *float64) (bool, error) {
+	res, err := r.db.ExecContext(ctx, `
+		UPDATE sync_job SET anomaly_mode = $3, anomaly_threshold = $4
+		WHERE id = $1 AND workspace_id = $2`, jobID, workspaceID, mode, threshold)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (r *Repo) GetRun(ctx context.Context, id, workspaceID string) (*model.SyncRun, error) {
+	var run model.SyncRun
+	err := r.db.GetContext(ctx, &run, `
+		SELECT sr.* FROM sync_run sr
+		JOIN sync_job j ON j.id = sr.job_id
+		WHERE sr.id = $1 AND j.workspace_id = $2`, id, workspaceID)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return &run, err
+}
+
+// GetRunByWorkflow returns the latest run a workflow recorded in a
+// workspace, nil when it recorded none.
+func (r *Repo) GetRunByWorkflow(ctx context.Context, workflowID, workspaceID string) (*model.SyncRun, error) {
+	var run model.SyncRun
+	err := r.db.GetContext(ctx, &run, `
+		SELECT sr.* FROM sync_run sr
+		JOIN sync_job j ON j.id = sr.job_id
+		WHERE sr.workflow_id = $1 AND j.workspace_id = $2
+		ORDER BY sr.started_at DESC
+		LIMIT 1`, workflowID, workspaceID)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return &run, err
+}
+
+func (r *Repo) SetErrorBudget(ctx context.Context, jobID, workspaceID string, maxRows int64, maxPct float64) (bool, error) {
+	res, err := r.db.ExecContext(ctx, `
+		UPDATE sync_job SET max_error_rows = $3, max_error_pct = $4
+		WHERE id = $1 AND workspace_id = $2`, jobID, workspaceID, maxRows, maxPct)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (r *Repo) SetOutput(ctx context.Context, jobID, workspaceID string, o model.OutputOptions) (bool, error) {
+	res, err := r.db.ExecContext(ctx, `
+		UPDATE sync_job SET output_json = $3
+		WHERE id = $1 AND workspace_id = $2`, jobID, workspaceID, o)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// SetDestination points a job's loads at a destination of its workspace, or
+// back at the bucket when destinationID is nil.
+func (r *Repo) SetDestination(ctx context.Context, jobID, workspaceID string, destinationID *string) (bool, error) {
+	res, err := r.db.ExecContext(ctx, `
+		UPDATE sync_job SET destination_id = $3
+		WHERE id = $1 AND workspace_id = $2
+		  AND ($3::uuid IS NULL OR EXISTS (
+		      SELECT 1 FROM destination WHERE id = $3 AND workspace_id = $2))`, jobID, workspaceID, destinationID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// SetLastSync moves a job's incremental cursor forward; it never goes back.
+func (r *Repo) SetLastSync(ctx context.Context, jobID string, t time.Time) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE sync_job SET last_sync_at = greatest(last_sync_at, $2)
+		WHERE id = $1`, jobID, t)
+	return err
+}
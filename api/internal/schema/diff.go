@@ -0,0 +1,64 @@
+package schema
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+
+	"github.com/Zubimendi/sync-loop/api/internal/model"
+)
+
+const (
+	ColumnAdded   = "column_added"
+	ColumnRemoved = "column_removed"
+	TypeChanged   = "type_changed"
+	// NullabilityChanged is a column switching between NULL and NOT NULL;
+	// the change's Nullable is its new setting.
+	NullabilityChanged = "nullability_changed"
+)
+
+// Hash fingerprints a column set. Columns are sorted by name first so a
+// reordered table keeps the same hash.
+func Hash(cols []model.Column) string {
+	sorted := append([]model.Column(nil), cols...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+	h := sha256.New()
+	for _, c := range sorted {
+		fmt.Fprintf(h, "%s\x1f%s\x1f%t\n", c.Name, c.Type, c.Nullable)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Diff lists what changed between two snapshots of the same table, which
+// is everything Hash covers but column order. A renamed column shows up as
+// one removal plus one addition.
+func Diff(prev, cur []model.Column) []model.SchemaChange {
+	old := make(map[string]model.Column, len(prev))
+	for _, c := range prev {
+		old[c.Name] = c
+	}
+	var changes []model.SchemaChange
+	seen := make(map[string]bool, len(cur))
+	for _, c := range cur {
+		seen[c.Name] = true
+		p, ok := old[c.Name]
+		if !ok {
+			changes = append(changes, model.SchemaChange{Kind: ColumnAdded, Column: c.Name, NewType: c.Type})
+			continue
+		}
+		if p.Type != c.Type {
+			changes = append(changes, model.SchemaChange{Kind: TypeChanged, Column: c.Name, OldType: p.Type, NewType: c.Type})
+		}
+		if p.Nullable != c.Nullable {
+			nullable := c.Nullable
+			changes = append(changes, model.SchemaChange{Kind: NullabilityChanged, Column: c.Name, NewType: c.Type, Nullable: &nullable})
+		}
+	}
+	for _, c := range prev {
+		if !seen[c.Name] {
+			changes = append(changes, model.SchemaChange{Kind: ColumnRemoved, Column: c.Name, OldType: c.Type})
+		}
+	}
+	return changes
+}
@@ -0,0 +1,44 @@
+package schema
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/Zubimendi/sync-loop/api/internal/middleware"
+	"github.com/Zubimendi/sync-loop/api/internal/model"
+	"github.com/go-chi/chi/v5"
+)
+
+type Handler struct {
+	repo *Repo
+}
+
+func NewHandler(repo *Repo) *Handler { return &Handler{repo: repo} }
+
+// GET /api/v1/jobs/{id}/schema – schema timeline of a sync job.
+// Only snapshots whose hash differs from the previous one are returned
+// unless ?all=true is passed.
+func (h *Handler) Timeline(w http.ResponseWriter, r *http.Request) {
+	wid := r.Context().Value(middleware.CtxWorkspaceID).(string)
+	ss, err := h.repo.ListByJob(r.Context(), chi.URLParam(r, "id"), wid)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if r.URL.Query().Get("all") != "true" {
+		ss = collapse(ss)
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"snapshots": ss})
+}
+
+// collapse drops consecutive snapshots that repeat the previous hash.
+func collapse(ss []model.SchemaSnapshot) []model.SchemaSnapshot {
+	out := make([]model.SchemaSnapshot, 0, len(ss))
+	for i, s := range ss {
+		if i > 0 && s.Hash == ss[i-1].Hash {
+			continue
+		}
+		out = append(out, s)
+	}
+	return out
+}
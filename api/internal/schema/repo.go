@@ -0,0 +1,47 @@
+package schema
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/Zubimendi/sync-loop/api/internal/model"
+	"github.com/jmoiron/sqlx"
+)
+
+type Repo struct {
+	db *sqlx.DB
+}
+
+func NewRepo(db *sqlx.DB) *Repo { return &Repo{db: db} }
+
+func (r *Repo) Latest(ctx context.Context, jobID string) (*model.SchemaSnapshot, error) {
+	var s model.SchemaSnapshot
+	err := r.db.GetContext(ctx, &s, `
+		SELECT * FROM schema_snapshot
+		WHERE job_id = $1
+		ORDER BY created_at DESC
+		LIMIT 1`, jobID)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return &s, err
+}
+
+func (r *Repo) Create(ctx context.Context, s *model.SchemaSnapshot) error {
+	return r.db.QueryRowxContext(ctx, `
+		INSERT INTO schema_snapshot (job_id, run_id, schema_hash, columns_json, changes_json)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at`,
+		s.JobID, s.RunID, s.Hash, s.Columns, s.Changes).Scan(&s.ID, &s.CreatedAt)
+}
+
+// ListByJob returns the schema timeline of a job, oldest first.
+func (r *Repo) ListByJob(ctx context.Context, jobID, workspaceID string) ([]model.SchemaSnapshot, error) {
+	ss := make([]model.SchemaSnapshot, 0)
+	err := r.db.SelectContext(ctx, &ss, `
+		SELECT s.* FROM schema_snapshot s
+		JOIN sync_job j ON j.id = s.job_id
+		WHERE s.job_id = $1 AND j.workspace_id = $2
+		ORDER BY s.created_at`, jobID, workspaceID)
+	return ss, err
+}
@@ -0,0 +1,87 @@
+// Package sftpconn opens SFTP sessions for the sftp source and destination.
+// The SSH connection is made as tunnel makes one: through the egress
+// policy, and only to a host whose key is pinned.
+package sftpconn
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+
+	"github.com/Zubimendi/sync-loop/api/internal/egress"
+	"github.com/Zubimendi/sync-loop/api/internal/tunnel"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// Conn is an SFTP session confined to a root directory. Keys are slash
+// separated paths relative to Root.
+type Conn struct {
+	*sftp.Client
+	ssh  *ssh.Client
+	Root string
+}
+
+// Open connects with the SSH keys of tunnel.Parse, plus root: the
+// directory keys are relative to, itself relative to the login directory
+// unless absolute.
+func Open(ctx context.Context, cfg map[string]interface{}) (*Conn, error) {
+	c, err := tunnel.Parse(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("sftp: %w", err)
+	}
+	sc, err := tunnel.Dial(ctx, c, egress.FromContext(ctx).DialContext)
+	if err != nil {
+		return nil, fmt.Errorf("sftp: %w", err)
+	}
+	client, err := sftp.NewClient(sc)
+	if err != nil {
+		sc.Close()
+		return nil, fmt.Errorf("sftp: %w", err)
+	}
+	conn := &Conn{Client: client, ssh: sc}
+	root, _ := cfg["root"].(string)
+	if !path.IsAbs(root) {
+		wd, err := client.Getwd()
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("sftp: working directory: %w", err)
+		}
+		root = path.Join(wd, root)
+	}
+	conn.Root = path.Clean(root)
+	return conn, nil
+}
+
+// Path resolves a key under Root. Keys cannot climb out of it.
+func (c *Conn) Path(key string) string {
+	return path.Join(c.Root, path.Clean("/"+key))
+}
+
+// Key is the inverse of Path.
+func (c *Conn) Key(p string) string {
+	if c.Root == "/" {
+		return p[1:]
+	}
+	return p[len(c.Root)+1:]
+}
+
+// Replace renames from to to, replacing to if it exists. Servers without
+// the posix-rename extension get a remove and a rename, which leaves a
+// moment where to is missing but never one where it is half written.
+func (c *Conn) Replace(from, to string) error {
+	if _, ok := c.HasExtension("posix-rename@openssh.com"); ok {
+		return c.PosixRename(from, to)
+	}
+	if err := c.Remove(to); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return c.Rename(from, to)
+}
+
+func (c *Conn) Close() error {
+	c.Client.Close()
+	return c.ssh.Close()
+}
@@ -0,0 +1,51 @@
+package source
+
+import (
+	"context"
+	"io"
+	"net"
+	"time"
+
+	"github.com/Zubimendi/sync-loop/api/internal/egress"
+	"github.com/Zubimendi/sync-loop/api/internal/tunnel"
+)
+
+// netDialer is how a database source reaches its host.
+type netDialer func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// dbDialer returns the dialer of a database connector: through the SSH
+// tunnel of cfg when it has one, otherwise straight out under the egress
+// policy of ctx, which also governs the bastion. The closer, when not nil,
+// shuts the tunnel.
+func dbDialer(ctx context.Context, cfg map[string]interface{}) (netDialer, io.Closer, error) {
+	policy := egress.FromContext(ctx)
+	tc, ok, err := tunnel.FromConfig(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !ok {
+		return policy.DialContext, nil, nil
+	}
+	t, err := tunnel.Open(ctx, tc, policy.DialContext)
+	if err != nil {
+		return nil, nil, err
+	}
+	return t.DialContext, t, nil
+}
+
+// pqDialer adapts a netDialer to lib/pq.
+type pqDialer netDialer
+
+func (d pqDialer) Dial(network, addr string) (net.Conn, error) {
+	return d(context.Background(), network, addr)
+}
+
+func (d pqDialer) DialTimeout(network, addr string, timeout time.Duration) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return d(ctx, network, addr)
+}
+
+func (d pqDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	return d(ctx, network, addr)
+}
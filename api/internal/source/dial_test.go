@@ -0,0 +1,59 @@
+package source
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/Zubimendi/sync-loop/api/internal/egress"
+	"github.com/Zubimendi/sync-loop/api/internal/sshtest"
+)
+
+func TestDBDialerTunnel(t *testing.T) {
+	// The database only answers on loopback, behind the bastion.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		c, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		c.Write([]byte("hello from db\n"))
+	}()
+	srv := sshtest.NewServer(t, "ops", "pw")
+	cfg := map[string]interface{}{"host": "ignored", "ssh_tunnel": srv.Config()}
+
+	dial, closer, err := dbDialer(loopback(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closer.Close()
+	c, err := pqDialer(dial).Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if line, err := bufio.NewReader(c).ReadString('\n'); line != "hello from db\n" {
+		t.Errorf("read %q, %v", line, err)
+	}
+}
+
+// TestDBDialerBastionEgress checks the egress policy governs the bastion:
+// a tunnel does not get around it.
+func TestDBDialerBastionEgress(t *testing.T) {
+	srv := sshtest.NewServer(t, "ops", "pw")
+	_, _, err := dbDialer(context.Background(), map[string]interface{}{"ssh_tunnel": srv.Config()})
+	if !errors.Is(err, egress.ErrBlocked) {
+		t.Errorf("err = %v, want egress.ErrBlocked", err)
+	}
+	_, _, err = dbDialer(context.Background(), map[string]interface{}{"ssh_tunnel": map[string]interface{}{"host": "bastion"}})
+	if err == nil {
+		t.Error("an incomplete ssh_tunnel was accepted")
+	}
+}
@@ -0,0 +1,290 @@
+package source
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Zubimendi/sync-loop/api/internal/model"
+	"github.com/Zubimendi/sync-loop/api/internal/xlsx"
+)
+
+// Object is one file a file-based source can read. ETag and LastModified
+// identify the version that was read, so incremental runs can tell a
+// changed file from one already processed.
+type Object struct {
+	Key          string
+	ETag         string
+	LastModified time.Time
+	Size         int64
+}
+
+// FileSource is implemented by sources that read a set of files. The table
+// of a query is a glob over file keys, relative to the connector's prefix,
+// optionally followed by #Sheet or #Sheet!Range to pick from workbooks.
+type FileSource interface {
+	Source
+	// Objects lists the files a table matches, sorted by key.
+	Objects(ctx context.Context, table string) ([]Object, error)
+	// ReadObjects reads only the given files of a table.
+	ReadObjects(ctx context.Context, table string, objs []Object, fn func(Row) error) error
+}
+
+// Consumer is a FileSource that disposes of files once a run has loaded
+// them, deleting or archiving them as its connector is configured to.
+type Consumer interface {
+	Consume(ctx context.Context, objs []Object) error
+}
+
+// objectStore is where a Files source finds its files.
+type objectStore interface {
+	list(ctx context.Context, prefix string) ([]Object, error)
+	open(ctx context.Context, key string) (io.ReadCloser, error)
+}
+
+// inferSampleFiles bounds how many files schema inference opens.
+const inferSampleFiles = 5
+
+// Files is a FileSource over an objectStore. The schema of a table is
+// inferred from a sample of its files, or taken from the footer of Parquet
+// files, and every row read is coerced to it.
+type Files struct {
+	store   objectStore
+	prefix  string
+	pattern string
+	opts    FileOptions
+	// types overrides the inferred type of columns by name.
+	types   map[string]string
+	schemas map[string][]model.Column
+}
+
+func newFiles(store objectStore, cfg map[string]interface{}) *Files {
+	f := &Files{
+		store:   store,
+		prefix:  strings.Trim(str(cfg, "prefix"), "/"),
+		pattern: str(cfg, "pattern"),
+		opts:    fileOptions(cfg),
+		types:   map[string]string{},
+		schemas: map[string][]model.Column{},
+	}
+	if tt, ok := cfg["types"].(map[string]interface{}); ok {
+		for k, v := range tt {
+			if t, ok := v.(string); ok {
+				f.types[k] = t
+			}
+		}
+	}
+	return f
+}
+
+// glob resolves a table to a pattern over whole keys. An empty table falls
+// back to the connector's pattern, then to every file under the prefix.
+func (f *Files) glob(table string) string {
+	p, _ := f.split(table)
+	if p == "" {
+		p = f.pattern
+	}
+	if p == "" {
+		p = "**"
+	}
+	if f.prefix == "" {
+		return strings.TrimPrefix(p, "/")
+	}
+	return f.prefix + "/" + strings.TrimPrefix(p, "/")
+}
+
+// split cuts the workbook selection off a table, as in
+// reports/*.xlsx#Budget!B3:H200, and returns the options to parse it with.
+func (f *Files) split(table string) (string, FileOptions) {
+	opts := f.opts
+	table, sel, ok := strings.Cut(table, "#")
+	if !ok {
+		return table, opts
+	}
+	opts.Sheet = sel
+	if i := strings.LastIndexByte(sel, '!'); i >= 0 {
+		if _, err := xlsx.ParseRange(sel[i+1:]); err == nil {
+			opts.Sheet, opts.Range = sel[:i], sel[i+1:]
+		}
+	}
+	return table, opts
+}
+
+func (f *Files) Objects(ctx context.Context, table string) ([]Object, error) {
+	pattern := f.glob(table)
+	re, err := compileGlob(pattern)
+	if err != nil {
+		return nil, err
+	}
+	all, err := f.store.list(ctx, globPrefix(pattern))
+	if err != nil {
+		return nil, err
+	}
+	var out []Object
+	for _, o := range all {
+		if strings.HasSuffix(o.Key, "/") || !re.MatchString(o.Key) {
+			continue
+		}
+		// Hidden and bookkeeping files, such as our own _manifests.
+		if base := path.Base(o.Key); strings.HasPrefix(base, "_") || strings.HasPrefix(base, ".") {
+			continue
+		}
+		out = append(out, o)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Key < out[j].Key })
+	return out, nil
+}
+
+func (f *Files) Columns(ctx context.Context, table string) ([]model.Column, error) {
+	if cols, ok := f.schemas[table]; ok {
+		return cols, nil
+	}
+	objs, err := f.Objects(ctx, table)
+	if err != nil {
+		return nil, err
+	}
+	if len(objs) == 0 {
+		return nil, fmt.Errorf("no files match %s", f.glob(table))
+	}
+	if len(objs) > inferSampleFiles {
+		objs = objs[:inferSampleFiles]
+	}
+	in := newInferrer()
+	var typed []model.Column
+	for _, o := range objs {
+		n := 0
+		cols, err := f.parse(ctx, table, o, func(row Row) error {
+			structured := map[string]bool{}
+			for k, v := range row {
+				if _, ok := v.(jsonValue); ok {
+					structured[k] = true
+				}
+			}
+			in.add(row, structured)
+			if n++; n >= inferSampleRows {
+				return errSampled
+			}
+			return nil
+		})
+		if err != nil && err != errSampled {
+			return nil, err
+		}
+		typed = mergeColumns(typed, cols)
+	}
+	inferred := in.columns()
+	for i, c := range typed {
+		ic, ok := inferred[c.Name]
+		if c.Type == "" {
+			c.Type = "text"
+			if ok {
+				c = ic
+			}
+		}
+		c.Nullable = c.Nullable || ic.Nullable
+		if t, ok := f.types[c.Name]; ok {
+			c.Type, c.Precision, c.Scale = t, 0, 0
+		}
+		typed[i] = c
+	}
+	f.schemas[table] = typed
+	return typed, nil
+}
+
+var errSampled = errors.New("sampled")
+
+// mergeColumns appends the columns of b not already in a. A column listed
+// by several files keeps the first type known from a file's own schema, and
+// is nullable if it is missing from any of them.
+func mergeColumns(a, b []model.Column) []model.Column {
+	at := make(map[string]int, len(a))
+	for i, c := range a {
+		at[c.Name] = i
+	}
+	in := make(map[string]bool, len(b))
+	for _, c := range b {
+		in[c.Name] = true
+		i, ok := at[c.Name]
+		if !ok {
+			if len(at) > 0 {
+				c.Nullable = true
+			}
+			at[c.Name] = len(a)
+			a = append(a, c)
+			continue
+		}
+		if a[i].Type == "" {
+			a[i].Type = c.Type
+		}
+		a[i].Nullable = a[i].Nullable || c.Nullable
+	}
+	for i := range a {
+		if !in[a[i].Name] {
+			a[i].Nullable = true
+		}
+	}
+	return a
+}
+
+func (f *Files) parse(ctx context.Context, table string, o Object, fn func(Row) error) ([]model.Column, error) {
+	body, err := f.store.open(ctx, o.Key)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	_, opts := f.split(table)
+	cols, err := opts.parseFile(o.Key, body, fn)
+	if err != nil && err != errSampled {
+		return nil, fmt.Errorf("%s: %w", o.Key, err)
+	}
+	return cols, err
+}
+
+// Read reads every file a table matches. Files have no cursor column, so
+// incremental pickup is by file; see FileSource.
+func (f *Files) Read(ctx context.Context, q Query, fn func(Row) error) error {
+	objs, err := f.Objects(ctx, q.Table)
+	if err != nil {
+		return err
+	}
+	return f.ReadObjects(ctx, q.Table, objs, fn)
+}
+
+func (f *Files) ReadObjects(ctx context.Context, table string, objs []Object, fn func(Row) error) error {
+	cols, err := f.Columns(ctx, table)
+	if err != nil {
+		return err
+	}
+	for _, o := range objs {
+		_, err := f.parse(ctx, table, o, func(row Row) error {
+			for k, v := range row {
+				if j, ok := v.(jsonValue); ok {
+					row[k] = string(j)
+				}
+			}
+			for _, c := range cols {
+				if _, ok := row[c.Name]; !ok {
+					row[c.Name] = nil
+				}
+			}
+			coerce(cols, row)
+			return fn(row)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close releases stores that hold a directory or a connection open.
+func (f *Files) Close() error {
+	if c, ok := f.store.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
@@ -0,0 +1,501 @@
+package source
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Zubimendi/sync-loop/api/internal/checksum"
+	"github.com/Zubimendi/sync-loop/api/internal/model"
+	"github.com/Zubimendi/sync-loop/api/internal/parquet"
+	"github.com/Zubimendi/sync-loop/api/internal/xlsx"
+	"github.com/xuri/excelize/v2"
+)
+
+// FileOptions say how the files of a file-based source are parsed.
+type FileOptions struct {
+	// Format is csv, jsonl, parquet or xlsx; empty picks it per file from
+	// the extension.
+	Format string
+	// Delimiter separates CSV fields; a comma when empty.
+	Delimiter rune
+	// NoHeader reads files without a header row, naming the columns col_1,
+	// col_2, ...
+	NoHeader bool
+	// Sheet, Range and HeaderRow pick what of a workbook is read: the named
+	// sheet (the first visible one when empty), a block such as B3:H200 and
+	// the sheet row holding the names (found by looking when zero).
+	Sheet     string
+	Range     string
+	HeaderRow int
+}
+
+func fileOptions(cfg map[string]interface{}) FileOptions {
+	o := FileOptions{Format: str(cfg, "format")}
+	if d := str(cfg, "delimiter"); d != "" {
+		o.Delimiter = []rune(d)[0]
+	}
+	if h, ok := cfg["header"].(bool); ok {
+		o.NoHeader = !h
+	}
+	o.Sheet, o.Range = str(cfg, "sheet"), str(cfg, "range")
+	if n, ok := cfg["header_row"].(float64); ok {
+		o.HeaderRow = int(n)
+	}
+	return o
+}
+
+// jsonValue marks a structured JSON value, kept as its compact text.
+type jsonValue string
+
+// fileFormat returns the parser name for a key.
+func (o FileOptions) fileFormat(key string) (string, error) {
+	if o.Format != "" {
+		return strings.ToLower(o.Format), nil
+	}
+	name := strings.ToLower(key)
+	for _, ext := range []string{".gz", ".zst"} {
+		if strings.HasSuffix(name, ext) {
+			return "", fmt.Errorf("%s: compressed files are not supported", key)
+		}
+	}
+	switch path.Ext(name) {
+	case ".csv", ".tsv", ".txt":
+		return "csv", nil
+	case ".jsonl", ".ndjson", ".json":
+		return "jsonl", nil
+	case ".parquet":
+		return "parquet", nil
+	case ".xlsx", ".xlsm":
+		return "xlsx", nil
+	case ".xls":
+		return "", fmt.Errorf("%s: legacy .xls workbooks are not supported; save it as .xlsx", key)
+	}
+	return "", fmt.Errorf("%s: cannot tell the file format; set format on the connector", key)
+}
+
+// parseFile streams the rows of one file. Values are strings, jsonValue or
+// nil. It returns the file's columns in file order; only Parquet knows their
+// types, the other formats leave Type empty for inference to fill.
+func (o FileOptions) parseFile(key string, r io.Reader, fn func(Row) error) ([]model.Column, error) {
+	format, err := o.fileFormat(key)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	switch format {
+	case "csv":
+		names, err = o.parseCSV(r, fn)
+	case "jsonl", "ndjson":
+		names, err = parseJSONL(r, fn)
+	case "parquet":
+		return parseParquet(r, fn)
+	case "xlsx", "excel":
+		names, err = o.parseXLSX(r, fn)
+	default:
+		return nil, fmt.Errorf("unknown file format %q", format)
+	}
+	cols := make([]model.Column, len(names))
+	for i, n := range names {
+		cols[i] = model.Column{Name: n}
+	}
+	return cols, err
+}
+
+// header cleans a header row: a leading BOM goes, blank names become
+// col_<n> and repeated names get a _<n> suffix.
+func header(names []string) []string {
+	out := make([]string, len(names))
+	seen := map[string]int{}
+	for i, n := range names {
+		if i == 0 {
+			n = strings.TrimPrefix(n, "\ufeff")
+		}
+		n = strings.TrimSpace(n)
+		if n == "" {
+			n = "col_" + strconv.Itoa(i+1)
+		}
+		if c := seen[n]; c > 0 {
+			seen[n]++
+			n = n + "_" + strconv.Itoa(c+1)
+		} else {
+			seen[n] = 1
+		}
+		out[i] = n
+	}
+	return out
+}
+
+func numbered(n int) []string {
+	out := make([]string, n)
+	for i := range out {
+		out[i] = "col_" + strconv.Itoa(i+1)
+	}
+	return out
+}
+
+func (o FileOptions) parseCSV(r io.Reader, fn func(Row) error) ([]string, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.ReuseRecord = true
+	if o.Delimiter != 0 {
+		cr.Comma = o.Delimiter
+	}
+	var names []string
+	for line := 0; ; line++ {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			return names, nil
+		}
+		if err != nil {
+			return names, err
+		}
+		if names == nil {
+			if !o.NoHeader {
+				names = header(rec)
+				continue
+			}
+			names = numbered(len(rec))
+		}
+		if len(rec) > len(names) {
+			return names, fmt.Errorf("line %d has %d fields, the header %d", line+1, len(rec), len(names))
+		}
+		row := make(Row, len(names))
+		for i, n := range names {
+			if i < len(rec) {
+				row[n] = rec[i]
+			} else {
+				row[n] = nil
+			}
+		}
+		if err := fn(row); err != nil {
+			return names, err
+		}
+	}
+}
+
+// parseJSONL reads one JSON object per line. Keys are named in the order
+// they are first met; the new keys of a record sort by name, since a decoded
+// object keeps no order of its own.
+func parseJSONL(r io.Reader, fn func(Row) error) ([]string, error) {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	var names []string
+	known := map[string]bool{}
+	for n := 1; ; n++ {
+		var obj map[string]interface{}
+		err := dec.Decode(&obj)
+		if err == io.EOF {
+			return names, nil
+		}
+		if err != nil {
+			return names, fmt.Errorf("record %d: %w", n, err)
+		}
+		row, err := jsonRow(obj)
+		if err != nil {
+			return names, fmt.Errorf("record %d: %w", n, err)
+		}
+		names = newKeys(names, known, obj)
+		if err := fn(row); err != nil {
+			return names, err
+		}
+	}
+}
+
+// jsonRow converts a decoded JSON object (numbers as json.Number) to a row:
+// scalars become canonical text and objects and arrays a jsonValue.
+func jsonRow(obj map[string]interface{}) (Row, error) {
+	row := make(Row, len(obj))
+	for k, v := range obj {
+		switch t := v.(type) {
+		case nil:
+			row[k] = nil
+		case string:
+			row[k] = t
+		case json.Number:
+			row[k] = t.String()
+		case bool:
+			row[k] = strconv.FormatBool(t)
+		default:
+			b, err := json.Marshal(t)
+			if err != nil {
+				return nil, err
+			}
+			row[k] = jsonValue(b)
+		}
+	}
+	return row, nil
+}
+
+// newKeys appends the keys of obj not yet known to names, sorted by name.
+func newKeys(names []string, known map[string]bool, obj map[string]interface{}) []string {
+	var added []string
+	for k := range obj {
+		if !known[k] {
+			known[k] = true
+			added = append(added, k)
+		}
+	}
+	sort.Strings(added)
+	return append(names, added...)
+}
+
+func parseParquet(r io.Reader, fn func(Row) error) ([]model.Column, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	f, err := parquet.Open(b)
+	if err != nil {
+		return nil, err
+	}
+	cols := make([]model.Column, len(f.Columns))
+	for i, c := range f.Columns {
+		cols[i] = parquetSourceColumn(c)
+	}
+	err = f.Rows(func(vals []interface{}) error {
+		row := make(Row, len(vals))
+		for i, c := range f.Columns {
+			if v := c.Native(vals[i]); v != nil {
+				row[c.Name] = checksum.Canonical(v)
+			} else {
+				row[c.Name] = nil
+			}
+		}
+		return fn(row)
+	})
+	return cols, err
+}
+
+// parquetSourceColumn names a Parquet column's type the way Postgres would.
+func parquetSourceColumn(c parquet.Column) model.Column {
+	mc := model.Column{Name: c.Name, Nullable: c.Optional, Type: "text"}
+	switch c.Logical {
+	case parquet.Decimal:
+		mc.Type, mc.Precision, mc.Scale = "numeric", c.Precision, c.Scale
+		return mc
+	case parquet.Date:
+		mc.Type = "date"
+		return mc
+	case parquet.Timestamp:
+		mc.Type = "timestamp with time zone"
+		return mc
+	case parquet.LocalTimestamp:
+		mc.Type = "timestamp without time zone"
+		return mc
+	case parquet.JSON:
+		mc.Type = "jsonb"
+		return mc
+	case parquet.String:
+		return mc
+	}
+	switch c.Type {
+	case parquet.Boolean:
+		mc.Type = "boolean"
+	case parquet.Int32:
+		mc.Type = "integer"
+	case parquet.Int64:
+		mc.Type = "bigint"
+	case parquet.Float, parquet.Double:
+		mc.Type = "double precision"
+	case parquet.Int96:
+		mc.Type = "timestamp with time zone"
+	case parquet.FixedLenByteArray:
+		mc.Type = "bytea"
+	}
+	return mc
+}
+
+// parseXLSX reads one sheet of a workbook. Merged cells repeat their value
+// across the range; date-formatted cells read as dates or timestamps and
+// numbers in plain decimal notation.
+func (o FileOptions) parseXLSX(r io.Reader, fn func(Row) error) ([]string, error) {
+	rng, err := xlsx.ParseRange(o.Range)
+	if err != nil {
+		return nil, err
+	}
+	f, err := xlsx.Open(r)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	sheet, err := o.pickSheet(f)
+	if err != nil {
+		return nil, err
+	}
+	grid, err := xlsx.ReadSheet(f, sheet)
+	if err != nil {
+		return nil, err
+	}
+	grid, first := rng.Clip(grid)
+	if o.Range == "" {
+		grid = trimLeft(grid)
+	}
+
+	var names []string
+	start := 0
+	switch {
+	case o.NoHeader:
+		width := 0
+		for _, row := range grid {
+			width = max(width, len(row))
+		}
+		names = numbered(width)
+	case o.HeaderRow > 0:
+		start = o.HeaderRow - first
+		if start < 0 || start >= len(grid) {
+			return nil, fmt.Errorf("header row %d is outside the sheet's data", o.HeaderRow)
+		}
+	default:
+		start = detectHeader(grid)
+	}
+	if names == nil {
+		if start >= len(grid) {
+			return nil, nil
+		}
+		hdr := make([]string, len(grid[start]))
+		for i, c := range grid[start] {
+			hdr[i], _ = cellValue(c).(string)
+		}
+		names = header(hdr)
+		start++
+	}
+	for _, rec := range grid[start:] {
+		row := make(Row, len(names))
+		empty := true
+		for i, n := range names {
+			row[n] = nil
+			if i < len(rec) {
+				if row[n] = cellValue(rec[i]); row[n] != nil {
+					empty = false
+				}
+			}
+		}
+		if empty {
+			continue
+		}
+		if err := fn(row); err != nil {
+			return names, err
+		}
+	}
+	return names, nil
+}
+
+// trimLeft drops the empty columns a sheet's table is indented by.
+func trimLeft(grid [][]xlsx.Cell) [][]xlsx.Cell {
+	left := -1
+	for _, row := range grid {
+		for i, c := range row {
+			if c.Kind != xlsx.Empty {
+				if left < 0 || i < left {
+					left = i
+				}
+				break
+			}
+		}
+	}
+	if left <= 0 {
+		return grid
+	}
+	for i, row := range grid {
+		if len(row) > left {
+			grid[i] = row[left:]
+		} else {
+			grid[i] = nil
+		}
+	}
+	return grid
+}
+
+// pickSheet returns the configured sheet, or the first visible one.
+func (o FileOptions) pickSheet(f *excelize.File) (string, error) {
+	sheets := f.GetSheetList()
+	if o.Sheet != "" {
+		for _, s := range sheets {
+			if strings.EqualFold(s, o.Sheet) {
+				return s, nil
+			}
+		}
+		return "", fmt.Errorf("no sheet %q; the workbook has %s", o.Sheet, strings.Join(sheets, ", "))
+	}
+	for _, s := range sheets {
+		if visible, err := f.GetSheetVisible(s); err == nil && visible {
+			return s, nil
+		}
+	}
+	return "", errors.New("the workbook has no visible sheet")
+}
+
+// headerScanRows is how far down detectHeader looks for the header row.
+const headerScanRows = 10
+
+// detectHeader finds the header row below any title or notes rows: the
+// first of the top rows that holds only text, at least half as many cells as
+// the widest of them and more than one distinct value (a merged title
+// repeats one). It falls back to the first non-empty row.
+func detectHeader(grid [][]xlsx.Cell) int {
+	var rows []int
+	widest := 0
+	for i := 0; i < len(grid) && len(rows) < headerScanRows; i++ {
+		if n := filled(grid[i]); n > 0 {
+			rows = append(rows, i)
+			widest = max(widest, n)
+		}
+	}
+	if len(rows) == 0 {
+		return len(grid)
+	}
+	for _, i := range rows {
+		n := filled(grid[i])
+		if 2*n < widest {
+			continue
+		}
+		distinct := map[string]bool{}
+		text := true
+		for _, c := range grid[i] {
+			switch c.Kind {
+			case xlsx.Empty:
+			case xlsx.Text:
+				distinct[c.Value] = true
+			default:
+				text = false
+			}
+		}
+		if text && (len(distinct) > 1 || widest == 1) {
+			return i
+		}
+	}
+	return rows[0]
+}
+
+func filled(row []xlsx.Cell) int {
+	n := 0
+	for _, c := range row {
+		if c.Kind != xlsx.Empty {
+			n++
+		}
+	}
+	return n
+}
+
+// cellValue renders a cell for inference: dates as 2006-01-02, timestamps
+// without a zone, errors such as #N/A as NULL.
+func cellValue(c xlsx.Cell) interface{} {
+	switch c.Kind {
+	case xlsx.Empty, xlsx.Error:
+		return nil
+	case xlsx.Date:
+		return c.Time.Format("2006-01-02")
+	case xlsx.DateTime:
+		return c.Time.Format("2006-01-02 15:04:05.999999")
+	case xlsx.Time:
+		return c.Time.Format("15:04:05.999999")
+	}
+	return c.Value
+}
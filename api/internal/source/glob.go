@@ -0,0 +1,82 @@
+package source
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// compileGlob turns a file pattern into a regexp matched against whole keys.
+// '*' and '?' stay within one path segment, '**' crosses segments, and
+// [...] and {a,b} work as in a shell.
+func compileGlob(pattern string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString("^")
+	depth := 0
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch c {
+		case '*':
+			if i+1 < len(pattern) && pattern[i+1] == '*' {
+				i++
+				if i+1 < len(pattern) && pattern[i+1] == '/' {
+					// "**/" also matches no directory at all.
+					i++
+					b.WriteString("(?:.*/)?")
+				} else {
+					b.WriteString(".*")
+				}
+				continue
+			}
+			b.WriteString("[^/]*")
+		case '?':
+			b.WriteString("[^/]")
+		case '[':
+			j := strings.IndexByte(pattern[i:], ']')
+			if j < 0 {
+				return nil, fmt.Errorf("glob %q: unclosed [", pattern)
+			}
+			class := pattern[i+1 : i+j]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + class + "]")
+			i += j
+		case '{':
+			depth++
+			b.WriteString("(?:")
+		case '}':
+			if depth == 0 {
+				return nil, fmt.Errorf("glob %q: unmatched }", pattern)
+			}
+			depth--
+			b.WriteString(")")
+		case ',':
+			if depth > 0 {
+				b.WriteString("|")
+			} else {
+				b.WriteString(",")
+			}
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	if depth != 0 {
+		return nil, fmt.Errorf("glob %q: unclosed {", pattern)
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
+
+// globPrefix is the literal directory part of a pattern, which is all a
+// listing needs to fetch.
+func globPrefix(pattern string) string {
+	i := strings.IndexAny(pattern, "*?[{")
+	if i < 0 {
+		i = len(pattern)
+	}
+	if j := strings.LastIndexByte(pattern[:i], '/'); j >= 0 {
+		return pattern[:j+1]
+	}
+	return ""
+}
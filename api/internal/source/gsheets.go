@@ -0,0 +1,170 @@
+package source
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/Zubimendi/sync-loop/api/internal/egress"
+	"github.com/Zubimendi/sync-loop/api/internal/gsheets"
+	"github.com/Zubimendi/sync-loop/api/internal/model"
+	"github.com/Zubimendi/sync-loop/api/internal/xlsx"
+)
+
+// GSheets reads the sheets of one spreadsheet; a table names the sheet.
+type GSheets struct {
+	client      *gsheets.Client
+	spreadsheet string
+	sheet       string
+	cells       string
+	headerRow   int
+	schemas     map[string][]model.Column
+}
+
+// OpenGSheets connects to the Sheets API. Config keys: spreadsheet_id,
+// sheet (read for tables that name none), range (a block such as B3:H, the
+// whole sheet when empty), header_row (the sheet row holding the names, by
+// default the first of the range) and the API keys of gsheets.ConfigFrom.
+func OpenGSheets(ctx context.Context, cfg map[string]interface{}) (*GSheets, error) {
+	gc, err := gsheets.ConfigFrom(cfg)
+	if err != nil {
+		return nil, err
+	}
+	client, err := gsheets.New(gc, egress.FromContext(ctx).Transport())
+	if err != nil {
+		return nil, err
+	}
+	g := &GSheets{
+		client:      client,
+		spreadsheet: str(cfg, "spreadsheet_id"),
+		sheet:       str(cfg, "sheet"),
+		cells:       str(cfg, "range"),
+		schemas:     map[string][]model.Column{},
+	}
+	if g.spreadsheet == "" {
+		return nil, errors.New("gsheets source: spreadsheet_id is required")
+	}
+	if _, err := xlsx.ParseRange(g.cells); err != nil {
+		return nil, fmt.Errorf("gsheets source: %w", err)
+	}
+	if n, ok := cfg["header_row"].(float64); ok {
+		g.headerRow = int(n)
+	}
+	return g, nil
+}
+
+// grid reads a table: its column names and the rows below them.
+func (g *GSheets) grid(ctx context.Context, table string) ([]string, [][]string, error) {
+	sheet := table
+	if sheet == "" {
+		sheet = g.sheet
+	}
+	vr, err := g.client.Get(ctx, g.spreadsheet, gsheets.Range(sheet, g.cells))
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(vr.Values) == 0 {
+		return nil, nil, nil
+	}
+	first := gsheets.FirstRow(g.cells)
+	if vr.Range != "" {
+		first = gsheets.FirstRow(vr.Range)
+	}
+	hdr := 0
+	if g.headerRow > 0 {
+		hdr = g.headerRow - first
+		if hdr < 0 || hdr >= len(vr.Values) {
+			return nil, nil, fmt.Errorf("gsheets source: header row %d is outside the sheet's data", g.headerRow)
+		}
+	}
+	return header(vr.Values[hdr]), vr.Values[hdr+1:], nil
+}
+
+// sheetRows hands each non-empty row to fn, blank cells as NULL.
+func sheetRows(names []string, recs [][]string, fn func(Row) error) error {
+	for _, rec := range recs {
+		row := make(Row, len(names))
+		empty := true
+		for i, n := range names {
+			row[n] = nil
+			if i < len(rec) && rec[i] != "" {
+				row[n], empty = rec[i], false
+			}
+		}
+		if empty {
+			continue
+		}
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (g *GSheets) Columns(ctx context.Context, table string) ([]model.Column, error) {
+	if cols, ok := g.schemas[table]; ok {
+		return cols, nil
+	}
+	names, recs, err := g.grid(ctx, table)
+	if err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("gsheets source: sheet %q has no header row", table)
+	}
+	cols := g.infer(names, recs)
+	g.schemas[table] = cols
+	return cols, nil
+}
+
+func (g *GSheets) infer(names []string, recs [][]string) []model.Column {
+	in := newInferrer()
+	n := 0
+	sheetRows(names, recs, func(row Row) error {
+		in.add(row, nil)
+		if n++; n >= inferSampleRows {
+			return errSampled
+		}
+		return nil
+	})
+	inferred := in.columns()
+	cols := make([]model.Column, len(names))
+	for i, name := range names {
+		cols[i] = inferred[name]
+		cols[i].Name = name
+		if cols[i].Type == "" {
+			cols[i].Type, cols[i].Nullable = "text", true
+		}
+	}
+	return cols
+}
+
+// Read reads a whole sheet. Incremental reads drop rows whose cursor column
+// is not newer than the last sync, as a database source would.
+func (g *GSheets) Read(ctx context.Context, q Query, fn func(Row) error) error {
+	names, recs, err := g.grid(ctx, q.Table)
+	if err != nil {
+		return err
+	}
+	cols, ok := g.schemas[q.Table]
+	if !ok {
+		cols = g.infer(names, recs)
+		g.schemas[q.Table] = cols
+	}
+	return sheetRows(names, recs, func(row Row) error {
+		coerce(cols, row)
+		if q.Incremental && !q.Since.IsZero() {
+			if v, ok := row[q.CursorColumn].(string); ok {
+				if t, ok := parseTimestamp(v); ok && !t.After(q.Since) {
+					return nil
+				}
+			}
+		}
+		return fn(row)
+	})
+}
+
+func (g *GSheets) Close() error {
+	g.client.Close()
+	return nil
+}
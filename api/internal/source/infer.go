@@ -0,0 +1,192 @@
+package source
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Zubimendi/sync-loop/api/internal/checksum"
+	"github.com/Zubimendi/sync-loop/api/internal/model"
+)
+
+// inferSampleRows is how many rows per file schema inference looks at.
+const inferSampleRows = 1000
+
+// Candidate types, narrowest first. A column keeps the candidates every
+// sampled value satisfies and ends up with the narrowest one left.
+const (
+	candBigint = 1 << iota
+	candNumeric
+	candBoolean
+	candDate
+	candTimestamp
+	candJSON
+)
+
+var candTypes = []struct {
+	bit int
+	typ string
+}{
+	{candBoolean, "boolean"},
+	{candBigint, "bigint"},
+	{candNumeric, "numeric"},
+	{candDate, "date"},
+	{candTimestamp, "timestamp with time zone"},
+	{candJSON, "jsonb"},
+}
+
+// ColumnTypes are the types a file column can be read as, whether inferred
+// or set by hand.
+var ColumnTypes = map[string]bool{
+	"text": true, "bigint": true, "numeric": true, "double precision": true,
+	"boolean": true, "date": true, "timestamp with time zone": true, "jsonb": true,
+}
+
+// timeLayouts are the timestamp spellings files commonly use.
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+}
+
+// inferrer builds a schema from sampled text values. A column missing from
+// some rows is nullable.
+type inferrer struct {
+	cols    []model.Column
+	index   map[string]int
+	cands   []int
+	seen    []bool
+	present []int
+	rows    int
+}
+
+func newInferrer() *inferrer { return &inferrer{index: map[string]int{}} }
+
+// add folds one row in. Values are canonical strings or nil; raw marks the
+// columns whose values were structured (JSON objects or arrays).
+func (in *inferrer) add(row Row, structured map[string]bool) {
+	in.rows++
+	for k, v := range row {
+		i, ok := in.index[k]
+		if !ok {
+			i = len(in.cols)
+			in.index[k] = i
+			in.cols = append(in.cols, model.Column{Name: k})
+			in.cands = append(in.cands, candBigint|candNumeric|candBoolean|candDate|candTimestamp|candJSON)
+			in.seen = append(in.seen, false)
+			in.present = append(in.present, 0)
+		}
+		in.present[i]++
+		var s string
+		switch t := v.(type) {
+		case string:
+			s = t
+		case jsonValue:
+			s = string(t)
+		}
+		if s == "" {
+			in.cols[i].Nullable = true
+			continue
+		}
+		in.seen[i] = true
+		in.cands[i] &= candidates(s, structured[k])
+	}
+}
+
+func candidates(s string, structured bool) int {
+	if structured {
+		return candJSON
+	}
+	c := 0
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil && strconv.FormatInt(n, 10) == s {
+		c |= candBigint | candNumeric
+	} else if isDecimal(s) {
+		c |= candNumeric
+	}
+	if s == "true" || s == "false" {
+		c |= candBoolean
+	}
+	if _, err := time.Parse("2006-01-02", s); err == nil {
+		c |= candDate
+	}
+	if _, ok := parseTimestamp(s); ok {
+		c |= candTimestamp
+	}
+	return c
+}
+
+// isDecimal accepts plain fixed-point numbers; exponents and leading zeros
+// would not survive the round trip through a numeric column.
+func isDecimal(s string) bool {
+	t := strings.TrimPrefix(s, "-")
+	whole, frac, _ := strings.Cut(t, ".")
+	if whole == "" || (len(whole) > 1 && whole[0] == '0') || strings.Contains(s, ".") && frac == "" {
+		return false
+	}
+	for _, part := range []string{whole, frac} {
+		for _, r := range part {
+			if r < '0' || r > '9' {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func parseTimestamp(s string) (time.Time, bool) {
+	for _, l := range timeLayouts {
+		if t, err := time.Parse(l, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// columns returns the inferred schema by name. Columns that only ever held
+// NULLs are text.
+func (in *inferrer) columns() map[string]model.Column {
+	out := make(map[string]model.Column, len(in.cols))
+	for i, c := range in.cols {
+		c.Type = "text"
+		if in.present[i] < in.rows {
+			c.Nullable = true
+		}
+		if in.seen[i] {
+			for _, t := range candTypes {
+				if in.cands[i]&t.bit != 0 {
+					c.Type = t.typ
+					break
+				}
+			}
+		}
+		out[c.Name] = c
+	}
+	return out
+}
+
+// coerce rewrites the text values of a row into the canonical form of their
+// column's type, so dates and timestamps read like those of a database
+// source. Values that do not parse are left alone for the load to judge.
+func coerce(cols []model.Column, row Row) {
+	for _, c := range cols {
+		s, ok := row[c.Name].(string)
+		if !ok {
+			continue
+		}
+		if s == "" {
+			row[c.Name] = nil
+			continue
+		}
+		switch c.Type {
+		case "date":
+			if t, err := time.Parse("2006-01-02", s); err == nil {
+				row[c.Name] = checksum.Canonical(t)
+			}
+		case "timestamp with time zone":
+			if t, ok := parseTimestamp(s); ok {
+				row[c.Name] = checksum.Canonical(t)
+			}
+		}
+	}
+}
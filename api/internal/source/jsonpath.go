@@ -0,0 +1,135 @@
+package source
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// jsonPath is a parsed JSONPath of the subset API specs need: $, .key,
+// ['key'], [n] and the [*] / .* wildcards.
+type jsonPath []pathStep
+
+type pathStep struct {
+	key   string
+	index int
+	kind  int // stepKey | stepIndex | stepAll
+}
+
+const (
+	stepKey = iota
+	stepIndex
+	stepAll
+)
+
+func parseJSONPath(s string) (jsonPath, error) {
+	p := strings.TrimSpace(s)
+	if p == "" || p == "$" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(p, "$") {
+		p = "$." + p
+	}
+	p = p[1:]
+	var out jsonPath
+	for p != "" {
+		switch {
+		case strings.HasPrefix(p, ".."):
+			return nil, fmt.Errorf("json path %q: recursive descent is not supported", s)
+		case p[0] == '.':
+			p = p[1:]
+			end := strings.IndexAny(p, ".[")
+			if end < 0 {
+				end = len(p)
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("json path %q: empty key", s)
+			}
+			if k := p[:end]; k == "*" {
+				out = append(out, pathStep{kind: stepAll})
+			} else {
+				out = append(out, pathStep{kind: stepKey, key: k})
+			}
+			p = p[end:]
+		case p[0] == '[':
+			end := strings.IndexByte(p, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("json path %q: unclosed [", s)
+			}
+			in := strings.TrimSpace(p[1:end])
+			p = p[end+1:]
+			switch {
+			case in == "*":
+				out = append(out, pathStep{kind: stepAll})
+			case len(in) >= 2 && (in[0] == '\'' || in[0] == '"') && in[len(in)-1] == in[0]:
+				out = append(out, pathStep{kind: stepKey, key: in[1 : len(in)-1]})
+			default:
+				n, err := strconv.Atoi(in)
+				if err != nil {
+					return nil, fmt.Errorf("json path %q: bad index %q", s, in)
+				}
+				out = append(out, pathStep{kind: stepIndex, index: n})
+			}
+		default:
+			return nil, fmt.Errorf("json path %q: unexpected %q", s, p[:1])
+		}
+	}
+	return out, nil
+}
+
+// find returns every value the path matches in v. Missing keys match
+// nothing; a negative index counts from the end.
+func (p jsonPath) find(v interface{}) []interface{} {
+	cur := []interface{}{v}
+	for _, st := range p {
+		var next []interface{}
+		for _, c := range cur {
+			switch st.kind {
+			case stepKey:
+				if m, ok := c.(map[string]interface{}); ok {
+					if x, ok := m[st.key]; ok {
+						next = append(next, x)
+					}
+				}
+			case stepIndex:
+				if a, ok := c.([]interface{}); ok {
+					i := st.index
+					if i < 0 {
+						i += len(a)
+					}
+					if i >= 0 && i < len(a) {
+						next = append(next, a[i])
+					}
+				}
+			case stepAll:
+				switch t := c.(type) {
+				case []interface{}:
+					next = append(next, t...)
+				case map[string]interface{}:
+					for _, x := range t {
+						next = append(next, x)
+					}
+				}
+			}
+		}
+		cur = next
+	}
+	return cur
+}
+
+// first returns the first match as text: strings as they are, numbers and
+// booleans spelled as in JSON, "" for null or no match.
+func (p jsonPath) first(v interface{}) string {
+	m := p.find(v)
+	if len(m) == 0 || m[0] == nil {
+		return ""
+	}
+	switch t := m[0].(type) {
+	case string:
+		return t
+	case map[string]interface{}, []interface{}:
+		return ""
+	default:
+		return fmt.Sprint(t)
+	}
+}
@@ -0,0 +1,380 @@
+package source
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/Zubimendi/sync-loop/api/internal/checksum"
+	"github.com/Zubimendi/sync-loop/api/internal/egress"
+	"github.com/Zubimendi/sync-loop/api/internal/kafka"
+	"github.com/Zubimendi/sync-loop/api/internal/model"
+	"github.com/Zubimendi/sync-loop/api/internal/output"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// kafkaColumns describe where each message was read. Fields of the value
+// with these names are shadowed by them.
+var kafkaColumns = []model.Column{
+	{Name: "_key", Type: "text", Nullable: true},
+	{Name: "_partition", Type: "integer"},
+	{Name: "_offset", Type: "bigint"},
+	{Name: "_timestamp", Type: "timestamp with time zone"},
+}
+
+// Kafka reads the messages of a topic, the table of a query, as rows: the
+// fields of each value plus the columns of kafkaColumns. Values are JSON
+// objects, Avro records framed for the schema registry, or text read into
+// _value, as value_format says.
+//
+// Runs of a job read from the offsets committed for the consumer group
+// syncloop-<job ID>, or from the start of each partition, up to the end
+// each partition had when the read began. The offsets a read reached are
+// only committed once the run has loaded its rows; see Checkpointed.
+type Kafka struct {
+	cfg      kafka.Config
+	format   string
+	reg      *kafka.Registry
+	decoders map[int]output.RecordDecoder
+	schemas  map[string][]model.Column
+	dial     func(ctx context.Context, network, addr string) (net.Conn, error)
+	client   *kgo.Client
+	// checkpoint is where the last complete Read of a job stopped.
+	checkpoint string
+}
+
+// OpenKafka builds a Kafka source from the keys of kafka.ConfigFrom and
+// value_format: json (the default), avro or text.
+func OpenKafka(ctx context.Context, cfg map[string]interface{}) (*Kafka, error) {
+	kc, err := kafka.ConfigFrom(cfg)
+	if err != nil {
+		return nil, err
+	}
+	k := &Kafka{
+		cfg:      kc,
+		format:   str(cfg, "value_format"),
+		decoders: map[int]output.RecordDecoder{},
+		schemas:  map[string][]model.Column{},
+		dial:     egress.FromContext(ctx).DialContext,
+	}
+	switch k.format {
+	case "":
+		k.format = "json"
+	case "json", "text":
+	case "avro":
+		if kc.Registry.URL == "" {
+			return nil, errors.New("kafka: value_format avro needs a schema_registry_url")
+		}
+		k.reg = kafka.NewRegistry(kc, egress.FromContext(ctx).Transport())
+	default:
+		return nil, fmt.Errorf("kafka: unknown value_format %q", k.format)
+	}
+	if k.client, err = kafka.NewClient(kc, k.dial); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+func (k *Kafka) Close() error {
+	k.client.Close()
+	if k.reg != nil {
+		k.reg.Close()
+	}
+	return nil
+}
+
+// Tables lists the topics of the cluster.
+func (k *Kafka) Tables(ctx context.Context) ([]string, error) {
+	return kafka.Topics(ctx, k.client)
+}
+
+// DefaultCursor makes incremental runs track the newest message time. It
+// only informs the run: where a read starts is the committed offsets.
+func (k *Kafka) DefaultCursor() string { return "_timestamp" }
+
+// Columns infers the fields of a topic's values from the first messages of
+// its partitions.
+func (k *Kafka) Columns(ctx context.Context, topic string) ([]model.Column, error) {
+	if cols, ok := k.schemas[topic]; ok {
+		return cols, nil
+	}
+	parts, err := kafka.Partitions(ctx, k.client, topic)
+	if err != nil {
+		return nil, err
+	}
+	start, err := kafka.StartOffsets(ctx, k.client, topic, parts)
+	if err != nil {
+		return nil, err
+	}
+	end, err := kafka.EndOffsets(ctx, k.client, topic, parts)
+	if err != nil {
+		return nil, err
+	}
+	in := newInferrer()
+	var names []string
+	known := map[string]bool{}
+	for _, c := range kafkaColumns {
+		known[c.Name] = true
+	}
+	n := 0
+	err = k.consume(ctx, topic, start, end, func(r *kgo.Record) error {
+		row, err := k.value(ctx, r)
+		if err != nil {
+			return err
+		}
+		structured := map[string]bool{}
+		for f, v := range row {
+			if _, ok := v.(jsonValue); ok {
+				structured[f] = true
+			}
+		}
+		in.add(row, structured)
+		names = newKeys(names, known, row)
+		if n++; n >= inferSampleRows {
+			return errSampled
+		}
+		return nil
+	})
+	if err != nil && err != errSampled {
+		return nil, err
+	}
+	inferred := in.columns()
+	cols := append([]model.Column(nil), kafkaColumns...)
+	for _, name := range names {
+		cols = append(cols, inferred[name])
+	}
+	k.schemas[topic] = cols
+	return cols, nil
+}
+
+// Read reads a topic up to the end its partitions have now. Incremental
+// reads of a job start at its committed offsets; Since is not used, as
+// message times need not grow with offsets.
+func (k *Kafka) Read(ctx context.Context, q Query, fn func(Row) error) error {
+	k.checkpoint = ""
+	cols, err := k.Columns(ctx, q.Table)
+	if err != nil {
+		return err
+	}
+	parts, err := kafka.Partitions(ctx, k.client, q.Table)
+	if err != nil {
+		return err
+	}
+	from, err := kafka.StartOffsets(ctx, k.client, q.Table, parts)
+	if err != nil {
+		return err
+	}
+	end, err := kafka.EndOffsets(ctx, k.client, q.Table, parts)
+	if err != nil {
+		return err
+	}
+	group := ""
+	if q.JobID != "" {
+		group = "syncloop-" + q.JobID
+	}
+	if q.Incremental && group != "" {
+		committed, err := kafka.Committed(ctx, k.client, group, q.Table)
+		if err != nil {
+			return err
+		}
+		for p, o := range committed {
+			if _, ok := from[p]; ok && o > from[p] {
+				from[p] = o
+			}
+		}
+	}
+	err = k.consume(ctx, q.Table, from, end, func(r *kgo.Record) error {
+		row, err := k.value(ctx, r)
+		if err != nil {
+			return err
+		}
+		for f, v := range row {
+			if j, ok := v.(jsonValue); ok {
+				row[f] = string(j)
+			}
+		}
+		k.meta(row, r)
+		for _, c := range cols {
+			if _, ok := row[c.Name]; !ok {
+				row[c.Name] = nil
+			}
+		}
+		coerce(cols, row)
+		return fn(row)
+	})
+	if err != nil {
+		return err
+	}
+	if group != "" {
+		b, err := json.Marshal(kafkaCheckpoint{Group: group, Topic: q.Table, Offsets: end})
+		if err != nil {
+			return err
+		}
+		k.checkpoint = string(b)
+	}
+	return nil
+}
+
+// kafkaCheckpoint is the offsets a read reached, next to read in each
+// partition.
+type kafkaCheckpoint struct {
+	Group   string        `json:"group"`
+	Topic   string        `json:"topic"`
+	Offsets kafka.Offsets `json:"offsets"`
+}
+
+func (k *Kafka) Checkpoint() string { return k.checkpoint }
+
+func (k *Kafka) Commit(ctx context.Context, checkpoint string) error {
+	var c kafkaCheckpoint
+	if err := json.Unmarshal([]byte(checkpoint), &c); err != nil {
+		return fmt.Errorf("kafka: checkpoint: %w", err)
+	}
+	return kafka.Commit(ctx, k.client, c.Group, c.Topic, c.Offsets)
+}
+
+// consume hands fn the messages of topic from the offsets of from up to
+// those of end, partition by partition in offset order. Transaction
+// markers are read too, so a partition ending in one is known to be done.
+func (k *Kafka) consume(ctx context.Context, topic string, from, end kafka.Offsets, fn func(*kgo.Record) error) error {
+	parts := map[int32]kgo.Offset{}
+	for p, o := range from {
+		if o < end[p] {
+			parts[p] = kgo.NewOffset().At(o)
+		}
+	}
+	if len(parts) == 0 {
+		return nil
+	}
+	cl, err := kafka.NewClient(k.cfg, k.dial,
+		kgo.ConsumePartitions(map[string]map[int32]kgo.Offset{topic: parts}),
+		kgo.FetchIsolationLevel(kgo.ReadCommitted()),
+		kgo.KeepControlRecords(),
+	)
+	if err != nil {
+		return err
+	}
+	defer cl.Close()
+	for len(parts) > 0 {
+		fetches := cl.PollFetches(ctx)
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		var ferr error
+		fetches.EachError(func(t string, p int32, err error) {
+			if ferr == nil {
+				ferr = fmt.Errorf("kafka: fetch %s/%d: %w", t, p, err)
+			}
+		})
+		if ferr != nil {
+			return ferr
+		}
+		for it := fetches.RecordIter(); !it.Done(); {
+			r := it.Next()
+			if _, ok := parts[r.Partition]; !ok {
+				continue
+			}
+			if r.Offset >= end[r.Partition]-1 {
+				delete(parts, r.Partition)
+			}
+			if r.Offset >= end[r.Partition] || r.Attrs.IsControl() {
+				continue
+			}
+			if err := fn(r); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// value decodes the value of a message into a row. A message without a
+// value, a tombstone, has no fields.
+func (k *Kafka) value(ctx context.Context, r *kgo.Record) (Row, error) {
+	at := func(err error) error { return fmt.Errorf("message %d/%d: %w", r.Partition, r.Offset, err) }
+	if k.format == "text" {
+		if r.Value == nil {
+			return Row{"_value": nil}, nil
+		}
+		return Row{"_value": text(r.Value)}, nil
+	}
+	if r.Value == nil {
+		return Row{}, nil
+	}
+	if k.format == "avro" {
+		id, b, err := kafka.Unframe(r.Value)
+		if err != nil {
+			return nil, at(err)
+		}
+		dec, err := k.decoder(ctx, id)
+		if err != nil {
+			return nil, at(err)
+		}
+		rec, err := dec.Decode(b)
+		if err != nil {
+			return nil, at(err)
+		}
+		row := make(Row, len(rec))
+		for f, v := range rec {
+			if v != nil {
+				v = checksum.Canonical(v)
+			}
+			row[f] = v
+		}
+		return row, nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(r.Value))
+	dec.UseNumber()
+	var obj map[string]interface{}
+	if err := dec.Decode(&obj); err != nil {
+		return nil, at(err)
+	}
+	if obj == nil {
+		return nil, at(errors.New("value is not a JSON object"))
+	}
+	row, err := jsonRow(obj)
+	if err != nil {
+		return nil, at(err)
+	}
+	return row, nil
+}
+
+func (k *Kafka) decoder(ctx context.Context, id int) (output.RecordDecoder, error) {
+	if d, ok := k.decoders[id]; ok {
+		return d, nil
+	}
+	schema, err := k.reg.Schema(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	d, err := output.NewAvroDecoder(schema)
+	if err != nil {
+		return nil, fmt.Errorf("schema %d: %w", id, err)
+	}
+	k.decoders[id] = d
+	return d, nil
+}
+
+func (k *Kafka) meta(row Row, r *kgo.Record) {
+	row["_key"] = nil
+	if r.Key != nil {
+		row["_key"] = text(r.Key)
+	}
+	row["_partition"] = strconv.Itoa(int(r.Partition))
+	row["_offset"] = strconv.FormatInt(r.Offset, 10)
+	row["_timestamp"] = checksum.Canonical(r.Timestamp)
+}
+
+// text reads message bytes as text, or as base64 when they are not UTF-8.
+func text(b []byte) string {
+	if utf8.Valid(b) {
+		return string(b)
+	}
+	return base64.StdEncoding.EncodeToString(b)
+}
@@ -0,0 +1,178 @@
+package source
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/Zubimendi/sync-loop/api/internal/egress"
+	"github.com/twmb/franz-go/pkg/kfake"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// kafkaFixture starts an in-process cluster with the topic "events" of two
+// partitions and returns a producer to it and the config of a source.
+func kafkaFixture(t *testing.T) (*kgo.Client, map[string]interface{}) {
+	t.Helper()
+	c, err := kfake.NewCluster(kfake.NumBrokers(1), kfake.SeedTopics(2, "events"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(c.Close)
+	p, err := kgo.NewClient(kgo.SeedBrokers(c.ListenAddrs()...), kgo.DefaultProduceTopic("events"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(p.Close)
+	return p, map[string]interface{}{"brokers": strings.Join(c.ListenAddrs(), ",")}
+}
+
+func produce(t *testing.T, p *kgo.Client, msgs ...[2]string) {
+	t.Helper()
+	for _, m := range msgs {
+		r := &kgo.Record{Value: []byte(m[1])}
+		if m[0] != "" {
+			r.Key = []byte(m[0])
+		}
+		if err := p.ProduceSync(context.Background(), r).FirstErr(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func openTestKafka(t *testing.T, cfg map[string]interface{}) *Kafka {
+	t.Helper()
+	k, err := OpenKafka(loopback(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { k.Close() })
+	return k
+}
+
+func readKafka(t *testing.T, k *Kafka, q Query) []Row {
+	t.Helper()
+	var rows []Row
+	if err := k.Read(loopback(), q, func(row Row) error {
+		rows = append(rows, row)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return rows
+}
+
+func TestKafkaRead(t *testing.T) {
+	p, cfg := kafkaFixture(t)
+	produce(t, p,
+		[2]string{"a", `{"id":1,"name":"ann","tags":["x"]}`},
+		[2]string{"b", `{"id":2,"name":null,"_offset":"shadowed"}`},
+		[2]string{"", `{"id":3}`},
+	)
+	k := openTestKafka(t, cfg)
+	tables, err := k.Tables(loopback())
+	if err != nil || len(tables) != 1 || tables[0] != "events" {
+		t.Errorf("tables = %v, %v", tables, err)
+	}
+	cols, err := k.Columns(loopback(), "events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, c := range cols {
+		names = append(names, c.Name)
+	}
+	if strings.Join(names, ",") != "_key,_partition,_offset,_timestamp,id,name,tags" {
+		t.Errorf("columns = %v", names)
+	}
+	rows := readKafka(t, k, Query{Table: "events"})
+	sort.Slice(rows, func(i, j int) bool { return rows[i]["id"].(string) < rows[j]["id"].(string) })
+	if len(rows) != 3 {
+		t.Fatalf("rows = %v", rows)
+	}
+	if rows[0]["_key"] != "a" || rows[0]["name"] != "ann" || rows[0]["tags"] != `["x"]` {
+		t.Errorf("row 1 = %v", rows[0])
+	}
+	if rows[1]["_offset"] == "shadowed" || rows[1]["name"] != nil {
+		t.Errorf("row 2 = %v", rows[1])
+	}
+	if rows[2]["_key"] != nil || rows[2]["tags"] != nil {
+		t.Errorf("row 3 = %v", rows[2])
+	}
+	if k.Checkpoint() != "" {
+		t.Errorf("a read without a job has checkpoint %s", k.Checkpoint())
+	}
+}
+
+func TestKafkaIncremental(t *testing.T) {
+	p, cfg := kafkaFixture(t)
+	produce(t, p, [2]string{"a", `{"id":1}`}, [2]string{"b", `{"id":2}`})
+	k := openTestKafka(t, cfg)
+	q := Query{Table: "events", JobID: "j1", Incremental: true}
+	if rows := readKafka(t, k, q); len(rows) != 2 {
+		t.Fatalf("first run read %d rows, want 2", len(rows))
+	}
+	// A run that failed to load commits nothing, and the next run reads
+	// the same messages again.
+	if rows := readKafka(t, k, q); len(rows) != 2 {
+		t.Fatalf("rerun read %d rows, want 2", len(rows))
+	}
+	if err := k.Commit(loopback(), k.Checkpoint()); err != nil {
+		t.Fatal(err)
+	}
+	produce(t, p, [2]string{"c", `{"id":3}`})
+	rows := readKafka(t, k, q)
+	if len(rows) != 1 || rows[0]["id"] != "3" {
+		t.Errorf("after commit read %v, want only id 3", rows)
+	}
+	// Full refreshes read from the start whatever was committed.
+	if rows := readKafka(t, k, Query{Table: "events", JobID: "j1"}); len(rows) != 3 {
+		t.Errorf("full refresh read %d rows, want 3", len(rows))
+	}
+}
+
+func TestKafkaText(t *testing.T) {
+	p, cfg := kafkaFixture(t)
+	produce(t, p, [2]string{"k", "plain text"}, [2]string{"", "\xff\xfe"})
+	cfg["value_format"] = "text"
+	rows := readKafka(t, openTestKafka(t, cfg), Query{Table: "events"})
+	var values []string
+	for _, r := range rows {
+		values = append(values, r["_value"].(string))
+	}
+	sort.Strings(values)
+	if strings.Join(values, "|") != "//4=|plain text" {
+		t.Errorf("values = %v", values)
+	}
+}
+
+func TestKafkaRefused(t *testing.T) {
+	p, cfg := kafkaFixture(t)
+	produce(t, p, [2]string{"", `[1,2]`})
+	k := openTestKafka(t, cfg)
+	if _, err := k.Columns(loopback(), "events"); err == nil || !strings.Contains(err.Error(), "cannot unmarshal array") {
+		t.Errorf("array value: err = %v", err)
+	}
+	if _, err := k.Columns(loopback(), "missing"); err == nil {
+		t.Error("a missing topic was read")
+	}
+	for key, want := range map[string]string{"value_format": "value_format", "brokers": "brokers"} {
+		bad := map[string]interface{}{"brokers": cfg["brokers"], key: "xml"}
+		if key == "brokers" {
+			bad[key] = ""
+		}
+		if _, err := OpenKafka(loopback(), bad); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("bad %s: err = %v", key, err)
+		}
+	}
+	blocked, err := OpenKafka(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer blocked.Close()
+	if _, err := blocked.Tables(context.Background()); !errors.Is(err, egress.ErrBlocked) {
+		t.Errorf("default egress: err = %v, want egress.ErrBlocked", err)
+	}
+}
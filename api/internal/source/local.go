@@ -0,0 +1,71 @@
+package source
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"strings"
+
+	"github.com/Zubimendi/sync-loop/api/internal/localfs"
+)
+
+// localStore lists and reads files of a directory on the worker, such as an
+// NFS mount, confined to it by localfs.
+type localStore struct {
+	dir *localfs.Dir
+}
+
+// OpenLocal builds a file source over a directory of the worker. Config
+// keys: root (see localfs.Open), prefix, pattern, plus the parsing keys of
+// OpenS3. Files carry no ETag, so incremental runs tell versions apart by
+// modification time and size. Directories whose names start with _ or .
+// are not listed.
+func OpenLocal(ctx context.Context, cfg map[string]interface{}) (*Files, error) {
+	dir, err := localfs.Open(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return newFiles(localStore{dir: dir}, cfg), nil
+}
+
+func (s localStore) list(ctx context.Context, prefix string) ([]Object, error) {
+	start := strings.TrimSuffix(prefix, "/")
+	if start == "" {
+		start = "."
+	}
+	var out []Object
+	err := fs.WalkDir(s.dir.FS(), start, func(p string, de fs.DirEntry, err error) error {
+		if err != nil {
+			if p == start && errors.Is(err, fs.ErrNotExist) {
+				return fs.SkipAll
+			}
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if de.IsDir() {
+			if p != start && (strings.HasPrefix(de.Name(), "_") || strings.HasPrefix(de.Name(), ".")) {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if !de.Type().IsRegular() {
+			return nil
+		}
+		fi, err := de.Info()
+		if err != nil {
+			return err
+		}
+		out = append(out, Object{Key: p, LastModified: fi.ModTime().UTC(), Size: fi.Size()})
+		return nil
+	})
+	return out, err
+}
+
+func (s localStore) open(ctx context.Context, key string) (io.ReadCloser, error) {
+	return s.dir.Open(key)
+}
+
+func (s localStore) Close() error { return s.dir.Close() }
@@ -0,0 +1,200 @@
+package source
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/Zubimendi/sync-loop/api/internal/model"
+	"github.com/go-sql-driver/mysql"
+	"github.com/jmoiron/sqlx"
+)
+
+type MySQL struct {
+	db     *sqlx.DB
+	net    string
+	tunnel io.Closer
+}
+
+// mysqlNets numbers the dial networks registered with the driver, which
+// only takes custom dialers by network name.
+var mysqlNets atomic.Int64
+
+// openMySQL connects to a connector's database. Config keys: dsn, or host,
+// port, user, password and database; plus the TLS keys of tlsFromConfig and
+// ssh_tunnel as for pg.
+func openMySQL(ctx context.Context, cfg map[string]interface{}) (*MySQL, error) {
+	mc := mysql.NewConfig()
+	if dsn := str(cfg, "dsn"); dsn != "" {
+		var err error
+		if mc, err = mysql.ParseDSN(dsn); err != nil {
+			return nil, fmt.Errorf("mysql dsn: %w", err)
+		}
+	} else {
+		host := str(cfg, "host")
+		if host == "" {
+			return nil, fmt.Errorf("mysql config needs dsn or host")
+		}
+		port := str(cfg, "port")
+		if port == "" {
+			port = "3306"
+		}
+		mc.User, mc.Passwd, mc.DBName = str(cfg, "user"), str(cfg, "password"), str(cfg, "database")
+		mc.Addr = net.JoinHostPort(host, port)
+	}
+	if mc.Net != "" && mc.Net != "tcp" {
+		return nil, fmt.Errorf("mysql: network %s is not supported", mc.Net)
+	}
+	mc.ParseTime, mc.Loc = true, time.UTC
+	opts, err := tlsFromConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if opts.set() {
+		if err := mysqlTLS(mc, opts); err != nil {
+			return nil, err
+		}
+	}
+	dial, tun, err := dbDialer(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	m := &MySQL{net: fmt.Sprintf("syncloop-%d", mysqlNets.Add(1)), tunnel: tun}
+	mysql.RegisterDialContext(m.net, func(ctx context.Context, addr string) (net.Conn, error) {
+		return dial(ctx, "tcp", addr)
+	})
+	mc.Net = m.net
+	c, err := mysql.NewConnector(mc)
+	if err != nil {
+		m.Close()
+		return nil, fmt.Errorf("mysql connect: %w", err)
+	}
+	m.db = sqlx.NewDb(sql.OpenDB(c), "mysql")
+	if err := m.db.PingContext(ctx); err != nil {
+		m.Close()
+		return nil, fmt.Errorf("mysql connect: %w", err)
+	}
+	return m, nil
+}
+
+// mysqlTLS applies TLS settings over any tls parameter of the dsn. A client
+// certificate without sslmode turns TLS on as require would.
+func mysqlTLS(mc *mysql.Config, o tlsOptions) error {
+	mc.AllowFallbackToPlaintext = o.Mode == "prefer"
+	if o.Mode == "disable" {
+		mc.TLS, mc.TLSConfig = nil, "false"
+		return nil
+	}
+	host, _, err := net.SplitHostPort(mc.Addr)
+	if err != nil {
+		host = mc.Addr
+	}
+	c, err := o.config(host)
+	if err != nil {
+		return err
+	}
+	mc.TLS, mc.TLSConfig = c, ""
+	return nil
+}
+
+// mysqlTypes maps MySQL column types to the Postgres ones the rest of the
+// pipeline speaks.
+var mysqlTypes = map[string]string{
+	"tinyint": "smallint", "smallint": "smallint", "mediumint": "integer",
+	"int": "integer", "integer": "integer", "bigint": "bigint",
+	"decimal": "numeric", "numeric": "numeric",
+	"float": "real", "double": "double precision",
+	"date": "date", "time": "time without time zone", "year": "integer",
+	"datetime": "timestamp without time zone", "timestamp": "timestamp with time zone",
+	"json": "jsonb", "bit": "bytea",
+	"binary": "bytea", "varbinary": "bytea",
+	"tinyblob": "bytea", "blob": "bytea", "mediumblob": "bytea", "longblob": "bytea",
+}
+
+// Columns reads the column list of a table, in the connection's database
+// unless the table is qualified.
+func (m *MySQL) Columns(ctx context.Context, table string) ([]model.Column, error) {
+	schemaName, name := "", table
+	if i := strings.IndexByte(table, '.'); i >= 0 {
+		schemaName, name = table[:i], table[i+1:]
+	}
+	var rows []struct {
+		Name     string `db:"column_name"`
+		Type     string `db:"data_type"`
+		Nullable bool   `db:"nullable"`
+		Prec     int    `db:"numeric_precision"`
+		Scale    int    `db:"numeric_scale"`
+	}
+	err := m.db.SelectContext(ctx, &rows, `
+		SELECT column_name AS column_name, data_type AS data_type, is_nullable = 'YES' AS nullable,
+		       CASE WHEN data_type IN ('decimal','numeric') THEN coalesce(numeric_precision, 0) ELSE 0 END AS numeric_precision,
+		       CASE WHEN data_type IN ('decimal','numeric') THEN coalesce(numeric_scale, 0) ELSE 0 END AS numeric_scale
+		FROM information_schema.columns
+		WHERE table_schema = coalesce(nullif(?, ''), database()) AND table_name = ?
+		ORDER BY ordinal_position`, schemaName, name)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("table %s not found", table)
+	}
+	cols := make([]model.Column, len(rows))
+	for i, r := range rows {
+		t, ok := mysqlTypes[strings.ToLower(r.Type)]
+		if !ok {
+			t = "text"
+		}
+		cols[i] = model.Column{Name: r.Name, Type: t, Nullable: r.Nullable, Precision: r.Prec, Scale: r.Scale}
+	}
+	return cols, nil
+}
+
+func (m *MySQL) Read(ctx context.Context, q Query, fn func(Row) error) error {
+	query := "SELECT * FROM " + quoteMySQL(q.Table)
+	var args []interface{}
+	if q.Incremental && !q.Since.IsZero() {
+		query += fmt.Sprintf(" WHERE %s > ?", quoteMySQL(q.CursorColumn))
+		args = append(args, q.Since)
+	}
+	rows, err := m.db.QueryxContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("query: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		raw := make(map[string]interface{})
+		if err := rows.MapScan(raw); err != nil {
+			return fmt.Errorf("scan row: %w", err)
+		}
+		if err := fn(canonicalRow(raw)); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (m *MySQL) Close() error {
+	var err error
+	if m.db != nil {
+		err = m.db.Close()
+	}
+	mysql.DeregisterDialContext(m.net)
+	if m.tunnel != nil {
+		m.tunnel.Close()
+	}
+	return err
+}
+
+// quoteMySQL quotes an optionally schema-qualified name with backticks.
+func quoteMySQL(name string) string {
+	parts := strings.Split(name, ".")
+	for i, p := range parts {
+		parts[i] = "`" + strings.ReplaceAll(p, "`", "``") + "`"
+	}
+	return strings.Join(parts, ".")
+}
@@ -0,0 +1,250 @@
+package source
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/Zubimendi/sync-loop/api/internal/checksum"
+	"github.com/Zubimendi/sync-loop/api/internal/model"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+type Postgres struct {
+	db       *sqlx.DB
+	tunnel   io.Closer
+	tlsFiles func()
+}
+
+func OpenPostgres(ctx context.Context, dsn string) (*Postgres, error) {
+	db, err := sqlx.ConnectContext(ctx, "postgres", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("postgres connect: %w", err)
+	}
+	return &Postgres{db: db}, nil
+}
+
+// openPostgresConnector connects to a connector's database through its SSH
+// tunnel, if any, or else under the egress policy of ctx. Config keys: those
+// of postgresDSN, the TLS keys of tlsFromConfig, and ssh_tunnel (host, port,
+// user, private_key, passphrase, password, host_key_fingerprint).
+func openPostgresConnector(ctx context.Context, cfg map[string]interface{}) (*Postgres, error) {
+	dsn, err := postgresDSN(cfg)
+	if err != nil {
+		return nil, err
+	}
+	opts, err := tlsFromConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	dial, tun, err := dbDialer(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	p := &Postgres{tunnel: tun}
+	files := map[string]string{}
+	if opts.set() {
+		if files, p.tlsFiles, err = opts.pemFiles(); err != nil {
+			p.Close()
+			return nil, fmt.Errorf("postgres tls: %w", err)
+		}
+	}
+	connect := func(mode string) error {
+		d, dl := dsn, dial
+		if opts.set() {
+			var err error
+			if d, dl, err = postgresTLS(dsn, opts, mode, files, dial); err != nil {
+				return err
+			}
+		}
+		c, err := pq.NewConnector(d)
+		if err != nil {
+			return err
+		}
+		c.Dialer(pqDialer(dl))
+		p.db = sqlx.NewDb(sql.OpenDB(c), "postgres")
+		return p.db.PingContext(ctx)
+	}
+	// lib/pq has no prefer mode: try TLS, then go without if the server
+	// has none.
+	if opts.Mode == "prefer" {
+		err = connect("require")
+		if errors.Is(err, pq.ErrSSLNotSupported) {
+			p.db.Close()
+			err = connect("disable")
+		}
+	} else {
+		err = connect(opts.Mode)
+	}
+	if err != nil {
+		p.Close()
+		return nil, fmt.Errorf("postgres connect: %w", err)
+	}
+	return p, nil
+}
+
+// postgresTLS adds TLS settings to a URL DSN. lib/pq verifies the server
+// certificate against the host it connects to, so a server name takes the
+// host's place and the returned dialer still reaches the real host.
+func postgresTLS(dsn string, o tlsOptions, mode string, files map[string]string, dial netDialer) (string, netDialer, error) {
+	u, err := url.Parse(dsn)
+	if err != nil || (u.Scheme != "postgres" && u.Scheme != "postgresql") {
+		return "", nil, fmt.Errorf("%w: ssl settings need host keys or a postgres:// dsn", ErrTLSConfig)
+	}
+	q := u.Query()
+	if mode != "" {
+		q.Set("sslmode", mode)
+	}
+	if mode != "disable" {
+		for k, v := range files {
+			q.Set(k, v)
+		}
+		if o.ServerName != "" {
+			port := u.Port()
+			if port == "" {
+				port = "5432"
+			}
+			real, alias := net.JoinHostPort(u.Hostname(), port), net.JoinHostPort(o.ServerName, port)
+			u.Host = alias
+			next := dial
+			dial = func(ctx context.Context, network, addr string) (net.Conn, error) {
+				if addr == alias {
+					addr = real
+				}
+				return next(ctx, network, addr)
+			}
+		}
+	}
+	u.RawQuery = q.Encode()
+	return u.String(), dial, nil
+}
+
+// postgresDSN accepts either a full "dsn" or discrete host/port/user/... keys.
+func postgresDSN(cfg map[string]interface{}) (string, error) {
+	if dsn := str(cfg, "dsn"); dsn != "" {
+		return dsn, nil
+	}
+	host := str(cfg, "host")
+	if host == "" {
+		return "", errors.New("pg config needs dsn or host")
+	}
+	port := str(cfg, "port")
+	if port == "" {
+		port = "5432"
+	}
+	u := url.URL{
+		Scheme: "postgres",
+		User:   url.UserPassword(str(cfg, "user"), str(cfg, "password")),
+		Host:   host + ":" + port,
+		Path:   "/" + str(cfg, "database"),
+	}
+	q := url.Values{}
+	if m := str(cfg, "sslmode"); m != "" {
+		q.Set("sslmode", m)
+	}
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// Columns reads the column list of a table. The table may be
+// schema-qualified; otherwise public is assumed.
+func (p *Postgres) Columns(ctx context.Context, table string) ([]model.Column, error) {
+	schemaName, name := "public", table
+	if i := strings.IndexByte(table, '.'); i >= 0 {
+		schemaName, name = table[:i], table[i+1:]
+	}
+	var rows []struct {
+		Name     string `db:"column_name"`
+		Type     string `db:"data_type"`
+		Nullable bool   `db:"nullable"`
+		Prec     int    `db:"numeric_precision"`
+		Scale    int    `db:"numeric_scale"`
+	}
+	err := p.db.SelectContext(ctx, &rows, `
+		SELECT column_name, data_type, is_nullable = 'YES' AS nullable,
+		       CASE WHEN data_type = 'numeric' THEN coalesce(numeric_precision, 0) ELSE 0 END AS numeric_precision,
+		       CASE WHEN data_type = 'numeric' THEN coalesce(numeric_scale, 0) ELSE 0 END AS numeric_scale
+		FROM information_schema.columns
+		WHERE table_schema = $1 AND table_name = $2
+		ORDER BY ordinal_position`, schemaName, name)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("table %s not found", table)
+	}
+	cols := make([]model.Column, len(rows))
+	for i, r := range rows {
+		cols[i] = model.Column{Name: r.Name, Type: r.Type, Nullable: r.Nullable, Precision: r.Prec, Scale: r.Scale}
+	}
+	return cols, nil
+}
+
+func (p *Postgres) Read(ctx context.Context, q Query, fn func(Row) error) error {
+	query := "SELECT * FROM " + QuoteTable(q.Table)
+	var args []interface{}
+	if q.Incremental && !q.Since.IsZero() {
+		query += fmt.Sprintf(" WHERE %s > $1", pq.QuoteIdentifier(q.CursorColumn))
+		args = append(args, q.Since)
+	}
+	rows, err := p.db.QueryxContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("query: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		raw := make(map[string]interface{})
+		if err := rows.MapScan(raw); err != nil {
+			return fmt.Errorf("scan row: %w", err)
+		}
+		if err := fn(canonicalRow(raw)); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// canonicalRow converts scanned values to checksum.Canonical strings,
+// keeping NULL as nil so typed destinations can still write NULL.
+func canonicalRow(raw map[string]interface{}) Row {
+	row := make(Row, len(raw))
+	for k, v := range raw {
+		if v == nil {
+			row[k] = nil
+		} else {
+			row[k] = checksum.Canonical(v)
+		}
+	}
+	return row
+}
+
+func (p *Postgres) DB() *sqlx.DB { return p.db }
+
+func (p *Postgres) Close() error {
+	var err error
+	if p.db != nil {
+		err = p.db.Close()
+	}
+	if p.tunnel != nil {
+		p.tunnel.Close()
+	}
+	if p.tlsFiles != nil {
+		p.tlsFiles()
+	}
+	return err
+}
+
+// QuoteTable quotes an optionally schema-qualified table name.
+func QuoteTable(table string) string {
+	parts := strings.Split(table, ".")
+	for i, part := range parts {
+		parts[i] = pq.QuoteIdentifier(part)
+	}
+	return strings.Join(parts, ".")
+}
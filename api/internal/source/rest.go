@@ -0,0 +1,676 @@
+package source
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Zubimendi/sync-loop/api/internal/egress"
+	"github.com/Zubimendi/sync-loop/api/internal/model"
+	"github.com/Zubimendi/sync-loop/api/internal/retry"
+	"golang.org/x/time/rate"
+)
+
+// REST reads JSON endpoints described by a declarative spec. A table names
+// one of the spec's streams, or else is a path under base_url read with the
+// spec's defaults. Records are the objects records_path selects from each
+// response; nested values are kept as JSON.
+type REST struct {
+	cfg     restConfig
+	base    *url.URL
+	client  *http.Client
+	limiter *rate.Limiter
+	schemas map[string][]model.Column
+
+	mu    sync.Mutex
+	token string
+	until time.Time
+}
+
+type restConfig struct {
+	BaseURL string            `json:"base_url"`
+	Headers map[string]string `json:"headers"`
+	Auth    restAuth          `json:"auth"`
+	// RateLimit caps requests per second; zero leaves it to Retry-After.
+	RateLimit  float64 `json:"rate_limit"`
+	MaxRetries *int    `json:"max_retries"`
+	restStream
+	Streams map[string]restStream `json:"streams"`
+}
+
+// restStream is what to read for one table. Fields a stream leaves empty
+// come from the top level of the spec.
+type restStream struct {
+	Path        string                 `json:"path"`
+	Params      map[string]interface{} `json:"params"`
+	RecordsPath string                 `json:"records_path"`
+	Pagination  *restPagination        `json:"pagination"`
+	Incremental *restIncremental       `json:"incremental"`
+}
+
+type restAuth struct {
+	Type string `json:"type"` // api_key | basic | bearer | oauth2
+	// api_key: sent in Header (X-API-Key), or as query parameter Param when
+	// In is query.
+	Key    string `json:"key"`
+	Header string `json:"header"`
+	In     string `json:"in"`
+	Param  string `json:"param"`
+	// basic
+	Username string `json:"username"`
+	Password string `json:"password"`
+	// bearer
+	Token string `json:"token"`
+	// oauth2 client credentials. ClientAuth is basic (the default) or body.
+	TokenURL     string   `json:"token_url"`
+	ClientID     string   `json:"client_id"`
+	ClientSecret string   `json:"client_secret"`
+	Scopes       []string `json:"scopes"`
+	ClientAuth   string   `json:"client_auth"`
+}
+
+type restPagination struct {
+	// Type is none | page | offset | cursor | next_link | link_header.
+	Type string `json:"type"`
+	// page: PageParam counts from StartPage. page and offset stop at a
+	// page shorter than PageSize, or an empty one.
+	PageParam string `json:"page_param"`
+	StartPage *int   `json:"start_page"`
+	SizeParam string `json:"size_param"`
+	PageSize  int    `json:"page_size"`
+	// offset
+	OffsetParam string `json:"offset_param"`
+	LimitParam  string `json:"limit_param"`
+	// cursor: the value at CursorPath is sent back as CursorParam.
+	CursorParam string `json:"cursor_param"`
+	CursorPath  string `json:"cursor_path"`
+	// next_link: the URL at NextPath is fetched next.
+	NextPath string `json:"next_path"`
+	// MaxPages bounds a read; zero reads until the last page.
+	MaxPages int `json:"max_pages"`
+}
+
+type restIncremental struct {
+	// Param carries the time of the last sync to the endpoint, spelled per
+	// Format: rfc3339 (default), unix, unix_ms, date or a Go layout.
+	Param  string `json:"param"`
+	Format string `json:"format"`
+}
+
+const (
+	restMaxRetries = 5
+	restMaxBackoff = 30 * time.Second
+)
+
+// OpenREST builds a REST source. Config keys: base_url, headers, auth,
+// rate_limit, max_retries, the stream keys (path, params, records_path,
+// pagination, incremental) as defaults, and streams, stream specs by table.
+func OpenREST(ctx context.Context, cfg map[string]interface{}) (*REST, error) {
+	b, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, err
+	}
+	var c restConfig
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, fmt.Errorf("rest source: %w", err)
+	}
+	base, err := url.Parse(c.BaseURL)
+	if err != nil || (base.Scheme != "http" && base.Scheme != "https") || base.Host == "" {
+		return nil, errors.New("rest source: base_url must be an http(s) URL")
+	}
+	if err := c.Auth.validate(); err != nil {
+		return nil, err
+	}
+	for name := range c.Streams {
+		if _, err := c.stream(name); err != nil {
+			return nil, fmt.Errorf("rest source: stream %s: %w", name, err)
+		}
+	}
+	if _, err := c.stream(""); err != nil {
+		return nil, fmt.Errorf("rest source: %w", err)
+	}
+	r := &REST{
+		cfg:     c,
+		base:    base,
+		client:  &http.Client{Timeout: time.Minute, Transport: egress.FromContext(ctx).Transport()},
+		limiter: rate.NewLimiter(rate.Inf, 1),
+		schemas: map[string][]model.Column{},
+	}
+	if c.RateLimit > 0 {
+		r.limiter = rate.NewLimiter(rate.Limit(c.RateLimit), 1)
+	}
+	return r, nil
+}
+
+func (a restAuth) validate() error {
+	switch a.Type {
+	case "", "none":
+	case "api_key":
+		if a.Key == "" {
+			return errors.New("rest source: api_key auth needs key")
+		}
+	case "basic":
+		if a.Username == "" {
+			return errors.New("rest source: basic auth needs username")
+		}
+	case "bearer":
+		if a.Token == "" {
+			return errors.New("rest source: bearer auth needs token")
+		}
+	case "oauth2":
+		if a.TokenURL == "" || a.ClientID == "" {
+			return errors.New("rest source: oauth2 auth needs token_url and client_id")
+		}
+	default:
+		return fmt.Errorf("rest source: unknown auth type %q", a.Type)
+	}
+	return nil
+}
+
+// stream resolves the spec of a table, filling what the stream leaves out
+// from the defaults.
+func (c restConfig) stream(table string) (restStream, error) {
+	s, ok := c.Streams[table]
+	if !ok {
+		s = restStream{Path: table}
+	}
+	if s.Path == "" {
+		s.Path = table
+	}
+	if s.RecordsPath == "" {
+		s.RecordsPath = c.RecordsPath
+	}
+	params := map[string]interface{}{}
+	for k, v := range c.Params {
+		params[k] = v
+	}
+	for k, v := range s.Params {
+		params[k] = v
+	}
+	s.Params = params
+	if s.Pagination == nil {
+		s.Pagination = c.Pagination
+	}
+	if s.Pagination == nil {
+		s.Pagination = &restPagination{}
+	}
+	if s.Incremental == nil {
+		s.Incremental = c.Incremental
+	}
+	if _, err := parseJSONPath(s.RecordsPath); err != nil {
+		return s, err
+	}
+	p := *s.Pagination
+	switch p.Type {
+	case "", "none", "link_header":
+	case "page":
+		if p.PageParam == "" {
+			p.PageParam = "page"
+		}
+		if p.StartPage == nil {
+			one := 1
+			p.StartPage = &one
+		}
+	case "offset":
+		if p.OffsetParam == "" {
+			p.OffsetParam = "offset"
+		}
+		if p.LimitParam == "" {
+			p.LimitParam = "limit"
+		}
+		if p.PageSize <= 0 {
+			p.PageSize = 100
+		}
+	case "cursor":
+		if p.CursorParam == "" || p.CursorPath == "" {
+			return s, errors.New("cursor pagination needs cursor_param and cursor_path")
+		}
+		if _, err := parseJSONPath(p.CursorPath); err != nil {
+			return s, err
+		}
+	case "next_link":
+		if p.NextPath == "" {
+			return s, errors.New("next_link pagination needs next_path")
+		}
+		if _, err := parseJSONPath(p.NextPath); err != nil {
+			return s, err
+		}
+	default:
+		return s, fmt.Errorf("unknown pagination type %q", p.Type)
+	}
+	s.Pagination = &p
+	return s, nil
+}
+
+// Columns infers a table's schema from its first records.
+func (r *REST) Columns(ctx context.Context, table string) ([]model.Column, error) {
+	if cols, ok := r.schemas[table]; ok {
+		return cols, nil
+	}
+	s, err := r.cfg.stream(table)
+	if err != nil {
+		return nil, err
+	}
+	if s.Path == "" {
+		return nil, errors.New("rest source: a table must name a stream or a path")
+	}
+	in := newInferrer()
+	var names []string
+	known := map[string]bool{}
+	n := 0
+	err = r.pages(ctx, s, Query{Table: table}, func(obj map[string]interface{}, row Row) error {
+		names = newKeys(names, known, obj)
+		structured := map[string]bool{}
+		for k, v := range row {
+			if _, ok := v.(jsonValue); ok {
+				structured[k] = true
+			}
+		}
+		in.add(row, structured)
+		if n++; n >= inferSampleRows {
+			return errSampled
+		}
+		return nil
+	})
+	if err != nil && err != errSampled {
+		return nil, err
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("rest source: %s returned no records to infer columns from", s.Path)
+	}
+	inferred := in.columns()
+	cols := make([]model.Column, len(names))
+	for i, name := range names {
+		cols[i] = inferred[name]
+	}
+	r.schemas[table] = cols
+	return cols, nil
+}
+
+// Read fetches every page of a table. Incremental reads send the time of the
+// last sync when the stream names a parameter for it, and drop records whose
+// cursor column is not newer, as a database source would.
+func (r *REST) Read(ctx context.Context, q Query, fn func(Row) error) error {
+	cols, err := r.Columns(ctx, q.Table)
+	if err != nil {
+		return err
+	}
+	s, err := r.cfg.stream(q.Table)
+	if err != nil {
+		return err
+	}
+	return r.pages(ctx, s, q, func(_ map[string]interface{}, row Row) error {
+		for k, v := range row {
+			if j, ok := v.(jsonValue); ok {
+				row[k] = string(j)
+			}
+		}
+		for _, c := range cols {
+			if _, ok := row[c.Name]; !ok {
+				row[c.Name] = nil
+			}
+		}
+		coerce(cols, row)
+		if q.Incremental && !q.Since.IsZero() {
+			if v, ok := row[q.CursorColumn].(string); ok {
+				if t, ok := parseTimestamp(v); ok && !t.After(q.Since) {
+					return nil
+				}
+			}
+		}
+		return fn(row)
+	})
+}
+
+func (r *REST) Close() error {
+	r.client.CloseIdleConnections()
+	return nil
+}
+
+// pages walks the pages of a stream, handing each record to fn.
+func (r *REST) pages(ctx context.Context, s restStream, q Query, fn func(map[string]interface{}, Row) error) error {
+	records, _ := parseJSONPath(s.RecordsPath)
+	p := s.Pagination
+	u, err := r.endpoint(s, q)
+	if err != nil {
+		return err
+	}
+	page, offset := 0, 0
+	if p.StartPage != nil {
+		page = *p.StartPage
+	}
+	cursors := map[string]bool{}
+	for n := 1; ; n++ {
+		params := u.Query()
+		switch p.Type {
+		case "page":
+			params.Set(p.PageParam, strconv.Itoa(page))
+			if p.SizeParam != "" && p.PageSize > 0 {
+				params.Set(p.SizeParam, strconv.Itoa(p.PageSize))
+			}
+			u.RawQuery = params.Encode()
+		case "offset":
+			params.Set(p.OffsetParam, strconv.Itoa(offset))
+			params.Set(p.LimitParam, strconv.Itoa(p.PageSize))
+			u.RawQuery = params.Encode()
+		}
+		body, header, err := r.get(ctx, u)
+		if err != nil {
+			return err
+		}
+		got := 0
+		for _, v := range records.find(body) {
+			vv, ok := v.([]interface{})
+			if !ok {
+				vv = []interface{}{v}
+			}
+			for _, rec := range vv {
+				obj, ok := rec.(map[string]interface{})
+				if !ok {
+					return fmt.Errorf("rest source: %s: record %d is not an object", u.Path, got+1)
+				}
+				got++
+				row, err := jsonRow(obj)
+				if err != nil {
+					return err
+				}
+				if err := fn(obj, row); err != nil {
+					return err
+				}
+			}
+		}
+		if p.MaxPages > 0 && n >= p.MaxPages {
+			return nil
+		}
+		switch p.Type {
+		case "page":
+			if got == 0 || (p.PageSize > 0 && got < p.PageSize) {
+				return nil
+			}
+			page++
+		case "offset":
+			if got < p.PageSize {
+				return nil
+			}
+			offset += got
+		case "cursor":
+			path, _ := parseJSONPath(p.CursorPath)
+			c := path.first(body)
+			if c == "" || got == 0 {
+				return nil
+			}
+			if cursors[c] {
+				return fmt.Errorf("rest source: %s: cursor %q came back twice", u.Path, c)
+			}
+			cursors[c] = true
+			params.Set(p.CursorParam, c)
+			u.RawQuery = params.Encode()
+		case "next_link", "link_header":
+			var next string
+			if p.Type == "next_link" {
+				path, _ := parseJSONPath(p.NextPath)
+				next = path.first(body)
+			} else {
+				next = nextLink(header.Values("Link"))
+			}
+			if next == "" {
+				return nil
+			}
+			if u, err = r.follow(u, next); err != nil {
+				return err
+			}
+			if cursors[u.String()] {
+				return fmt.Errorf("rest source: %s: next link points back to a page already read", u.Path)
+			}
+			cursors[u.String()] = true
+		default:
+			return nil
+		}
+	}
+}
+
+// endpoint is the URL of a stream's first page: its path under base_url
+// with the stream's parameters and, for incremental reads, the last sync.
+func (r *REST) endpoint(s restStream, q Query) (*url.URL, error) {
+	path, rawQuery, _ := strings.Cut(s.Path, "?")
+	u := *r.base
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + strings.TrimPrefix(path, "/")
+	u.RawPath = ""
+	params := u.Query()
+	extra, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return nil, fmt.Errorf("rest source: path %s: %w", s.Path, err)
+	}
+	for k, vv := range extra {
+		params[k] = vv
+	}
+	for k, v := range s.Params {
+		params.Set(k, fmt.Sprint(v))
+	}
+	if inc := s.Incremental; inc != nil && inc.Param != "" && q.Incremental && !q.Since.IsZero() {
+		params.Set(inc.Param, formatSince(q.Since, inc.Format))
+	}
+	if a := r.cfg.Auth; a.Type == "api_key" && a.In == "query" {
+		name := a.Param
+		if name == "" {
+			name = "api_key"
+		}
+		params.Set(name, a.Key)
+	}
+	u.RawQuery = params.Encode()
+	return &u, nil
+}
+
+func formatSince(t time.Time, format string) string {
+	t = t.UTC()
+	switch format {
+	case "", "rfc3339":
+		return t.Format(time.RFC3339)
+	case "unix":
+		return strconv.FormatInt(t.Unix(), 10)
+	case "unix_ms":
+		return strconv.FormatInt(t.UnixMilli(), 10)
+	case "date":
+		return t.Format("2006-01-02")
+	}
+	return t.Format(format)
+}
+
+// follow resolves a next link against the page it came from. Links must
+// stay on base_url's host, since every request carries the credentials.
+func (r *REST) follow(from *url.URL, link string) (*url.URL, error) {
+	ref, err := url.Parse(link)
+	if err != nil {
+		return nil, fmt.Errorf("rest source: next link %q: %w", link, err)
+	}
+	u := from.ResolveReference(ref)
+	if u.Scheme != r.base.Scheme || u.Host != r.base.Host {
+		return nil, fmt.Errorf("rest source: next link leaves %s", r.base.Host)
+	}
+	if a := r.cfg.Auth; a.Type == "api_key" && a.In == "query" {
+		name := a.Param
+		if name == "" {
+			name = "api_key"
+		}
+		params := u.Query()
+		params.Set(name, a.Key)
+		u.RawQuery = params.Encode()
+	}
+	return u, nil
+}
+
+// nextLink finds the rel="next" target of RFC 8288 Link headers.
+func nextLink(headers []string) string {
+	for _, h := range headers {
+		for _, link := range strings.Split(h, ",") {
+			parts := strings.Split(link, ";")
+			target := strings.TrimSpace(parts[0])
+			if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+				continue
+			}
+			for _, attr := range parts[1:] {
+				k, v, _ := strings.Cut(strings.TrimSpace(attr), "=")
+				if !strings.EqualFold(strings.TrimSpace(k), "rel") {
+					continue
+				}
+				for _, rel := range strings.Fields(strings.Trim(strings.TrimSpace(v), `"`)) {
+					if strings.EqualFold(rel, "next") {
+						return target[1 : len(target)-1]
+					}
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// get fetches and decodes one page. Rate limited (429) and unavailable (5xx)
+// answers, and failed connections, are retried after the Retry-After the
+// server asks for or an exponential backoff.
+func (r *REST) get(ctx context.Context, u *url.URL) (interface{}, http.Header, error) {
+	retries := restMaxRetries
+	if r.cfg.MaxRetries != nil {
+		retries = *r.cfg.MaxRetries
+	}
+	reauth := r.cfg.Auth.Type == "oauth2"
+	for attempt := 0; ; attempt++ {
+		if err := r.limiter.Wait(ctx); err != nil {
+			return nil, nil, err
+		}
+		resp, err := r.do(ctx, u)
+		if err != nil {
+			if ctx.Err() != nil || attempt >= retries {
+				return nil, nil, fmt.Errorf("rest source: GET %s: %w", u.Path, err)
+			}
+			if err := retry.Sleep(ctx, retry.Backoff(attempt, restMaxBackoff)); err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+		switch {
+		case resp.StatusCode == http.StatusUnauthorized && reauth:
+			// The token may have been revoked before it expired.
+			resp.Body.Close()
+			reauth = false
+			r.mu.Lock()
+			r.token = ""
+			r.mu.Unlock()
+			continue
+		case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+			wait := retry.After(resp.Header.Get("Retry-After"), retry.Backoff(attempt, restMaxBackoff))
+			resp.Body.Close()
+			if attempt >= retries {
+				return nil, nil, fmt.Errorf("rest source: GET %s: %s after %d retries", u.Path, resp.Status, retries)
+			}
+			if err := retry.Sleep(ctx, wait); err != nil {
+				return nil, nil, err
+			}
+			continue
+		case resp.StatusCode >= 300:
+			msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+			resp.Body.Close()
+			return nil, nil, fmt.Errorf("rest source: GET %s: %s: %s", u.Path, resp.Status, strings.TrimSpace(string(msg)))
+		}
+		dec := json.NewDecoder(resp.Body)
+		dec.UseNumber()
+		var body interface{}
+		err = dec.Decode(&body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, nil, fmt.Errorf("rest source: GET %s: decode: %w", u.Path, err)
+		}
+		return body, resp.Header, nil
+	}
+}
+
+func (r *REST) do(ctx context.Context, u *url.URL) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	for k, v := range r.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	switch a := r.cfg.Auth; a.Type {
+	case "api_key":
+		if a.In != "query" {
+			h := a.Header
+			if h == "" {
+				h = "X-API-Key"
+			}
+			req.Header.Set(h, a.Key)
+		}
+	case "basic":
+		req.SetBasicAuth(a.Username, a.Password)
+	case "bearer":
+		req.Header.Set("Authorization", "Bearer "+a.Token)
+	case "oauth2":
+		tok, err := r.accessToken(ctx)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+tok)
+	}
+	return r.client.Do(req)
+}
+
+// accessToken returns a client-credentials token, fetching a new one when
+// the cached one is about to expire.
+func (r *REST) accessToken(ctx context.Context) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.token != "" && time.Now().Before(r.until) {
+		return r.token, nil
+	}
+	a := r.cfg.Auth
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(a.Scopes) > 0 {
+		form.Set("scope", strings.Join(a.Scopes, " "))
+	}
+	if a.ClientAuth == "body" {
+		form.Set("client_id", a.ClientID)
+		form.Set("client_secret", a.ClientSecret)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if a.ClientAuth != "body" {
+		req.SetBasicAuth(url.QueryEscape(a.ClientID), url.QueryEscape(a.ClientSecret))
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("rest source: oauth2 token: %w", err)
+	}
+	defer resp.Body.Close()
+	var tok struct {
+		AccessToken string      `json:"access_token"`
+		ExpiresIn   json.Number `json:"expires_in"`
+		Error       string      `json:"error"`
+		Description string      `json:"error_description"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&tok); err != nil && resp.StatusCode < 300 {
+		return "", fmt.Errorf("rest source: oauth2 token: %w", err)
+	}
+	if resp.StatusCode >= 300 || tok.AccessToken == "" {
+		return "", fmt.Errorf("rest source: oauth2 token: %s %s %s", resp.Status, tok.Error, tok.Description)
+	}
+	r.token = tok.AccessToken
+	r.until = time.Now().Add(time.Hour)
+	if n, err := tok.ExpiresIn.Int64(); err == nil && n > 0 {
+		// Renew a little early so a token never expires mid-request.
+		r.until = time.Now().Add(time.Duration(n)*time.Second - min(30*time.Second, time.Duration(n)*time.Second/2))
+	}
+	return r.token, nil
+}
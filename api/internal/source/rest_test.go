@@ -0,0 +1,386 @@
+package source
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Zubimendi/sync-loop/api/internal/egress"
+)
+
+// loopback lets sources reach the test servers, which the default egress
+// policy refuses.
+func loopback() context.Context {
+	return egress.NewContext(context.Background(), egress.New([]netip.Prefix{netip.MustParsePrefix("127.0.0.0/8")}))
+}
+
+func openTestREST(t *testing.T, cfg map[string]interface{}) *REST {
+	t.Helper()
+	r, err := OpenREST(loopback(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { r.Close() })
+	return r
+}
+
+func readIDs(t *testing.T, r *REST, q Query) []string {
+	t.Helper()
+	var ids []string
+	err := r.Read(loopback(), q, func(row Row) error {
+		ids = append(ids, fmt.Sprint(row["id"]))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ids
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func TestRESTPagination(t *testing.T) {
+	items := []map[string]interface{}{}
+	for i := 1; i <= 5; i++ {
+		items = append(items, map[string]interface{}{"id": i, "name": "item " + strconv.Itoa(i), "tags": []string{"a"}})
+	}
+	page := func(start int) []map[string]interface{} {
+		return items[min(start, len(items)):min(start+2, len(items))]
+	}
+	for _, tc := range []struct {
+		name       string
+		pagination map[string]interface{}
+		serve      func(w http.ResponseWriter, r *http.Request)
+	}{
+		{
+			name:       "page",
+			pagination: map[string]interface{}{"type": "page", "size_param": "per_page", "page_size": 2},
+			serve: func(w http.ResponseWriter, r *http.Request) {
+				p, _ := strconv.Atoi(r.URL.Query().Get("page"))
+				if r.URL.Query().Get("per_page") != "2" {
+					http.Error(w, "per_page missing", http.StatusBadRequest)
+					return
+				}
+				writeJSON(w, map[string]interface{}{"data": page((p - 1) * 2)})
+			},
+		},
+		{
+			name:       "offset",
+			pagination: map[string]interface{}{"type": "offset", "page_size": 2},
+			serve: func(w http.ResponseWriter, r *http.Request) {
+				off, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+				writeJSON(w, map[string]interface{}{"data": page(off)})
+			},
+		},
+		{
+			name:       "cursor",
+			pagination: map[string]interface{}{"type": "cursor", "cursor_param": "after", "cursor_path": "$.meta.next"},
+			serve: func(w http.ResponseWriter, r *http.Request) {
+				start, _ := strconv.Atoi(r.URL.Query().Get("after"))
+				next := ""
+				if start+2 < len(items) {
+					next = strconv.Itoa(start + 2)
+				}
+				writeJSON(w, map[string]interface{}{"data": page(start), "meta": map[string]interface{}{"next": next}})
+			},
+		},
+		{
+			name:       "next_link",
+			pagination: map[string]interface{}{"type": "next_link", "next_path": "links.next"},
+			serve: func(w http.ResponseWriter, r *http.Request) {
+				start, _ := strconv.Atoi(r.URL.Query().Get("start"))
+				body := map[string]interface{}{"data": page(start), "links": map[string]interface{}{}}
+				if start+2 < len(items) {
+					body["links"] = map[string]interface{}{"next": fmt.Sprintf("/v1/items?start=%d", start+2)}
+				}
+				writeJSON(w, body)
+			},
+		},
+		{
+			name:       "link_header",
+			pagination: map[string]interface{}{"type": "link_header"},
+			serve: func(w http.ResponseWriter, r *http.Request) {
+				start, _ := strconv.Atoi(r.URL.Query().Get("start"))
+				if start+2 < len(items) {
+					w.Header().Add("Link", fmt.Sprintf(`</v1/items?start=%d>; rel="next", </v1/items>; rel="first"`, start+2))
+				}
+				writeJSON(w, map[string]interface{}{"data": page(start)})
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/v1/items" || r.Header.Get("Authorization") != "Bearer secret" || r.Header.Get("X-Tenant") != "acme" {
+					http.Error(w, "unexpected request", http.StatusBadRequest)
+					return
+				}
+				tc.serve(w, r)
+			}))
+			defer srv.Close()
+			r := openTestREST(t, map[string]interface{}{
+				"base_url": srv.URL + "/v1",
+				"headers":  map[string]interface{}{"X-Tenant": "acme"},
+				"auth":     map[string]interface{}{"type": "bearer", "token": "secret"},
+				"streams": map[string]interface{}{
+					"items": map[string]interface{}{"records_path": "$.data", "pagination": tc.pagination},
+				},
+			})
+			cols, err := r.Columns(loopback(), "items")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(cols) != 3 || cols[0].Name != "id" || cols[0].Type != "bigint" || cols[2].Type != "jsonb" {
+				t.Errorf("columns = %+v", cols)
+			}
+			if got := strings.Join(readIDs(t, r, Query{Table: "items"}), ","); got != "1,2,3,4,5" {
+				t.Errorf("ids = %s, want 1,2,3,4,5", got)
+			}
+		})
+	}
+}
+
+func TestRESTAuth(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		auth map[string]interface{}
+		ok   func(r *http.Request) bool
+	}{
+		{
+			name: "api_key header",
+			auth: map[string]interface{}{"type": "api_key", "key": "k1", "header": "X-Key"},
+			ok:   func(r *http.Request) bool { return r.Header.Get("X-Key") == "k1" },
+		},
+		{
+			name: "api_key query",
+			auth: map[string]interface{}{"type": "api_key", "key": "k1", "in": "query", "param": "token"},
+			ok:   func(r *http.Request) bool { return r.URL.Query().Get("token") == "k1" },
+		},
+		{
+			name: "basic",
+			auth: map[string]interface{}{"type": "basic", "username": "ann", "password": "pw"},
+			ok: func(r *http.Request) bool {
+				u, p, ok := r.BasicAuth()
+				return ok && u == "ann" && p == "pw"
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if !tc.ok(r) {
+					http.Error(w, "who are you", http.StatusUnauthorized)
+					return
+				}
+				writeJSON(w, []map[string]interface{}{{"id": 1}})
+			}))
+			defer srv.Close()
+			r := openTestREST(t, map[string]interface{}{"base_url": srv.URL, "auth": tc.auth})
+			if got := readIDs(t, r, Query{Table: "items"}); len(got) != 1 {
+				t.Errorf("ids = %v", got)
+			}
+		})
+	}
+}
+
+// TestRESTOAuth2 fetches a client-credentials token and fetches a new one
+// when the API revokes it.
+func TestRESTOAuth2(t *testing.T) {
+	var issued atomic.Int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		id, secret, _ := r.BasicAuth()
+		if r.Method != http.MethodPost || id != "app" || secret != "s3cret" ||
+			r.FormValue("grant_type") != "client_credentials" || r.FormValue("scope") != "read write" {
+			w.WriteHeader(http.StatusBadRequest)
+			writeJSON(w, map[string]interface{}{"error": "invalid_client"})
+			return
+		}
+		writeJSON(w, map[string]interface{}{"access_token": fmt.Sprintf("t%d", issued.Add(1)), "expires_in": 3600})
+	})
+	mux.HandleFunc("/items", func(w http.ResponseWriter, r *http.Request) {
+		// The first token is revoked.
+		if r.Header.Get("Authorization") != "Bearer t2" {
+			http.Error(w, "token revoked", http.StatusUnauthorized)
+			return
+		}
+		writeJSON(w, []map[string]interface{}{{"id": 1}, {"id": 2}})
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	r := openTestREST(t, map[string]interface{}{
+		"base_url": srv.URL,
+		"auth": map[string]interface{}{
+			"type": "oauth2", "token_url": srv.URL + "/token", "client_id": "app", "client_secret": "s3cret",
+			"scopes": []string{"read", "write"},
+		},
+	})
+	if got := readIDs(t, r, Query{Table: "items"}); len(got) != 2 {
+		t.Errorf("ids = %v", got)
+	}
+	if n := issued.Load(); n != 2 {
+		t.Errorf("%d tokens issued, want 2: one revoked, then one cached", n)
+	}
+}
+
+func TestRESTRetries(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch calls.Add(1) {
+		case 1, 2:
+			w.Header().Set("Retry-After", "0")
+			http.Error(w, "slow down", http.StatusTooManyRequests)
+		case 3:
+			w.Header().Set("Retry-After", "0")
+			http.Error(w, "try later", http.StatusServiceUnavailable)
+		default:
+			writeJSON(w, []map[string]interface{}{{"id": 1}})
+		}
+	}))
+	defer srv.Close()
+	r := openTestREST(t, map[string]interface{}{"base_url": srv.URL})
+	if _, err := r.Columns(loopback(), "items"); err != nil {
+		t.Fatal(err)
+	}
+	if n := calls.Load(); n != 4 {
+		t.Errorf("%d requests, want 4", n)
+	}
+}
+
+func TestRESTRetriesGiveUp(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Retry-After", "0")
+		http.Error(w, "down", http.StatusBadGateway)
+	}))
+	defer srv.Close()
+	r := openTestREST(t, map[string]interface{}{"base_url": srv.URL, "max_retries": 2})
+	_, err := r.Columns(loopback(), "items")
+	if err == nil || !strings.Contains(err.Error(), "502 Bad Gateway after 2 retries") {
+		t.Errorf("err = %v", err)
+	}
+	if n := calls.Load(); n != 3 {
+		t.Errorf("%d requests, want 3", n)
+	}
+}
+
+func TestRESTErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		spec  map[string]interface{}
+		serve func(w http.ResponseWriter, r *http.Request)
+		want  string
+	}{
+		{
+			name: "client error",
+			serve: func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, "no such stream", http.StatusNotFound)
+			},
+			want: "404 Not Found: no such stream",
+		},
+		{
+			name: "not json",
+			serve: func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("<html>"))
+			},
+			want: "decode",
+		},
+		{
+			name: "record not an object",
+			spec: map[string]interface{}{"records_path": "data"},
+			serve: func(w http.ResponseWriter, r *http.Request) {
+				writeJSON(w, map[string]interface{}{"data": []interface{}{map[string]interface{}{"id": 1}, 2}})
+			},
+			want: "record 2 is not an object",
+		},
+		{
+			name: "repeated cursor",
+			spec: map[string]interface{}{"pagination": map[string]interface{}{"type": "cursor", "cursor_param": "c", "cursor_path": "next"}},
+			serve: func(w http.ResponseWriter, r *http.Request) {
+				writeJSON(w, map[string]interface{}{"next": "same", "items": []interface{}{map[string]interface{}{"id": 1}}})
+			},
+			want: `cursor "same" came back twice`,
+		},
+		{
+			name: "next link to another host",
+			spec: map[string]interface{}{"pagination": map[string]interface{}{"type": "link_header"}},
+			serve: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Link", `<https://elsewhere.example/items?page=2>; rel="next"`)
+				writeJSON(w, []map[string]interface{}{{"id": 1}})
+			},
+			want: "next link leaves",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var calls atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls.Add(1)
+				tc.serve(w, r)
+			}))
+			defer srv.Close()
+			cfg := map[string]interface{}{"base_url": srv.URL}
+			for k, v := range tc.spec {
+				cfg[k] = v
+			}
+			r := openTestREST(t, cfg)
+			_, err := r.Columns(loopback(), "items")
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("err = %v, want one with %q", err, tc.want)
+			}
+			if tc.name == "client error" && calls.Load() != 1 {
+				t.Errorf("a 404 was retried: %d requests", calls.Load())
+			}
+		})
+	}
+}
+
+func TestRESTEgressBlocked(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("request reached a refused address")
+	}))
+	defer srv.Close()
+	r, err := OpenREST(context.Background(), map[string]interface{}{"base_url": srv.URL, "max_retries": 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if _, err := r.Columns(context.Background(), "items"); !errors.Is(err, egress.ErrBlocked) {
+		t.Errorf("err = %v, want egress.ErrBlocked", err)
+	}
+}
+
+func TestRESTIncremental(t *testing.T) {
+	since := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("updated_since") != strconv.FormatInt(since.Unix(), 10) && r.URL.Query().Get("updated_since") != "" {
+			http.Error(w, "bad updated_since", http.StatusBadRequest)
+			return
+		}
+		// The endpoint's filter is coarse, so an old record comes back too.
+		writeJSON(w, []map[string]interface{}{
+			{"id": 1, "updated_at": "2024-04-30T23:59:59Z"},
+			{"id": 2, "updated_at": "2024-05-01T00:00:00Z"},
+			{"id": 3, "updated_at": "2024-05-01T00:00:01Z"},
+		})
+	}))
+	defer srv.Close()
+	r := openTestREST(t, map[string]interface{}{
+		"base_url":    srv.URL,
+		"incremental": map[string]interface{}{"param": "updated_since", "format": "unix"},
+	})
+	got := readIDs(t, r, Query{Table: "items", Incremental: true, CursorColumn: "updated_at", Since: since})
+	if strings.Join(got, ",") != "3" {
+		t.Errorf("ids = %v, want only 3", got)
+	}
+}
@@ -0,0 +1,71 @@
+package source
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"github.com/Zubimendi/sync-loop/api/internal/egress"
+	"github.com/Zubimendi/sync-loop/api/internal/storage"
+)
+
+// s3Store lists and reads objects of any S3-compatible bucket, MinIO
+// included.
+type s3Store struct {
+	store *storage.Store
+}
+
+// OpenS3 builds a file source over a bucket. Config keys: endpoint, region,
+// access_key, secret_key, bucket, prefix, pattern, plus the parsing keys of
+// FileOptions (format, delimiter, header, sheet, range, header_row) and
+// types, a map of column names to one of ColumnTypes.
+// Credentials are required so a connector can never fall back to the
+// worker's own bucket keys.
+func OpenS3(ctx context.Context, cfg map[string]interface{}) (*Files, error) {
+	if str(cfg, "bucket") == "" || str(cfg, "access_key") == "" || str(cfg, "secret_key") == "" {
+		return nil, errors.New("s3 source: bucket, access_key and secret_key are required")
+	}
+	st, err := storage.New(ctx, storage.Options{
+		Endpoint:  str(cfg, "endpoint"),
+		Region:    str(cfg, "region"),
+		AccessKey: str(cfg, "access_key"),
+		SecretKey: str(cfg, "secret_key"),
+		Bucket:    str(cfg, "bucket"),
+		Dial:      egress.FromContext(ctx).DialContext,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return newFiles(s3Store{store: st}, cfg), nil
+}
+
+func (s s3Store) list(ctx context.Context, prefix string) ([]Object, error) {
+	objs, err := s.store.List(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Object, len(objs))
+	for i, o := range objs {
+		out[i] = Object(o)
+	}
+	return out, nil
+}
+
+func (s s3Store) open(ctx context.Context, key string) (io.ReadCloser, error) {
+	return s.store.Get(ctx, key)
+}
+
+// OpenExcel reads workbooks from a bucket as OpenS3 does, every file parsed
+// as xlsx. A table can pick its own sheet and range, as in
+// reports/*.xlsx#Budget!B3:H200.
+func OpenExcel(ctx context.Context, cfg map[string]interface{}) (*Files, error) {
+	c := make(map[string]interface{}, len(cfg)+2)
+	for k, v := range cfg {
+		c[k] = v
+	}
+	c["format"] = "xlsx"
+	if str(c, "pattern") == "" {
+		c["pattern"] = "**/*.xlsx"
+	}
+	return OpenS3(ctx, c)
+}
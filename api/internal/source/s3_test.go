@@ -0,0 +1,101 @@
+package source
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/Zubimendi/sync-loop/api/internal/egress"
+	"github.com/Zubimendi/sync-loop/api/internal/miniotest"
+)
+
+func TestS3Read(t *testing.T) {
+	b := miniotest.New(t)
+	for key, body := range map[string]string{
+		"in/2024/01/orders.csv":   "id,amount\n1,9.50\n2,3\n",
+		"in/2024/02/orders.csv":   "id,amount\n3,\n",
+		"in/2024/02/_partial.csv": "id,amount\n99,0\n",
+		"in/2024/readme.md":       "not data",
+		"in/events.jsonl":         `{"id":1,"tags":["a"]}` + "\n" + `{"id":2,"tags":null}` + "\n",
+		"other/orders.csv":        "id,amount\n98,0\n",
+	} {
+		b.Put(t, key, body)
+	}
+	cfg := b.Config()
+	cfg["prefix"] = "/in/"
+	s, err := OpenS3(miniotest.Context(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	ctx := miniotest.Context()
+
+	objs, err := s.Objects(ctx, "**/*.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for _, o := range objs {
+		keys = append(keys, o.Key)
+		if o.ETag == "" || o.Size == 0 || o.LastModified.IsZero() {
+			t.Errorf("%s has no version: %+v", o.Key, o)
+		}
+	}
+	if strings.Join(keys, ",") != "in/2024/01/orders.csv,in/2024/02/orders.csv" {
+		t.Errorf("keys = %v", keys)
+	}
+	cols, err := s.Columns(ctx, "2024/*/orders.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cols) != 2 || cols[0].Type != "bigint" || cols[1].Type != "numeric" || !cols[1].Nullable {
+		t.Errorf("columns = %+v", cols)
+	}
+	var ids []string
+	if err := s.Read(ctx, Query{Table: "**/*.csv"}, func(row Row) error {
+		ids = append(ids, row["id"].(string))
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(ids)
+	if strings.Join(ids, ",") != "1,2,3" {
+		t.Errorf("ids = %v", ids)
+	}
+	var tags []interface{}
+	if err := s.Read(ctx, Query{Table: "*.jsonl"}, func(row Row) error {
+		tags = append(tags, row["tags"])
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(tags) != 2 || tags[0] != `["a"]` || tags[1] != nil {
+		t.Errorf("tags = %v", tags)
+	}
+}
+
+func TestS3Refused(t *testing.T) {
+	b := miniotest.New(t)
+	cfg := b.Config()
+	delete(cfg, "secret_key")
+	if _, err := OpenS3(miniotest.Context(), cfg); err == nil || !strings.Contains(err.Error(), "secret_key") {
+		t.Errorf("no secret_key: err = %v", err)
+	}
+	cfg["secret_key"] = "guess"
+	s, err := OpenS3(miniotest.Context(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Objects(miniotest.Context(), "**"); err == nil {
+		t.Error("a wrong secret_key listed the bucket")
+	}
+	s, err = OpenS3(context.Background(), b.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Objects(context.Background(), "**"); !errors.Is(err, egress.ErrBlocked) {
+		t.Errorf("default egress: err = %v, want egress.ErrBlocked", err)
+	}
+}
@@ -0,0 +1,631 @@
+package source
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Zubimendi/sync-loop/api/internal/checksum"
+	"github.com/Zubimendi/sync-loop/api/internal/egress"
+	"github.com/Zubimendi/sync-loop/api/internal/model"
+	"github.com/Zubimendi/sync-loop/api/internal/retry"
+)
+
+const (
+	sfLoginURL      = "https://login.salesforce.com"
+	sfAPIVersion    = "59.0"
+	sfBulkThreshold = 50000
+	sfBulkPageSize  = 50000
+	sfPollMin       = 500 * time.Millisecond
+	sfPollMax       = 15 * time.Second
+	// sfCursor is the change cursor of an object when a job names none; it
+	// moves on deletes as well as updates.
+	sfCursor = "SystemModstamp"
+)
+
+// sfTimeLayout reads the datetimes of both APIs: +0000 from the REST API,
+// Z from Bulk API results.
+const sfTimeLayout = "2006-01-02T15:04:05.999999999Z0700"
+
+// Salesforce reads sObjects; a table names one, such as Account. Small reads
+// page through the REST query API and large ones run a Bulk API 2.0 query
+// job. Incremental reads use queryAll, so records deleted since the last
+// sync (and still in the recycle bin) come through with IsDeleted true.
+type Salesforce struct {
+	cfg     sfConfig
+	client  *http.Client
+	schemas map[string]*sfObject
+
+	mu       sync.Mutex
+	token    string
+	instance *url.URL
+}
+
+type sfConfig struct {
+	// InstanceURL is where the API calls go, such as
+	// https://acme.my.salesforce.com. When empty it comes from the token
+	// response.
+	InstanceURL string `json:"instance_url"`
+	// LoginURL is the authorization server the refresh token is traded at;
+	// https://test.salesforce.com for sandboxes.
+	LoginURL     string `json:"login_url"`
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	RefreshToken string `json:"refresh_token"`
+	// AccessToken is used as is when there is no refresh token.
+	AccessToken string `json:"access_token"`
+	APIVersion  string `json:"api_version"`
+	// Bulk is auto (a Bulk API job when a read counts at least
+	// BulkThreshold records), always or never.
+	Bulk          string `json:"bulk"`
+	BulkThreshold int    `json:"bulk_threshold"`
+	MaxRetries    *int   `json:"max_retries"`
+}
+
+// sfObject is the part of a describe a read needs.
+type sfObject struct {
+	name   string
+	fields []string
+	cols   []model.Column
+	byName map[string]string // lower-cased field name to field name
+}
+
+func (o *sfObject) field(name string) (string, bool) {
+	f, ok := o.byName[strings.ToLower(name)]
+	return f, ok
+}
+
+// OpenSalesforce builds a Salesforce source and checks it can reach the
+// API. Config keys: instance_url, login_url, client_id, client_secret,
+// refresh_token, access_token, api_version, bulk, bulk_threshold and
+// max_retries.
+func OpenSalesforce(ctx context.Context, cfg map[string]interface{}) (*Salesforce, error) {
+	b, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, err
+	}
+	var c sfConfig
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, fmt.Errorf("sf source: %w", err)
+	}
+	if c.LoginURL == "" {
+		c.LoginURL = sfLoginURL
+	}
+	if c.APIVersion == "" {
+		c.APIVersion = sfAPIVersion
+	}
+	c.APIVersion = strings.TrimPrefix(c.APIVersion, "v")
+	if c.BulkThreshold <= 0 {
+		c.BulkThreshold = sfBulkThreshold
+	}
+	switch c.Bulk {
+	case "":
+		c.Bulk = "auto"
+	case "auto", "always", "never":
+	default:
+		return nil, fmt.Errorf("sf source: bulk %q is not auto, always or never", c.Bulk)
+	}
+	switch {
+	case c.RefreshToken != "" && c.ClientID == "":
+		return nil, errors.New("sf source: refresh_token needs client_id")
+	case c.RefreshToken == "" && c.AccessToken == "":
+		return nil, errors.New("sf source: refresh_token or access_token is required")
+	case c.RefreshToken == "" && c.InstanceURL == "":
+		return nil, errors.New("sf source: access_token needs instance_url")
+	}
+	s := &Salesforce{
+		cfg:     c,
+		client:  &http.Client{Timeout: 5 * time.Minute, Transport: egress.FromContext(ctx).Transport()},
+		schemas: map[string]*sfObject{},
+		token:   c.AccessToken,
+	}
+	if c.InstanceURL != "" {
+		if s.instance, err = sfURL(c.InstanceURL); err != nil {
+			return nil, fmt.Errorf("sf source: instance_url: %w", err)
+		}
+	}
+	if _, err := sfURL(c.LoginURL); err != nil {
+		return nil, fmt.Errorf("sf source: login_url: %w", err)
+	}
+	// The version list is cheap and proves the credentials work.
+	var versions []struct {
+		Version string `json:"version"`
+	}
+	if err := s.getJSON(ctx, "/services/data/", nil, &versions); err != nil {
+		s.Close()
+		return nil, err
+	}
+	for _, v := range versions {
+		if v.Version == c.APIVersion {
+			return s, nil
+		}
+	}
+	s.Close()
+	return nil, fmt.Errorf("sf source: the org does not offer API version %s", c.APIVersion)
+}
+
+func sfURL(s string) (*url.URL, error) {
+	u, err := url.Parse(strings.TrimRight(s, "/"))
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return nil, fmt.Errorf("%q is not an http(s) URL", s)
+	}
+	return u, nil
+}
+
+func (s *Salesforce) data(path string) string {
+	return "/services/data/v" + s.cfg.APIVersion + path
+}
+
+// DefaultCursor is the cursor of incremental reads whose job names none.
+func (s *Salesforce) DefaultCursor() string { return sfCursor }
+
+// Tables lists the objects that can be queried.
+func (s *Salesforce) Tables(ctx context.Context) ([]string, error) {
+	var out struct {
+		SObjects []struct {
+			Name      string `json:"name"`
+			Queryable bool   `json:"queryable"`
+		} `json:"sobjects"`
+	}
+	if err := s.getJSON(ctx, s.data("/sobjects"), nil, &out); err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(out.SObjects))
+	for _, o := range out.SObjects {
+		if o.Queryable {
+			names = append(names, o.Name)
+		}
+	}
+	return names, nil
+}
+
+func (s *Salesforce) Columns(ctx context.Context, table string) ([]model.Column, error) {
+	o, err := s.describe(ctx, table)
+	if err != nil {
+		return nil, err
+	}
+	return o.cols, nil
+}
+
+// describe reads an object's fields. Compound address and location fields
+// are left out, as the Bulk API cannot query them; their parts are fields
+// of their own. So are base64 fields, which it cannot return either.
+func (s *Salesforce) describe(ctx context.Context, table string) (*sfObject, error) {
+	if o, ok := s.schemas[table]; ok {
+		return o, nil
+	}
+	if table == "" {
+		return nil, errors.New("sf source: a table must name an object")
+	}
+	var d struct {
+		Name      string `json:"name"`
+		Queryable bool   `json:"queryable"`
+		Fields    []struct {
+			Name      string `json:"name"`
+			Type      string `json:"type"`
+			Nillable  bool   `json:"nillable"`
+			Precision int    `json:"precision"`
+			Scale     int    `json:"scale"`
+		} `json:"fields"`
+	}
+	if err := s.getJSON(ctx, s.data("/sobjects/"+url.PathEscape(table)+"/describe"), nil, &d); err != nil {
+		return nil, err
+	}
+	if !d.Queryable {
+		return nil, fmt.Errorf("sf source: %s cannot be queried", d.Name)
+	}
+	o := &sfObject{name: d.Name, byName: map[string]string{}}
+	for _, f := range d.Fields {
+		c := model.Column{Name: f.Name, Type: "text", Nullable: f.Nillable}
+		switch f.Type {
+		case "address", "location", "base64":
+			continue
+		case "boolean":
+			c.Type = "boolean"
+		case "int":
+			c.Type = "bigint"
+		case "double", "currency", "percent":
+			c.Type, c.Precision, c.Scale = "numeric", f.Precision, f.Scale
+		case "date":
+			c.Type = "date"
+		case "datetime":
+			c.Type = "timestamp with time zone"
+		}
+		o.fields = append(o.fields, f.Name)
+		o.cols = append(o.cols, c)
+		o.byName[strings.ToLower(f.Name)] = f.Name
+	}
+	if len(o.fields) == 0 {
+		return nil, fmt.Errorf("sf source: %s has no fields to read", d.Name)
+	}
+	s.schemas[table] = o
+	return o, nil
+}
+
+// Read queries every field of an object. Incremental reads filter on the
+// cursor field in SOQL and drop records not newer than the last sync, as
+// SOQL datetimes carry no fractions of a second.
+func (s *Salesforce) Read(ctx context.Context, q Query, fn func(Row) error) error {
+	o, err := s.describe(ctx, q.Table)
+	if err != nil {
+		return err
+	}
+	op, where := "query", ""
+	var cursor string
+	if q.Incremental && !q.Since.IsZero() {
+		var ok bool
+		if cursor, ok = o.field(q.CursorColumn); !ok {
+			return fmt.Errorf("sf source: %s has no field %s to sync incrementally on", o.name, q.CursorColumn)
+		}
+		where = " WHERE " + cursor + " > " + q.Since.UTC().Truncate(time.Second).Format("2006-01-02T15:04:05Z")
+		if _, ok := o.field("IsDeleted"); ok {
+			op = "queryAll"
+		}
+	}
+	soql := "SELECT " + strings.Join(o.fields, ", ") + " FROM " + o.name + where
+	emit := func(row Row) error {
+		s.normalize(o, row)
+		if cursor != "" {
+			if v, ok := row[cursor].(string); ok {
+				if t, err := time.Parse(time.RFC3339Nano, v); err == nil && !t.After(q.Since) {
+					return nil
+				}
+			}
+		}
+		return fn(row)
+	}
+	bulk := s.cfg.Bulk == "always"
+	if s.cfg.Bulk == "auto" {
+		n, err := s.count(ctx, op, "SELECT COUNT() FROM "+o.name+where)
+		if err != nil {
+			return err
+		}
+		bulk = n >= s.cfg.BulkThreshold
+	}
+	if bulk {
+		return s.bulkQuery(ctx, op, o, soql, emit)
+	}
+	return s.restQuery(ctx, op, o, soql, emit)
+}
+
+// count runs a SELECT COUNT() query.
+func (s *Salesforce) count(ctx context.Context, op, soql string) (int, error) {
+	var out struct {
+		TotalSize int `json:"totalSize"`
+	}
+	if err := s.getJSON(ctx, s.data("/"+op+"/"), url.Values{"q": {soql}}, &out); err != nil {
+		return 0, err
+	}
+	return out.TotalSize, nil
+}
+
+// normalize puts a record's values in canonical form: NULL for blanks,
+// datetimes in UTC and numbers without exponents.
+func (s *Salesforce) normalize(o *sfObject, row Row) {
+	for _, c := range o.cols {
+		v, ok := row[c.Name].(string)
+		if !ok || v == "" {
+			row[c.Name] = nil
+			continue
+		}
+		switch c.Type {
+		case "timestamp with time zone":
+			if t, err := time.Parse(sfTimeLayout, v); err == nil {
+				row[c.Name] = checksum.Canonical(t)
+			}
+		case "numeric", "bigint":
+			if strings.ContainsAny(v, "eE") {
+				if f, err := strconv.ParseFloat(v, 64); err == nil {
+					row[c.Name] = strconv.FormatFloat(f, 'f', -1, 64)
+				}
+			}
+		case "boolean":
+			row[c.Name] = strings.ToLower(v)
+		}
+	}
+}
+
+// restQuery pages through the REST query API.
+func (s *Salesforce) restQuery(ctx context.Context, op string, o *sfObject, soql string, fn func(Row) error) error {
+	path, params := s.data("/"+op+"/"), url.Values{"q": {soql}}
+	for {
+		var page struct {
+			Done           bool                     `json:"done"`
+			NextRecordsURL string                   `json:"nextRecordsUrl"`
+			Records        []map[string]interface{} `json:"records"`
+		}
+		if err := s.getJSON(ctx, path, params, &page); err != nil {
+			return err
+		}
+		for _, rec := range page.Records {
+			delete(rec, "attributes")
+			row, err := jsonRow(rec)
+			if err != nil {
+				return err
+			}
+			if err := fn(row); err != nil {
+				return err
+			}
+		}
+		if page.Done || page.NextRecordsURL == "" {
+			return nil
+		}
+		path, params = page.NextRecordsURL, nil
+	}
+}
+
+// bulkQuery runs a Bulk API 2.0 query job, waits for it and reads its CSV
+// results page by page. The job is deleted afterwards, or aborted when the
+// read gives up first.
+func (s *Salesforce) bulkQuery(ctx context.Context, op string, o *sfObject, soql string, fn func(Row) error) error {
+	var job struct {
+		ID           string `json:"id"`
+		State        string `json:"state"`
+		ErrorMessage string `json:"errorMessage"`
+	}
+	body := map[string]string{"operation": op, "query": soql, "contentType": "CSV", "columnDelimiter": "COMMA", "lineEnding": "LF"}
+	if err := s.sendJSON(ctx, http.MethodPost, s.data("/jobs/query"), body, &job); err != nil {
+		return fmt.Errorf("sf source: create bulk query of %s: %w", o.name, err)
+	}
+	jobPath := s.data("/jobs/query/" + url.PathEscape(job.ID))
+	defer func() {
+		ctx := context.WithoutCancel(ctx)
+		if job.State != "JobComplete" && job.State != "Failed" && job.State != "Aborted" {
+			s.sendJSON(ctx, http.MethodPatch, jobPath, map[string]string{"state": "Aborted"}, nil)
+		}
+		s.sendJSON(ctx, http.MethodDelete, jobPath, nil, nil)
+	}()
+
+	for wait := sfPollMin; job.State != "JobComplete"; wait = min(wait*2, sfPollMax) {
+		switch job.State {
+		case "Failed", "Aborted":
+			return fmt.Errorf("sf source: bulk query %s of %s %s: %s", job.ID, o.name, strings.ToLower(job.State), job.ErrorMessage)
+		}
+		if err := retry.Sleep(ctx, wait); err != nil {
+			return err
+		}
+		if err := s.getJSON(ctx, jobPath, nil, &job); err != nil {
+			return err
+		}
+	}
+
+	params := url.Values{"maxRecords": {strconv.Itoa(sfBulkPageSize)}}
+	for {
+		resp, err := s.call(ctx, http.MethodGet, jobPath+"/results", params, nil, "text/csv")
+		if err != nil {
+			return err
+		}
+		err = sfCSV(resp.Body, fn)
+		resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("sf source: bulk query %s results: %w", job.ID, err)
+		}
+		next := resp.Header.Get("Sforce-Locator")
+		if next == "" || next == "null" {
+			return nil
+		}
+		params.Set("locator", next)
+	}
+}
+
+// sfCSV reads one page of Bulk API results, whose header row names the
+// fields.
+func sfCSV(r io.Reader, fn func(Row) error) error {
+	cr := csv.NewReader(r)
+	cr.ReuseRecord = true
+	hdr, err := cr.Read()
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	hdr = append([]string(nil), hdr...)
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		row := make(Row, len(hdr))
+		for i, name := range hdr {
+			row[name] = rec[i]
+		}
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *Salesforce) getJSON(ctx context.Context, path string, params url.Values, out interface{}) error {
+	resp, err := s.call(ctx, http.MethodGet, path, params, nil, "application/json")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	dec := json.NewDecoder(resp.Body)
+	dec.UseNumber()
+	if err := dec.Decode(out); err != nil {
+		return fmt.Errorf("sf source: GET %s: decode: %w", path, err)
+	}
+	return nil
+}
+
+func (s *Salesforce) sendJSON(ctx context.Context, method, path string, body, out interface{}) error {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+	resp, err := s.call(ctx, method, path, nil, payload, "application/json")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if out == nil {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("sf source: %s %s: decode: %w", method, path, err)
+	}
+	return nil
+}
+
+// call sends a request to the instance and returns a successful answer.
+// An expired session is refreshed once. Rate limited (429) and unavailable
+// (5xx) answers and failed connections are retried for reads; a job that
+// may have been created is not sent twice.
+func (s *Salesforce) call(ctx context.Context, method, path string, params url.Values, payload []byte, accept string) (*http.Response, error) {
+	retries := restMaxRetries
+	if s.cfg.MaxRetries != nil {
+		retries = *s.cfg.MaxRetries
+	}
+	idempotent := method != http.MethodPost
+	reauth := s.cfg.RefreshToken != ""
+	for attempt := 0; ; attempt++ {
+		tok, base, err := s.session(ctx)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := s.do(ctx, tok, base, method, path, params, payload, accept)
+		if err != nil {
+			if ctx.Err() != nil || !idempotent || attempt >= retries {
+				return nil, fmt.Errorf("sf source: %s %s: %w", method, path, err)
+			}
+			if err := retry.Sleep(ctx, retry.Backoff(attempt, restMaxBackoff)); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		switch {
+		case resp.StatusCode < 300:
+			return resp, nil
+		case resp.StatusCode == http.StatusUnauthorized && reauth:
+			resp.Body.Close()
+			reauth = false
+			s.mu.Lock()
+			s.token = ""
+			s.mu.Unlock()
+			continue
+		case (resp.StatusCode == http.StatusTooManyRequests || (idempotent && resp.StatusCode >= 500)) && attempt < retries:
+			wait := retry.After(resp.Header.Get("Retry-After"), retry.Backoff(attempt, restMaxBackoff))
+			resp.Body.Close()
+			if err := retry.Sleep(ctx, wait); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		err = sfError(resp)
+		resp.Body.Close()
+		return nil, fmt.Errorf("sf source: %s %s: %w", method, path, err)
+	}
+}
+
+// sfError reads the error list Salesforce answers with.
+func sfError(resp *http.Response) error {
+	b, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	var errs []struct {
+		Message   string `json:"message"`
+		ErrorCode string `json:"errorCode"`
+	}
+	if json.Unmarshal(b, &errs) == nil && len(errs) > 0 {
+		return fmt.Errorf("%s: %s: %s", resp.Status, errs[0].ErrorCode, errs[0].Message)
+	}
+	return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(b)))
+}
+
+func (s *Salesforce) do(ctx context.Context, tok string, base *url.URL, method, path string, params url.Values, payload []byte, accept string) (*http.Response, error) {
+	// Next pages of a query come as paths relative to the instance.
+	target := base.String() + path
+	if len(params) > 0 {
+		target += "?" + params.Encode()
+	}
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", accept)
+	req.Header.Set("Authorization", "Bearer "+tok)
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return s.client.Do(req)
+}
+
+// session returns the access token and instance to call, trading the
+// refresh token for a new access token when there is none.
+func (s *Salesforce) session(ctx context.Context) (string, *url.URL, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token != "" && s.instance != nil {
+		return s.token, s.instance, nil
+	}
+	if s.cfg.RefreshToken == "" {
+		return "", nil, errors.New("sf source: access_token was rejected and there is no refresh_token")
+	}
+	form := url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {s.cfg.RefreshToken},
+		"client_id":     {s.cfg.ClientID},
+	}
+	if s.cfg.ClientSecret != "" {
+		form.Set("client_secret", s.cfg.ClientSecret)
+	}
+	tokenURL := strings.TrimRight(s.cfg.LoginURL, "/") + "/services/oauth2/token"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", nil, fmt.Errorf("sf source: refresh token: %w", err)
+	}
+	defer resp.Body.Close()
+	var tok struct {
+		AccessToken string `json:"access_token"`
+		InstanceURL string `json:"instance_url"`
+		Error       string `json:"error"`
+		Description string `json:"error_description"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&tok); err != nil && resp.StatusCode < 300 {
+		return "", nil, fmt.Errorf("sf source: refresh token: %w", err)
+	}
+	if resp.StatusCode >= 300 || tok.AccessToken == "" {
+		return "", nil, fmt.Errorf("sf source: refresh token: %s %s %s", resp.Status, tok.Error, tok.Description)
+	}
+	// A configured instance_url wins, so tests and proxies can stand in
+	// for the org.
+	if s.instance == nil {
+		if s.instance, err = sfURL(tok.InstanceURL); err != nil {
+			return "", nil, fmt.Errorf("sf source: token instance_url: %w", err)
+		}
+	}
+	s.token = tok.AccessToken
+	return s.token, s.instance, nil
+}
+
+func (s *Salesforce) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
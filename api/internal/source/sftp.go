@@ -0,0 +1,132 @@
+package source
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/Zubimendi/sync-loop/api/internal/sftpconn"
+)
+
+// SFTP reads files from a directory tree on an SFTP server. Files carry no
+// ETag there, so incremental runs tell versions apart by modification time
+// and size.
+type SFTP struct {
+	*Files
+	conn *sftpconn.Conn
+	// after is what becomes of files once a run loaded them: keep, delete
+	// or archive, into archiveDir.
+	after      string
+	archiveDir string
+}
+
+// OpenSFTP builds a file source over an SFTP server. Config keys: the SSH
+// keys of an ssh_tunnel (host, port, user, private_key, passphrase,
+// password, host_key_fingerprint), root, prefix, pattern, after_success
+// (keep, delete or archive) and archive_dir, plus the parsing keys of
+// OpenS3. Directories whose names start with _ or . are not listed, so the
+// default archive_dir, _archive, is never read again.
+func OpenSFTP(ctx context.Context, cfg map[string]interface{}) (*SFTP, error) {
+	s := &SFTP{after: str(cfg, "after_success"), archiveDir: strings.Trim(str(cfg, "archive_dir"), "/")}
+	switch s.after {
+	case "":
+		s.after = "keep"
+	case "keep", "delete", "archive":
+	default:
+		return nil, fmt.Errorf("sftp source: after_success must be keep, delete or archive, not %q", s.after)
+	}
+	if s.archiveDir == "" {
+		s.archiveDir = "_archive"
+	}
+	conn, err := sftpconn.Open(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	s.conn = conn
+	s.Files = newFiles(sftpStore{conn: conn}, cfg)
+	return s, nil
+}
+
+// Consume deletes or archives files a run loaded. A file rewritten since
+// it was read is left for the next run, and one already gone, as on a
+// retry, is skipped.
+func (s *SFTP) Consume(ctx context.Context, objs []Object) error {
+	if s.after == "keep" {
+		return nil
+	}
+	for _, o := range objs {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		p := s.conn.Path(o.Key)
+		fi, err := s.conn.Stat(p)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", o.Key, err)
+		}
+		if fi.Size() != o.Size || !fi.ModTime().Equal(o.LastModified) {
+			continue
+		}
+		if s.after == "delete" {
+			err = s.conn.Remove(p)
+		} else {
+			dst := s.conn.Path(path.Join(s.archiveDir, o.Key))
+			if err = s.conn.MkdirAll(path.Dir(dst)); err == nil {
+				err = s.conn.Replace(p, dst)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", o.Key, err)
+		}
+	}
+	return nil
+}
+
+func (s *SFTP) Close() error { return s.conn.Close() }
+
+type sftpStore struct {
+	conn *sftpconn.Conn
+}
+
+func (s sftpStore) list(ctx context.Context, prefix string) ([]Object, error) {
+	dir := s.conn.Path(prefix)
+	if _, err := s.conn.Stat(dir); errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	var out []Object
+	w := s.conn.Walk(dir)
+	for w.Step() {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if err := w.Err(); err != nil {
+			return nil, err
+		}
+		fi := w.Stat()
+		if fi.IsDir() {
+			if w.Path() != dir && (strings.HasPrefix(fi.Name(), "_") || strings.HasPrefix(fi.Name(), ".")) {
+				w.SkipDir()
+			}
+			continue
+		}
+		if !fi.Mode().IsRegular() {
+			continue
+		}
+		out = append(out, Object{
+			Key:          s.conn.Key(w.Path()),
+			LastModified: fi.ModTime().UTC(),
+			Size:         fi.Size(),
+		})
+	}
+	return out, nil
+}
+
+func (s sftpStore) open(ctx context.Context, key string) (io.ReadCloser, error) {
+	return s.conn.Open(s.conn.Path(key))
+}
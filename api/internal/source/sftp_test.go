@@ -0,0 +1,156 @@
+package source
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Zubimendi/sync-loop/api/internal/egress"
+	"github.com/Zubimendi/sync-loop/api/internal/sshtest"
+)
+
+// sftpFixture serves files, given by key under the root "in", over SFTP.
+func sftpFixture(t *testing.T, files map[string]string) (*sshtest.Server, map[string]interface{}) {
+	t.Helper()
+	srv := sshtest.NewServer(t, "ops", "pw")
+	for key, body := range files {
+		p := filepath.Join(srv.Dir, "in", filepath.FromSlash(key))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cfg := srv.Config()
+	cfg["root"] = "in"
+	return srv, cfg
+}
+
+func openTestSFTP(t *testing.T, cfg map[string]interface{}) *SFTP {
+	t.Helper()
+	s, err := OpenSFTP(loopback(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestSFTPRead(t *testing.T) {
+	_, cfg := sftpFixture(t, map[string]string{
+		"2024/01/orders.csv":   "id,amount\n1,9.50\n2,3\n",
+		"2024/02/orders.csv":   "id,amount\n3,\n",
+		"2024/02/_partial.csv": "id,amount\n99,0\n",
+		"2024/.hidden.csv":     "id,amount\n98,0\n",
+		"_archive/old.csv":     "id,amount\n97,0\n",
+		"2024/readme.md":       "not data",
+	})
+	s := openTestSFTP(t, cfg)
+	objs, err := s.Objects(loopback(), "**/*.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for _, o := range objs {
+		keys = append(keys, o.Key)
+		if o.Size == 0 || o.LastModified.IsZero() {
+			t.Errorf("%s has no size or modification time: %+v", o.Key, o)
+		}
+	}
+	if strings.Join(keys, ",") != "2024/01/orders.csv,2024/02/orders.csv" {
+		t.Errorf("keys = %v", keys)
+	}
+	cols, err := s.Columns(loopback(), "**/*.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cols) != 2 || cols[0].Type != "bigint" || !cols[1].Nullable {
+		t.Errorf("columns = %+v", cols)
+	}
+	var ids []string
+	err = s.Read(loopback(), Query{Table: "**/*.csv"}, func(row Row) error {
+		ids = append(ids, row["id"].(string))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(ids)
+	if strings.Join(ids, ",") != "1,2,3" {
+		t.Errorf("ids = %v", ids)
+	}
+}
+
+func TestSFTPConsume(t *testing.T) {
+	for _, after := range []string{"keep", "delete", "archive"} {
+		t.Run(after, func(t *testing.T) {
+			srv, cfg := sftpFixture(t, map[string]string{
+				"a/one.csv": "id\n1\n",
+				"a/two.csv": "id\n2\n",
+			})
+			cfg["after_success"] = after
+			s := openTestSFTP(t, cfg)
+			objs, err := s.Objects(loopback(), "**")
+			if err != nil || len(objs) != 2 {
+				t.Fatalf("objects = %v, %v", objs, err)
+			}
+			// two.csv is rewritten after the run read it, and a retry
+			// names a file already gone.
+			two := filepath.Join(srv.Dir, "in", "a", "two.csv")
+			if err := os.WriteFile(two, []byte("id\n2\n3\n"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			objs = append(objs, Object{Key: "a/gone.csv", Size: 1, LastModified: time.Now()})
+			if err := s.Consume(loopback(), objs); err != nil {
+				t.Fatal(err)
+			}
+
+			exists := func(p string) bool {
+				_, err := os.Stat(filepath.Join(srv.Dir, "in", filepath.FromSlash(p)))
+				return err == nil
+			}
+			if !exists("a/two.csv") || exists("_archive/a/two.csv") {
+				t.Error("a file rewritten since it was read was consumed")
+			}
+			if got, want := exists("a/one.csv"), after == "keep"; got != want {
+				t.Errorf("one.csv still there = %v, want %v", got, want)
+			}
+			if got, want := exists("_archive/a/one.csv"), after == "archive"; got != want {
+				t.Errorf("one.csv archived = %v, want %v", got, want)
+			}
+			// Archived files are not listed again.
+			if objs, _ := s.Objects(loopback(), "**"); len(objs) != 1+btoi(after == "keep") {
+				t.Errorf("objects after consuming = %v", objs)
+			}
+		})
+	}
+}
+
+func btoi(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func TestSFTPRefused(t *testing.T) {
+	_, cfg := sftpFixture(t, nil)
+	cfg["after_success"] = "move"
+	if _, err := OpenSFTP(loopback(), cfg); err == nil || !strings.Contains(err.Error(), "after_success") {
+		t.Errorf("after_success move: err = %v", err)
+	}
+	delete(cfg, "after_success")
+	if _, err := OpenSFTP(context.Background(), cfg); !errors.Is(err, egress.ErrBlocked) {
+		t.Errorf("default egress: err = %v, want egress.ErrBlocked", err)
+	}
+	cfg["host_key_fingerprint"] = "SHA256:notthisone"
+	if _, err := OpenSFTP(loopback(), cfg); err == nil || !strings.Contains(err.Error(), "pinned") {
+		t.Errorf("unpinned host key: err = %v", err)
+	}
+}
@@ -0,0 +1,89 @@
+// Package source reads rows out of a connector. Every Source hands rows to the
+// caller with values already in checksum.Canonical form (strings or nil) so
+// they survive Temporal's JSON payloads unchanged.
+package source
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Zubimendi/sync-loop/api/internal/model"
+)
+
+type Row = map[string]interface{}
+
+type Query struct {
+	Table string
+	// Incremental reads only rows whose CursorColumn is newer than Since.
+	Incremental  bool
+	CursorColumn string
+	Since        time.Time
+	// JobID names the job reading, for sources that keep their position
+	// per job. Empty for reads outside a run, such as previews.
+	JobID string
+}
+
+type Source interface {
+	Columns(ctx context.Context, table string) ([]model.Column, error)
+	Read(ctx context.Context, q Query, fn func(Row) error) error
+	Close() error
+}
+
+// Catalog is a Source that can list its tables.
+type Catalog interface {
+	Tables(ctx context.Context) ([]string, error)
+}
+
+// Cursored is a Source whose tables carry a change cursor of their own,
+// read incrementally when a job names none.
+type Cursored interface {
+	DefaultCursor() string
+}
+
+// Checkpointed is a Source that keeps its own position, such as the
+// offsets of a Kafka consumer group. Checkpoint is where the last Read of a
+// job stopped, empty if it did not finish; Commit stores a checkpoint once
+// the run that read it has loaded its rows, so the job's next incremental
+// Read starts from there.
+type Checkpointed interface {
+	Checkpoint() string
+	Commit(ctx context.Context, checkpoint string) error
+}
+
+// Open builds the Source for a connector type from its decrypted config.
+// Sources reaching hosts from the config dial through the egress policy of
+// ctx.
+func Open(ctx context.Context, ctype string, cfg map[string]interface{}) (Source, error) {
+	switch ctype {
+	case "pg":
+		return openPostgresConnector(ctx, cfg)
+	case "mysql":
+		return openMySQL(ctx, cfg)
+	case "s3":
+		return OpenS3(ctx, cfg)
+	case "excel":
+		return OpenExcel(ctx, cfg)
+	case "upload":
+		return OpenUpload(ctx, cfg)
+	case "rest":
+		return OpenREST(ctx, cfg)
+	case "gsheets":
+		return OpenGSheets(ctx, cfg)
+	case "sf":
+		return OpenSalesforce(ctx, cfg)
+	case "sftp":
+		return OpenSFTP(ctx, cfg)
+	case "file":
+		return OpenLocal(ctx, cfg)
+	case "kafka":
+		return OpenKafka(ctx, cfg)
+	default:
+		return nil, fmt.Errorf("source type %q is not supported yet", ctype)
+	}
+}
+
+func str(cfg map[string]interface{}, key string) string {
+	s, _ := cfg[key].(string)
+	return s
+}
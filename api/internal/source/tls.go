@@ -0,0 +1,171 @@
+package source
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ErrTLSConfig is wrapped by errors in a connector's TLS settings, as
+// opposed to errors of the handshake itself.
+var ErrTLSConfig = errors.New("tls config")
+
+// tlsOptions are the TLS settings of a database connector. Certificates and
+// keys are PEM text kept in the config, so they are encrypted with the rest
+// of its secrets.
+type tlsOptions struct {
+	// Mode is one of disable, prefer, require, verify-ca or verify-full, as
+	// in libpq; empty keeps the driver's default.
+	Mode       string
+	RootCert   string // ssl_root_cert: CA bundle the server is verified against
+	Cert       string // ssl_cert and ssl_key: client certificate
+	Key        string
+	ServerName string // ssl_server_name: name verified instead of the host
+}
+
+var tlsModes = map[string]bool{
+	"disable": true, "prefer": true, "require": true, "verify-ca": true, "verify-full": true,
+}
+
+// tlsFromConfig reads the sslmode and ssl_* keys of a connector config. A
+// CA bundle or server name without a mode implies verify-full.
+func tlsFromConfig(cfg map[string]interface{}) (tlsOptions, error) {
+	o := tlsOptions{
+		Mode:       str(cfg, "sslmode"),
+		RootCert:   str(cfg, "ssl_root_cert"),
+		Cert:       str(cfg, "ssl_cert"),
+		Key:        str(cfg, "ssl_key"),
+		ServerName: str(cfg, "ssl_server_name"),
+	}
+	if o.Mode == "" && (o.RootCert != "" || o.ServerName != "") {
+		o.Mode = "verify-full"
+	}
+	if o.Mode != "" && !tlsModes[o.Mode] {
+		return o, fmt.Errorf("%w: unknown sslmode %q", ErrTLSConfig, o.Mode)
+	}
+	if (o.Cert == "") != (o.Key == "") {
+		return o, fmt.Errorf("%w: ssl_cert and ssl_key go together", ErrTLSConfig)
+	}
+	if o.Mode == "disable" && (o.RootCert != "" || o.Cert != "") {
+		return o, fmt.Errorf("%w: certificates given with sslmode disable", ErrTLSConfig)
+	}
+	if o.RootCert != "" {
+		if _, err := o.roots(); err != nil {
+			return o, err
+		}
+	}
+	if o.Cert != "" {
+		if _, err := tls.X509KeyPair([]byte(o.Cert), []byte(o.Key)); err != nil {
+			return o, fmt.Errorf("%w: ssl_cert/ssl_key: %v", ErrTLSConfig, err)
+		}
+	}
+	return o, nil
+}
+
+func (o tlsOptions) set() bool {
+	return o.Mode != "" || o.Cert != ""
+}
+
+// roots is the CA pool of ssl_root_cert, or nil for the system roots.
+func (o tlsOptions) roots() (*x509.CertPool, error) {
+	if o.RootCert == "" {
+		return nil, nil
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM([]byte(o.RootCert)) {
+		return nil, fmt.Errorf("%w: ssl_root_cert holds no PEM certificate", ErrTLSConfig)
+	}
+	return pool, nil
+}
+
+// config builds the client TLS config for a server known as host, or nil
+// when TLS is off. Like libpq, require checks the chain only when a CA
+// bundle is given, and verify-ca never checks the name.
+func (o tlsOptions) config(host string) (*tls.Config, error) {
+	if o.Mode == "disable" {
+		return nil, nil
+	}
+	roots, err := o.roots()
+	if err != nil {
+		return nil, err
+	}
+	c := &tls.Config{RootCAs: roots, ServerName: host, MinVersion: tls.VersionTLS12}
+	if o.ServerName != "" {
+		c.ServerName = o.ServerName
+	}
+	if o.Cert != "" {
+		cert, err := tls.X509KeyPair([]byte(o.Cert), []byte(o.Key))
+		if err != nil {
+			return nil, fmt.Errorf("%w: ssl_cert/ssl_key: %v", ErrTLSConfig, err)
+		}
+		c.Certificates = []tls.Certificate{cert}
+	}
+	switch {
+	case o.Mode == "verify-full":
+	case o.Mode == "verify-ca" || roots != nil:
+		c.InsecureSkipVerify = true
+		c.VerifyPeerCertificate = verifyChain(roots)
+	default:
+		c.InsecureSkipVerify = true
+	}
+	return c, nil
+}
+
+// verifyChain checks the server's chain against roots without matching its
+// name, for verify-ca.
+func verifyChain(roots *x509.CertPool) func([][]byte, [][]*x509.Certificate) error {
+	return func(raw [][]byte, _ [][]*x509.Certificate) error {
+		if len(raw) == 0 {
+			return errors.New("tls: server sent no certificate")
+		}
+		certs := make([]*x509.Certificate, len(raw))
+		for i, b := range raw {
+			c, err := x509.ParseCertificate(b)
+			if err != nil {
+				return err
+			}
+			certs[i] = c
+		}
+		opts := x509.VerifyOptions{Roots: roots, Intermediates: x509.NewCertPool()}
+		for _, c := range certs[1:] {
+			opts.Intermediates.AddCert(c)
+		}
+		_, err := certs[0].Verify(opts)
+		return err
+	}
+}
+
+// pemFiles writes the certificates of o to a private directory for lib/pq,
+// which reads them from disk on every connection and only takes inline PEM
+// together with a client certificate. params are the DSN settings naming
+// the files; remove deletes them.
+func (o tlsOptions) pemFiles() (params map[string]string, remove func(), err error) {
+	params = map[string]string{}
+	if o.RootCert == "" && o.Cert == "" {
+		return params, func() {}, nil
+	}
+	dir, err := os.MkdirTemp("", "syncloop-tls-")
+	if err != nil {
+		return nil, nil, err
+	}
+	remove = func() { os.RemoveAll(dir) }
+	for _, f := range []struct{ param, name, pem string }{
+		{"sslrootcert", "root.crt", o.RootCert},
+		{"sslcert", "client.crt", o.Cert},
+		{"sslkey", "client.key", o.Key},
+	} {
+		if f.pem == "" {
+			continue
+		}
+		p := filepath.Join(dir, f.name)
+		if err := os.WriteFile(p, []byte(f.pem), 0o600); err != nil {
+			remove()
+			return nil, nil, err
+		}
+		params[f.param] = p
+	}
+	return params, remove, nil
+}
@@ -0,0 +1,66 @@
+package source
+
+import (
+	"context"
+	"errors"
+	"path"
+	"strings"
+
+	"github.com/Zubimendi/sync-loop/api/internal/model"
+	"github.com/Zubimendi/sync-loop/api/internal/storage"
+)
+
+// Upload reads one file uploaded through the API, from SyncLoop's own
+// bucket. The table of a query only names the job; a #Sheet!Range after it
+// still picks from a workbook.
+type Upload struct {
+	files *Files
+	name  string
+}
+
+// OpenUpload builds the source for an uploaded object. Config keys: key,
+// plus the parsing keys of OpenS3. The config must come from the upload
+// record, never from a user, since the worker's bucket holds every
+// workspace's files.
+func OpenUpload(ctx context.Context, cfg map[string]interface{}) (*Upload, error) {
+	key := str(cfg, "key")
+	if key == "" {
+		return nil, errors.New("upload source: key is required")
+	}
+	st, err := storage.FromEnv(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c := make(map[string]interface{}, len(cfg)+2)
+	for k, v := range cfg {
+		c[k] = v
+	}
+	c["prefix"], c["pattern"] = path.Dir(key), ""
+	return &Upload{files: newFiles(s3Store{store: st}, c), name: path.Base(key)}, nil
+}
+
+func (u *Upload) table(t string) string {
+	if _, sel, ok := strings.Cut(t, "#"); ok {
+		return u.name + "#" + sel
+	}
+	return u.name
+}
+
+func (u *Upload) Columns(ctx context.Context, table string) ([]model.Column, error) {
+	return u.files.Columns(ctx, u.table(table))
+}
+
+func (u *Upload) Read(ctx context.Context, q Query, fn func(Row) error) error {
+	q.Table = u.table(q.Table)
+	return u.files.Read(ctx, q, fn)
+}
+
+func (u *Upload) Objects(ctx context.Context, table string) ([]Object, error) {
+	return u.files.Objects(ctx, u.table(table))
+}
+
+func (u *Upload) ReadObjects(ctx context.Context, table string, objs []Object, fn func(Row) error) error {
+	return u.files.ReadObjects(ctx, u.table(table), objs, fn)
+}
+
+func (u *Upload) Close() error { return u.files.Close() }
@@ -0,0 +1,39 @@
+package sourcefile
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/Zubimendi/sync-loop/api/internal/middleware"
+	"github.com/go-chi/chi/v5"
+)
+
+type Handler struct {
+	repo *Repo
+}
+
+func NewHandler(repo *Repo) *Handler { return &Handler{repo: repo} }
+
+// GET /api/v1/jobs/{id}/files – files the job has loaded, with the version
+// it read
+func (h *Handler) List(w http.ResponseWriter, r *http.Request) {
+	wid := r.Context().Value(middleware.CtxWorkspaceID).(string)
+	ff, err := h.repo.ListByJob(r.Context(), chi.URLParam(r, "id"), wid)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"files": ff})
+}
+
+// DELETE /api/v1/jobs/{id}/files?key=... – forget one file, or all of them,
+// so the next incremental run loads it again
+func (h *Handler) Forget(w http.ResponseWriter, r *http.Request) {
+	wid := r.Context().Value(middleware.CtxWorkspaceID).(string)
+	n, err := h.repo.Forget(r.Context(), chi.URLParam(r, "id"), wid, r.URL.Query().Get("key"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"forgotten": n})
+}
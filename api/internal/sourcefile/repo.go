@@ -0,0 +1,108 @@
+// Package sourcefile remembers which files a job has loaded, so incremental
+// runs of file-based sources only pick up new or changed ones.
+package sourcefile
+
+import (
+	"context"
+
+	"github.com/Zubimendi/sync-loop/api/internal/model"
+	"github.com/Zubimendi/sync-loop/api/internal/source"
+	"github.com/jmoiron/sqlx"
+)
+
+type Repo struct {
+	db *sqlx.DB
+}
+
+func NewRepo(db *sqlx.DB) *Repo { return &Repo{db: db} }
+
+// Processed returns the files a job has loaded, by key.
+func (r *Repo) Processed(ctx context.Context, jobID string) (map[string]model.SourceFile, error) {
+	ff := make([]model.SourceFile, 0)
+	if err := r.db.SelectContext(ctx, &ff, `SELECT * FROM source_file WHERE job_id = $1`, jobID); err != nil {
+		return nil, err
+	}
+	out := make(map[string]model.SourceFile, len(ff))
+	for _, f := range ff {
+		out[f.Key] = f
+	}
+	return out, nil
+}
+
+// Pending keeps the objects that are new or changed since they were last
+// loaded.
+func Pending(objs []source.Object, seen map[string]model.SourceFile) []source.Object {
+	var out []source.Object
+	for _, o := range objs {
+		f, ok := seen[o.Key]
+		if ok && f.ETag == o.ETag && f.Size == o.Size &&
+			f.LastModified != nil && f.LastModified.Equal(o.LastModified) {
+			continue
+		}
+		out = append(out, o)
+	}
+	return out
+}
+
+// Record marks files as loaded by a run, replacing any earlier version.
+func (r *Repo) Record(ctx context.Context, jobID, runID string, files []model.SourceFile) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, f := range files {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO source_file (job_id, run_id, object_key, etag, last_modified, size_bytes)
+			VALUES ($1, NULLIF($2,'')::uuid, $3, $4, $5, $6)
+			ON CONFLICT (job_id, object_key) DO UPDATE
+			SET run_id = EXCLUDED.run_id, etag = EXCLUDED.etag, last_modified = EXCLUDED.last_modified,
+			    size_bytes = EXCLUDED.size_bytes, processed_at = now()`,
+			jobID, runID, f.Key, f.ETag, f.LastModified, f.Size); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Version describes the version of an object that was read.
+func Version(o source.Object) model.SourceFile {
+	f := model.SourceFile{Key: o.Key, ETag: o.ETag, Size: o.Size}
+	if !o.LastModified.IsZero() {
+		t := o.LastModified
+		f.LastModified = &t
+	}
+	return f
+}
+
+// Object is the inverse of Version.
+func Object(f model.SourceFile) source.Object {
+	o := source.Object{Key: f.Key, ETag: f.ETag, Size: f.Size}
+	if f.LastModified != nil {
+		o.LastModified = *f.LastModified
+	}
+	return o
+}
+
+func (r *Repo) ListByJob(ctx context.Context, jobID, workspaceID string) ([]model.SourceFile, error) {
+	ff := make([]model.SourceFile, 0)
+	err := r.db.SelectContext(ctx, &ff, `
+		SELECT f.* FROM source_file f
+		JOIN sync_job j ON j.id = f.job_id
+		WHERE f.job_id = $1 AND j.workspace_id = $2
+		ORDER BY f.object_key`, jobID, workspaceID)
+	return ff, err
+}
+
+// Forget drops a job's record of one file, or of all of them when key is
+// empty, so the next incremental run loads them again.
+func (r *Repo) Forget(ctx context.Context, jobID, workspaceID, key string) (int64, error) {
+	res, err := r.db.ExecContext(ctx, `
+		DELETE FROM source_file f USING sync_job j
+		WHERE j.id = f.job_id AND f.job_id = $1 AND j.workspace_id = $2
+		  AND ($3 = '' OR f.object_key = $3)`, jobID, workspaceID, key)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,91 @@
+package sourcefile
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Zubimendi/sync-loop/api/internal/miniotest"
+	"github.com/Zubimendi/sync-loop/api/internal/model"
+	"github.com/Zubimendi/sync-loop/api/internal/source"
+)
+
+func keys(objs []source.Object) string {
+	var kk []string
+	for _, o := range objs {
+		kk = append(kk, o.Key)
+	}
+	return strings.Join(kk, ",")
+}
+
+func TestPending(t *testing.T) {
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	seen := map[string]model.SourceFile{}
+	for _, o := range []source.Object{
+		{Key: "same", ETag: "e1", Size: 10, LastModified: at},
+		{Key: "etag", ETag: "e1", Size: 10, LastModified: at},
+		{Key: "size", ETag: "e1", Size: 10, LastModified: at},
+		{Key: "touched", ETag: "e1", Size: 10, LastModified: at},
+		{Key: "undated", ETag: "e1", Size: 10},
+	} {
+		seen[o.Key] = Version(o)
+	}
+	objs := []source.Object{
+		{Key: "same", ETag: "e1", Size: 10, LastModified: at.In(time.FixedZone("x", 3600))},
+		{Key: "etag", ETag: "e2", Size: 10, LastModified: at},
+		{Key: "size", ETag: "e1", Size: 11, LastModified: at},
+		{Key: "touched", ETag: "e1", Size: 10, LastModified: at.Add(time.Second)},
+		{Key: "undated", ETag: "e1", Size: 10},
+		{Key: "new", ETag: "e1", Size: 10, LastModified: at},
+	}
+	if got := keys(Pending(objs, seen)); got != "etag,size,touched,undated,new" {
+		t.Errorf("pending = %s", got)
+	}
+	if o := Object(seen["same"]); o.Key != "same" || o.ETag != "e1" || o.Size != 10 || !o.LastModified.Equal(at) {
+		t.Errorf("Object(Version(o)) = %+v", o)
+	}
+	if o := Object(seen["undated"]); !o.LastModified.IsZero() {
+		t.Errorf("Object(Version(o)) without a time = %+v", o)
+	}
+}
+
+// TestPendingS3 checks incremental runs against MinIO pick up new and
+// rewritten objects, and only those.
+func TestPendingS3(t *testing.T) {
+	b := miniotest.New(t)
+	b.Put(t, "in/a.csv", "id\n1\n")
+	b.Put(t, "in/b.csv", "id\n2\n")
+	cfg := b.Config()
+	cfg["prefix"] = "in"
+	s, err := source.OpenS3(miniotest.Context(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	list := func() []source.Object {
+		t.Helper()
+		objs, err := s.Objects(miniotest.Context(), "*.csv")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return objs
+	}
+
+	seen := map[string]model.SourceFile{}
+	first := Pending(list(), seen)
+	if got := keys(first); got != "in/a.csv,in/b.csv" {
+		t.Fatalf("first run = %s", got)
+	}
+	for _, o := range first {
+		seen[o.Key] = Version(o)
+	}
+	if got := keys(Pending(list(), seen)); got != "" {
+		t.Errorf("nothing changed, yet pending = %s", got)
+	}
+	// The same size with other content changes the ETag.
+	b.Put(t, "in/b.csv", "id\n3\n")
+	b.Put(t, "in/c.csv", "id\n4\n")
+	if got := keys(Pending(list(), seen)); got != "in/b.csv,in/c.csv" {
+		t.Errorf("after b was rewritten and c added, pending = %s", got)
+	}
+}
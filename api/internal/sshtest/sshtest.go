@@ -0,0 +1,253 @@
+// Package sshtest runs an in-process SSH server for the tests of connectors
+// that reach hosts over SSH. Like a bastion, it forwards the connections
+// clients open through it, and it serves SFTP from a temporary directory.
+package sshtest
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// Server accepts User with Password, or with any of AuthorizedKeys, until
+// the test ends.
+type Server struct {
+	Host string
+	Port int
+	// Fingerprint is the SHA256 fingerprint of the host key, as a
+	// connector pins it.
+	Fingerprint string
+
+	User           string
+	Password       string
+	AuthorizedKeys []ssh.PublicKey
+
+	// Dir is the working directory of SFTP sessions, where relative paths
+	// land.
+	Dir string
+
+	ln    net.Listener
+	mu    sync.Mutex
+	conns map[net.Conn]bool
+}
+
+// NewServer starts a server on a loopback port for user, with a fresh host
+// key. An empty password allows only key logins.
+func NewServer(t testing.TB, user, password string, keys ...ssh.PublicKey) *Server {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostKey, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{
+		Host:           "127.0.0.1",
+		Port:           ln.Addr().(*net.TCPAddr).Port,
+		Fingerprint:    ssh.FingerprintSHA256(hostKey.PublicKey()),
+		User:           user,
+		Password:       password,
+		AuthorizedKeys: keys,
+		Dir:            t.TempDir(),
+		ln:             ln,
+		conns:          map[net.Conn]bool{},
+	}
+	conf := &ssh.ServerConfig{PublicKeyCallback: s.publicKey}
+	if password != "" {
+		conf.PasswordCallback = s.password
+	}
+	conf.AddHostKey(hostKey)
+	go s.serve(conf)
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Addr is the host:port the server listens on.
+func (s *Server) Addr() string { return net.JoinHostPort(s.Host, strconv.Itoa(s.Port)) }
+
+// Config is a connector's SSH settings for the server, logging in with the
+// password.
+func (s *Server) Config() map[string]interface{} {
+	return map[string]interface{}{
+		"host":                 s.Host,
+		"port":                 float64(s.Port),
+		"user":                 s.User,
+		"password":             s.Password,
+		"host_key_fingerprint": s.Fingerprint,
+	}
+}
+
+// Close stops the server and drops its connections.
+func (s *Server) Close() {
+	s.ln.Close()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for c := range s.conns {
+		c.Close()
+	}
+}
+
+func (s *Server) password(c ssh.ConnMetadata, pw []byte) (*ssh.Permissions, error) {
+	if c.User() == s.User && string(pw) == s.Password {
+		return nil, nil
+	}
+	return nil, errDenied
+}
+
+func (s *Server) publicKey(c ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+	for _, k := range s.AuthorizedKeys {
+		if c.User() == s.User && bytes.Equal(k.Marshal(), key.Marshal()) {
+			return nil, nil
+		}
+	}
+	return nil, errDenied
+}
+
+var errDenied = errors.New("sshtest: access denied")
+
+func (s *Server) serve(conf *ssh.ServerConfig) {
+	for {
+		c, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.conns[c] = true
+		s.mu.Unlock()
+		go func() {
+			defer func() {
+				s.mu.Lock()
+				delete(s.conns, c)
+				s.mu.Unlock()
+				c.Close()
+			}()
+			s.handle(c, conf)
+		}()
+	}
+}
+
+func (s *Server) handle(c net.Conn, conf *ssh.ServerConfig) {
+	sc, chans, reqs, err := ssh.NewServerConn(c, conf)
+	if err != nil {
+		return
+	}
+	defer sc.Close()
+	go ssh.DiscardRequests(reqs)
+	for nc := range chans {
+		switch nc.ChannelType() {
+		case "direct-tcpip":
+			go forward(nc)
+		case "session":
+			go s.session(nc)
+		default:
+			nc.Reject(ssh.UnknownChannelType, "sshtest: "+nc.ChannelType()+" is not served")
+		}
+	}
+}
+
+// forward connects a direct-tcpip channel to the address it asks for.
+func forward(nc ssh.NewChannel) {
+	var to struct {
+		Host     string
+		Port     uint32
+		FromHost string
+		FromPort uint32
+	}
+	if err := ssh.Unmarshal(nc.ExtraData(), &to); err != nil {
+		nc.Reject(ssh.Prohibited, err.Error())
+		return
+	}
+	target, err := net.Dial("tcp", net.JoinHostPort(to.Host, strconv.Itoa(int(to.Port))))
+	if err != nil {
+		nc.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	ch, reqs, err := nc.Accept()
+	if err != nil {
+		target.Close()
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(ch, target)
+		ch.CloseWrite()
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(target, ch)
+		target.(*net.TCPConn).CloseWrite()
+		done <- struct{}{}
+	}()
+	<-done
+	<-done
+	ch.Close()
+	target.Close()
+}
+
+// session serves the sftp subsystem; a session asking for anything else,
+// such as a shell, is refused.
+func (s *Server) session(nc ssh.NewChannel) {
+	ch, reqs, err := nc.Accept()
+	if err != nil {
+		return
+	}
+	defer ch.Close()
+	for req := range reqs {
+		var sub struct{ Name string }
+		ok := req.Type == "subsystem" && ssh.Unmarshal(req.Payload, &sub) == nil && sub.Name == "sftp"
+		req.Reply(ok, nil)
+		if !ok {
+			continue
+		}
+		go ssh.DiscardRequests(reqs)
+		srv, err := sftp.NewServer(ch, sftp.WithServerWorkingDirectory(s.Dir))
+		if err != nil {
+			return
+		}
+		srv.Serve()
+		srv.Close()
+		return
+	}
+}
+
+// NewKey makes a client key, returning it PEM encoded as a connector takes
+// it, encrypted when passphrase is not empty, and its public half for the
+// server.
+func NewKey(t testing.TB, passphrase string) (string, ssh.PublicKey) {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var block *pem.Block
+	if passphrase == "" {
+		block, err = ssh.MarshalPrivateKey(priv, "")
+	} else {
+		block, err = ssh.MarshalPrivateKeyWithPassphrase(priv, "", []byte(passphrase))
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	sshPub, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(block)), sshPub
+}
@@ -0,0 +1,256 @@
+// Package storage wraps the S3/MinIO bucket SyncLoop writes run artifacts to.
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+type Store struct {
+	Client *s3.Client
+	Bucket string
+}
+
+// Options point a Store at any S3-compatible endpoint. Empty fields fall back
+// to the S3_* environment used by the worker's own bucket.
+type Options struct {
+	Endpoint  string
+	Region    string
+	AccessKey string
+	SecretKey string
+	Bucket    string
+	// Dial, when set, makes every connection to the endpoint.
+	Dial func(ctx context.Context, network, addr string) (net.Conn, error)
+}
+
+func FromEnv(ctx context.Context) (*Store, error) {
+	return New(ctx, Options{})
+}
+
+func New(ctx context.Context, o Options) (*Store, error) {
+	if o.Endpoint == "" {
+		o.Endpoint = os.Getenv("S3_ENDPOINT")
+	}
+	if o.AccessKey == "" {
+		o.AccessKey, o.SecretKey = os.Getenv("S3_KEY"), os.Getenv("S3_SECRET")
+	}
+	if o.Bucket == "" {
+		o.Bucket = os.Getenv("S3_BUCKET")
+	}
+	if o.Region == "" {
+		o.Region = "us-east-1"
+	}
+	cfg, err := config.LoadDefaultConfig(ctx,
+		config.WithRegion(o.Region),
+		config.WithCredentialsProvider(
+			credentials.NewStaticCredentialsProvider(o.AccessKey, o.SecretKey, "")),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("load aws config: %w", err)
+	}
+	client := s3.NewFromConfig(cfg, func(opts *s3.Options) {
+		if o.Endpoint != "" {
+			opts.BaseEndpoint = aws.String(o.Endpoint)
+		}
+		opts.UsePathStyle = true
+		if o.Dial != nil {
+			opts.HTTPClient = awshttp.NewBuildableClient().WithTransportOptions(func(t *http.Transport) {
+				t.Proxy = nil
+				t.DialContext = o.Dial
+			})
+		}
+	})
+	return &Store{Client: client, Bucket: o.Bucket}, nil
+}
+
+func (s *Store) Put(ctx context.Context, key string, body io.Reader) error {
+	_, err := s.Client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(key),
+		Body:   body,
+	})
+	if err != nil {
+		return fmt.Errorf("s3 put %s: %w", key, err)
+	}
+	return nil
+}
+
+func (s *Store) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	out, err := s.Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("s3 get %s: %w", key, err)
+	}
+	return out.Body, nil
+}
+
+// Copy duplicates an object within the bucket server-side.
+func (s *Store) Copy(ctx context.Context, src, dst string) error {
+	_, err := s.Client.CopyObject(ctx, &s3.CopyObjectInput{
+		Bucket:     aws.String(s.Bucket),
+		CopySource: aws.String(s.Bucket + "/" + escapeKey(src)),
+		Key:        aws.String(dst),
+	})
+	if err != nil {
+		return fmt.Errorf("s3 copy %s -> %s: %w", src, dst, err)
+	}
+	return nil
+}
+
+func (s *Store) Delete(ctx context.Context, key string) error {
+	_, err := s.Client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return fmt.Errorf("s3 delete %s: %w", key, err)
+	}
+	return nil
+}
+
+// escapeKey URL-encodes every segment of a key, as CopySource requires.
+func escapeKey(key string) string {
+	segs := strings.Split(key, "/")
+	for i, seg := range segs {
+		segs[i] = url.PathEscape(seg)
+	}
+	return strings.Join(segs, "/")
+}
+
+// Object describes one listed object.
+type Object struct {
+	Key          string
+	ETag         string
+	LastModified time.Time
+	Size         int64
+}
+
+// List returns every object under prefix.
+func (s *Store) List(ctx context.Context, prefix string) ([]Object, error) {
+	var out []Object
+	p := s3.NewListObjectsV2Paginator(s.Client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.Bucket),
+		Prefix: aws.String(prefix),
+	})
+	for p.HasMorePages() {
+		page, err := p.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("s3 list %s: %w", prefix, err)
+		}
+		for _, o := range page.Contents {
+			out = append(out, Object{
+				Key:          aws.ToString(o.Key),
+				ETag:         strings.Trim(aws.ToString(o.ETag), `"`),
+				LastModified: aws.ToTime(o.LastModified),
+				Size:         aws.ToInt64(o.Size),
+			})
+		}
+	}
+	return out, nil
+}
+
+// Part is one uploaded part of a multipart upload.
+type Part struct {
+	Number int32  `json:"number"`
+	ETag   string `json:"etag"`
+	Size   int64  `json:"size"`
+}
+
+// CreateMultipart starts a multipart upload to key and returns its id.
+func (s *Store) CreateMultipart(ctx context.Context, key string) (string, error) {
+	out, err := s.Client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return "", fmt.Errorf("s3 create multipart %s: %w", key, err)
+	}
+	return aws.ToString(out.UploadId), nil
+}
+
+// UploadPart stores part n. Uploading the same n again replaces it.
+func (s *Store) UploadPart(ctx context.Context, key, uploadID string, n int32, body io.ReadSeeker, size int64) (string, error) {
+	out, err := s.Client.UploadPart(ctx, &s3.UploadPartInput{
+		Bucket:        aws.String(s.Bucket),
+		Key:           aws.String(key),
+		UploadId:      aws.String(uploadID),
+		PartNumber:    aws.Int32(n),
+		Body:          body,
+		ContentLength: aws.Int64(size),
+	})
+	if err != nil {
+		return "", fmt.Errorf("s3 upload part %d of %s: %w", n, key, err)
+	}
+	return strings.Trim(aws.ToString(out.ETag), `"`), nil
+}
+
+// ListParts returns the parts uploaded so far, by number.
+func (s *Store) ListParts(ctx context.Context, key, uploadID string) ([]Part, error) {
+	var out []Part
+	p := s3.NewListPartsPaginator(s.Client, &s3.ListPartsInput{
+		Bucket:   aws.String(s.Bucket),
+		Key:      aws.String(key),
+		UploadId: aws.String(uploadID),
+	})
+	for p.HasMorePages() {
+		page, err := p.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("s3 list parts of %s: %w", key, err)
+		}
+		for _, pt := range page.Parts {
+			out = append(out, Part{
+				Number: aws.ToInt32(pt.PartNumber),
+				ETag:   strings.Trim(aws.ToString(pt.ETag), `"`),
+				Size:   aws.ToInt64(pt.Size),
+			})
+		}
+	}
+	return out, nil
+}
+
+// CompleteMultipart assembles the parts into the object.
+func (s *Store) CompleteMultipart(ctx context.Context, key, uploadID string, parts []Part) error {
+	done := make([]types.CompletedPart, len(parts))
+	for i, pt := range parts {
+		done[i] = types.CompletedPart{PartNumber: aws.Int32(pt.Number), ETag: aws.String(`"` + pt.ETag + `"`)}
+	}
+	_, err := s.Client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(s.Bucket),
+		Key:             aws.String(key),
+		UploadId:        aws.String(uploadID),
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: done},
+	})
+	if err != nil {
+		return fmt.Errorf("s3 complete multipart %s: %w", key, err)
+	}
+	return nil
+}
+
+// AbortMultipart drops an unfinished upload and its parts.
+func (s *Store) AbortMultipart(ctx context.Context, key, uploadID string) error {
+	_, err := s.Client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(s.Bucket),
+		Key:      aws.String(key),
+		UploadId: aws.String(uploadID),
+	})
+	if err != nil {
+		return fmt.Errorf("s3 abort multipart %s: %w", key, err)
+	}
+	return nil
+}
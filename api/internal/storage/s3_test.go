@@ -0,0 +1,100 @@
+package storage_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/Zubimendi/sync-loop/api/internal/miniotest"
+	"github.com/Zubimendi/sync-loop/api/internal/storage"
+)
+
+func get(t *testing.T, st *storage.Store, key string) string {
+	t.Helper()
+	rc, err := st.Get(context.Background(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	b, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestStore(t *testing.T) {
+	b := miniotest.New(t)
+	ctx := context.Background()
+	b.Put(t, "runs/r1/part 1.csv", "id\n1\n")
+	b.Put(t, "runs/r2/part.csv", "id\n2\n")
+	if got := get(t, b.Store, "runs/r1/part 1.csv"); got != "id\n1\n" {
+		t.Errorf("get = %q", got)
+	}
+	// Keys are escaped for the copy source.
+	if err := b.Copy(ctx, "runs/r1/part 1.csv", "runs/r1/part #1+.csv"); err != nil {
+		t.Fatal(err)
+	}
+	if got := get(t, b.Store, "runs/r1/part #1+.csv"); got != "id\n1\n" {
+		t.Errorf("copy = %q", got)
+	}
+	if err := b.Delete(ctx, "runs/r1/part 1.csv"); err != nil {
+		t.Fatal(err)
+	}
+	objs, err := b.List(ctx, "runs/r1/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objs) != 1 || objs[0].Key != "runs/r1/part #1+.csv" || objs[0].Size != 5 ||
+		objs[0].ETag == "" || strings.Contains(objs[0].ETag, `"`) || objs[0].LastModified.IsZero() {
+		t.Errorf("list = %+v", objs)
+	}
+	if _, err := b.Get(ctx, "runs/missing.csv"); err == nil {
+		t.Error("got a missing object")
+	}
+}
+
+func TestStoreMultipart(t *testing.T) {
+	b := miniotest.New(t)
+	ctx := context.Background()
+	id, err := b.CreateMultipart(ctx, "big.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every part but the last must be at least 5 MiB.
+	first := bytes.Repeat([]byte("x"), 5<<20)
+	for _, body := range [][]byte{[]byte("stale"), first} {
+		if _, err := b.UploadPart(ctx, "big.csv", id, 1, bytes.NewReader(body), int64(len(body))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := b.UploadPart(ctx, "big.csv", id, 2, strings.NewReader("end"), 3); err != nil {
+		t.Fatal(err)
+	}
+	parts, err := b.ListParts(ctx, "big.csv", id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parts) != 2 || parts[0].Size != int64(len(first)) || parts[1].Number != 2 {
+		t.Fatalf("parts = %+v", parts)
+	}
+	if err := b.CompleteMultipart(ctx, "big.csv", id, parts); err != nil {
+		t.Fatal(err)
+	}
+	if got := get(t, b.Store, "big.csv"); len(got) != len(first)+3 || !strings.HasSuffix(got, "xend") {
+		t.Errorf("assembled %d bytes", len(got))
+	}
+
+	id, err = b.CreateMultipart(ctx, "dropped.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.AbortMultipart(ctx, "dropped.csv", id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.ListParts(ctx, "dropped.csv", id); err == nil {
+		t.Error("an aborted upload still has parts")
+	}
+}
@@ -0,0 +1,199 @@
+// Package tunnel reaches databases in private networks through an SSH
+// bastion. The bastion's host key must be pinned by fingerprint; there is
+// no trust on first use. Other SSH-based connectors, such as SFTP, connect
+// the same way through Parse and Dial.
+package tunnel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Config is the ssh_tunnel object of a database connector's config.
+type Config struct {
+	Host string
+	Port int
+	User string
+	// PrivateKey is a PEM or OpenSSH key, unlocked by Passphrase when it is
+	// encrypted. Password is tried too, or instead.
+	PrivateKey string
+	Passphrase string
+	Password   string
+	// HostKeyFingerprints pins the bastion's host key, as ssh-keygen -l
+	// prints it (SHA256:...). Several can be listed, comma separated, while
+	// a key is rotated.
+	HostKeyFingerprints []string
+}
+
+const keepAlive = 30 * time.Second
+
+// FromConfig reads the ssh_tunnel settings of a connector config; ok is
+// false when it has none.
+func FromConfig(cfg map[string]interface{}) (c Config, ok bool, err error) {
+	m, ok := cfg["ssh_tunnel"].(map[string]interface{})
+	if !ok || len(m) == 0 {
+		return Config{}, false, nil
+	}
+	if c, err = Parse(m); err != nil {
+		return c, true, fmt.Errorf("ssh_tunnel: %w", err)
+	}
+	return c, true, nil
+}
+
+// Parse reads SSH settings: host, port, user, private_key, passphrase,
+// password and host_key_fingerprint.
+func Parse(m map[string]interface{}) (c Config, err error) {
+	s := func(k string) string {
+		v, _ := m[k].(string)
+		return v
+	}
+	c = Config{
+		Host:       s("host"),
+		Port:       22,
+		User:       s("user"),
+		PrivateKey: s("private_key"),
+		Passphrase: s("passphrase"),
+		Password:   s("password"),
+	}
+	switch p := m["port"].(type) {
+	case float64:
+		c.Port = int(p)
+	case string:
+		if p != "" {
+			if c.Port, err = strconv.Atoi(p); err != nil {
+				return c, fmt.Errorf("port %q is not a number", p)
+			}
+		}
+	}
+	for _, f := range strings.Split(s("host_key_fingerprint"), ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			c.HostKeyFingerprints = append(c.HostKeyFingerprints, f)
+		}
+	}
+	switch {
+	case c.Host == "" || c.User == "":
+		return c, errors.New("host and user are required")
+	case c.PrivateKey == "" && c.Password == "":
+		return c, errors.New("private_key or password is required")
+	case len(c.HostKeyFingerprints) == 0:
+		return c, errors.New("host_key_fingerprint is required")
+	case c.Port <= 0 || c.Port > 65535:
+		return c, fmt.Errorf("bad port %d", c.Port)
+	}
+	return c, nil
+}
+
+// Tunnel is an SSH connection to a bastion that dials onwards from it.
+type Tunnel struct {
+	client *ssh.Client
+	done   chan struct{}
+}
+
+// Open connects to the bastion. dial makes the connection to it, so the
+// bastion itself is subject to the egress policy.
+func Open(ctx context.Context, c Config, dial func(ctx context.Context, network, addr string) (net.Conn, error)) (*Tunnel, error) {
+	client, err := Dial(ctx, c, dial)
+	if err != nil {
+		return nil, fmt.Errorf("ssh_tunnel: %w", err)
+	}
+	t := &Tunnel{client: client, done: make(chan struct{})}
+	go t.keepAlive()
+	return t, nil
+}
+
+// Dial makes an SSH connection to the host of c, authenticated by key,
+// password or both, and refused unless the host key is pinned.
+func Dial(ctx context.Context, c Config, dial func(ctx context.Context, network, addr string) (net.Conn, error)) (*ssh.Client, error) {
+	var auth []ssh.AuthMethod
+	if c.PrivateKey != "" {
+		var (
+			signer ssh.Signer
+			err    error
+		)
+		if c.Passphrase != "" {
+			signer, err = ssh.ParsePrivateKeyWithPassphrase([]byte(c.PrivateKey), []byte(c.Passphrase))
+		} else {
+			signer, err = ssh.ParsePrivateKey([]byte(c.PrivateKey))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("private key: %w", err)
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	if c.Password != "" {
+		auth = append(auth, ssh.Password(c.Password))
+	}
+	addr := net.JoinHostPort(c.Host, strconv.Itoa(c.Port))
+	conf := &ssh.ClientConfig{
+		User:            c.User,
+		Auth:            auth,
+		HostKeyCallback: pinned(c.HostKeyFingerprints),
+		Timeout:         30 * time.Second,
+	}
+	conn, err := dial(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("dial %s: %w", addr, err)
+	}
+	if d, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(d)
+	}
+	sc, chans, reqs, err := ssh.NewClientConn(conn, addr, conf)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("%s: %w", addr, err)
+	}
+	conn.SetDeadline(time.Time{})
+	return ssh.NewClient(sc, chans, reqs), nil
+}
+
+// pinned accepts only host keys with one of the given fingerprints.
+func pinned(fingerprints []string) ssh.HostKeyCallback {
+	return func(hostname string, _ net.Addr, key ssh.PublicKey) error {
+		got := ssh.FingerprintSHA256(key)
+		for _, f := range fingerprints {
+			if f == got || "SHA256:"+f == got {
+				return nil
+			}
+		}
+		return fmt.Errorf("host key of %s is %s, not the pinned fingerprint", hostname, got)
+	}
+}
+
+// keepAlive pings the bastion so idle tunnels survive NAT and firewall
+// timeouts during long activities.
+func (t *Tunnel) keepAlive() {
+	tick := time.NewTicker(keepAlive)
+	defer tick.Stop()
+	for {
+		select {
+		case <-t.done:
+			return
+		case <-tick.C:
+			if _, _, err := t.client.SendRequest("keepalive@openssh.com", true, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// DialContext opens a connection from the bastion to addr.
+func (t *Tunnel) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	return t.client.DialContext(ctx, network, addr)
+}
+
+func (t *Tunnel) Close() error {
+	select {
+	case <-t.done:
+		return nil
+	default:
+		close(t.done)
+	}
+	return t.client.Close()
+}
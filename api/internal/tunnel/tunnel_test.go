@@ -0,0 +1,150 @@
+package tunnel
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/Zubimendi/sync-loop/api/internal/sshtest"
+)
+
+// echoServer stands for a database in the bastion's private network.
+func echoServer(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				line, _ := bufio.NewReader(c).ReadString('\n')
+				c.Write([]byte("echo " + line))
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func dialer(ctx context.Context, network, addr string) (net.Conn, error) {
+	return (&net.Dialer{}).DialContext(ctx, network, addr)
+}
+
+func roundTrip(t *testing.T, tun *Tunnel, addr string) {
+	t.Helper()
+	c, err := tun.DialContext(context.Background(), "tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if _, err := c.Write([]byte("ping\n")); err != nil {
+		t.Fatal(err)
+	}
+	got, err := bufio.NewReader(c).ReadString('\n')
+	if err != nil || got != "echo ping\n" {
+		t.Errorf("read %q, %v; want echo ping", got, err)
+	}
+}
+
+func TestParse(t *testing.T) {
+	c, err := Parse(map[string]interface{}{
+		"host": "bastion", "port": "2222", "user": "ops", "password": "pw",
+		"host_key_fingerprint": "SHA256:aaa, SHA256:bbb",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Port != 2222 || len(c.HostKeyFingerprints) != 2 || c.HostKeyFingerprints[1] != "SHA256:bbb" {
+		t.Errorf("config = %+v", c)
+	}
+	for _, tc := range []struct {
+		m    map[string]interface{}
+		want string
+	}{
+		{map[string]interface{}{"user": "ops", "password": "pw", "host_key_fingerprint": "x"}, "host and user"},
+		{map[string]interface{}{"host": "b", "user": "ops", "host_key_fingerprint": "x"}, "private_key or password"},
+		{map[string]interface{}{"host": "b", "user": "ops", "password": "pw"}, "host_key_fingerprint"},
+		{map[string]interface{}{"host": "b", "user": "ops", "password": "pw", "host_key_fingerprint": "x", "port": "ssh"}, "not a number"},
+		{map[string]interface{}{"host": "b", "user": "ops", "password": "pw", "host_key_fingerprint": "x", "port": 70000.0}, "bad port"},
+	} {
+		if _, err := Parse(tc.m); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("Parse(%v) = %v, want an error with %q", tc.m, err, tc.want)
+		}
+	}
+	if _, ok, err := FromConfig(map[string]interface{}{"host": "db"}); ok || err != nil {
+		t.Errorf("FromConfig without ssh_tunnel = %v, %v", ok, err)
+	}
+}
+
+func TestTunnelPassword(t *testing.T) {
+	srv := sshtest.NewServer(t, "ops", "pw")
+	c, ok, err := FromConfig(map[string]interface{}{"ssh_tunnel": srv.Config()})
+	if !ok || err != nil {
+		t.Fatal(ok, err)
+	}
+	tun, err := Open(context.Background(), c, dialer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tun.Close()
+	db := echoServer(t)
+	roundTrip(t, tun, db)
+	// A pool opens several connections through one tunnel.
+	roundTrip(t, tun, db)
+}
+
+func TestTunnelKey(t *testing.T) {
+	for _, passphrase := range []string{"", "unlock me"} {
+		key, pub := sshtest.NewKey(t, passphrase)
+		srv := sshtest.NewServer(t, "ops", "", pub)
+		tun, err := Open(context.Background(), Config{
+			Host: srv.Host, Port: srv.Port, User: "ops",
+			PrivateKey: key, Passphrase: passphrase,
+			// Fingerprints are taken with or without their prefix.
+			HostKeyFingerprints: []string{"SHA256:old", strings.TrimPrefix(srv.Fingerprint, "SHA256:")},
+		}, dialer)
+		if err != nil {
+			t.Fatalf("passphrase %q: %v", passphrase, err)
+		}
+		roundTrip(t, tun, echoServer(t))
+		tun.Close()
+	}
+}
+
+func TestTunnelRefused(t *testing.T) {
+	srv := sshtest.NewServer(t, "ops", "pw")
+	other, _ := sshtest.NewKey(t, "")
+	for _, tc := range []struct {
+		name string
+		edit func(*Config)
+		want string
+	}{
+		{"unpinned host key", func(c *Config) { c.HostKeyFingerprints = []string{"SHA256:somethingelse"} }, "not the pinned fingerprint"},
+		{"wrong password", func(c *Config) { c.Password = "guess" }, "unable to authenticate"},
+		{"unknown key", func(c *Config) { c.Password, c.PrivateKey = "", other }, "unable to authenticate"},
+		{"encrypted key without passphrase", func(c *Config) { c.PrivateKey, _ = sshtest.NewKey(t, "secret") }, "private key"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c, err := Parse(srv.Config())
+			if err != nil {
+				t.Fatal(err)
+			}
+			tc.edit(&c)
+			tun, err := Open(context.Background(), c, dialer)
+			if err == nil {
+				tun.Close()
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("err = %v, want one with %q", err, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,239 @@
+package upload
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"github.com/Zubimendi/sync-loop/api/internal/middleware"
+	"github.com/Zubimendi/sync-loop/api/internal/model"
+	"github.com/go-chi/chi/v5"
+)
+
+type Handler struct {
+	svc *Service
+}
+
+func NewHandler(svc *Service) *Handler { return &Handler{svc: svc} }
+
+// POST /api/v1/uploads – a multipart form with the file in its file field,
+// or a JSON {filename, size} to start a resumable upload sent in parts
+func (h *Handler) Create(w http.ResponseWriter, r *http.Request) {
+	uid := r.Context().Value(middleware.CtxUserID).(string)
+	wid := r.Context().Value(middleware.CtxWorkspaceID).(string)
+	if mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mt == "multipart/form-data" {
+		h.receive(w, r, wid, uid)
+		return
+	}
+	var req struct {
+		Filename string `json:"filename"`
+		Size     int64  `json:"size"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+	u, err := h.svc.Start(r.Context(), wid, uid, req.Filename, req.Size)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{"upload": u, "parts": PartCount(u)})
+}
+
+func (h *Handler) receive(w http.ResponseWriter, r *http.Request, wid, uid string) {
+	mr, err := r.MultipartReader()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			http.Error(w, "no file field in form", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if p.FormName() != "file" {
+			p.Close()
+			continue
+		}
+		u, err := h.svc.Receive(r.Context(), wid, uid, p.FileName(), p)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(u)
+		return
+	}
+}
+
+// GET /api/v1/uploads – the workspace's uploads, newest first
+func (h *Handler) List(w http.ResponseWriter, r *http.Request) {
+	wid := r.Context().Value(middleware.CtxWorkspaceID).(string)
+	uu, err := h.svc.List(r.Context(), wid)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"uploads": uu})
+}
+
+// GET /api/v1/uploads/{id} – one upload, with the parts received so far
+// while it is in progress
+func (h *Handler) Get(w http.ResponseWriter, r *http.Request) {
+	u, ok := h.load(w, r)
+	if !ok {
+		return
+	}
+	pp, err := h.svc.Parts(r.Context(), u)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"upload": u, "parts": PartCount(u), "received": pp})
+}
+
+// PUT /api/v1/uploads/{id}/parts/{n} – the bytes of part n, numbered from 1
+func (h *Handler) PutPart(w http.ResponseWriter, r *http.Request) {
+	u, ok := h.load(w, r)
+	if !ok {
+		return
+	}
+	n, err := strconv.ParseInt(chi.URLParam(r, "n"), 10, 32)
+	if err != nil {
+		http.Error(w, "invalid part number", http.StatusBadRequest)
+		return
+	}
+	p, err := h.svc.PutPart(r.Context(), u, int32(n), r.Body)
+	if err != nil {
+		writeError(w, err, http.StatusBadRequest)
+		return
+	}
+	json.NewEncoder(w).Encode(p)
+}
+
+// POST /api/v1/uploads/{id}/complete – assemble a resumable upload once
+// every part is in
+func (h *Handler) Complete(w http.ResponseWriter, r *http.Request) {
+	u, ok := h.load(w, r)
+	if !ok {
+		return
+	}
+	if err := h.svc.Complete(r.Context(), u); err != nil {
+		writeError(w, err, http.StatusBadRequest)
+		return
+	}
+	json.NewEncoder(w).Encode(u)
+}
+
+// DELETE /api/v1/uploads/{id} – abort an upload or remove its file
+func (h *Handler) Delete(w http.ResponseWriter, r *http.Request) {
+	u, ok := h.load(w, r)
+	if !ok {
+		return
+	}
+	if err := h.svc.Delete(r.Context(), u); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GET /api/v1/uploads/{id}/preview?rows=20 – the inferred columns and
+// first rows, parsed with the upload's options
+func (h *Handler) Preview(w http.ResponseWriter, r *http.Request) {
+	u, ok := h.load(w, r)
+	if !ok {
+		return
+	}
+	rows := PreviewRows
+	if s := r.URL.Query().Get("rows"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > MaxPreviewRows {
+			http.Error(w, "rows must be between 1 and "+strconv.Itoa(MaxPreviewRows), http.StatusBadRequest)
+			return
+		}
+		rows = n
+	}
+	p, err := h.svc.Preview(r.Context(), u, u.Options, rows)
+	if err != nil {
+		writeError(w, err, http.StatusUnprocessableEntity)
+		return
+	}
+	json.NewEncoder(w).Encode(p)
+}
+
+// PUT /api/v1/uploads/{id}/options – how to parse the file and which
+// column types to override; answers with a preview parsed that way
+func (h *Handler) SetOptions(w http.ResponseWriter, r *http.Request) {
+	u, ok := h.load(w, r)
+	if !ok {
+		return
+	}
+	var o model.UploadOptions
+	if err := json.NewDecoder(r.Body).Decode(&o); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+	p, err := h.svc.SetOptions(r.Context(), u, o)
+	if err != nil {
+		writeError(w, err, http.StatusUnprocessableEntity)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"options": u.Options, "preview": p})
+}
+
+// POST /api/v1/uploads/{id}/connector – create a connector reading the
+// upload, or point an existing upload connector (connector_id) at it
+func (h *Handler) Connect(w http.ResponseWriter, r *http.Request) {
+	u, ok := h.load(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		Name        string `json:"name"`
+		ConnectorID string `json:"connector_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+	uid := r.Context().Value(middleware.CtxUserID).(string)
+	c, err := h.svc.Connect(r.Context(), u, req.Name, req.ConnectorID, uid)
+	if err != nil {
+		writeError(w, err, http.StatusBadRequest)
+		return
+	}
+	json.NewEncoder(w).Encode(c)
+}
+
+func (h *Handler) load(w http.ResponseWriter, r *http.Request) (*model.Upload, bool) {
+	wid := r.Context().Value(middleware.CtxWorkspaceID).(string)
+	u, err := h.svc.Get(r.Context(), chi.URLParam(r, "id"), wid)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "upload not found", http.StatusNotFound)
+		return nil, false
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	return u, true
+}
+
+func writeError(w http.ResponseWriter, err error, code int) {
+	if errors.Is(err, ErrNotReady) || errors.Is(err, ErrNotOpen) {
+		code = http.StatusConflict
+	}
+	http.Error(w, err.Error(), code)
+}
@@ -0,0 +1,78 @@
+// Package upload takes files sent to the API and keeps them in SyncLoop's
+// bucket, to be read by connectors of type upload.
+package upload
+
+import (
+	"context"
+
+	"github.com/Zubimendi/sync-loop/api/internal/model"
+	"github.com/jmoiron/sqlx"
+)
+
+type Repo struct {
+	db *sqlx.DB
+}
+
+func NewRepo(db *sqlx.DB) *Repo { return &Repo{db: db} }
+
+// Create records a new upload. Its object key is built from its id, as
+// uploads/<workspace>/<id>/data<ext>.
+func (r *Repo) Create(ctx context.Context, u *model.Upload, ext string) error {
+	return r.db.QueryRowxContext(ctx, `
+		INSERT INTO upload (id, workspace_id, created_by_user_id, filename, size_bytes, object_key, part_size)
+		SELECT g.id, $1, NULLIF($2,'')::uuid, $3, $4, 'uploads/' || $1 || '/' || g.id || '/data' || $5, $6
+		FROM (SELECT gen_random_uuid() AS id) g
+		RETURNING *`,
+		u.WorkspaceID, deref(u.CreatedBy), u.Filename, u.Size, ext, u.PartSize).StructScan(u)
+}
+
+func (r *Repo) Get(ctx context.Context, id, workspaceID string) (*model.Upload, error) {
+	var u model.Upload
+	err := r.db.GetContext(ctx, &u,
+		`SELECT * FROM upload WHERE id = $1 AND workspace_id = $2`, id, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+func (r *Repo) ListByWorkspace(ctx context.Context, workspaceID string) ([]model.Upload, error) {
+	uu := make([]model.Upload, 0)
+	err := r.db.SelectContext(ctx, &uu, `
+		SELECT * FROM upload WHERE workspace_id = $1 AND status <> 'aborted'
+		ORDER BY created_at DESC`, workspaceID)
+	return uu, err
+}
+
+func (r *Repo) SetMultipart(ctx context.Context, id, s3UploadID string) error {
+	_, err := r.db.ExecContext(ctx,
+		`UPDATE upload SET s3_upload_id = $2 WHERE id = $1`, id, s3UploadID)
+	return err
+}
+
+// Complete marks an upload ready to be read.
+func (r *Repo) Complete(ctx context.Context, u *model.Upload) error {
+	return r.db.QueryRowxContext(ctx, `
+		UPDATE upload SET status = 'ready', size_bytes = $2, s3_upload_id = '', completed_at = now()
+		WHERE id = $1
+		RETURNING *`, u.ID, u.Size).StructScan(u)
+}
+
+func (r *Repo) Abort(ctx context.Context, id string) error {
+	_, err := r.db.ExecContext(ctx,
+		`UPDATE upload SET status = 'aborted', s3_upload_id = '' WHERE id = $1`, id)
+	return err
+}
+
+func (r *Repo) SetOptions(ctx context.Context, id string, o model.UploadOptions) error {
+	_, err := r.db.ExecContext(ctx,
+		`UPDATE upload SET options_json = $2 WHERE id = $1`, id, o)
+	return err
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
@@ -0,0 +1,424 @@
+package upload
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/Zubimendi/sync-loop/api/internal/connector"
+	"github.com/Zubimendi/sync-loop/api/internal/model"
+	"github.com/Zubimendi/sync-loop/api/internal/source"
+	"github.com/Zubimendi/sync-loop/api/internal/storage"
+)
+
+const (
+	// MinPartSize is the smallest part of a resumable upload but the last,
+	// and the chunk size a streamed upload is sent to the bucket in.
+	MinPartSize = 8 << 20
+	// MaxParts is the most parts S3 takes for one object.
+	MaxParts = 10000
+	// MaxSize bounds a single upload.
+	MaxSize = 5 << 30
+	// PreviewRows is the default and MaxPreviewRows the largest preview.
+	PreviewRows    = 20
+	MaxPreviewRows = 1000
+)
+
+// extensions are the file types an upload can be; they pick the parser
+// unless the upload's options set a format.
+var extensions = map[string]bool{
+	".csv": true, ".tsv": true, ".txt": true,
+	".jsonl": true, ".ndjson": true, ".json": true,
+	".parquet": true, ".xlsx": true, ".xlsm": true,
+}
+
+var (
+	ErrNotReady = errors.New("upload is not complete")
+	ErrNotOpen  = errors.New("upload is not in progress")
+)
+
+type Service struct {
+	repo       *Repo
+	connectors *connector.Service
+}
+
+func NewService(repo *Repo, connectors *connector.Service) *Service {
+	return &Service{repo: repo, connectors: connectors}
+}
+
+func (s *Service) Get(ctx context.Context, id, workspaceID string) (*model.Upload, error) {
+	return s.repo.Get(ctx, id, workspaceID)
+}
+
+func (s *Service) List(ctx context.Context, workspaceID string) ([]model.Upload, error) {
+	return s.repo.ListByWorkspace(ctx, workspaceID)
+}
+
+func extension(filename string) (string, error) {
+	ext := strings.ToLower(path.Ext(filename))
+	if !extensions[ext] {
+		return "", fmt.Errorf("%s: unsupported file type; upload csv, tsv, jsonl, parquet or xlsx", filename)
+	}
+	return ext, nil
+}
+
+// Receive stores a file sent in one request, streaming it to the bucket a
+// chunk at a time.
+func (s *Service) Receive(ctx context.Context, workspaceID, userID, filename string, body io.Reader) (*model.Upload, error) {
+	ext, err := extension(filename)
+	if err != nil {
+		return nil, err
+	}
+	store, err := storage.FromEnv(ctx)
+	if err != nil {
+		return nil, err
+	}
+	u := &model.Upload{WorkspaceID: workspaceID, CreatedBy: &userID, Filename: path.Base(filename), PartSize: MinPartSize}
+	if err := s.repo.Create(ctx, u, ext); err != nil {
+		return nil, fmt.Errorf("create upload: %w", err)
+	}
+	size, err := s.stream(ctx, store, u, io.LimitReader(body, MaxSize+1))
+	if err != nil {
+		s.abort(ctx, store, u)
+		return nil, err
+	}
+	u.Size = size
+	if err := s.repo.Complete(ctx, u); err != nil {
+		return nil, fmt.Errorf("complete upload: %w", err)
+	}
+	return u, nil
+}
+
+// stream copies body to the upload's key: in one put when it fits in a
+// chunk, as a multipart upload otherwise.
+func (s *Service) stream(ctx context.Context, store *storage.Store, u *model.Upload, body io.Reader) (int64, error) {
+	buf := make([]byte, MinPartSize)
+	var parts []storage.Part
+	var size int64
+	for n := int32(1); ; n++ {
+		k, err := io.ReadFull(body, buf)
+		last := err == io.EOF || err == io.ErrUnexpectedEOF
+		if err != nil && !last {
+			return 0, err
+		}
+		if size += int64(k); size > MaxSize {
+			return 0, fmt.Errorf("file is larger than %d bytes", int64(MaxSize))
+		}
+		if n == 1 && last {
+			return size, store.Put(ctx, u.Key, bytes.NewReader(buf[:k]))
+		}
+		if k > 0 {
+			if u.S3UploadID == "" {
+				if u.S3UploadID, err = store.CreateMultipart(ctx, u.Key); err != nil {
+					return 0, err
+				}
+				if err := s.repo.SetMultipart(ctx, u.ID, u.S3UploadID); err != nil {
+					return 0, err
+				}
+			}
+			etag, err := store.UploadPart(ctx, u.Key, u.S3UploadID, n, bytes.NewReader(buf[:k]), int64(k))
+			if err != nil {
+				return 0, err
+			}
+			parts = append(parts, storage.Part{Number: n, ETag: etag, Size: int64(k)})
+		}
+		if last {
+			return size, store.CompleteMultipart(ctx, u.Key, u.S3UploadID, parts)
+		}
+	}
+}
+
+// Start begins a resumable upload of a file of the given size, sent as
+// parts of the returned upload's PartSize.
+func (s *Service) Start(ctx context.Context, workspaceID, userID, filename string, size int64) (*model.Upload, error) {
+	ext, err := extension(filename)
+	if err != nil {
+		return nil, err
+	}
+	if size <= 0 || size > MaxSize {
+		return nil, fmt.Errorf("size must be between 1 and %d bytes", int64(MaxSize))
+	}
+	store, err := storage.FromEnv(ctx)
+	if err != nil {
+		return nil, err
+	}
+	u := &model.Upload{WorkspaceID: workspaceID, CreatedBy: &userID, Filename: path.Base(filename), Size: size, PartSize: partSize(size)}
+	if err := s.repo.Create(ctx, u, ext); err != nil {
+		return nil, fmt.Errorf("create upload: %w", err)
+	}
+	if u.S3UploadID, err = store.CreateMultipart(ctx, u.Key); err != nil {
+		s.repo.Abort(ctx, u.ID)
+		return nil, err
+	}
+	if err := s.repo.SetMultipart(ctx, u.ID, u.S3UploadID); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// partSize is the smallest whole-MiB part size that sends size bytes in at
+// most MaxParts parts.
+func partSize(size int64) int64 {
+	p := (size + MaxParts - 1) / MaxParts
+	p = (p + 1<<20 - 1) &^ (1<<20 - 1)
+	return max(p, MinPartSize)
+}
+
+// PartCount is how many parts a resumable upload is sent in.
+func PartCount(u *model.Upload) int32 {
+	return int32((u.Size + u.PartSize - 1) / u.PartSize)
+}
+
+// partLen is the exact size part n must have.
+func partLen(u *model.Upload, n int32) int64 {
+	if n == PartCount(u) {
+		return u.Size - int64(n-1)*u.PartSize
+	}
+	return u.PartSize
+}
+
+// PutPart stores part n of a resumable upload. Sending a part again
+// replaces it.
+func (s *Service) PutPart(ctx context.Context, u *model.Upload, n int32, body io.Reader) (storage.Part, error) {
+	if u.Status != "uploading" || u.S3UploadID == "" {
+		return storage.Part{}, ErrNotOpen
+	}
+	if n < 1 || n > PartCount(u) {
+		return storage.Part{}, fmt.Errorf("part must be between 1 and %d", PartCount(u))
+	}
+	want := partLen(u, n)
+	buf, err := io.ReadAll(io.LimitReader(body, want+1))
+	if err != nil {
+		return storage.Part{}, err
+	}
+	if int64(len(buf)) != want {
+		return storage.Part{}, fmt.Errorf("part %d must be %d bytes, got %d", n, want, len(buf))
+	}
+	store, err := storage.FromEnv(ctx)
+	if err != nil {
+		return storage.Part{}, err
+	}
+	etag, err := store.UploadPart(ctx, u.Key, u.S3UploadID, n, bytes.NewReader(buf), want)
+	if err != nil {
+		return storage.Part{}, err
+	}
+	return storage.Part{Number: n, ETag: etag, Size: want}, nil
+}
+
+// Parts lists the parts of a resumable upload the bucket has, so a client
+// can tell which are left to send.
+func (s *Service) Parts(ctx context.Context, u *model.Upload) ([]storage.Part, error) {
+	if u.Status != "uploading" || u.S3UploadID == "" {
+		return []storage.Part{}, nil
+	}
+	store, err := storage.FromEnv(ctx)
+	if err != nil {
+		return nil, err
+	}
+	pp, err := store.ListParts(ctx, u.Key, u.S3UploadID)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(pp, func(i, j int) bool { return pp[i].Number < pp[j].Number })
+	return pp, nil
+}
+
+// Complete assembles a resumable upload once every part is in.
+func (s *Service) Complete(ctx context.Context, u *model.Upload) error {
+	if u.Status != "uploading" || u.S3UploadID == "" {
+		return ErrNotOpen
+	}
+	pp, err := s.Parts(ctx, u)
+	if err != nil {
+		return err
+	}
+	got := make(map[int32]storage.Part, len(pp))
+	for _, p := range pp {
+		got[p.Number] = p
+	}
+	var missing []string
+	for n := int32(1); n <= PartCount(u); n++ {
+		if p, ok := got[n]; !ok || p.Size != partLen(u, n) {
+			missing = append(missing, fmt.Sprint(n))
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("parts missing: %s", strings.Join(missing, ","))
+	}
+	store, err := storage.FromEnv(ctx)
+	if err != nil {
+		return err
+	}
+	parts := make([]storage.Part, 0, PartCount(u))
+	for n := int32(1); n <= PartCount(u); n++ {
+		parts = append(parts, got[n])
+	}
+	if err := store.CompleteMultipart(ctx, u.Key, u.S3UploadID, parts); err != nil {
+		return err
+	}
+	return s.repo.Complete(ctx, u)
+}
+
+// Delete aborts an upload in progress or removes a finished one's file.
+// Connectors reading it fail from then on.
+func (s *Service) Delete(ctx context.Context, u *model.Upload) error {
+	store, err := storage.FromEnv(ctx)
+	if err != nil {
+		return err
+	}
+	if u.S3UploadID != "" {
+		if err := store.AbortMultipart(ctx, u.Key, u.S3UploadID); err != nil {
+			return err
+		}
+	} else if u.Status == "ready" {
+		if err := store.Delete(ctx, u.Key); err != nil {
+			return err
+		}
+	}
+	return s.repo.Abort(ctx, u.ID)
+}
+
+func (s *Service) abort(ctx context.Context, store *storage.Store, u *model.Upload) {
+	ctx = context.WithoutCancel(ctx)
+	if u.S3UploadID != "" {
+		store.AbortMultipart(ctx, u.Key, u.S3UploadID)
+	}
+	store.Delete(ctx, u.Key)
+	s.repo.Abort(ctx, u.ID)
+}
+
+// Config is the source config of a finished upload, as source.OpenUpload
+// takes it.
+func Config(u *model.Upload) map[string]interface{} {
+	o := u.Options
+	cfg := map[string]interface{}{"key": u.Key}
+	if o.Format != "" {
+		cfg["format"] = o.Format
+	}
+	if o.Delimiter != "" {
+		cfg["delimiter"] = o.Delimiter
+	}
+	if o.Header != nil {
+		cfg["header"] = *o.Header
+	}
+	if o.Sheet != "" {
+		cfg["sheet"] = o.Sheet
+	}
+	if o.Range != "" {
+		cfg["range"] = o.Range
+	}
+	if o.HeaderRow > 0 {
+		cfg["header_row"] = float64(o.HeaderRow)
+	}
+	if len(o.Types) > 0 {
+		tt := make(map[string]interface{}, len(o.Types))
+		for k, v := range o.Types {
+			tt[k] = v
+		}
+		cfg["types"] = tt
+	}
+	return cfg
+}
+
+// Preview is the schema of an upload and its first rows, in column order.
+type Preview struct {
+	Columns []model.Column  `json:"columns"`
+	Rows    [][]interface{} `json:"rows"`
+}
+
+var errPreviewed = errors.New("previewed")
+
+// Preview parses the first rows of a finished upload with the given
+// options.
+func (s *Service) Preview(ctx context.Context, u *model.Upload, o model.UploadOptions, rows int) (*Preview, error) {
+	if u.Status != "ready" {
+		return nil, ErrNotReady
+	}
+	v := *u
+	v.Options = o
+	src, err := source.OpenUpload(ctx, Config(&v))
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+	cols, err := src.Columns(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	p := &Preview{Columns: cols, Rows: make([][]interface{}, 0, rows)}
+	err = src.Read(ctx, source.Query{}, func(row source.Row) error {
+		if len(p.Rows) >= rows {
+			return errPreviewed
+		}
+		r := make([]interface{}, len(cols))
+		for i, c := range cols {
+			r[i] = row[c.Name]
+		}
+		p.Rows = append(p.Rows, r)
+		return nil
+	})
+	if err != nil && !errors.Is(err, errPreviewed) {
+		return nil, err
+	}
+	return p, nil
+}
+
+// SetOptions checks that an upload parses with the given options, whose
+// type overrides must name its columns, and keeps them for its connectors.
+func (s *Service) SetOptions(ctx context.Context, u *model.Upload, o model.UploadOptions) (*Preview, error) {
+	for name, t := range o.Types {
+		if !source.ColumnTypes[t] {
+			return nil, fmt.Errorf("column %s: unsupported type %q", name, t)
+		}
+	}
+	p, err := s.Preview(ctx, u, o, PreviewRows)
+	if err != nil {
+		return nil, err
+	}
+	known := make(map[string]bool, len(p.Columns))
+	for _, c := range p.Columns {
+		known[c.Name] = true
+	}
+	for name := range o.Types {
+		if !known[name] {
+			return nil, fmt.Errorf("no column named %s", name)
+		}
+	}
+	if err := s.repo.SetOptions(ctx, u.ID, o); err != nil {
+		return nil, err
+	}
+	u.Options = o
+	return p, nil
+}
+
+// Connect points a connector at a finished upload: a new one named name,
+// or an existing upload connector, say to load a corrected file with the
+// same jobs.
+func (s *Service) Connect(ctx context.Context, u *model.Upload, name, connectorID, userID string) (*model.Connector, error) {
+	if u.Status != "ready" {
+		return nil, ErrNotReady
+	}
+	cfg := map[string]interface{}{"upload_id": u.ID}
+	if connectorID == "" {
+		if name == "" {
+			name = u.Filename
+		}
+		return s.connectors.CreateSource(ctx, name, "upload", cfg, userID, u.WorkspaceID)
+	}
+	c, _, err := s.connectors.Config(ctx, connectorID)
+	if err != nil {
+		return nil, err
+	}
+	if c.Workspace != u.WorkspaceID || c.Type != "upload" {
+		return nil, errors.New("connector is not an upload connector of this workspace")
+	}
+	if err := s.connectors.UpdateConfig(ctx, c.ID, c.Workspace, cfg); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
@@ -0,0 +1,199 @@
+// Package webhook POSTs JSON to an HTTP endpoint for the webhook
+// destination. Requests can be signed: with a signing secret, each carries
+//
+//	X-Syncloop-Signature: t=<unix seconds>,v1=<hex HMAC-SHA256>
+//
+// where the HMAC, keyed by the secret, is over "<t>.<body>". Receivers
+// recompute it and reject stale timestamps to stop replays.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Zubimendi/sync-loop/api/internal/retry"
+)
+
+const (
+	SignatureHeader = "X-Syncloop-Signature"
+	// IdempotencyHeader carries a key that is the same every time a
+	// request is retried or resent, so receivers can drop duplicates.
+	IdempotencyHeader = "Idempotency-Key"
+
+	defaultRetries = 5
+	maxBackoff     = time.Minute
+)
+
+// reserved are the headers the client sets itself.
+var reserved = map[string]bool{
+	"Content-Type": true, "Content-Length": true, "Host": true,
+	SignatureHeader: true, IdempotencyHeader: true,
+}
+
+// Config is how a webhook connector reaches its endpoint.
+type Config struct {
+	URL string
+	// Headers are sent with every request, e.g. an Authorization token.
+	Headers       map[string]string
+	SigningSecret string
+	// MaxRetries bounds the retries of a request refused with 429 or a
+	// server error, or that failed to connect.
+	MaxRetries int
+}
+
+// ConfigFrom reads the keys of a connector config: url, headers (an object
+// of header names to values), signing_secret and max_retries.
+func ConfigFrom(cfg map[string]interface{}) (Config, error) {
+	c := Config{Headers: map[string]string{}, MaxRetries: defaultRetries}
+	c.URL, _ = cfg["url"].(string)
+	c.SigningSecret, _ = cfg["signing_secret"].(string)
+	if n, ok := cfg["max_retries"].(float64); ok && n >= 0 {
+		c.MaxRetries = int(n)
+	}
+	if hh, ok := cfg["headers"].(map[string]interface{}); ok {
+		for k, v := range hh {
+			s, ok := v.(string)
+			if !ok {
+				return c, fmt.Errorf("webhook: header %s is not a string", k)
+			}
+			k = http.CanonicalHeaderKey(k)
+			if reserved[k] {
+				return c, fmt.Errorf("webhook: header %s is set by SyncLoop", k)
+			}
+			c.Headers[k] = s
+		}
+	}
+	u, err := url.Parse(c.URL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return c, fmt.Errorf("webhook: bad url %q", c.URL)
+	}
+	return c, nil
+}
+
+// Client posts to one endpoint.
+type Client struct {
+	cfg  Config
+	http *http.Client
+}
+
+// New builds a client whose requests go through transport. Redirects are
+// not followed: a signed request is meant for the URL it was signed for.
+func New(c Config, transport http.RoundTripper) *Client {
+	return &Client{cfg: c, http: &http.Client{
+		Transport: transport,
+		Timeout:   2 * time.Minute,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}}
+}
+
+func (c *Client) Close() { c.http.CloseIdleConnections() }
+
+// Reachable connects to the endpoint's host without sending anything, as
+// any request might be taken for a delivery.
+func Reachable(ctx context.Context, c Config, dial func(ctx context.Context, network, addr string) (net.Conn, error)) error {
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		return err
+	}
+	port := u.Port()
+	if port == "" {
+		port = "443"
+		if u.Scheme == "http" {
+			port = "80"
+		}
+	}
+	conn, err := dial(ctx, "tcp", net.JoinHostPort(u.Hostname(), port))
+	if err != nil {
+		return fmt.Errorf("webhook: %w", err)
+	}
+	return conn.Close()
+}
+
+// StatusError is an answer other than 2xx.
+type StatusError struct {
+	Code int
+	Body string
+}
+
+func (e *StatusError) Error() string {
+	if e.Body == "" {
+		return fmt.Sprintf("webhook: %d %s", e.Code, http.StatusText(e.Code))
+	}
+	return fmt.Sprintf("webhook: %d %s: %s", e.Code, http.StatusText(e.Code), e.Body)
+}
+
+// Post sends body as JSON, retrying 429s and server errors after the
+// Retry-After the endpoint asks for or an exponential backoff. Failed
+// connections are retried too: the idempotency key lets the endpoint tell
+// a resend from a new request. Each attempt is signed afresh.
+func (c *Client) Post(ctx context.Context, body []byte, idempotencyKey string) error {
+	for attempt := 0; ; attempt++ {
+		resp, err := c.send(ctx, body, idempotencyKey)
+		if err != nil {
+			if ctx.Err() != nil || attempt >= c.cfg.MaxRetries {
+				return fmt.Errorf("webhook: %w", err)
+			}
+			if err := retry.Sleep(ctx, retry.Backoff(attempt, maxBackoff)); err != nil {
+				return err
+			}
+			continue
+		}
+		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<20))
+			resp.Body.Close()
+			return nil
+		}
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		resp.Body.Close()
+		se := &StatusError{Code: resp.StatusCode, Body: strings.TrimSpace(string(msg))}
+		if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode < 500 {
+			return se
+		}
+		if attempt >= c.cfg.MaxRetries {
+			return fmt.Errorf("%w (after %d retries)", se, attempt)
+		}
+		if err := retry.Sleep(ctx, retry.After(resp.Header.Get("Retry-After"), retry.Backoff(attempt, maxBackoff))); err != nil {
+			return err
+		}
+	}
+}
+
+func (c *Client) send(ctx context.Context, body []byte, idempotencyKey string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range c.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if idempotencyKey != "" {
+		req.Header.Set(IdempotencyHeader, idempotencyKey)
+	}
+	if c.cfg.SigningSecret != "" {
+		req.Header.Set(SignatureHeader, sign(c.cfg.SigningSecret, time.Now(), body))
+	}
+	return c.http.Do(req)
+}
+
+// sign computes the signature header of a body sent at t.
+func sign(secret string, t time.Time, body []byte) string {
+	ts := strconv.FormatInt(t.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts + "."))
+	mac.Write(body)
+	return "t=" + ts + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
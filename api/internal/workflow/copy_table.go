@@ -2,8 +2,10 @@ package workflow
 
 import (
 	"fmt"
+	"strings"
 	"time"
 
+	"github.com/Zubimendi/sync-loop/api/internal/model"
 	"go.temporal.io/sdk/temporal"
 	"go.temporal.io/sdk/workflow"
 )
@@ -11,8 +13,19 @@ import (
 type CopyTableParams struct {
 	Table        string
 	ConnectorID  string
+	WorkspaceID  string
 	Incremental  bool
 	LastSyncTime time.Time
+	// CursorColumn drives incremental reads; defaults to updated_at.
+	CursorColumn string
+	// FailOnChecksumMismatch fails the run when the loaded rows do not hash
+	// to the extracted ones. Otherwise the run is marked unverified.
+	FailOnChecksumMismatch bool
+	// ReplayRunID reruns the dead-lettered rows of an earlier run instead of
+	// reading the source. ReplayStage picks which rejects: transform rows go
+	// through the mappings again, load rows skip straight to the load.
+	ReplayRunID string
+	ReplayStage string
 }
 
 func CopyTableWorkflow(ctx workflow.Context, params CopyTableParams) error {
@@ -38,12 +51,45 @@ func CopyTableWorkflow(ctx workflow.Context, params CopyTableParams) error {
 		return currentState, nil
 	})
 
+	// Open a sync_run so row counts and schema snapshots have somewhere to land
+	currentState = "starting_run"
+	runStart := workflow.Now(ctx)
+	var runInfo RunInfo
+	err := workflow.ExecuteActivity(ctx, "StartRunActivity", StartRunParams{
+		WorkspaceID: params.WorkspaceID,
+		ConnectorID: params.ConnectorID,
+		Table:       params.Table,
+	}).Get(ctx, &runInfo)
+	if err != nil {
+		currentState = "start_run_failed"
+		logger.Error("StartRunActivity failed", "error", err)
+		return fmt.Errorf("start run failed: %w", err)
+	}
+
+	// finish closes the sync_run even if the workflow itself was cancelled
+	finish := func(fp FinishRunParams, cause error) {
+		fctx, _ := workflow.NewDisconnectedContext(ctx)
+		fp.RunID = runInfo.RunID
+		if cause != nil {
+			fp.Error = cause.Error()
+		}
+		if err := workflow.ExecuteActivity(fctx, "FinishRunActivity", fp).Get(fctx, nil); err != nil {
+			logger.Error("FinishRunActivity failed", "error", err)
+		}
+	}
+
+	replay := params.ReplayRunID != ""
+	if replay {
+		params.Incremental = false
+	}
+
 	// Get last sync time if incremental
 	var lastSyncTime = params.LastSyncTime
 	if params.Incremental && lastSyncTime.IsZero() {
 		currentState = "fetching_last_sync_time"
 		var lastSync LastSyncInfo
 		err := workflow.ExecuteActivity(ctx, "GetLastSyncTimeActivity", GetLastSyncTimeParams{
+			JobID:       runInfo.JobID,
 			ConnectorID: params.ConnectorID,
 			Table:       params.Table,
 		}).Get(ctx, &lastSync)
@@ -60,58 +106,207 @@ func CopyTableWorkflow(ctx workflow.Context, params CopyTableParams) error {
 	// Extract data
 	currentState = "extracting"
 	var extractResult ExtractResult
-	err := workflow.ExecuteActivity(ctx, "ExtractActivity", ExtractParams{
+	err = workflow.ExecuteActivity(ctx, "ExtractActivity", ExtractParams{
+		WorkspaceID:  params.WorkspaceID,
+		JobID:        runInfo.JobID,
 		Table:        params.Table,
 		ConnectorID:  params.ConnectorID,
 		Incremental:  params.Incremental,
 		LastSyncTime: lastSyncTime,
+		CursorColumn: params.CursorColumn,
+		ReplayRunID:  params.ReplayRunID,
+		ReplayStage:  params.ReplayStage,
 	}).Get(ctx, &extractResult)
 	
 	if err != nil {
 		currentState = "extract_failed"
 		logger.Error("ExtractActivity failed", "error", err)
+		finish(FinishRunParams{Status: runFailedStatus(ctx)}, err)
 		return fmt.Errorf("extract failed: %w", err)
 	}
 
+	// Replays read a handful of rejected rows, not the source, so they say
+	// nothing about its schema or volume.
+	if !replay {
+		// Snapshot the source schema; drift raises alerts but never fails the run
+		currentState = "snapshotting_schema"
+		var schemaResult SnapshotSchemaResult
+		err = workflow.ExecuteActivity(ctx, "SnapshotSchemaActivity", SnapshotSchemaParams{
+			WorkspaceID: params.WorkspaceID,
+			JobID:       runInfo.JobID,
+			RunID:       runInfo.RunID,
+			ConnectorID: params.ConnectorID,
+			Table:       params.Table,
+			Columns:     extractResult.Columns,
+		}).Get(ctx, &schemaResult)
+		if err != nil {
+			logger.Error("SnapshotSchemaActivity failed", "error", err)
+		} else if len(schemaResult.Changes) > 0 {
+			logger.Warn("Source schema changed", "schema_hash", schemaResult.Hash, "changes", len(schemaResult.Changes))
+		}
+
+		// Score the extracted volume against run history. A run with 0 rows is
+		// still checked here before it short-circuits as a success.
+		currentState = "checking_volume"
+		var anomalyResult DetectAnomalyResult
+		err = workflow.ExecuteActivity(ctx, "DetectAnomalyActivity", DetectAnomalyParams{
+			WorkspaceID: params.WorkspaceID,
+			JobID:       runInfo.JobID,
+			RunID:       runInfo.RunID,
+			Table:       params.Table,
+			RowsRead:    extractResult.RowCount,
+			StartedAt:   runStart,
+		}).Get(ctx, &anomalyResult)
+		if err != nil {
+			logger.Error("DetectAnomalyActivity failed", "error", err)
+		} else if anomalyResult.Anomalous {
+			logger.Warn("Row count anomaly", "rows", extractResult.RowCount, "expected", anomalyResult.Expected)
+		}
+	}
+
 	if extractResult.RowCount == 0 {
 		currentState = "no_data_to_process"
 		logger.Info("No new data to process")
+		finish(FinishRunParams{Status: "success", Checksum: extractResult.Checksum}, nil)
 		return nil
 	}
 
-	// Transform data
+	// Transform data; rows that fail their mapping are dead-lettered
 	currentState = "transforming"
 	var transformResult TransformResult
-	err = workflow.ExecuteActivity(ctx, "TransformActivity", TransformParams{
-		Data:      extractResult.Data,
-		Table:     params.Table,
-	}).Get(ctx, &transformResult)
-	
+	if params.ReplayStage == "load" {
+		transformResult = TransformResult{
+			Data:     extractResult.Data,
+			Columns:  extractResult.Columns,
+			RowCount: extractResult.RowCount,
+		}
+	} else {
+		err = workflow.ExecuteActivity(ctx, "TransformActivity", TransformParams{
+			Data:    extractResult.Data,
+			Columns: extractResult.Columns,
+			Table:   params.Table,
+			JobID:   runInfo.JobID,
+			RunID:   runInfo.RunID,
+		}).Get(ctx, &transformResult)
+	}
+
 	if err != nil {
 		currentState = "transform_failed"
 		logger.Error("TransformActivity failed", "error", err)
+		finish(FinishRunParams{Status: runFailedStatus(ctx), RowsRead: extractResult.RowCount, Checksum: extractResult.Checksum}, err)
 		return fmt.Errorf("transform failed: %w", err)
 	}
+	if err := runInfo.checkErrorBudget(transformResult.Rejected, extractResult.RowCount); err != nil {
+		currentState = "error_budget_exceeded"
+		finish(FinishRunParams{
+			Status:    "failed",
+			RowsRead:  extractResult.RowCount,
+			Checksum:  extractResult.Checksum,
+			ErrorRows: transformResult.Rejected,
+		}, err)
+		return err
+	}
 
 	// Load data
 	currentState = "loading"
 	var loadResult LoadResult
 	err = workflow.ExecuteActivity(ctx, "LoadActivity", LoadParams{
 		Data:        transformResult.Data,
+		Columns:     transformResult.Columns,
 		Table:       params.Table,
+		WorkspaceID: params.WorkspaceID,
 		ConnectorID: params.ConnectorID,
+		JobID:       runInfo.JobID,
+		RunID:       runInfo.RunID,
 	}).Get(ctx, &loadResult)
 	
 	if err != nil {
 		currentState = "load_failed"
 		logger.Error("LoadActivity failed", "error", err)
+		finish(FinishRunParams{Status: runFailedStatus(ctx), RowsRead: extractResult.RowCount, Checksum: extractResult.Checksum}, err)
 		return fmt.Errorf("load failed: %w", err)
 	}
+	errorRows := transformResult.Rejected + loadResult.Rejected
+	if err := runInfo.checkErrorBudget(errorRows, extractResult.RowCount); err != nil {
+		currentState = "error_budget_exceeded"
+		finish(FinishRunParams{
+			Status:       "failed",
+			RowsRead:     extractResult.RowCount,
+			RowsWritten:  loadResult.RowsProcessed,
+			Checksum:     extractResult.Checksum,
+			DestChecksum: loadResult.Checksum,
+			ErrorRows:    errorRows,
+		}, err)
+		return err
+	}
+
+	// Verify the loaded rows hash to what was extracted (or transformed,
+	// or accepted by the destination when it rejected some)
+	runStatus := "success"
+	expected := extractResult.Checksum
+	if transformResult.Checksum != "" {
+		expected = transformResult.Checksum
+	}
+	if loadResult.AcceptedChecksum != "" {
+		expected = loadResult.AcceptedChecksum
+	}
+	if loadResult.Checksum != expected {
+		logger.Warn("Checksum mismatch", "expected", expected, "loaded", loadResult.Checksum)
+		mismatch := fmt.Errorf("checksum mismatch: expected %s, destination has %s", expected, loadResult.Checksum)
+		if params.FailOnChecksumMismatch {
+			currentState = "checksum_failed"
+			finish(FinishRunParams{
+				Status:       "failed",
+				RowsRead:     extractResult.RowCount,
+				RowsWritten:  loadResult.RowsProcessed,
+				Checksum:     extractResult.Checksum,
+				DestChecksum: loadResult.Checksum,
+				ErrorRows:    errorRows,
+			}, mismatch)
+			return mismatch
+		}
+		runStatus = "unverified"
+	} else if errorRows > 0 {
+		runStatus = "partial_success"
+	}
+
+	// Data quality assertions; warn-level failures keep the run successful
+	currentState = "asserting"
+	var assertResult RunAssertionsResult
+	err = workflow.ExecuteActivity(ctx, "RunAssertionsActivity", RunAssertionsParams{
+		WorkspaceID: params.WorkspaceID,
+		JobID:       runInfo.JobID,
+		RunID:       runInfo.RunID,
+		ConnectorID: params.ConnectorID,
+		Table:       params.Table,
+		Data:        transformResult.Data,
+		RowCount:    loadResult.RowsProcessed,
+	}).Get(ctx, &assertResult)
+	if err == nil && assertResult.Failed > 0 {
+		err = fmt.Errorf("%d assertions failed: %s", assertResult.Failed, strings.Join(assertResult.Failures, "; "))
+	}
+	if err != nil {
+		currentState = "assertions_failed"
+		logger.Error("Assertions failed", "error", err)
+		finish(FinishRunParams{
+			Status:       runFailedStatus(ctx),
+			RowsRead:     extractResult.RowCount,
+			RowsWritten:  loadResult.RowsProcessed,
+			Checksum:     extractResult.Checksum,
+			DestChecksum: loadResult.Checksum,
+			ErrorRows:    errorRows,
+		}, err)
+		return fmt.Errorf("assertions failed: %w", err)
+	}
+	if assertResult.Warned > 0 {
+		logger.Warn("Assertions warned", "count", assertResult.Warned)
+	}
 
 	// Update last sync time if incremental
 	if params.Incremental {
 		currentState = "updating_sync_time"
 		err = workflow.ExecuteActivity(ctx, "UpdateLastSyncTimeActivity", UpdateLastSyncTimeParams{
+			JobID:       runInfo.JobID,
 			ConnectorID: params.ConnectorID,
 			Table:       params.Table,
 			SyncTime:    extractResult.MaxTimestamp,
@@ -124,51 +319,193 @@ func CopyTableWorkflow(ctx workflow.Context, params CopyTableParams) error {
 		}
 	}
 
+	// Remember the files this run loaded, so incremental runs skip them,
+	// and let the source delete or archive them if it is set up to. An
+	// unverified run keeps its files, as they may be needed to reload.
+	if len(extractResult.Files) > 0 {
+		currentState = "recording_files"
+		err = workflow.ExecuteActivity(ctx, "RecordSourceFilesActivity", RecordSourceFilesParams{
+			WorkspaceID: params.WorkspaceID,
+			JobID:       runInfo.JobID,
+			RunID:       runInfo.RunID,
+			ConnectorID: params.ConnectorID,
+			Files:       extractResult.Files,
+			Consume:     runStatus != "unverified",
+		}).Get(ctx, nil)
+		if err != nil {
+			currentState = "record_files_failed"
+			logger.Error("RecordSourceFilesActivity failed", "error", err)
+			// The next incremental run picks these files up again
+		}
+	}
+
+	// Commit where the source stopped, such as Kafka offsets, now that its
+	// rows are loaded
+	if extractResult.Checkpoint != "" {
+		currentState = "committing_checkpoint"
+		err = workflow.ExecuteActivity(ctx, "CommitCheckpointActivity", CommitCheckpointParams{
+			WorkspaceID: params.WorkspaceID,
+			ConnectorID: params.ConnectorID,
+			Checkpoint:  extractResult.Checkpoint,
+		}).Get(ctx, nil)
+		if err != nil {
+			currentState = "commit_checkpoint_failed"
+			logger.Error("CommitCheckpointActivity failed", "error", err)
+			// The next run reads these rows again
+		}
+	}
+
 	currentState = "completed"
+	finish(FinishRunParams{
+		Status:       runStatus,
+		RowsRead:     extractResult.RowCount,
+		RowsWritten:  loadResult.RowsProcessed,
+		Checksum:     extractResult.Checksum,
+		DestChecksum: loadResult.Checksum,
+		ErrorRows:    errorRows,
+	}, nil)
 	logger.Info("CopyTableWorkflow completed successfully", 
 		"rows_processed", loadResult.RowsProcessed,
+		"error_rows", errorRows,
 		"incremental", params.Incremental)
 	
 	return nil
 }
 
+// runFailedStatus maps a failed step to the sync_run status: cancellation
+// surfaces as an activity error too, so check the workflow context first.
+func runFailedStatus(ctx workflow.Context) string {
+	if ctx.Err() != nil {
+		return "cancelled"
+	}
+	return "failed"
+}
+
 // Activity parameter types
+type StartRunParams struct {
+	WorkspaceID string
+	ConnectorID string
+	Table       string
+}
+
+type RunInfo struct {
+	JobID string
+	RunID string
+	// Error budget of the job, see checkErrorBudget.
+	MaxErrorRows int64
+	MaxErrorPct  float64
+}
+
+// checkErrorBudget fails once more rows were rejected than the job allows.
+// The run stays within budget while the rejects are at most MaxErrorRows or
+// at most MaxErrorPct percent of the rows read; with both at zero any
+// rejected row fails the run.
+func (ri RunInfo) checkErrorBudget(rejected, read int64) error {
+	if rejected == 0 || rejected <= ri.MaxErrorRows {
+		return nil
+	}
+	if ri.MaxErrorPct > 0 && read > 0 && float64(rejected)*100/float64(read) <= ri.MaxErrorPct {
+		return nil
+	}
+	return temporal.NewNonRetryableApplicationError(
+		fmt.Sprintf("error budget exceeded: %d of %d rows rejected", rejected, read),
+		"ErrorBudgetExceeded", nil)
+}
+
+type FinishRunParams struct {
+	RunID        string
+	Status       string
+	RowsRead     int64
+	RowsWritten  int64
+	Checksum     string
+	DestChecksum string
+	Error        string
+	ErrorRows    int64
+}
+
+type SnapshotSchemaParams struct {
+	WorkspaceID string
+	JobID       string
+	RunID       string
+	ConnectorID string
+	Table       string
+	// Columns as seen by ExtractActivity; looked up again when empty.
+	Columns []model.Column
+}
+
+type SnapshotSchemaResult struct {
+	Hash    string
+	Changes []model.SchemaChange
+}
+
 type ExtractParams struct {
+	WorkspaceID  string
+	JobID        string
 	Table        string
 	ConnectorID  string
 	Incremental  bool
 	LastSyncTime time.Time
+	CursorColumn string
+	ReplayRunID  string
+	ReplayStage  string
 }
 
 type ExtractResult struct {
 	Data         []map[string]interface{}
+	Columns      []model.Column
 	RowCount     int64
 	MaxTimestamp time.Time
 	Checksum     string
+	// Files are the files a file-based source read.
+	Files []model.SourceFile
+	// Checkpoint is where a source that keeps its own position stopped,
+	// committed once the run succeeds.
+	Checkpoint string
 }
 
 type TransformParams struct {
-	Data  []map[string]interface{}
-	Table string
+	Data    []map[string]interface{}
+	Columns []model.Column
+	Table   string
+	JobID   string
+	RunID   string
 }
 
 type TransformResult struct {
 	Data     []map[string]interface{}
+	Columns  []model.Column
 	RowCount int64
+	// Checksum is set only when the transform rewrote rows; the load is
+	// then verified against it instead of the extract checksum.
+	Checksum string
+	// Rejected rows were dead-lettered and are not in Data.
+	Rejected int64
 }
 
 type LoadParams struct {
 	Data        []map[string]interface{}
+	Columns     []model.Column
 	Table       string
+	WorkspaceID string
 	ConnectorID string
+	JobID       string
+	RunID       string
 }
 
 type LoadResult struct {
 	RowsProcessed int64
 	Success       bool
+	// Checksum is the digest of the rows read back from the destination.
+	Checksum  string
+	ObjectKey string
+	// Rejected rows were refused by the destination and dead-lettered;
+	// AcceptedChecksum then digests the rows it was actually given.
+	Rejected         int64
+	AcceptedChecksum string
 }
 
 type GetLastSyncTimeParams struct {
+	JobID       string
 	ConnectorID string
 	Table       string
 }
@@ -178,7 +515,56 @@ type LastSyncInfo struct {
 }
 
 type UpdateLastSyncTimeParams struct {
+	JobID       string
 	ConnectorID string
 	Table       string
 	SyncTime    time.Time
-}
\ No newline at end of file
+}
+
+type RecordSourceFilesParams struct {
+	WorkspaceID string
+	JobID       string
+	RunID       string
+	ConnectorID string
+	Files       []model.SourceFile
+	// Consume lets the source delete or archive the files once recorded.
+	Consume bool
+}
+
+type CommitCheckpointParams struct {
+	WorkspaceID string
+	ConnectorID string
+	Checkpoint  string
+}
+
+type RunAssertionsParams struct {
+	WorkspaceID string
+	JobID       string
+	RunID       string
+	ConnectorID string
+	Table       string
+	Data        []map[string]interface{}
+	RowCount    int64
+}
+
+type RunAssertionsResult struct {
+	Passed   int
+	Warned   int
+	Failed   int
+	Failures []string
+}
+
+type DetectAnomalyParams struct {
+	WorkspaceID string
+	JobID       string
+	RunID       string
+	Table       string
+	RowsRead    int64
+	StartedAt   time.Time
+}
+
+type DetectAnomalyResult struct {
+	Anomalous bool
+	Score     float64
+	Expected  float64
+}
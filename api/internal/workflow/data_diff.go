@@ -0,0 +1,110 @@
+package workflow
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Zubimendi/sync-loop/api/internal/model"
+	"go.temporal.io/sdk/temporal"
+	"go.temporal.io/sdk/workflow"
+)
+
+type DataDiffParams struct {
+	WorkspaceID       string
+	SourceConnectorID string
+	TargetConnectorID string
+	// Either a table or a SELECT per side; TargetTable defaults to SourceTable.
+	SourceTable string
+	SourceQuery string
+	TargetTable string
+	TargetQuery string
+	KeyColumn   string
+	Columns     []string
+	Tolerances  []model.DiffTolerance
+	LeafRows    int64
+}
+
+type DataDiffResult struct {
+	DiffID    string
+	ReportKey string
+	Stats     model.DiffStats
+}
+
+// DataDiffWorkflow compares a table or query across two connectors and
+// writes a report of missing, extra and mismatched rows to the bucket.
+func DataDiffWorkflow(ctx workflow.Context, params DataDiffParams) (DataDiffResult, error) {
+	logger := workflow.GetLogger(ctx)
+	logger.Info("Starting DataDiffWorkflow",
+		"source", params.SourceConnectorID,
+		"target", params.TargetConnectorID,
+		"key", params.KeyColumn)
+
+	if params.TargetTable == "" && params.TargetQuery == "" {
+		params.TargetTable = params.SourceTable
+	}
+
+	ctx = workflow.WithActivityOptions(ctx, workflow.ActivityOptions{
+		StartToCloseTimeout: time.Hour * 6,
+		HeartbeatTimeout:    time.Minute * 2,
+		RetryPolicy: &temporal.RetryPolicy{
+			InitialInterval:    time.Second,
+			BackoffCoefficient: 2.0,
+			MaximumInterval:    time.Minute * 5,
+			MaximumAttempts:    3,
+		},
+	})
+
+	var currentState = "starting"
+	workflow.SetQueryHandler(ctx, "state", func() (string, error) {
+		return currentState, nil
+	})
+
+	var diffID string
+	err := workflow.ExecuteActivity(ctx, "StartDataDiffActivity", params).Get(ctx, &diffID)
+	if err != nil {
+		currentState = "start_failed"
+		return DataDiffResult{}, fmt.Errorf("start diff failed: %w", err)
+	}
+
+	currentState = "diffing"
+	var result DataDiffResult
+	err = workflow.ExecuteActivity(ctx, "DiffTableActivity", DiffTableParams{
+		DiffID: diffID,
+		Params: params,
+	}).Get(ctx, &result)
+
+	finish := FinishDataDiffParams{DiffID: diffID, Status: "success", Stats: result.Stats, ReportKey: result.ReportKey}
+	if err != nil {
+		currentState = "diff_failed"
+		logger.Error("DiffTableActivity failed", "error", err)
+		finish.Status, finish.Error = runFailedStatus(ctx), err.Error()
+	}
+	fctx, _ := workflow.NewDisconnectedContext(ctx)
+	if ferr := workflow.ExecuteActivity(fctx, "FinishDataDiffActivity", finish).Get(fctx, nil); ferr != nil {
+		logger.Error("FinishDataDiffActivity failed", "error", ferr)
+	}
+	if err != nil {
+		return DataDiffResult{}, fmt.Errorf("diff failed: %w", err)
+	}
+
+	currentState = "completed"
+	result.DiffID = diffID
+	logger.Info("DataDiffWorkflow completed",
+		"missing", result.Stats.Missing,
+		"extra", result.Stats.Extra,
+		"mismatched", result.Stats.Mismatched)
+	return result, nil
+}
+
+type DiffTableParams struct {
+	DiffID string
+	Params DataDiffParams
+}
+
+type FinishDataDiffParams struct {
+	DiffID    string
+	Status    string
+	Stats     model.DiffStats
+	ReportKey string
+	Error     string
+}
@@ -0,0 +1,418 @@
+// Package xlsx reads typed cells out of Excel workbooks on top of excelize.
+// Date-formatted numbers become times, numbers keep the fixed decimals of
+// their format and merged ranges repeat their top-left value, so a sheet
+// reads the way it looks in Excel.
+package xlsx
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// Sheet limits of the file format.
+const (
+	MaxRows      = 1048576
+	MaxCols      = 16384
+	MaxCellChars = 32767
+	MaxSheetName = 31
+)
+
+type Kind int
+
+const (
+	Empty Kind = iota
+	Text
+	Number
+	Bool
+	Date     // a date-formatted number without a time of day
+	DateTime // a date-formatted number with one
+	Time     // a time of day alone
+	Error    // #N/A, #DIV/0! and the like
+)
+
+// Cell is one typed cell. Value holds the text, the number in plain decimal
+// notation, true/false or the error code; Time holds the wall clock of the
+// date kinds, in UTC.
+type Cell struct {
+	Kind  Kind
+	Value string
+	Time  time.Time
+}
+
+// Open reads a whole workbook.
+func Open(r io.Reader) (*excelize.File, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return excelize.OpenReader(bytes.NewReader(b))
+}
+
+// Date1904 reports whether the workbook counts dates from 1904, as old Mac
+// workbooks do.
+func Date1904(f *excelize.File) bool {
+	p, err := f.GetWorkbookProps()
+	return err == nil && p.Date1904 != nil && *p.Date1904
+}
+
+// ReadSheet returns the typed cells of a sheet, row by row from A1. Rows
+// and cells past the last non-empty one are left out.
+func ReadSheet(f *excelize.File, sheet string) ([][]Cell, error) {
+	raw, err := f.GetRows(sheet, excelize.Options{RawCellValue: true})
+	if err != nil {
+		return nil, err
+	}
+	rd := reader{f: f, sheet: sheet, date1904: Date1904(f), formats: map[int]numFormat{}}
+	grid := make([][]Cell, len(raw))
+	for r, rec := range raw {
+		grid[r] = make([]Cell, len(rec))
+		for c, v := range rec {
+			if v == "" {
+				continue
+			}
+			axis, err := excelize.CoordinatesToCellName(c+1, r+1)
+			if err != nil {
+				return nil, err
+			}
+			if grid[r][c], err = rd.cell(axis, v); err != nil {
+				return nil, fmt.Errorf("%s!%s: %w", sheet, axis, err)
+			}
+		}
+	}
+	return fillMerged(f, sheet, grid)
+}
+
+type reader struct {
+	f        *excelize.File
+	sheet    string
+	date1904 bool
+	formats  map[int]numFormat
+}
+
+func (rd *reader) cell(axis, raw string) (Cell, error) {
+	t, err := rd.f.GetCellType(rd.sheet, axis)
+	if err != nil {
+		return Cell{}, err
+	}
+	switch t {
+	case excelize.CellTypeBool:
+		return Cell{Kind: Bool, Value: strconv.FormatBool(raw == "1" || strings.EqualFold(raw, "true"))}, nil
+	case excelize.CellTypeError:
+		return Cell{Kind: Error, Value: raw}, nil
+	case excelize.CellTypeDate:
+		// ISO 8601 dates, which few writers use.
+		for _, l := range []string{time.RFC3339Nano, "2006-01-02T15:04:05.999999999", "2006-01-02"} {
+			if tm, err := time.Parse(l, raw); err == nil {
+				return timeCell(tm.UTC(), numFormat{date: true, time: l != "2006-01-02"}), nil
+			}
+		}
+		return Cell{Kind: Text, Value: raw}, nil
+	case excelize.CellTypeUnset, excelize.CellTypeNumber:
+		n, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return Cell{Kind: Text, Value: raw}, nil
+		}
+		nf, err := rd.format(axis)
+		if err != nil {
+			return Cell{}, err
+		}
+		if (nf.date || nf.time) && n >= 0 {
+			return timeCell(TimeOf(n, rd.date1904), nf), nil
+		}
+		return Cell{Kind: Number, Value: FormatNumber(n, nf.decimals)}, nil
+	}
+	return Cell{Kind: Text, Value: raw}, nil
+}
+
+func timeCell(t time.Time, nf numFormat) Cell {
+	switch {
+	case nf.date && nf.time:
+		return Cell{Kind: DateTime, Time: t}
+	case nf.date:
+		return Cell{Kind: Date, Time: t}
+	}
+	return Cell{Kind: Time, Time: t}
+}
+
+// FormatNumber renders n the way Excel shows it, to 15 significant digits,
+// padded with zeros to at least decimals places. It never rounds to fit
+// decimals, so no digit stored in the cell is lost.
+func FormatNumber(n float64, decimals int) string {
+	if math.IsNaN(n) || math.IsInf(n, 0) {
+		return strconv.FormatFloat(n, 'f', -1, 64)
+	}
+	n, _ = strconv.ParseFloat(strconv.FormatFloat(n, 'g', 15, 64), 64)
+	s := strconv.FormatFloat(n, 'f', -1, 64)
+	if decimals > 0 {
+		_, frac, ok := strings.Cut(s, ".")
+		if !ok {
+			s += "."
+		}
+		s += strings.Repeat("0", max(0, decimals-len(frac)))
+	}
+	return s
+}
+
+var (
+	epoch1900 = time.Date(1899, time.December, 30, 0, 0, 0, 0, time.UTC)
+	epoch1904 = time.Date(1904, time.January, 1, 0, 0, 0, 0, time.UTC)
+	// Excel counts a 29 February 1900 that never was; serials before it
+	// are one day off.
+	leapBug = time.Date(1900, time.March, 1, 0, 0, 0, 0, time.UTC)
+)
+
+// TimeOf converts a date serial to its wall clock, to the microsecond.
+func TimeOf(serial float64, date1904 bool) time.Time {
+	epoch := epoch1900
+	if date1904 {
+		epoch = epoch1904
+	} else if serial < 61 {
+		epoch = epoch.AddDate(0, 0, 1)
+	}
+	days := math.Floor(serial)
+	us := math.Round((serial - days) * 86400e6)
+	return epoch.AddDate(0, 0, int(days)).Add(time.Duration(us) * time.Microsecond)
+}
+
+// Serial converts a wall clock to a date serial. It fails for times before
+// the workbook's epoch or after 9999, which Excel cannot show as dates.
+func Serial(t time.Time, date1904 bool) (float64, bool) {
+	epoch, first := epoch1900, time.Date(1900, time.January, 1, 0, 0, 0, 0, time.UTC)
+	if date1904 {
+		epoch, first = epoch1904, epoch1904
+	} else if t.Before(leapBug) {
+		epoch = epoch.AddDate(0, 0, 1)
+	}
+	if t.Before(first) || t.Year() > 9999 {
+		return 0, false
+	}
+	secs := t.Unix() - epoch.Unix()
+	days := secs / 86400
+	us := (secs%86400)*1e6 + int64(t.Nanosecond()/1e3)
+	return float64(days) + float64(us)/86400e6, true
+}
+
+// numFormat is what a cell's number format says about its value.
+type numFormat struct {
+	date, time bool
+	decimals   int // fixed decimal places, -1 when the format has none
+}
+
+// Built-in formats by id; see ECMA-376 §18.8.30.
+var builtinFormats = map[int]numFormat{
+	1: {decimals: 0}, 2: {decimals: 2}, 3: {decimals: 0}, 4: {decimals: 2},
+	37: {decimals: 0}, 38: {decimals: 0}, 39: {decimals: 2}, 40: {decimals: 2},
+	14: {date: true}, 15: {date: true}, 16: {date: true}, 17: {date: true},
+	18: {time: true}, 19: {time: true}, 20: {time: true}, 21: {time: true},
+	22: {date: true, time: true}, 45: {time: true}, 47: {time: true},
+}
+
+func (rd *reader) format(axis string) (numFormat, error) {
+	id, err := rd.f.GetCellStyle(rd.sheet, axis)
+	if err != nil {
+		return numFormat{}, err
+	}
+	if nf, ok := rd.formats[id]; ok {
+		return nf, nil
+	}
+	nf := numFormat{decimals: -1}
+	if st, err := rd.f.GetStyle(id); err == nil && st != nil {
+		switch {
+		case st.CustomNumFmt != nil:
+			nf = parseFormat(*st.CustomNumFmt)
+		case (st.NumFmt >= 27 && st.NumFmt <= 36) || (st.NumFmt >= 50 && st.NumFmt <= 58):
+			// Locale dates of the East Asian built-ins.
+			nf = numFormat{date: true}
+		default:
+			if b, ok := builtinFormats[st.NumFmt]; ok {
+				nf = b
+			}
+		}
+	}
+	rd.formats[id] = nf
+	return nf, nil
+}
+
+var (
+	formatLiterals = regexp.MustCompile(`"[^"]*"|\\.|_.|\*.|\[[^\]]*\]`)
+	fixedDecimals  = regexp.MustCompile(`[#,0]*0(?:\.(0+))?`)
+)
+
+// parseFormat reads a custom format code. Only the first section, the one
+// for positive numbers, decides.
+func parseFormat(code string) numFormat {
+	nf := numFormat{decimals: -1}
+	if strings.HasPrefix(code, "[h]") || strings.HasPrefix(code, "[m]") || strings.HasPrefix(code, "[s]") {
+		// Elapsed durations are numbers of days, not points in time.
+		return nf
+	}
+	code = formatLiterals.ReplaceAllString(code, "")
+	if i := strings.IndexByte(code, ';'); i >= 0 {
+		code = code[:i]
+	}
+	lc := strings.ToLower(code)
+	nf.time = strings.ContainsAny(lc, "hs")
+	nf.date = strings.ContainsAny(lc, "yd") || (strings.Contains(lc, "m") && !nf.time)
+	if nf.date || nf.time || strings.ContainsAny(lc, "%e/?@") {
+		return nf
+	}
+	if m := fixedDecimals.FindStringSubmatch(code); m != nil {
+		nf.decimals = len(m[1])
+	}
+	return nf
+}
+
+// fillMerged repeats the top-left value of every merged range over the rest
+// of it.
+func fillMerged(f *excelize.File, sheet string, grid [][]Cell) ([][]Cell, error) {
+	merged, err := f.GetMergeCells(sheet, true)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range merged {
+		c1, r1, err := excelize.CellNameToCoordinates(m.GetStartAxis())
+		if err != nil {
+			return nil, err
+		}
+		c2, r2, err := excelize.CellNameToCoordinates(m.GetEndAxis())
+		if err != nil {
+			return nil, err
+		}
+		if r1 > len(grid) || c1 > len(grid[r1-1]) {
+			continue
+		}
+		top := grid[r1-1][c1-1]
+		if top.Kind == Empty {
+			continue
+		}
+		for len(grid) < r2 {
+			grid = append(grid, nil)
+		}
+		for r := r1 - 1; r < r2; r++ {
+			for len(grid[r]) < c2 {
+				grid[r] = append(grid[r], Cell{})
+			}
+			for c := c1 - 1; c < c2; c++ {
+				grid[r][c] = top
+			}
+		}
+	}
+	return grid, nil
+}
+
+// Range is a block of cells, 1-based and inclusive. A zero bound is open,
+// so B3:F reads columns B to F from row 3 down.
+type Range struct {
+	FromCol, FromRow, ToCol, ToRow int
+}
+
+// ParseRange reads A1:F200, B3:F, B:F or a single top-left cell such as B3.
+func ParseRange(s string) (Range, error) {
+	var r Range
+	if s == "" {
+		return r, nil
+	}
+	from, to, hasTo := strings.Cut(strings.ReplaceAll(strings.ToUpper(s), "$", ""), ":")
+	var err error
+	if r.FromCol, r.FromRow, err = parseRef(from); err != nil {
+		return r, fmt.Errorf("range %q: %w", s, err)
+	}
+	if hasTo {
+		if r.ToCol, r.ToRow, err = parseRef(to); err != nil {
+			return r, fmt.Errorf("range %q: %w", s, err)
+		}
+		if (r.ToCol > 0 && r.ToCol < r.FromCol) || (r.ToRow > 0 && r.ToRow < r.FromRow) {
+			return r, fmt.Errorf("range %q ends before it starts", s)
+		}
+	}
+	return r, nil
+}
+
+// parseRef reads a column, a row or both, as in B, 3 or B3.
+func parseRef(s string) (col, row int, err error) {
+	i := strings.IndexFunc(s, func(r rune) bool { return r >= '0' && r <= '9' })
+	letters, digits := s, ""
+	if i >= 0 {
+		letters, digits = s[:i], s[i:]
+	}
+	if letters == "" && digits == "" {
+		return 0, 0, fmt.Errorf("empty cell reference")
+	}
+	if letters != "" {
+		if col, err = excelize.ColumnNameToNumber(letters); err != nil {
+			return 0, 0, err
+		}
+	}
+	if digits != "" {
+		if row, err = strconv.Atoi(digits); err != nil || row < 1 || row > MaxRows {
+			return 0, 0, fmt.Errorf("bad row %q", digits)
+		}
+	}
+	return col, row, nil
+}
+
+// Clip cuts a grid down to the range, rows and columns re-based to its
+// top-left corner. The returned offset is the sheet row of the first row.
+func (r Range) Clip(grid [][]Cell) ([][]Cell, int) {
+	top := max(r.FromRow, 1) - 1
+	if top >= len(grid) {
+		return nil, top + 1
+	}
+	end := len(grid)
+	if r.ToRow > 0 && r.ToRow < end {
+		end = r.ToRow
+	}
+	left := max(r.FromCol, 1) - 1
+	out := make([][]Cell, 0, end-top)
+	for _, row := range grid[top:end] {
+		right := len(row)
+		if r.ToCol > 0 && r.ToCol < right {
+			right = r.ToCol
+		}
+		if left >= right {
+			out = append(out, nil)
+			continue
+		}
+		out = append(out, row[left:right])
+	}
+	return out, top + 1
+}
+
+// SheetName turns any text into a valid, unique sheet name: the characters
+// Excel forbids become _, it is cut to 31 characters and a repeat, compared
+// case-insensitively, gets a (2), (3)... suffix.
+func SheetName(s string, taken map[string]bool) string {
+	s = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`[]:*?/\`, r) || r < 0x20 {
+			return '_'
+		}
+		return r
+	}, s)
+	s = strings.Trim(s, "'")
+	if strings.TrimSpace(s) == "" {
+		s = "Sheet"
+	}
+	name := truncate(s, MaxSheetName)
+	for n := 2; taken[strings.ToLower(name)]; n++ {
+		suffix := fmt.Sprintf(" (%d)", n)
+		name = truncate(s, MaxSheetName-len(suffix)) + suffix
+	}
+	taken[strings.ToLower(name)] = true
+	return name
+}
+
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) > n {
+		r = r[:n]
+	}
+	return string(r)
+}
@@ -21,7 +21,23 @@ func main() {
 
 	w := worker.New(c, "sync-loop-task-queue", worker.Options{})
 	w.RegisterWorkflow(workflow.CopyTableWorkflow)
+	w.RegisterWorkflow(workflow.DataDiffWorkflow)
 	w.RegisterActivity(activity.CopyTableActivity)
+	w.RegisterActivity(activity.StartRunActivity)
+	w.RegisterActivity(activity.FinishRunActivity)
+	w.RegisterActivity(activity.ExtractActivity)
+	w.RegisterActivity(activity.TransformActivity)
+	w.RegisterActivity(activity.LoadActivity)
+	w.RegisterActivity(activity.GetLastSyncTimeActivity)
+	w.RegisterActivity(activity.UpdateLastSyncTimeActivity)
+	w.RegisterActivity(activity.RecordSourceFilesActivity)
+	w.RegisterActivity(activity.CommitCheckpointActivity)
+	w.RegisterActivity(activity.RunAssertionsActivity)
+	w.RegisterActivity(activity.SnapshotSchemaActivity)
+	w.RegisterActivity(activity.DetectAnomalyActivity)
+	w.RegisterActivity(activity.StartDataDiffActivity)
+	w.RegisterActivity(activity.DiffTableActivity)
+	w.RegisterActivity(activity.FinishDataDiffActivity)
 
 	log.Println("Worker started")
 	if err := w.Run(worker.InterruptCh()); err != nil {